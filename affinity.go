@@ -0,0 +1,31 @@
+package gocmd
+
+import "fmt"
+
+// maxCPUs is the number of CPUs WithCPUAffinity can pin to, the size of the cpu_set_t of glibc.
+const maxCPUs = 1024
+
+// WithCPUAffinity pins the command to the CPUs, numbered from 0, by
+// sched_setaffinity right after it started, to benchmark wrapped tools or to
+// keep noisy batch jobs off latency-critical cores, like taskset does.
+// The processes the command starts inherit it, the ones it started before
+// it was set do not. Run fails on other platforms than Linux.
+//
+// Example:
+//
+//	c := gocmd.New("make -j4", gocmd.WithCPUAffinity(4, 5, 6, 7))
+func WithCPUAffinity(cpus ...int) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.afterStart = append(c.afterStart, func(pid int) error {
+			if len(cpus) == 0 {
+				return fmt.Errorf("cpu affinity: no cpus")
+			}
+			for _, cpu := range cpus {
+				if cpu < 0 || cpu >= maxCPUs {
+					return fmt.Errorf("cpu affinity: cpu %d out of [0, %d)", cpu, maxCPUs)
+				}
+			}
+			return setCPUAffinity(pid, cpus)
+		})
+	}
+}
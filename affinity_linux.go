@@ -0,0 +1,21 @@
+package gocmd
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+func setCPUAffinity(pid int, cpus []int) error {
+	var mask [maxCPUs / 64]uint64
+	for _, cpu := range cpus {
+		mask[cpu/64] |= 1 << (uint(cpu) % 64)
+	}
+
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY,
+		uintptr(pid), unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask)))
+	if errno != 0 {
+		return fmt.Errorf("sched_setaffinity %v: %w", cpus, errno)
+	}
+	return nil
+}
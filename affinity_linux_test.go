@@ -0,0 +1,19 @@
+package gocmd_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithCPUAffinity(t *testing.T) {
+	c := gocmd.New("sleep 0.1; grep Cpus_allowed_list /proc/$$/status", gocmd.WithCPUAffinity(0))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, []string{"Cpus_allowed_list:", "0"}, strings.Fields(c.Stdout()))
+
+	c = gocmd.New("sleep 5", gocmd.WithCPUAffinity(-1))
+	assert.ErrorContains(t, c.Run(context.TODO()), "cpu -1 out of")
+}
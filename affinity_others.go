@@ -0,0 +1,9 @@
+//go:build !linux
+
+package gocmd
+
+import "fmt"
+
+func setCPUAffinity(pid int, cpus []int) error {
+	return fmt.Errorf("cpu affinity: %w", ErrNotSupported)
+}
@@ -0,0 +1,106 @@
+package gocmd
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/gocmd/linestream"
+)
+
+// Annotation is the format of the lines written by WithAnnotatedOutput.
+type Annotation struct {
+	// TimeFormat is the layout of the timestamps, time.RFC3339 by default.
+	TimeFormat string
+	// OutTag and ErrTag tag the lines of stdout and stderr, [out] and [err] by default.
+	OutTag, ErrTag string
+	// Relative stamps the lines with the time since the start of the
+	// command, like 00:01:02.345, instead of the time of the day.
+	Relative bool
+}
+
+// AnnotateTimeFormat sets the layout of the timestamps of the annotated lines.
+func AnnotateTimeFormat(layout string) func(*Annotation) {
+	return func(a *Annotation) {
+		a.TimeFormat = layout
+	}
+}
+
+// AnnotateRelative stamps the annotated lines with the time since the start
+// of the command instead of the time of the day, like ts -s, to see where the
+// command spends its time, like a build.
+func AnnotateRelative() func(*Annotation) {
+	return func(a *Annotation) {
+		a.Relative = true
+	}
+}
+
+// AnnotateTags sets the tags of the annotated lines of stdout and stderr.
+func AnnotateTags(out, err string) func(*Annotation) {
+	return func(a *Annotation) {
+		a.OutTag, a.ErrTag = out, err
+	}
+}
+
+// WithAnnotatedOutput also writes the lines of stdout and stderr to w, each
+// with a timestamp and a tag telling its stream, like
+//
+//	2006-01-02T15:04:05Z07:00 [out] hello
+//	2006-01-02T15:04:05Z07:00 [err] oops
+//
+// Lines are written whole, w is not written by stdout and stderr at the same time.
+//
+// Example:
+//
+//	c := gocmd.New("make", gocmd.WithAnnotatedOutput(os.Stderr))
+//	c.Run(context.TODO())
+func WithAnnotatedOutput(w io.Writer, options ...func(*Annotation)) func(c *Cmd) {
+	return func(c *Cmd) {
+		a := &Annotation{TimeFormat: time.RFC3339, OutTag: "[out]", ErrTag: "[err]"}
+		for _, o := range options {
+			o(a)
+		}
+
+		var mu sync.Mutex
+		annotate := func(tag string) *linestream.LineStream {
+			return linestream.New(func(line string) {
+				mu.Lock()
+				defer mu.Unlock()
+				var stamp string
+				if a.Relative {
+					stamp = formatOffset(c.sinceStarted())
+				} else {
+					stamp = time.Now().Format(a.TimeFormat)
+				}
+				fmt.Fprintf(w, "%s %s %s\n", stamp, tag, line)
+			})
+		}
+
+		out, err := annotate(a.OutTag), annotate(a.ErrTag)
+		c.stdoutWriters = append(c.stdoutWriters, out)
+		c.stderrWriters = append(c.stderrWriters, err)
+		c.flushers = append(c.flushers, out.Flush, err.Flush)
+	}
+}
+
+// sinceStarted returns the time since the last attempt was started, by the monotonic clock.
+func (c *Cmd) sinceStarted() time.Duration {
+	c.mu.Lock()
+	started := c.started
+	c.mu.Unlock()
+
+	if started.IsZero() {
+		return 0
+	}
+	if d := time.Since(started); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// formatOffset formats the duration like 00:01:02.345.
+func formatOffset(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
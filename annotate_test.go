@@ -0,0 +1,44 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithAnnotatedOutput(t *testing.T) {
+	var out bytes.Buffer
+	c := gocmd.New("echo hello; sleep 0.05; echo oops >&2; sleep 0.05; printf last",
+		gocmd.WithAnnotatedOutput(&out),
+		gocmd.WithStdout(), // later options keep the annotated output
+	)
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, "hello\nlast", c.Stdout())
+
+	re := regexp.MustCompile(`(?m)^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(Z|[+-]\d\d:\d\d) `)
+	assert.Equal(t, "[out] hello\n[err] oops\n[out] last\n", re.ReplaceAllString(out.String(), ""))
+
+	out.Reset()
+	c = gocmd.New("echo hello", gocmd.WithAnnotatedOutput(&out,
+		gocmd.AnnotateTimeFormat("15:04"), gocmd.AnnotateTags("O", "E")))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Regexp(t, `^\d\d:\d\d O hello\n$`, out.String())
+}
+
+func TestAnnotateRelative(t *testing.T) {
+	var out bytes.Buffer
+	c := gocmd.New("echo first; sleep 0.3; echo second >&2", gocmd.WithAnnotatedOutput(&out, gocmd.AnnotateRelative()))
+	assert.Nil(t, c.Run(context.TODO()))
+
+	lines := regexp.MustCompile(`(?m)^00:00:(\d\d\.\d{3}) (\[out\] first|\[err\] second)$`).FindAllStringSubmatch(out.String(), -1)
+	if assert.Len(t, lines, 2, out.String()) {
+		assert.Less(t, lines[0][1], "00.250")
+		assert.GreaterOrEqual(t, lines[1][1], "00.300")
+	}
+}
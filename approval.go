@@ -0,0 +1,110 @@
+package gocmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrNotApproved is wrapped by the error of Run if the command was denied by the approval of WithApproval.
+var ErrNotApproved = errors.New("not approved")
+
+// Approval is the decision on a command by the approval of WithApproval,
+// reported by Status and recorded in the Manifest, for audits.
+type Approval struct {
+	Approved bool `json:"approved"`
+	// Error is the one returned by the approval, which denied the command then.
+	Error string    `json:"error,omitempty"`
+	At    time.Time `json:"at"`
+	// Waited is how long the approval took, like a human reading the plan.
+	Waited time.Duration `json:"waited"`
+}
+
+// WithApproval requires the approval of the command by approve, a human or a
+// policy engine, before it is started, for operator tooling whose commands
+// have a large blast radius. The approval gets the Plan of the command, and
+// Run fails with an error wrapping ErrNotApproved, without starting it, if
+// it returns false or an error. With patterns, only the commands whose
+// command line, masked like by Redacted, matches one of them, the sensitive
+// ones, require it. It is asked once per Run, retries do not ask again.
+//
+// Example:
+//
+//	c := gocmd.New("kubectl delete namespace "+ns,
+//		gocmd.WithApproval(gocmd.PromptApproval(os.Stdin, os.Stderr), regexp.MustCompile(`\bdelete\b`)))
+//	if err := c.Run(ctx); errors.Is(err, gocmd.ErrNotApproved) {
+//		log.Printf("canceled by the operator")
+//	}
+func WithApproval(approve func(Plan) (bool, error), patterns ...*regexp.Regexp) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.approve = approve
+		c.approvalPatterns = patterns
+	}
+}
+
+// Approval returns the decision of the approval of WithApproval, nil if the
+// command did not require one or was not run.
+func (c *Cmd) Approval() *Approval {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.approval
+}
+
+// checkApproval asks the approval of the command, if it requires one.
+func (c *Cmd) checkApproval() error {
+	if c.approve == nil {
+		return nil
+	}
+	if len(c.approvalPatterns) > 0 {
+		line, sensitive := c.Redacted(), false
+		for _, re := range c.approvalPatterns {
+			sensitive = sensitive || re.MatchString(line)
+		}
+		if !sensitive {
+			return nil
+		}
+	}
+
+	start := time.Now()
+	ok, err := c.approve(c.Plan())
+	a := &Approval{Approved: ok && err == nil, At: time.Now()}
+	a.Waited = a.At.Sub(start)
+	if err != nil {
+		a.Error = err.Error()
+	}
+	c.mu.Lock()
+	c.approval = a
+	c.mu.Unlock()
+
+	switch {
+	case err != nil:
+		return fmt.Errorf("%w: %s: %w", ErrNotApproved, c.Redacted(), err)
+	case !ok:
+		return fmt.Errorf("%w: %s", ErrNotApproved, c.Redacted())
+	}
+	return nil
+}
+
+// PromptApproval returns an approval printing the plan of the command to
+// out and asking to run it, approved by an answer of y or yes read from in,
+// like the terminal. Anything else, or no answer, denies it.
+func PromptApproval(in io.Reader, out io.Writer) func(Plan) (bool, error) {
+	r := bufio.NewReader(in)
+	return func(p Plan) (bool, error) {
+		fmt.Fprintf(out, "%sRun it? [y/N] ", p)
+		answer, err := r.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return false, err
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return true, nil
+		}
+		return false, nil
+	}
+}
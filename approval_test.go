@@ -0,0 +1,72 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithApproval(t *testing.T) {
+	marker := t.TempDir() + "/ran"
+	var plans []gocmd.Plan
+	deny := func(p gocmd.Plan) (bool, error) {
+		plans = append(plans, p)
+		return false, nil
+	}
+
+	c := gocmd.New("touch "+marker, gocmd.WithApproval(deny))
+	err := c.Run(context.TODO())
+	assert.ErrorIs(t, err, gocmd.ErrNotApproved)
+	assert.NoFileExists(t, marker)
+	assert.Len(t, plans, 1)
+	assert.Equal(t, "touch "+marker, plans[0].Command)
+	assert.False(t, c.Status().Approval.Approved)
+
+	// only the sensitive commands
+	c = gocmd.New("echo hello", gocmd.WithApproval(deny, regexp.MustCompile(`\brm\b`)))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Nil(t, c.Approval())
+	assert.Len(t, plans, 1)
+
+	c = gocmd.New("exit 1", gocmd.WithRetry(gocmd.RetryPolicy{Retries: 2}), gocmd.WithApproval(func(p gocmd.Plan) (bool, error) {
+		plans = append(plans, p)
+		return true, nil
+	}))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, 3, c.Attempts())
+	assert.Len(t, plans, 2) // once for the retries
+	assert.True(t, c.Approval().Approved)
+
+	c = gocmd.New("true", gocmd.WithApproval(func(gocmd.Plan) (bool, error) {
+		return true, errors.New("policy engine unreachable")
+	}))
+	err = c.Run(context.TODO())
+	assert.ErrorIs(t, err, gocmd.ErrNotApproved)
+	assert.EqualError(t, err, "not approved: true: policy engine unreachable")
+	assert.Equal(t, "policy engine unreachable", c.Approval().Error)
+}
+
+func TestPromptApproval(t *testing.T) {
+	var out bytes.Buffer
+	approve := gocmd.PromptApproval(strings.NewReader("yes\nn\n"), &out)
+
+	c := gocmd.New("echo hello", gocmd.WithApproval(approve))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, "hello\n", c.Stdout())
+	assert.Contains(t, out.String(), "echo hello\n")
+	assert.True(t, strings.HasSuffix(out.String(), "Run it? [y/N] "))
+
+	c = gocmd.New("echo hello", gocmd.WithApproval(approve))
+	assert.ErrorIs(t, c.Run(context.TODO()), gocmd.ErrNotApproved)
+	// no answer
+	c = gocmd.New("echo hello", gocmd.WithApproval(approve))
+	assert.ErrorIs(t, c.Run(context.TODO()), gocmd.ErrNotApproved)
+}
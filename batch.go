@@ -0,0 +1,454 @@
+package gocmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bingoohuang/gocmd/linestream"
+)
+
+// BatchJob is a named command of a Batch.
+type BatchJob struct {
+	Name string
+	Cmd  *Cmd
+	// Priority orders the start of the jobs, the higher first, and the same in
+	// the order of the jobs. Higher ones may preempt lower ones by Batch.Preempt.
+	Priority int
+}
+
+// BatchResult is the result of a BatchJob.
+type BatchResult struct {
+	Name     string
+	Cmd      *Cmd
+	Err      error // the error of Cmd.Run
+	ExitCode int
+	// Outcome classifies ExitCode by the WithExitCodeMap of Cmd, zero if it did not exit by itself.
+	Outcome Outcome
+	// Failure is the kind of the failure by the WithFailureClassifier of Cmd.
+	Failure  FailureKind
+	Start    time.Time
+	Duration time.Duration
+	Skipped  bool // not run, because of HaltOnError or MaxFailures
+	// Preempted is how many times the job was paused or requeued for higher priority jobs.
+	Preempted int
+	// Resumed tells the job was not run, its result is the one of a previous run, by Batch.Resume.
+	Resumed bool
+	// Labels are the ones of Cmd set by WithLabels, for grouping results in reports.
+	Labels Labels
+}
+
+// Failed tells if the job did not run successfully.
+// An exit code is a failure unless its Outcome is Success.
+func (r BatchResult) Failed() bool {
+	if r.Skipped || r.Err != nil {
+		return true
+	}
+	if r.Outcome != 0 {
+		return r.Outcome != Success
+	}
+	return r.ExitCode != 0
+}
+
+// Preemption is what a Batch does to a running job when a job of a higher
+// priority is due and Parallel jobs are running.
+type Preemption int
+
+const (
+	// PreemptNone lets the higher priority job wait.
+	PreemptNone Preemption = iota
+	// PreemptPause pauses the lower priority job by SIGSTOP, and continues it by
+	// SIGCONT once a slot is free, its timeout still runs while it is paused.
+	PreemptPause
+	// PreemptRequeue cancels the lower priority job, and runs it again from the
+	// start once a slot is free.
+	PreemptRequeue
+)
+
+// ErrBatchNotRunning is returned by Batch.Submit if the batch is not running.
+var ErrBatchNotRunning = errors.New("batch not running")
+
+// Batch runs many commands with bounded parallelism.
+//
+// Example:
+//
+//	b := gocmd.Batch{Parallel: 4, Output: os.Stdout}
+//	results := b.Run(ctx,
+//		gocmd.BatchJob{Name: "web", Cmd: gocmd.New("make web")},
+//		gocmd.BatchJob{Name: "api", Cmd: gocmd.New("make api")},
+//	)
+type Batch struct {
+	// Parallel is the maximum number of jobs running at the same time, 1 if less.
+	Parallel int
+	// HaltOnError stops starting new jobs after a job failed, the running ones
+	// are run to completion and the remaining ones are reported as skipped.
+	HaltOnError bool
+	// MaxFailures, if not zero, stops starting new jobs like HaltOnError, once
+	// more than MaxFailures jobs failed.
+	MaxFailures int
+	// Preempt tells what to do to a running job of a lower priority than a due
+	// job, when Parallel jobs are running, like when interactive requests and
+	// background maintenance share a batch, the former submitted by Submit.
+	Preempt Preemption
+	// Output, if not nil, receives the stdout and stderr lines of all jobs,
+	// prefixed by the colored job name, like docker-compose does.
+	Output io.Writer
+	// NoColor disables the colors of the Output prefixes.
+	NoColor bool
+	// OnStart, if not nil, is called when a job is started, again when it is
+	// run again after it was requeued, from the goroutine running it.
+	OnStart func(BatchJob)
+	// OnDone, if not nil, is called when a job finished, from the goroutine running it.
+	OnDone func(BatchResult)
+	// OnSkip, if not nil, is called when a job is skipped since the batch
+	// halted or its context is done, from the goroutine calling Run.
+	OnSkip func(BatchJob)
+	// OnPreempt, if not nil, is called when a job is preempted by another one.
+	OnPreempt func(job, by BatchJob)
+	// Webhook, if not nil, is posted the results once all jobs finished, see NewWebhook.
+	Webhook *Webhook
+
+	mu   sync.Mutex
+	run  *batchRun         // while Run is running
+	save func(BatchResult) // by Resume
+}
+
+// batchRun is the state of a Run of a Batch, guarded by the mutex of the Batch.
+type batchRun struct {
+	ctx      context.Context
+	parallel int
+	results  []BatchResult
+	pending  []*batchItem
+	running  []*batchItem
+	paused   []*batchItem
+	skipped  []*batchItem // not reported to OnSkip yet
+	halted   bool
+	failed   int
+	width    int
+	outMu    sync.Mutex
+	wake     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// batchItem is a job of a batchRun.
+type batchItem struct {
+	i         int
+	job       BatchJob
+	flush     func() // of the prefixed Output
+	requeue   bool   // canceled by PreemptRequeue
+	preempted int
+	finished  bool // its run returned, like by its timeout while paused
+}
+
+// Run runs the jobs, and the ones submitted while it runs, and returns their
+// results, in the order of the jobs, then of their submission.
+func (b *Batch) Run(ctx context.Context, jobs ...BatchJob) []BatchResult {
+	results := b.runJobs(ctx, jobs...)
+	if b.Webhook != nil {
+		b.postWebhook(results)
+	}
+	return results
+}
+
+func (b *Batch) runJobs(ctx context.Context, jobs ...BatchJob) []BatchResult {
+	r := &batchRun{ctx: ctx, parallel: b.Parallel, width: maxNameWidth(jobs), wake: make(chan struct{}, 1)}
+	if r.parallel < 1 {
+		r.parallel = 1
+	}
+
+	b.mu.Lock()
+	b.run = r
+	for _, job := range jobs {
+		b.add(job)
+	}
+	b.mu.Unlock()
+
+	done := ctx.Done()
+	for {
+		b.mu.Lock()
+		b.schedule()
+		finished := len(r.pending)+len(r.running)+len(r.paused) == 0
+		if finished {
+			b.run = nil
+		}
+		skipped := r.skipped
+		r.skipped = nil
+		b.mu.Unlock()
+
+		if b.OnSkip != nil {
+			for _, item := range skipped {
+				b.OnSkip(item.job)
+			}
+		}
+		if finished {
+			break
+		}
+
+		select {
+		case <-r.wake:
+		case <-done:
+			done = nil
+		}
+	}
+
+	r.wg.Wait()
+	return r.results
+}
+
+// Submit adds the job to the running Run, its result is added to the ones of Run.
+func (b *Batch) Submit(job BatchJob) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.run == nil {
+		return ErrBatchNotRunning
+	}
+	b.add(job)
+	b.run.wakeUp()
+	return nil
+}
+
+func (b *Batch) add(job BatchJob) {
+	r := b.run
+	i := len(r.results)
+	r.results = append(r.results, BatchResult{Name: job.Name, Cmd: job.Cmd, Skipped: true, Labels: job.Cmd.Labels()})
+	item := &batchItem{i: i, job: job}
+	if b.Output != nil {
+		color := linestream.ColorOf(i)
+		if b.NoColor {
+			color = linestream.NoColor
+		}
+		if len(job.Name) > r.width {
+			r.width = len(job.Name)
+		}
+		item.flush = prefixOutput(job, b.Output, &r.outMu, r.width, color)
+	}
+	r.pending = append(r.pending, item)
+}
+
+func (r *batchRun) wakeUp() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// schedule starts, resumes and preempts the jobs as the slots and priorities allow.
+func (b *Batch) schedule() {
+	r := b.run
+	if r.halted || r.ctx.Err() != nil {
+		// the pending ones are skipped, the paused ones run to completion
+		r.skipped = append(r.skipped, r.pending...)
+		r.pending = nil
+		for len(r.paused) > 0 {
+			b.resume(r.paused[0])
+		}
+		return
+	}
+
+	for {
+		top := highest(r.pending)
+		if p := highest(r.paused); p != nil && len(r.running) < r.parallel &&
+			(top == nil || p.job.Priority >= top.job.Priority) {
+			b.resume(p)
+			continue
+		}
+		if top == nil {
+			return
+		}
+		if len(r.running) < r.parallel {
+			b.start(top)
+			continue
+		}
+		if b.Preempt == PreemptNone || !b.preempt(top) {
+			return
+		}
+	}
+}
+
+// highest returns the item of the highest priority, the first of them, nil if none.
+func highest(items []*batchItem) *batchItem {
+	var top *batchItem
+	for _, item := range items {
+		if top == nil || item.job.Priority > top.job.Priority {
+			top = item
+		}
+	}
+	return top
+}
+
+// preempt preempts the running job of the lowest priority below the one of
+// the item, the last started of them, it tells if a slot was freed.
+func (b *Batch) preempt(by *batchItem) bool {
+	r := b.run
+	var victim *batchItem
+	exiting := 0 // requeued jobs, whose slots are freed once they exited
+	for _, item := range r.running {
+		if item.requeue {
+			exiting++
+		} else if item.job.Priority < by.job.Priority &&
+			(victim == nil || item.job.Priority <= victim.job.Priority) {
+			victim = item
+		}
+	}
+	if victim == nil {
+		return false
+	}
+	// the slots being freed go to the pending jobs of the highest priorities,
+	// so preempt only for the ones outranking the victim beyond them
+	waiting := 0
+	for _, item := range r.pending {
+		if item.job.Priority > victim.job.Priority {
+			waiting++
+		}
+	}
+	if waiting <= exiting {
+		return false
+	}
+
+	if b.Preempt == PreemptPause {
+		if err := victim.job.Cmd.Signal(syscall.SIGSTOP); err != nil {
+			// not started yet, or exited
+			return false
+		}
+		r.running = removeItem(r.running, victim)
+		r.paused = append(r.paused, victim)
+	} else {
+		if err := victim.job.Cmd.Cancel("preempted by " + by.job.Name); err != nil {
+			return false
+		}
+		// its slot is freed once it exited
+		victim.requeue = true
+	}
+	victim.preempted++
+	if b.OnPreempt != nil {
+		b.OnPreempt(victim.job, by.job)
+	}
+	return b.Preempt == PreemptPause
+}
+
+func (b *Batch) resume(item *batchItem) {
+	r := b.run
+	r.paused = removeItem(r.paused, item)
+	if item.finished {
+		return
+	}
+	_ = item.job.Cmd.Signal(syscall.SIGCONT)
+	r.running = append(r.running, item)
+}
+
+func (b *Batch) start(item *batchItem) {
+	r := b.run
+	r.pending = removeItem(r.pending, item)
+	r.running = append(r.running, item)
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		if b.OnStart != nil {
+			b.OnStart(item.job)
+		}
+		res := runJob(r.ctx, item.job)
+		if item.flush != nil {
+			item.flush()
+		}
+
+		b.mu.Lock()
+		// a paused job finishes too, once killed by its timeout or the context
+		r.running = removeItem(r.running, item)
+		r.paused = removeItem(r.paused, item)
+		requeued := item.requeue && r.ctx.Err() == nil
+		if requeued {
+			item.requeue = false
+			item.job.Cmd.resetForRequeue()
+			r.pending = append(r.pending, item)
+		} else {
+			item.finished = true
+			res.Preempted = item.preempted
+			r.results[item.i] = res
+			if res.Failed() {
+				r.failed++
+				if b.HaltOnError || b.MaxFailures > 0 && r.failed > b.MaxFailures {
+					r.halted = true
+				}
+			}
+		}
+		r.wakeUp()
+		save := b.save
+		b.mu.Unlock()
+
+		if requeued {
+			return
+		}
+		if save != nil {
+			save(res)
+		}
+		if b.OnDone != nil {
+			b.OnDone(res)
+		}
+	}()
+}
+
+func removeItem(items []*batchItem, item *batchItem) []*batchItem {
+	for i, it := range items {
+		if it == item {
+			return append(items[:i:i], items[i+1:]...)
+		}
+	}
+	return items
+}
+
+// resetForRequeue makes the command runnable again, after it was canceled.
+func (c *Cmd) resetForRequeue() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.resetForRetry(cloneCmd(c.Cmd))
+	c.Executed = false
+}
+
+func runJob(ctx context.Context, job BatchJob) BatchResult {
+	r := BatchResult{Name: job.Name, Cmd: job.Cmd, Start: time.Now(), Labels: job.Cmd.Labels()}
+	r.Err = job.Cmd.Run(ctx)
+	r.Duration = time.Since(r.Start)
+	if job.Cmd.Executed {
+		r.ExitCode = job.Cmd.ExitCode()
+	}
+	if r.Err == nil {
+		r.Outcome = job.Cmd.Outcome()
+		r.Failure = job.Cmd.Failure()
+	}
+	return r
+}
+
+// prefixOutput adds prefixed copies of the outputs of the job to w,
+// the returned func flushes the last unterminated lines.
+func prefixOutput(job BatchJob, w io.Writer, mu sync.Locker, width int, color linestream.Color) func() {
+	stdout := linestream.NewPrefixer(w, job.Name, linestream.PrefixLocker(mu),
+		linestream.PrefixWidth(width), linestream.PrefixColor(color))
+	stderr := linestream.NewPrefixer(w, job.Name, linestream.PrefixLocker(mu),
+		linestream.PrefixWidth(width), linestream.PrefixColor(color))
+
+	c := job.Cmd
+	c.StdoutWriter = io.MultiWriter(c.StdoutWriter, stdout)
+	c.stderrWriter = io.MultiWriter(c.stderrWriter, stderr)
+
+	return func() {
+		stdout.Flush()
+		stderr.Flush()
+	}
+}
+
+func maxNameWidth(jobs []BatchJob) int {
+	width := 0
+	for _, job := range jobs {
+		if len(job.Name) > width {
+			width = len(job.Name)
+		}
+	}
+	return width
+}
@@ -0,0 +1,200 @@
+package gocmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// BatchRecord is the result of a job of a Batch kept by a BatchCheckpoint.
+type BatchRecord struct {
+	Name string `json:"name"`
+	// Command is the redacted command line, a job whose command changed is run again.
+	Command  string        `json:"command"`
+	ExitCode int           `json:"exit_code"`
+	Outcome  Outcome       `json:"outcome,omitempty"`
+	Failure  FailureKind   `json:"failure,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	Labels   Labels        `json:"labels,omitempty"`
+	// Skipped tells the job was not run, because of HaltOnError or MaxFailures.
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// BatchCheckpoint keeps the results of the jobs of a Batch run by Resume, so
+// that an interrupted batch, like by a restart of the agent running it,
+// resumes where it left off.
+type BatchCheckpoint interface {
+	// Load returns the records saved before.
+	Load() ([]BatchRecord, error)
+	// Save saves the record of a job which finished.
+	Save(BatchRecord) error
+}
+
+// FileCheckpoint returns a BatchCheckpoint keeping the records as JSON lines in
+// the file of the path, synced after each record.
+//
+// Example:
+//
+//	results, err := b.Resume(ctx, gocmd.FileCheckpoint("/var/lib/agent/batch-42.jsonl"), jobs...)
+func FileCheckpoint(path string) BatchCheckpoint {
+	return &fileCheckpoint{path: path}
+}
+
+type fileCheckpoint struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (f *fileCheckpoint) Load() ([]BatchRecord, error) {
+	file, err := os.Open(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []BatchRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r BatchRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// the last line of a crash while saving
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+func (f *fileCheckpoint) Save(r BatchRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(b, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Resume runs the jobs like Run, except the ones which ran successfully before
+// by the records of the checkpoint, matched by name and command line: they are
+// not run again, and their recorded results are returned, marked Resumed. The
+// results of the jobs run are saved to the checkpoint once they finished.
+func (b *Batch) Resume(ctx context.Context, cp BatchCheckpoint, jobs ...BatchJob) ([]BatchResult, error) {
+	records, err := cp.Load()
+	if err != nil {
+		return nil, fmt.Errorf("load checkpoint: %w", err)
+	}
+	done := map[[2]string]BatchRecord{}
+	for _, r := range records {
+		key := [2]string{r.Name, r.Command}
+		if r.result().Failed() {
+			delete(done, key)
+		} else {
+			done[key] = r
+		}
+	}
+
+	results := make([]BatchResult, len(jobs))
+	var run []BatchJob
+	var positions []int
+	for i, job := range jobs {
+		if r, ok := done[[2]string{job.Name, job.Cmd.Redacted()}]; ok {
+			results[i] = r.result()
+			results[i].Cmd = job.Cmd
+			continue
+		}
+		run = append(run, job)
+		positions = append(positions, i)
+	}
+
+	var mu sync.Mutex
+	var errs []error
+	b.mu.Lock()
+	b.save = func(r BatchResult) {
+		if err := cp.Save(newBatchRecord(r)); err != nil {
+			mu.Lock()
+			errs = append(errs, fmt.Errorf("save checkpoint of %s: %w", r.Name, err))
+			mu.Unlock()
+		}
+	}
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.save = nil
+		b.mu.Unlock()
+	}()
+
+	ran := b.runJobs(ctx, run...)
+	for k, i := range positions {
+		results[i] = ran[k]
+	}
+	// the ones submitted while it ran
+	results = append(results, ran[len(positions):]...)
+	if b.Webhook != nil {
+		b.postWebhook(results)
+	}
+	return results, errors.Join(errs...)
+}
+
+func newBatchRecord(r BatchResult) BatchRecord {
+	rec := BatchRecord{
+		Name:     r.Name,
+		ExitCode: r.ExitCode,
+		Outcome:  r.Outcome,
+		Failure:  r.Failure,
+		Start:    r.Start,
+		Duration: r.Duration,
+		Labels:   r.Labels,
+		Skipped:  r.Skipped,
+	}
+	if r.Cmd != nil {
+		rec.Command = r.Cmd.Redacted()
+	}
+	if r.Err != nil {
+		rec.Error = r.Err.Error()
+	}
+	return rec
+}
+
+// result returns the BatchResult of the record, without Cmd.
+func (r BatchRecord) result() BatchResult {
+	res := BatchResult{
+		Name:     r.Name,
+		ExitCode: r.ExitCode,
+		Outcome:  r.Outcome,
+		Failure:  r.Failure,
+		Start:    r.Start,
+		Duration: r.Duration,
+		Labels:   r.Labels,
+		Skipped:  r.Skipped,
+		Resumed:  true,
+	}
+	if r.Error != "" {
+		res.Err = errors.New(r.Error)
+	}
+	return res
+}
@@ -0,0 +1,257 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatch(t *testing.T) {
+	var out bytes.Buffer
+	var started, done int32
+	b := gocmd.Batch{
+		Parallel: 2,
+		Output:   &out,
+		OnStart:  func(gocmd.BatchJob) { atomic.AddInt32(&started, 1) },
+		OnDone:   func(gocmd.BatchResult) { atomic.AddInt32(&done, 1) },
+	}
+
+	results := b.Run(context.TODO(),
+		gocmd.BatchJob{Name: "a", Cmd: gocmd.New("echo one; echo two >&2")},
+		gocmd.BatchJob{Name: "bb", Cmd: gocmd.New("printf three")},
+		gocmd.BatchJob{Name: "c", Cmd: gocmd.New("exit 3", gocmd.WithLabels(map[string]string{"tenant": "acme"}))},
+	)
+
+	assert.Equal(t, int32(3), started)
+	assert.Equal(t, int32(3), done)
+	assert.Len(t, results, 3)
+	assert.Equal(t, "a", results[0].Name)
+	assert.False(t, results[0].Failed())
+	assert.Equal(t, "one\n", results[0].Cmd.Stdout())
+	assert.Equal(t, 3, results[2].ExitCode)
+	assert.True(t, results[2].Failed())
+	assert.Equal(t, gocmd.Labels{"tenant": "acme"}, results[2].Labels)
+
+	lines := strings.Split(strings.TrimSpace(stripColors(out.String())), "\n")
+	sort.Strings(lines)
+	assert.Equal(t, []string{"a  | one", "a  | two", "bb | three"}, lines)
+}
+
+func TestBatchParallel(t *testing.T) {
+	b := gocmd.Batch{Parallel: 3}
+	start := time.Now()
+	results := b.Run(context.TODO(),
+		gocmd.BatchJob{Name: "1", Cmd: gocmd.New("sleep 0.2")},
+		gocmd.BatchJob{Name: "2", Cmd: gocmd.New("sleep 0.2")},
+		gocmd.BatchJob{Name: "3", Cmd: gocmd.New("sleep 0.2")},
+	)
+
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	for _, r := range results {
+		assert.False(t, r.Failed())
+	}
+}
+
+func TestBatchHaltOnError(t *testing.T) {
+	var skipped []string
+	b := gocmd.Batch{Parallel: 1, HaltOnError: true, OnSkip: func(job gocmd.BatchJob) { skipped = append(skipped, job.Name) }}
+	results := b.Run(context.TODO(),
+		gocmd.BatchJob{Name: "ok", Cmd: gocmd.New("true")},
+		gocmd.BatchJob{Name: "fail", Cmd: gocmd.New("false")},
+		gocmd.BatchJob{Name: "skipped", Cmd: gocmd.New("true")},
+	)
+
+	assert.False(t, results[0].Failed())
+	assert.Equal(t, 1, results[1].ExitCode)
+	assert.False(t, results[1].Skipped)
+	assert.True(t, results[2].Skipped)
+	assert.False(t, results[2].Cmd.Executed)
+	assert.Equal(t, []string{"skipped"}, skipped)
+}
+
+func TestBatchMaxFailures(t *testing.T) {
+	b := gocmd.Batch{Parallel: 1, MaxFailures: 1}
+	results := b.Run(context.TODO(),
+		gocmd.BatchJob{Name: "fail1", Cmd: gocmd.New("false")},
+		gocmd.BatchJob{Name: "ok", Cmd: gocmd.New("true")},
+		gocmd.BatchJob{Name: "fail2", Cmd: gocmd.New("false")},
+		gocmd.BatchJob{Name: "skipped", Cmd: gocmd.New("true")},
+	)
+
+	assert.False(t, results[0].Skipped)
+	assert.False(t, results[1].Failed())
+	assert.False(t, results[2].Skipped)
+	assert.True(t, results[3].Skipped)
+}
+
+func TestBatchPriority(t *testing.T) {
+	var mu sync.Mutex
+	var started []string
+	b := gocmd.Batch{Parallel: 1, OnStart: func(job gocmd.BatchJob) {
+		mu.Lock()
+		started = append(started, job.Name)
+		mu.Unlock()
+	}}
+	b.Run(context.TODO(),
+		gocmd.BatchJob{Name: "low", Cmd: gocmd.New("true")},
+		gocmd.BatchJob{Name: "high", Cmd: gocmd.New("true"), Priority: 10},
+		gocmd.BatchJob{Name: "low2", Cmd: gocmd.New("true")},
+		gocmd.BatchJob{Name: "mid", Cmd: gocmd.New("true"), Priority: 5},
+	)
+	assert.Equal(t, []string{"high", "mid", "low", "low2"}, started)
+}
+
+// runPreempted runs a low priority job, and submits a high priority one while it runs.
+func runPreempted(t *testing.T, preempt gocmd.Preemption, low string) ([]gocmd.BatchResult, []string) {
+	var mu sync.Mutex
+	var done []string
+	b := gocmd.Batch{Parallel: 1, Preempt: preempt, OnDone: func(r gocmd.BatchResult) {
+		mu.Lock()
+		done = append(done, r.Name)
+		mu.Unlock()
+	}}
+	var once sync.Once
+	b.OnStart = func(job gocmd.BatchJob) {
+		once.Do(func() {
+			time.AfterFunc(100*time.Millisecond, func() {
+				assert.Nil(t, b.Submit(gocmd.BatchJob{Name: "high", Cmd: gocmd.New("echo high"), Priority: 1}))
+			})
+		})
+	}
+	results := b.Run(context.TODO(), gocmd.BatchJob{Name: "low", Cmd: gocmd.New(low)})
+	assert.Equal(t, gocmd.ErrBatchNotRunning, b.Submit(gocmd.BatchJob{Name: "late", Cmd: gocmd.New("true")}))
+	return results, done
+}
+
+func TestBatchPreemptPause(t *testing.T) {
+	results, done := runPreempted(t, gocmd.PreemptPause, "sleep 0.3; echo low")
+
+	assert.Equal(t, []string{"high", "low"}, done)
+	assert.Len(t, results, 2)
+	assert.False(t, results[0].Failed())
+	assert.Equal(t, "low\n", results[0].Cmd.Stdout())
+	assert.Equal(t, 1, results[0].Preempted)
+	assert.Equal(t, "high\n", results[1].Cmd.Stdout())
+}
+
+func TestBatchPreemptPauseTimeout(t *testing.T) {
+	b := gocmd.Batch{Parallel: 1, Preempt: gocmd.PreemptPause}
+	var once sync.Once
+	b.OnStart = func(job gocmd.BatchJob) {
+		once.Do(func() {
+			time.AfterFunc(100*time.Millisecond, func() {
+				assert.Nil(t, b.Submit(gocmd.BatchJob{Name: "high", Cmd: gocmd.New("sleep 1"), Priority: 1}))
+			})
+		})
+	}
+	start := time.Now()
+	// low times out while it is paused by high
+	results := b.Run(context.TODO(), gocmd.BatchJob{Name: "low", Cmd: gocmd.New("sleep 5", gocmd.WithTimeout(500*time.Millisecond))})
+	assert.Less(t, time.Since(start), 4*time.Second)
+	assert.Len(t, results, 2)
+	assert.ErrorIs(t, results[0].Err, gocmd.ErrTimeout)
+	assert.Less(t, results[0].Duration, time.Second)
+	assert.Equal(t, 1, results[0].Preempted)
+	assert.False(t, results[1].Failed())
+}
+
+func TestBatchPreemptRequeue(t *testing.T) {
+	marker := t.TempDir() + "/runs"
+	results, done := runPreempted(t, gocmd.PreemptRequeue, "echo run >> "+marker+"; sleep 0.3")
+
+	assert.Equal(t, []string{"high", "low"}, done)
+	assert.False(t, results[0].Failed(), "%+v", results[0])
+	assert.Equal(t, 1, results[0].Preempted)
+	runs, err := os.ReadFile(marker)
+	assert.Nil(t, err)
+	assert.Equal(t, "run\nrun\n", string(runs))
+}
+
+func TestBatchPreemptRequeueExiting(t *testing.T) {
+	marker := t.TempDir() + "/started"
+	var mu sync.Mutex
+	var preempted []string
+	b := gocmd.Batch{Parallel: 2, Preempt: gocmd.PreemptRequeue, OnPreempt: func(job, by gocmd.BatchJob) {
+		mu.Lock()
+		preempted = append(preempted, job.Name)
+		mu.Unlock()
+	}}
+	var once sync.Once
+	b.OnStart = func(job gocmd.BatchJob) {
+		once.Do(func() {
+			time.AfterFunc(200*time.Millisecond, func() {
+				assert.Nil(t, b.Submit(gocmd.BatchJob{Name: "high", Cmd: gocmd.New("echo high"), Priority: 1}))
+				// while the victim is still exiting
+				time.Sleep(100 * time.Millisecond)
+				assert.Nil(t, b.Submit(gocmd.BatchJob{Name: "other", Cmd: gocmd.New("true")}))
+			})
+		})
+	}
+	results := b.Run(context.TODO(),
+		gocmd.BatchJob{Name: "low", Cmd: gocmd.New("sleep 1")},
+		// the victim, the last started, slow to exit on SIGTERM at its first run
+		gocmd.BatchJob{Name: "slow", Cmd: gocmd.New("test -e " + marker + " && exit 0; touch " + marker +
+			"; trap 'sleep 0.5; exit 1' TERM; sleep 3 >/dev/null 2>&1 & wait")})
+
+	assert.Equal(t, []string{"slow"}, preempted)
+	assert.Len(t, results, 4)
+	for _, r := range results {
+		assert.False(t, r.Failed(), "%+v", r)
+	}
+	assert.Equal(t, 0, results[0].Preempted)
+}
+
+func TestBatchPreemptNone(t *testing.T) {
+	_, done := runPreempted(t, gocmd.PreemptNone, "sleep 0.3")
+	assert.Equal(t, []string{"low", "high"}, done)
+}
+
+func TestBatchResume(t *testing.T) {
+	dir := t.TempDir()
+	cp := gocmd.FileCheckpoint(dir + "/checkpoint.jsonl")
+	jobs := func() []gocmd.BatchJob {
+		return []gocmd.BatchJob{
+			{Name: "a", Cmd: gocmd.New("echo a >> " + dir + "/a")},
+			{Name: "b", Cmd: gocmd.New("test -e " + dir + "/ready")},
+			{Name: "c", Cmd: gocmd.New("true")},
+		}
+	}
+	b := gocmd.Batch{Parallel: 1, HaltOnError: true}
+
+	results, err := b.Resume(context.TODO(), cp, jobs()...)
+	assert.Nil(t, err)
+	assert.False(t, results[0].Failed())
+	assert.True(t, results[1].Failed())
+	assert.True(t, results[2].Skipped)
+
+	assert.Nil(t, os.WriteFile(dir+"/ready", nil, 0o644))
+	results, err = b.Resume(context.TODO(), cp, jobs()...)
+	assert.Nil(t, err)
+	assert.True(t, results[0].Resumed)
+	assert.False(t, results[0].Cmd.Executed)
+	for _, r := range results {
+		assert.False(t, r.Failed(), "%+v", r)
+	}
+	assert.False(t, results[1].Resumed)
+	a, err := os.ReadFile(dir + "/a")
+	assert.Nil(t, err)
+	assert.Equal(t, "a\n", string(a))
+}
+
+func stripColors(s string) string {
+	for _, code := range []string{"\x1b[0m", "\x1b[31m", "\x1b[32m", "\x1b[33m", "\x1b[34m", "\x1b[35m", "\x1b[36m"} {
+		s = strings.ReplaceAll(s, code, "")
+	}
+	return s
+}
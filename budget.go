@@ -0,0 +1,109 @@
+package gocmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrBudgetExhausted is wrapped by the error of Run if the command was not
+// started or was stopped because its Budget was exhausted.
+var ErrBudgetExhausted = errors.New("time budget exhausted")
+
+// Budget is a time budget shared by steps run one after another, like the
+// commands of a deploy script, which shrinks by the time each step ran, so
+// that an overall budget of 10 minutes is enforced across heterogeneous
+// steps instead of giving each its own full timeout. A step gets the
+// remaining budget as its timeout if its own is longer.
+//
+// Example:
+//
+//	b := gocmd.NewBudget(10 * time.Minute)
+//	for _, step := range []string{"make build", "make test", "./deploy.sh"} {
+//		c := gocmd.New(step, gocmd.WithTimeout(5*time.Minute), gocmd.WithBudget(b))
+//		if err := c.Run(ctx); err != nil || c.ExitCode() != 0 {
+//			return fmt.Errorf("%s: %v, %s of the budget left", step, err, b.Remaining())
+//		}
+//	}
+type Budget struct {
+	total time.Duration
+
+	mu    sync.Mutex
+	spent time.Duration
+}
+
+// NewBudget creates a budget of the total duration.
+func NewBudget(total time.Duration) *Budget {
+	return &Budget{total: total}
+}
+
+// Total returns the total duration of the budget.
+func (b *Budget) Total() time.Duration {
+	return b.total
+}
+
+// Spent returns the time the steps ran so far.
+func (b *Budget) Spent() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.spent
+}
+
+// Remaining returns the time left, 0 once the budget is exhausted.
+func (b *Budget) Remaining() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.spent >= b.total {
+		return 0
+	}
+	return b.total - b.spent
+}
+
+func (b *Budget) charge(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.spent += d
+}
+
+// exhausted returns the error of a step not started or stopped by the budget.
+func (b *Budget) exhausted() error {
+	return fmt.Errorf("%w, %v spent of %v", ErrBudgetExhausted, b.Spent().Round(time.Millisecond), b.total)
+}
+
+// withDeadline returns ctx done once the budget is exhausted, if it is done
+// later else, and the func charging the time since to the budget.
+func (b *Budget) withDeadline(ctx context.Context) (context.Context, func(), bool) {
+	start := time.Now()
+	remaining := b.Remaining()
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= remaining {
+		return ctx, func() { b.charge(time.Since(start)) }, false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, remaining)
+	return ctx, func() {
+		cancel()
+		b.charge(time.Since(start))
+	}, true
+}
+
+// WithBudget runs the command within the remaining time of the budget, each
+// attempt being charged to it by the time it ran. Run fails with
+// ErrBudgetExhausted, without starting the command, if there is none left.
+func WithBudget(b *Budget) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.budget = b
+	}
+}
+
+// WithBudget runs the pipeline within the remaining time of the budget,
+// charged by the time it ran. Its stages run at the same time, they must not
+// be charged to the budget by their own WithBudget too.
+func (p *Pipeline) WithBudget(b *Budget) *Pipeline {
+	p.budget = b
+	return p
+}
@@ -0,0 +1,59 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithBudget(t *testing.T) {
+	b := gocmd.NewBudget(500 * time.Millisecond)
+
+	c := gocmd.New("sleep 0.2", gocmd.WithTimeout(time.Minute), gocmd.WithBudget(b))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.GreaterOrEqual(t, b.Spent(), 200*time.Millisecond)
+	assert.Less(t, b.Remaining(), 300*time.Millisecond)
+
+	// gets the remaining budget instead of its own timeout
+	start := time.Now()
+	c = gocmd.New("sleep 10", gocmd.WithTimeout(time.Minute), gocmd.WithBudget(b))
+	err := c.Run(context.TODO())
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.ErrorIs(t, err, gocmd.ErrBudgetExhausted)
+	assert.ErrorIs(t, err, gocmd.ErrTimeout)
+	assert.Equal(t, "budget exhausted", c.Status().StopReason)
+	assert.Equal(t, time.Duration(0), b.Remaining())
+
+	// not started without budget left
+	marker := t.TempDir() + "/started"
+	c = gocmd.New("touch "+marker, gocmd.WithBudget(b))
+	assert.ErrorIs(t, c.Run(context.TODO()), gocmd.ErrBudgetExhausted)
+	assert.NoFileExists(t, marker)
+}
+
+func TestWithBudgetShorterTimeout(t *testing.T) {
+	b := gocmd.NewBudget(time.Minute)
+	c := gocmd.New("sleep 10", gocmd.WithTimeout(100*time.Millisecond), gocmd.WithBudget(b))
+	err := c.Run(context.TODO())
+	assert.ErrorIs(t, err, gocmd.ErrTimeout)
+	assert.False(t, errors.Is(err, gocmd.ErrBudgetExhausted))
+	assert.Greater(t, b.Remaining(), 50*time.Second)
+}
+
+func TestPipelineWithBudget(t *testing.T) {
+	b := gocmd.NewBudget(200 * time.Millisecond)
+	p := gocmd.NewPipeline(gocmd.New("echo hello"), gocmd.New("cat; sleep 10")).WithBudget(b)
+	start := time.Now()
+	err := p.Run(context.TODO())
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.ErrorIs(t, err, gocmd.ErrBudgetExhausted)
+	assert.Equal(t, time.Duration(0), b.Remaining())
+
+	assert.ErrorIs(t, p.Run(context.TODO()), gocmd.ErrBudgetExhausted)
+}
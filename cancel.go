@@ -0,0 +1,78 @@
+package gocmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrCanceled is wrapped by the error of Run if the command was stopped by Cancel.
+var ErrCanceled = errors.New("canceled")
+
+// Cancel stops the running command like a canceled context does, by SIGTERM to
+// its process group, and stops its retries. The reason, like "by user",
+// "by policy" or "idle timeout", is kept in the error returned by Run and in
+// Status, to tell why the command was stopped.
+// It returns ErrNotRunning if Run is not running.
+//
+// Example:
+//
+//	go func() {
+//		<-idle
+//		c.Cancel("idle timeout")
+//	}()
+//	err := c.Run(ctx) // errors.Is(err, gocmd.ErrCanceled)
+func (c *Cmd) Cancel(reason string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cancel == nil {
+		return ErrNotRunning
+	}
+	if c.cancelReason == "" {
+		c.cancelReason = reason
+	}
+	c.cancel()
+	return nil
+}
+
+// startCancel makes ctx cancelable by Cancel while Run runs.
+func (c *Cmd) startCancel(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cancel, c.cancelReason, c.stopReason = cancel, "", ""
+	return ctx, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		c.cancel = nil
+		cancel()
+	}
+}
+
+// stopped returns the error of a command stopped because ctx is done,
+// recording the reason for Status.
+func (c *Cmd) stopped(ctx context.Context, timeoutCtx, budgetCtx bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	switch {
+	case c.cancelReason != "":
+		c.stopReason = c.cancelReason
+		err = fmt.Errorf("%w: %s", ErrCanceled, c.cancelReason)
+	case budgetCtx && errors.Is(ctx.Err(), context.DeadlineExceeded):
+		c.stopReason = "budget exhausted"
+		err = fmt.Errorf("%w: %w", c.budget.exhausted(), ErrTimeout)
+	case timeoutCtx:
+		c.stopReason = "timeout"
+		err = fmt.Errorf("timeout %v: %w", c.Timeout, ErrTimeout)
+	default:
+		err = ctx.Err()
+		c.stopReason = err.Error()
+	}
+	return err
+}
@@ -12,12 +12,19 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
+
+	"github.com/bingoohuang/gocmd/shellquote"
 )
 
 // Cmd represents a single command which can be Executed
 type Cmd struct {
+	stdin        io.Reader
+	stdinPipe    *os.File // read end of StdinPipe, closed once Run returns
 	stderrWriter io.Writer
 	StdoutWriter io.Writer
 	Cmd          *exec.Cmd
@@ -30,13 +37,102 @@ type Cmd struct {
 	// StdoutBuf and StdoutBuf retrieve the output after the command was Executed
 	StdoutBuf   bytes.Buffer
 	CombinedBuf bytes.Buffer
+	combined    combinedLines // pending lines of CombinedBuf
 	StderrBuf   bytes.Buffer
 	Timeout     time.Duration
-	exitCode    int
+	maxBuffer   int  // set by WithMaxBuffer
+	noCombined  bool // set by WithoutCombined
+	// KillAfter, if not zero, is how long a timed out or canceled command has
+	// to exit after SIGTERM, before it is killed by SIGKILL. Run waits for it
+	// then, instead of up to the OutputDeadline after SIGTERM.
+	KillAfter time.Duration
+	// OutputDeadline, if not zero, bounds the waiting for the output, see WithOutputDeadline.
+	OutputDeadline time.Duration
+	exitCode       int
+	attempts       int
+	retry          RetryPolicy
+	// exitCodeMap classifies exit codes, set by WithExitCodeMap
+	exitCodeMap map[int]Outcome
+	// classifier classifies failures, set by WithFailureClassifier
+	classifier func(stderr string, code int) FailureKind
+	failure    FailureKind
+	// expectedStderr are the patterns of the expected stderr lines, set by WithExpectedStderr
+	expectedStderr []*regexp.Regexp
+	// legacyStderrFailure makes the package level Run fail by stderr, set by WithLegacyStderrFailure
+	legacyStderrFailure bool
+
+	// redactedArgs and redactedPatterns mask secrets in displayed command lines
+	redactedArgs     []int
+	redactedPatterns []*regexp.Regexp
+	// deadlineEnv is the name of the env var of the deadline, set by WithDeadlineEnv
+	deadlineEnv string
+	// budget is the time budget shared with other commands, set by WithBudget
+	budget *Budget
+	// approve approves the command before it is run, set by WithApproval
+	approve          func(Plan) (bool, error)
+	approvalPatterns []*regexp.Regexp
+	// policy decides whether and how the command runs, set by WithPolicy
+	policy         Policy
+	policyDecision *PolicyDecision
+	// limiters limit the runs of the command, set by WithLimiter
+	limiters []*Limiter
+	// meters account the usage of the command, set by WithMeter
+	meters []*Meter
+	// afterRun are called with the error of Run when it returns, like by WithWebhook
+	afterRun []func(err error)
+	// secrets are passed over inherited pipes, set by WithSecretFD
+	secrets []secretFD
+	// credentials are fetched when the command is run, into resolved
+	credentials []credential
+	resolved    resolvedCredentials
+
+	// extra writers of the outputs, added when the command is run, so that
+	// they are kept by later WithStdout and WithStderr options
+	stdoutWriters []io.Writer
+	stderrWriters []io.Writer
+	sinks         []Sink
+	flushers      []func() // called after each attempt
+	// beforeStart are called with the exec.Cmd of every attempt right before
+	// it is started, for settings of its SysProcAttr
+	beforeStart []func(cmd *exec.Cmd) error
+	// afterStart are called with the pid right after the command started,
+	// an error kills it, for settings which can only be applied to a process
+	afterStart []func(pid int) error
+	// afterExit are called once the process of an attempt exited, before its
+	// exit is handled, like to drain the output of a pty
+	afterExit []func()
+	// pty is the pseudo-terminal of WithPTY
+	pty *ptyState
+	// async is the run of Start
+	async *asyncRun
+	// watchers run while an attempt is running, their context is done when it exited
+	watchers []func(ctx context.Context)
+
+	labels Labels
+	// stats are the last ones sampled by WithProcessStats
+	stats *ProcessStats
+	// coreDump is the core file of the last attempt, found by WithCoreDumps
+	coreDump string
+	// traceFile is the one of the last attempt, of WithTraceSyscalls
+	traceFile string
+	// manifest of the last run, recorded by WithManifest
+	manifest *Manifest
+	// approval is the decision of the approval of WithApproval
+	approval *Approval
+
+	mu       sync.Mutex
+	process  *os.Process // while running, for Signal
+	env      []string    // of the last attempt, for EnvDiff
+	started  time.Time   // of the last attempt, for Status
+	finished time.Time
+
+	cancel       context.CancelFunc // while running, for Cancel
+	cancelReason string             // given to Cancel
+	stopReason   string             // why the last attempt was stopped, for Status
 
 	Executed bool
 	Setpgid  bool // 设置进程组
-	Setsid   bool // 设置进程组
+	Setsid   bool // 创建新会话, 也是新进程组
 }
 
 // EnvVars represents a map where the key is the name of the Env variable
@@ -47,9 +143,12 @@ type Cmd struct {
 //	Env := map[string]string{"ENV": "VALUE"}
 type EnvVars map[string]string
 
+// DefaultTimeout is the timeout of commands created by New.
+const DefaultTimeout = 1 * time.Minute
+
 // New creates a new command
 // You can add option with variadic option argument
-// Default timeout is set to 30 minutes
+// Default timeout is set to DefaultTimeout
 //
 // Example:
 //
@@ -65,13 +164,13 @@ type EnvVars map[string]string
 func New(cmd string, options ...func(*Cmd)) *Cmd {
 	c := &Cmd{
 		Command: cmd,
-		Timeout: 1 * time.Minute,
+		Timeout: DefaultTimeout,
 		Setpgid: true,
 	}
 	c.Env = append(c.Env, os.Environ()...)
 	c.Cmd = createBaseCommand(c)
-	c.StdoutWriter = io.MultiWriter(&c.StdoutBuf, &c.CombinedBuf)
-	c.stderrWriter = io.MultiWriter(&c.StderrBuf, &c.CombinedBuf)
+	c.StdoutWriter = io.MultiWriter(c.stdoutBuffers()...)
+	c.stderrWriter = io.MultiWriter(c.stderrBuffers()...)
 
 	for _, o := range options {
 		o(c)
@@ -80,20 +179,55 @@ func New(cmd string, options ...func(*Cmd)) *Cmd {
 	return c
 }
 
-// Run directly runs a new command
+// Run directly runs a new command, returning its stdout, or an *ExitError
+// with its stderr if its exit code is not a Success one, see WithExitCodeMap.
+// Writing to stderr is not a failure, many tools like curl, git or ffmpeg
+// write their progress there, see WithLegacyStderrFailure.
 func Run(cmd string, options ...func(*Cmd)) (string, error) {
 	c := New(cmd, options...)
 	if err := c.Run(context.Background()); err != nil {
 		return "", err
 	}
 
-	if stderr := c.Stderr(); stderr != "" {
-		return "", errors.New(stderr)
+	if c.legacyStderrFailure {
+		if stderr := c.UnexpectedStderr(); stderr != "" {
+			return "", errors.New(stderr)
+		}
+	} else if c.Outcome() != Success {
+		return "", &ExitError{Command: c.Redacted(), ExitCode: c.ExitCode(), Stderr: c.UnexpectedStderr()}
 	}
 
 	return c.Stdout(), nil
 }
 
+// ExitError is the error of the package level Run for a command which exited with a failure exit code.
+type ExitError struct {
+	Command  string // redacted command line
+	ExitCode int
+	// Stderr of the command, but the lines expected by WithExpectedStderr.
+	Stderr string
+}
+
+func (e *ExitError) Error() string {
+	msg := fmt.Sprintf("%q: exit code %d", e.Command, e.ExitCode)
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		lines := strings.Split(stderr, "\n")
+		msg += ": " + lines[len(lines)-1]
+	}
+	return msg
+}
+
+// WithLegacyStderrFailure makes the package level Run fail with the stderr of
+// the command as the error if it wrote any, but the lines expected by
+// WithExpectedStderr, whatever its exit code, like it did before.
+//
+// Deprecated: Run fails by the exit code, check the stderr explicitly if needed.
+func WithLegacyStderrFailure() func(c *Cmd) {
+	return func(c *Cmd) {
+		c.legacyStderrFailure = true
+	}
+}
+
 // WithCmd allows the OS specific generated baseCommand
 // to be overridden by an *os/exec.Cmd.
 //
@@ -111,6 +245,26 @@ func WithCmd(cmd *exec.Cmd) func(c *Cmd) {
 	}
 }
 
+// WithShell runs the command by the given shell instead of the default one of
+// the platform, like "sh", "zsh", "cmd.exe" or "pwsh". The flag which makes the
+// shell run a command string is chosen by the dialect of the shell.
+//
+// Example:
+//
+//	c := gocmd.New("echo $0", gocmd.WithShell("sh"))
+//	c.Run(context.TODO())
+func WithShell(shell string) func(c *Cmd) {
+	flag := "-c"
+	switch shellquote.DialectOf(shell) {
+	case shellquote.CmdExe:
+		flag = "/C"
+	case shellquote.PowerShell:
+		flag = "-Command"
+	}
+
+	return WithCmd(exec.Command(shell, flag))
+}
+
 // WithStdStreams is used as an option by the New constructor function and writes the output streams
 // to StderrBuf and StdoutBuf of the operating system
 //
@@ -120,16 +274,82 @@ func WithCmd(cmd *exec.Cmd) func(c *Cmd) {
 //	c.Run(context.TODO())
 func WithStdStreams() func(c *Cmd) {
 	return func(c *Cmd) {
-		c.StdoutWriter = io.MultiWriter(os.Stdout, &c.StdoutBuf, &c.CombinedBuf)
-		c.stderrWriter = io.MultiWriter(os.Stderr, &c.StderrBuf, &c.CombinedBuf)
+		c.StdoutWriter = io.MultiWriter(append([]io.Writer{os.Stdout}, c.stdoutBuffers()...)...)
+		c.stderrWriter = io.MultiWriter(append([]io.Writer{os.Stderr}, c.stderrBuffers()...)...)
 	}
 }
 
+// WithInheritedStdio connects stdin, stdout and stderr of the command to the ones
+// of the current process, for interactive commands like editors and REPLs which
+// need the terminal. The output is not captured then. The command stays in the
+// process group of the current process, which is the one owning the terminal,
+// so a timeout kills the command only, not the processes it started.
+//
+// Example:
+//
+//	c := gocmd.New("vim notes.txt", gocmd.WithInheritedStdio(), gocmd.WithTimeout(0))
+//	c.Run(context.TODO())
+func WithInheritedStdio() func(c *Cmd) {
+	return func(c *Cmd) {
+		c.stdin = os.Stdin
+		c.StdoutWriter = os.Stdout
+		c.stderrWriter = os.Stderr
+		c.Setpgid = false
+	}
+}
+
+// WithStdin sets the stdin of the command, like a file or a strings.Reader.
+// It is not replayed on retries, see WithRetry.
+//
+// Example:
+//
+//	c := gocmd.New("grep -c error", gocmd.WithStdin(strings.NewReader(logs)))
+//	c.Run(context.TODO())
+func WithStdin(r io.Reader) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.stdin = r
+	}
+}
+
+// StdinPipe returns a pipe connected to the stdin of the command when it is
+// run, to write to it while it runs, like a password or a stream of data.
+// It must be called before Run, and closed to tell the command the input ended.
+// Writes fail once Run returned.
+//
+// Example:
+//
+//	c := gocmd.New("grep --line-buffered error", gocmd.WithTimeout(0))
+//	stdin, _ := c.StdinPipe()
+//	go func() {
+//		defer stdin.Close()
+//		for line := range lines {
+//			fmt.Fprintln(stdin, line)
+//		}
+//	}()
+//	c.Run(context.TODO())
+func (c *Cmd) StdinPipe() (io.WriteCloser, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.started.IsZero() {
+		return nil, errors.New("stdin pipe after the command was run")
+	}
+	if c.stdinPipe != nil {
+		return nil, errors.New("stdin pipe already created")
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	c.stdin, c.stdinPipe = r, r
+	return w, nil
+}
+
 // WithStdout allows to add custom writers to StdoutBuf
 func WithStdout(writers ...io.Writer) func(c *Cmd) {
 	return func(c *Cmd) {
 		var allWriters []io.Writer
-		allWriters = append(allWriters, &c.StdoutBuf, &c.CombinedBuf)
+		allWriters = append(allWriters, c.stdoutBuffers()...)
 		allWriters = append(allWriters, writers...)
 		c.StdoutWriter = io.MultiWriter(allWriters...)
 	}
@@ -139,12 +359,72 @@ func WithStdout(writers ...io.Writer) func(c *Cmd) {
 func WithStderr(writers ...io.Writer) func(c *Cmd) {
 	return func(c *Cmd) {
 		var allWriters []io.Writer
-		allWriters = append(allWriters, &c.StderrBuf, &c.CombinedBuf)
+		allWriters = append(allWriters, c.stderrBuffers()...)
 		allWriters = append(allWriters, writers...)
 		c.stderrWriter = io.MultiWriter(allWriters...)
 	}
 }
 
+// WithMaxBuffer keeps at most the first n bytes of the outputs in each of
+// StdoutBuf, StderrBuf and CombinedBuf, the rest is still written to the other
+// writers, so that commands streaming much output, like the stages of a
+// Pipeline, do not use memory for nothing. Zero keeps all.
+//
+// Example:
+//
+//	c := gocmd.New("tar c /data", gocmd.WithStdout(f), gocmd.WithMaxBuffer(64<<10))
+func WithMaxBuffer(n int) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.maxBuffer = n
+	}
+}
+
+// WithoutCombined does not keep the output in CombinedBuf, for callers which
+// never read Combined, as it doubles the memory used by the output otherwise.
+// Combined returns an empty string then.
+//
+// Example:
+//
+//	c := gocmd.New("make", gocmd.WithoutCombined(), gocmd.WithMaxBuffer(1<<20))
+func WithoutCombined() func(c *Cmd) {
+	return func(c *Cmd) {
+		c.noCombined = true
+	}
+}
+
+// stdoutBuffers returns the writers of stdout to StdoutBuf and CombinedBuf.
+func (c *Cmd) stdoutBuffers() []io.Writer {
+	return []io.Writer{&bufferWriter{c: c, buf: &c.StdoutBuf}, &combinedWriter{c: c, stream: stdoutStream}}
+}
+
+// stderrBuffers returns the writers of stderr to StderrBuf and CombinedBuf.
+func (c *Cmd) stderrBuffers() []io.Writer {
+	return []io.Writer{&bufferWriter{c: c, buf: &c.StderrBuf}, &combinedWriter{c: c, stream: stderrStream}}
+}
+
+// bufferWriter writes to a buffer of the command up to its WithMaxBuffer.
+type bufferWriter struct {
+	c   *Cmd
+	buf *bytes.Buffer
+}
+
+func (w *bufferWriter) Write(p []byte) (int, error) {
+	return w.c.writeBuffer(w.buf, p)
+}
+
+// writeBuffer writes p to the buffer up to WithMaxBuffer, dropping the rest.
+func (c *Cmd) writeBuffer(buf *bytes.Buffer, p []byte) (int, error) {
+	if max := c.maxBuffer; max > 0 {
+		if room := max - buf.Len(); room < len(p) {
+			if room > 0 {
+				buf.Write(p[:room])
+			}
+			return len(p), nil
+		}
+	}
+	return buf.Write(p)
+}
+
 // WithTimeout sets the timeout of the command
 //
 // Example:
@@ -156,6 +436,18 @@ func WithTimeout(t time.Duration) func(c *Cmd) {
 	}
 }
 
+// WithKillAfter kills a timed out or canceled command by SIGKILL, if it did not
+// exit within d after SIGTERM, like timeout --kill-after of coreutils.
+//
+// Example:
+//
+//	gocmd.New("./server", gocmd.WithTimeout(time.Minute), gocmd.WithKillAfter(10*time.Second))
+func WithKillAfter(d time.Duration) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.KillAfter = d
+	}
+}
+
 // WithSetpgid sets Setpgid
 func WithSetpgid(value bool) func(c *Cmd) {
 	return func(c *Cmd) {
@@ -163,7 +455,14 @@ func WithSetpgid(value bool) func(c *Cmd) {
 	}
 }
 
-// WithSetsid sets Setsid
+// WithSetsid sets Setsid, which runs the command in a new session, detached
+// from the controlling terminal, so that it does not get the SIGHUP of the
+// terminal closing, as daemons do. The session leader leads a new process
+// group too, which is signaled on timeouts and by Signal like one of Setpgid.
+//
+// Example:
+//
+//	c := gocmd.New("./daemon", gocmd.WithSetsid(true), gocmd.WithTimeout(0))
 func WithSetsid(value bool) func(c *Cmd) {
 	return func(c *Cmd) {
 		c.Setsid = value
@@ -212,7 +511,52 @@ func (c *Cmd) Stderr() string {
 	return c.StderrBuf.String()
 }
 
-// Combined returns the CombinedBuf output of StderrBuf and StdoutBuf according to their timeline
+// StdoutBytes returns the output to StdoutBuf without copying it, it must not
+// be modified, and is valid until the command is run again.
+func (c *Cmd) StdoutBytes() []byte {
+	c.checkExecuted("StdoutBytes")
+	return c.StdoutBuf.Bytes()
+}
+
+// StdoutLen returns the length of the output to StdoutBuf.
+func (c *Cmd) StdoutLen() int {
+	c.checkExecuted("StdoutLen")
+	return c.StdoutBuf.Len()
+}
+
+// WriteStdoutTo writes the output to StdoutBuf to w, without copying it like
+// Stdout does, and keeps it.
+//
+// Example:
+//
+//	f, _ := os.Create("dump.sql")
+//	c.WriteStdoutTo(f)
+func (c *Cmd) WriteStdoutTo(w io.Writer) (int64, error) {
+	c.checkExecuted("WriteStdoutTo")
+	return bytes.NewReader(c.StdoutBuf.Bytes()).WriteTo(w)
+}
+
+// StderrBytes returns the output to StderrBuf without copying it, like StdoutBytes.
+func (c *Cmd) StderrBytes() []byte {
+	c.checkExecuted("StderrBytes")
+	return c.StderrBuf.Bytes()
+}
+
+// StderrLen returns the length of the output to StderrBuf.
+func (c *Cmd) StderrLen() int {
+	c.checkExecuted("StderrLen")
+	return c.StderrBuf.Len()
+}
+
+// WriteStderrTo writes the output to StderrBuf to w, like WriteStdoutTo.
+func (c *Cmd) WriteStderrTo(w io.Writer) (int64, error) {
+	c.checkExecuted("WriteStderrTo")
+	return bytes.NewReader(c.StderrBuf.Bytes()).WriteTo(w)
+}
+
+// Combined returns the CombinedBuf output of StderrBuf and StdoutBuf according to their timeline,
+// merged by whole lines in the order they were completed, so that lines are not split,
+// empty with WithoutCombined
 func (c *Cmd) Combined() string {
 	c.checkExecuted("Combined")
 	return c.CombinedBuf.String()
@@ -237,20 +581,99 @@ var ErrTimeout = errors.New("timeout")
 
 // Run runs with Context
 // If timeout, a wrapped ErrTimeout returned.
-func (c *Cmd) Run(ctx context.Context) error {
+// With a retry policy set by WithRetry, the command is run again while the
+// policy tells so, and the outputs are the ones of the last attempt.
+// Run returns once the output was written and the sinks flushed and closed,
+// see WithOutputDeadline.
+func (c *Cmd) Run(ctx context.Context) (err error) {
+	if len(c.afterRun) > 0 {
+		defer func() {
+			for _, f := range c.afterRun {
+				f(err)
+			}
+		}()
+	}
+	if c.stdinPipe != nil {
+		defer c.stdinPipe.Close()
+	}
+	if err := c.checkPolicy(ctx); err != nil {
+		return err
+	}
+	if err := c.checkApproval(); err != nil {
+		return err
+	}
+	if err := c.checkMeters(); err != nil {
+		return err
+	}
+	release, err := c.acquireLimiters()
+	if err != nil {
+		return err
+	}
+	defer release()
+	if err := c.resolveCredentials(ctx); err != nil {
+		return err
+	}
+	if err := c.startSinks(); err != nil {
+		return err
+	}
+	defer c.closeSinks()
+
+	ctx, cancel := c.startCancel(ctx)
+	defer cancel()
+
+	template := cloneCmd(c.Cmd)
+	for attempt := 1; ; attempt++ {
+		c.mu.Lock()
+		c.attempts = attempt
+		c.mu.Unlock()
+		err := c.runOnce(ctx)
+		c.flushCombined()
+		_ = c.flushSinks()
+		for _, flush := range c.flushers {
+			flush()
+		}
+		if err == nil {
+			c.classify()
+		}
+		if attempt > c.retry.Retries || !c.retry.shouldRetry(c, err) {
+			return err
+		}
+
+		if c.retry.OnAttempt != nil {
+			c.retry.OnAttempt(attempt, c.exitCode, err)
+		}
+		if !sleepContext(ctx, c.retry.Delay) {
+			return err
+		}
+
+		c.mu.Lock()
+		c.resetForRetry(template)
+		c.mu.Unlock()
+	}
+}
+
+func (c *Cmd) runOnce(ctx context.Context) error {
 	cmd := c.Cmd
 
 	if cmd.SysProcAttr == nil {
 		cmd.SysProcAttr = &syscall.SysProcAttr{}
 	}
 
-	cmd.SysProcAttr.Setpgid = c.Setpgid // 设置进程组
+	// a session leader leads a new process group already, setpgid would fail with EPERM
+	cmd.SysProcAttr.Setpgid = c.Setpgid && !c.Setsid // 设置进程组
 	cmd.SysProcAttr.Setsid = c.Setsid
 
 	cmd.Env = c.Env
 	cmd.Dir = c.Dir
-	cmd.Stdout = c.StdoutWriter
-	cmd.Stderr = c.stderrWriter
+	var closeStdout, closeStderr func()
+	cmd.Stdout, closeStdout = newOutputGate(withWriters(c.StdoutWriter, c.stdoutWriters))
+	cmd.Stderr, closeStderr = newOutputGate(withWriters(c.stderrWriter, c.stderrWriters))
+	defer closeStdout()
+	defer closeStderr()
+	cmd.WaitDelay = c.OutputDeadline
+	if c.stdin != nil {
+		cmd.Stdin = c.stdin
+	}
 	cmd.Dir = c.WorkingDir
 
 	// Respect legacy timer setting only if timeout was set > 0
@@ -262,39 +685,160 @@ func (c *Cmd) Run(ctx context.Context) error {
 		defer cancel()
 		ctx = subCtx
 	}
+	budgetCtx := false
+	if c.budget != nil {
+		if c.budget.Remaining() <= 0 {
+			return fmt.Errorf("run %s: %w", c.Redacted(), c.budget.exhausted())
+		}
+		var charge func()
+		ctx, charge, budgetCtx = c.budget.withDeadline(ctx)
+		defer charge()
+	}
+	if deadline, ok := ctx.Deadline(); ok && c.deadlineEnv != "" {
+		cmd.Env = deadlineEnv(c.Env, c.deadlineEnv, deadline)
+	}
 
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("start %s, Setpgid: %t: %w", cmd, c.Setpgid, err)
+	for _, f := range c.beforeStart {
+		if err := f(cmd); err != nil {
+			return fmt.Errorf("setup %s: %w", c.Redacted(), err)
+		}
 	}
-	defer func() {
-		c.Executed = true
-	}()
+	if len(c.resolved.env) > 0 {
+		cmd.Env = append(cmd.Env[:len(cmd.Env):len(cmd.Env)], c.resolved.env...)
+	}
+	closeSecrets, err := passSecrets(cmd, append(c.secrets[:len(c.secrets):len(c.secrets)], c.resolved.secrets...))
+	if err != nil {
+		return fmt.Errorf("pass secrets of %s: %w", c.Redacted(), err)
+	}
+	c.mu.Lock()
+	c.env = cmd.Env
+	c.mu.Unlock()
+
+	err = cmd.Start()
+	closeSecrets()
+	if err != nil {
+		return fmt.Errorf("start %s, Setpgid: %t, Setsid: %t: %w", c.Redacted(), c.Setpgid, c.Setsid, err)
+	}
+	c.setProcess(cmd.Process)
+	defer c.setProcess(nil)
 
-	done := make(chan error)
+	done := make(chan error, 1)
 	go func() {
-		done <- cmd.Wait()
+		err := cmd.Wait()
+		for _, f := range c.afterExit {
+			f()
+		}
+		done <- err
 	}()
 
+	// Signal the process group (-pid), not just the process, so that the process
+	// and all its children are signaled. Else, child procs can keep running and
+	// keep the stdout/stderr fd open and cause gocmd.Wait to hang.
+	// Without a process group of its own, only the process can be signaled.
+	pid := cmd.Process.Pid
+	if c.Setpgid || c.Setsid {
+		pid = -pid
+	}
+
+	for _, f := range c.afterStart {
+		if err := f(cmd.Process.Pid); err != nil {
+			_ = syscall.Kill(pid, syscall.SIGKILL)
+			<-done
+			return fmt.Errorf("setup %s: %w", c.Redacted(), err)
+		}
+	}
+	defer c.watch(ctx)()
+
 	select {
 	case <-ctx.Done():
-		// cmd.Process.Kill();
-		// Signal the process group (-pid), not just the process, so that the process
-		// and all its children are signaled. Else, child procs can keep running and
-		// keep the stdout/stderr fd open and cause gocmd.Wait to hang.
-		if err := syscall.Kill(-1*cmd.Process.Pid, syscall.SIGTERM); err != nil {
+		// a stopped command, like one paused by PreemptPause, would keep SIGTERM pending
+		_ = syscall.Kill(pid, syscall.SIGCONT)
+		if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
 			return fmt.Errorf("timeout, kill %v: %w", cmd.Process.Pid, err)
 		}
-
-		if timeoutCtx {
-			return fmt.Errorf("timeout %v: %w", c.Timeout, ErrTimeout)
+		if c.KillAfter > 0 {
+			c.killAfter(pid, done)
+		} else {
+			c.waitOutput(done)
 		}
-		return ctx.Err()
+
+		return c.stopped(ctx, timeoutCtx, budgetCtx)
 	case err := <-done:
 		c.getExitCode(err)
 		return nil
 	}
 }
 
+// killAfter waits for the command to exit, killing it by SIGKILL if it did not within KillAfter.
+func (c *Cmd) killAfter(pid int, done <-chan error) {
+	t := time.NewTimer(c.KillAfter)
+	defer t.Stop()
+
+	select {
+	case err := <-done:
+		c.getExitCode(err)
+	case <-t.C:
+		_ = syscall.Kill(pid, syscall.SIGKILL)
+		c.getExitCode(<-done)
+	}
+}
+
+// ErrNotRunning is returned by Signal if the command is not running.
+var ErrNotRunning = errors.New("command not running")
+
+// ErrNotSupported is returned by Run for options which are not supported on the platform.
+var ErrNotSupported = errors.New("not supported on this platform")
+
+// Signal sends the signal to the running command, to its process group if it
+// has one of its own by Setpgid or Setsid, so that the processes it started
+// get the signal too, like the ones of a shell pipeline.
+//
+// Example:
+//
+//	go c.Run(ctx)
+//	...
+//	c.Signal(syscall.SIGHUP) // reload its config
+func (c *Cmd) Signal(sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return fmt.Errorf("unsupported signal %v", sig)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.process == nil {
+		return ErrNotRunning
+	}
+	pid := c.process.Pid
+	if c.Setpgid || c.Setsid {
+		pid = -pid
+	}
+	return syscall.Kill(pid, s)
+}
+
+// setProcess sets the started process, or nil when it exited.
+func (c *Cmd) setProcess(p *os.Process) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.process = p
+	if p != nil {
+		c.started = time.Now()
+	} else {
+		c.finished = time.Now()
+		c.Executed = true
+	}
+}
+
+// withWriters returns w writing to the writers too.
+func withWriters(w io.Writer, writers []io.Writer) io.Writer {
+	if len(writers) == 0 {
+		return w
+	}
+	return io.MultiWriter(append([]io.Writer{w}, writers...)...)
+}
+
 func (c *Cmd) getExitCode(err error) {
 	var exitErr *exec.ExitError
 	if errors.As(err, &exitErr) {
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/bingoohuang/gocmd/shellquote"
+)
+
+// jobSpec is a JSON line of a batch file, lines not starting with { are plain shell commands.
+type jobSpec struct {
+	Name    string            `json:"name"`
+	Command string            `json:"command"` // run by the shell
+	Args    []string          `json:"args"`    // executed directly, if Command is empty
+	Timeout string            `json:"timeout"`
+	Workdir string            `json:"workdir"`
+	Env     map[string]string `json:"env"`
+	Labels  map[string]string `json:"labels"`
+	// Priority orders the start of the commands, the higher first
+	Priority int `json:"priority"`
+	// ExitCodes classifies exit codes, like {"24": "success"}, see gocmd.WithExitCodeMap
+	ExitCodes map[int]gocmd.Outcome `json:"exit_codes"`
+}
+
+func runBatch(argv []string) {
+	fs := flag.NewFlagSet(os.Args[0]+" batch", flag.ExitOnError)
+	file := fs.String("f", "-", "file of commands, one per line or JSON specs, - for stdin")
+	parallel := fs.Int("P", runtime.NumCPU(), "maximum number of commands running at the same time")
+	halt := fs.Bool("halt-on-error", false, "do not start further commands after one failed")
+	timeout := fs.Duration("t", gocmd.DefaultTimeout, "timeout of each command, 0 for none")
+	noColor := fs.Bool("no-color", !isTerminal(os.Stdout), "do not colorize the output prefixes")
+	useTUI := fs.Bool("tui", false, "show a dashboard with a row per command instead of the prefixed output")
+	dryRun := fs.Bool("dry-run", false, "print the plan of what would run instead of running it")
+	jsonPlan := fs.Bool("json", false, "print the --dry-run plan as JSON")
+	checkpoint := fs.String("checkpoint", "", "file keeping the results, to resume an interrupted batch without running the succeeded commands again")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [flags]\n\nFlags:\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(argv)
+
+	in := os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	specs, err := readJobSpecs(in)
+	if err != nil {
+		log.Fatalf("read %s: %v", *file, err)
+	}
+
+	jobs := make([]gocmd.BatchJob, len(specs))
+	for i, spec := range specs {
+		if jobs[i], err = spec.job(i, *timeout); err != nil {
+			log.Fatalf("command %d: %v", i+1, err)
+		}
+	}
+
+	commands := make([]string, len(specs))
+	for i, spec := range specs {
+		commands[i] = spec.display()
+	}
+
+	b := gocmd.Batch{Parallel: *parallel, HaltOnError: *halt, Output: os.Stdout, NoColor: *noColor}
+	if *dryRun {
+		printPlan(b.Plan(jobs...), *jsonPlan)
+		return
+	}
+	var cp gocmd.BatchCheckpoint
+	if *checkpoint != "" {
+		cp = gocmd.FileCheckpoint(*checkpoint)
+	}
+	if printSummary(os.Stdout, commands, runBatchJobs(&b, jobs, commands, "gocmd batch", *useTUI, cp)) {
+		os.Exit(1)
+	}
+}
+
+func readJobSpecs(r io.Reader) ([]jobSpec, error) {
+	var specs []jobSpec
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var spec jobSpec
+		if strings.HasPrefix(line, "{") {
+			if err := json.Unmarshal([]byte(line), &spec); err != nil {
+				return nil, fmt.Errorf("parse %s: %w", line, err)
+			}
+		} else {
+			spec.Command = line
+		}
+		specs = append(specs, spec)
+	}
+
+	return specs, scanner.Err()
+}
+
+func (s jobSpec) job(i int, timeout time.Duration) (gocmd.BatchJob, error) {
+	if s.Name == "" {
+		s.Name = fmt.Sprintf("#%d", i+1)
+	}
+	if s.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(s.Timeout); err != nil {
+			return gocmd.BatchJob{}, fmt.Errorf("parse timeout %q: %w", s.Timeout, err)
+		}
+	}
+
+	options := []func(*gocmd.Cmd){gocmd.WithTimeout(timeout)}
+	if s.Workdir != "" {
+		options = append(options, gocmd.WithWorkingDir(s.Workdir))
+	}
+	if len(s.Env) > 0 {
+		options = append(options, gocmd.WithEnv(s.Env))
+	}
+	if len(s.Labels) > 0 {
+		options = append(options, gocmd.WithLabels(s.Labels))
+	}
+	if len(s.ExitCodes) > 0 {
+		options = append(options, gocmd.WithExitCodeMap(s.ExitCodes))
+	}
+
+	switch {
+	case s.Command != "":
+	case len(s.Args) > 0:
+		options = append(options, gocmd.WithCmd(exec.Command(s.Args[0], s.Args[1:]...)))
+	default:
+		return gocmd.BatchJob{}, fmt.Errorf("command or args required")
+	}
+
+	return gocmd.BatchJob{Name: s.Name, Cmd: gocmd.New(s.Command, options...), Priority: s.Priority}, nil
+}
+
+func (s jobSpec) display() string {
+	if s.Command != "" {
+		return s.Command
+	}
+	return shellquote.QuoteMust(s.Args...)
+}
+
+// printPlan prints the plan to stdout, as text or JSON.
+func printPlan(p gocmd.Plan, asJSON bool) {
+	if !asJSON {
+		fmt.Print(p)
+		return
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(p)
+}
+
+// runBatchJobs runs the jobs by the batch, showing the dashboard if useTUI and stdout is a terminal,
+// resuming them by the checkpoint if not nil.
+func runBatchJobs(b *gocmd.Batch, jobs []gocmd.BatchJob, commands []string, title string, useTUI bool,
+	cp gocmd.BatchCheckpoint,
+) []gocmd.BatchResult {
+	run := func(ctx context.Context) []gocmd.BatchResult {
+		if cp == nil {
+			return b.Run(ctx, jobs...)
+		}
+		results, err := b.Resume(ctx, cp, jobs...)
+		if results == nil && err != nil {
+			log.Fatalf("error: %v", err)
+		} else if err != nil {
+			log.Printf("warning: %v", err)
+		}
+		return results
+	}
+
+	if useTUI && !isTerminal(os.Stdout) {
+		log.Printf("warning: --tui ignored, stdout is not a terminal")
+		useTUI = false
+	}
+	if !useTUI {
+		return run(context.TODO())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ui := newTUI(title, b, jobs, commands)
+	ui.start(cancel)
+	results := run(ctx)
+	ui.stop()
+	return results
+}
+
+// printSummary prints a table of the results, it returns true if any command failed.
+// A LABELS column is printed if any command has labels.
+func printSummary(w io.Writer, commands []string, results []gocmd.BatchResult) (failed bool) {
+	withLabels := false
+	for _, r := range results {
+		withLabels = withLabels || len(r.Labels) > 0
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if withLabels {
+		fmt.Fprintln(tw, "\nNAME\tEXIT\tDURATION\tSTATUS\tLABELS\tCOMMAND")
+	} else {
+		fmt.Fprintln(tw, "\nNAME\tEXIT\tDURATION\tSTATUS\tCOMMAND")
+	}
+	for i, r := range results {
+		exitCode, status := fmt.Sprint(r.ExitCode), "ok"
+		switch {
+		case r.Skipped:
+			exitCode, status = "-", "skipped"
+		case r.Resumed:
+			status = "ok (resumed)"
+		case r.Err != nil:
+			exitCode, status = "-", r.Err.Error()
+		case r.Failure != gocmd.FailureNone:
+			status = "failed (" + string(r.Failure) + ")"
+		case r.Failed():
+			status = "failed"
+		}
+		failed = failed || r.Failed()
+
+		if withLabels {
+			status += "\t" + r.Labels.String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Name, exitCode,
+			r.Duration.Round(time.Millisecond), status, commands[i])
+	}
+	_ = tw.Flush()
+
+	return failed
+}
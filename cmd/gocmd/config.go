@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"gopkg.in/yaml.v3"
+)
+
+// config is the gocmd config file, like
+//
+//	presets:
+//	  deploy:
+//	    command: kubectl --context prod apply -f {{.Arg 0}}
+//	    env: {KUBECONFIG: /etc/kube/prod.yaml}
+//	    timeout: 5m
+//	    retries: 2
+//	    retry_delay: 10s
+type config struct {
+	Presets map[string]preset `yaml:"presets"`
+}
+
+// preset is a named command of the config file, run by gocmd run <preset> [args...].
+type preset struct {
+	// Command is a text/template of the shell command, see presetArgs,
+	// the args are appended to it, if it is not a template.
+	Command     string            `yaml:"command"`
+	Description string            `yaml:"description"`
+	Env         map[string]string `yaml:"env"`
+	Timeout     *time.Duration    `yaml:"timeout"` // gocmd.DefaultTimeout if not set, 0 for none
+	Retries     int               `yaml:"retries"`
+	RetryDelay  time.Duration     `yaml:"retry_delay"`
+	Workdir     string            `yaml:"workdir"`
+}
+
+// presetArgs are the args of a preset template, {{.}} is all args shell quoted,
+// {{.Arg 0}} is the first one shell quoted, {{.Len}} is their number.
+type presetArgs []string
+
+func (a presetArgs) Len() int { return len(a) }
+
+func (a presetArgs) String() string {
+	q, err := gocmd.Quote(a...)
+	if err != nil {
+		panic(err) // text/template recovers it and returns it as the error of Execute
+	}
+	return q
+}
+
+func (a presetArgs) Arg(i int) (string, error) {
+	if i < 0 || i >= len(a) {
+		return "", fmt.Errorf("arg %d required, got %d args", i, len(a))
+	}
+	return quote(a[i]), nil
+}
+
+// configFile returns the path of the config file, $GOCMD_CONFIG,
+// or gocmd/config.yaml in $XDG_CONFIG_HOME or ~/.config.
+func configFile() string {
+	if f := os.Getenv("GOCMD_CONFIG"); f != "" {
+		return f
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "gocmd", "config.yaml")
+}
+
+func loadConfig(file string) (*config, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var c config
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parse %s: %w", file, err)
+	}
+
+	for name, p := range c.Presets {
+		if p.Command == "" {
+			return nil, fmt.Errorf("parse %s: preset %s: command required", file, name)
+		}
+		if _, err := template.New(name).Parse(p.Command); err != nil {
+			return nil, fmt.Errorf("parse %s: preset %s: %w", file, name, err)
+		}
+	}
+	return &c, nil
+}
+
+// presetNames returns the names of the presets, sorted.
+func (c *config) presetNames() []string {
+	names := make([]string, 0, len(c.Presets))
+	for name := range c.Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// command renders the shell command of the preset for the args.
+func (p preset) command(name string, args []string) (string, error) {
+	if !strings.Contains(p.Command, "{{") {
+		if len(args) == 0 {
+			return p.Command, nil
+		}
+		return p.Command + " " + presetArgs(args).String(), nil
+	}
+
+	t, err := template.New(name).Option("missingkey=error").Parse(p.Command)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, presetArgs(args)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
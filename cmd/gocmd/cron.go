@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/bingoohuang/gocmd/cron"
+)
+
+// historyEntry is a JSON line of the --history file.
+type historyEntry struct {
+	Command    string     `json:"command"`
+	Scheduled  time.Time  `json:"scheduled"`
+	Start      *time.Time `json:"start,omitempty"`
+	DurationMs float64    `json:"duration_ms"`
+	ExitCode   int        `json:"exit_code"`
+	Skipped    bool       `json:"skipped,omitempty"`
+	Missed     bool       `json:"missed,omitempty"`
+	CatchUp    bool       `json:"catch_up,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+func runCron(argv []string) {
+	fs := flag.NewFlagSet(os.Args[0]+" cron", flag.ExitOnError)
+	spec := fs.String("spec", "", "schedule, like '*/5 * * * *', @hourly or '@every 10m'")
+	overlap := fs.String("overlap", "skip", "when a run is due while the previous one is running: skip, allow, queue or kill")
+	queueDepth := fs.Int("queue-depth", 1, "runs waiting by --overlap queue")
+	catchUp := fs.String("catch-up", "none", "runs missed since the last run in --history or while suspended: none, once or all")
+	grace := fs.Duration("grace", time.Minute, "how late a run can be started before it is missed")
+	jitter := fs.Duration("jitter", 0, "delay each run by a random duration up to this")
+	history := fs.String("history", "", "file to append a JSON line per run to")
+	timeout := fs.Duration("t", 0, "timeout of each run, 0 for none")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s --spec SPEC [flags] -- command...\n\nFlags:\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(argv)
+
+	args := fs.Args()
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if *spec == "" || len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	schedule, err := cron.Parse(*spec)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+	o, err := cron.ParseOverlap(*overlap)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+	c, err := cron.ParseCatchUp(*catchUp)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+	command, err := gocmd.Quote(args...)
+	if err != nil {
+		log.Fatalf("quote %q: %v", args, err)
+	}
+
+	var hist *os.File
+	var since time.Time
+	if *history != "" {
+		if since, err = lastScheduled(*history); err != nil {
+			log.Fatalf("read history: %v", err)
+		}
+		if hist, err = os.OpenFile(*history, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+			log.Fatalf("open history: %v", err)
+		}
+		defer hist.Close()
+	}
+	var histMu sync.Mutex
+
+	s := cron.Scheduler{
+		Schedule:   schedule,
+		Overlap:    o,
+		QueueDepth: *queueDepth,
+		Jitter:     *jitter,
+		Since:      since,
+		Grace:      *grace,
+		CatchUp:    c,
+		Command: func() *gocmd.Cmd {
+			return gocmd.New(command, gocmd.WithTimeout(*timeout), gocmd.WithStdStreams())
+		},
+		OnRun: func(r cron.Run) {
+			switch {
+			case r.Missed:
+				log.Printf("run of %s missed", r.Scheduled.Format(time.RFC3339))
+			case r.Skipped:
+				log.Printf("run of %s skipped, the previous one is still running", r.Scheduled.Format(time.RFC3339))
+			case r.Err != nil:
+				log.Printf("run of %s failed after %s: %v", r.Scheduled.Format(time.RFC3339), r.Duration.Round(time.Millisecond), r.Err)
+			default:
+				log.Printf("run of %s exited with %d after %s", r.Scheduled.Format(time.RFC3339), r.ExitCode, r.Duration.Round(time.Millisecond))
+			}
+
+			if hist != nil {
+				histMu.Lock()
+				defer histMu.Unlock()
+				if err := json.NewEncoder(hist).Encode(newHistoryEntry(command, r)); err != nil {
+					log.Printf("write history: %v", err)
+				}
+			}
+		},
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("scheduling %q on %q, next run at %s", command, *spec, schedule.Next(time.Now()).Format(time.RFC3339))
+	if err := s.Run(ctx); err != nil && ctx.Err() == nil {
+		log.Fatalf("error: %v", err)
+	}
+}
+
+func newHistoryEntry(command string, r cron.Run) historyEntry {
+	h := historyEntry{
+		Command:    command,
+		Scheduled:  r.Scheduled,
+		DurationMs: float64(r.Duration) / float64(time.Millisecond),
+		ExitCode:   r.ExitCode,
+		Skipped:    r.Skipped,
+		Missed:     r.Missed,
+		CatchUp:    r.CatchUp,
+	}
+	if !r.Skipped && !r.Missed {
+		h.Start = &r.Start
+	}
+	if r.Err != nil {
+		// the command did not exit by itself, so it has no exit code
+		h.ExitCode = -1
+		h.Error = r.Err.Error()
+	}
+	return h
+}
+
+// lastScheduled returns the time of the last run in the history file, the zero
+// time if there is none.
+func lastScheduled(path string) (time.Time, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+
+	var last time.Time
+	dec := json.NewDecoder(f)
+	for {
+		var h historyEntry
+		if err := dec.Decode(&h); err == io.EOF {
+			return last, nil
+		} else if err != nil {
+			return time.Time{}, err
+		}
+		if h.Scheduled.After(last) {
+			last = h.Scheduled
+		}
+	}
+}
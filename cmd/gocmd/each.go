@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+
+	"github.com/bingoohuang/gocmd"
+)
+
+// eachItem is the data of an each template. {{.}} is the shell quoted item,
+// {{.Base}} and {{.NoExt}} are its quoted base name and path without extension,
+// {{.Raw}} is the item unquoted and {{.Index}} is the 1-based index of the item.
+type eachItem struct {
+	raw   string
+	index int
+}
+
+func (i eachItem) String() string { return quote(i.raw) }
+func (i eachItem) Raw() string    { return i.raw }
+func (i eachItem) Index() int     { return i.index }
+func (i eachItem) Base() string   { return quote(filepath.Base(i.raw)) }
+func (i eachItem) NoExt() string  { return quote(strings.TrimSuffix(i.raw, filepath.Ext(i.raw))) }
+
+// newEachItem returns the item, or why it cannot be quoted, like for a NUL
+// byte. It is checked before rendering since fmt recovers a panic of String,
+// for {{.}}, and prints it, which would end up in the command. The parts of
+// a quotable item, like its base name, are quotable.
+func newEachItem(raw string, index int) (eachItem, error) {
+	if _, err := gocmd.Quote(raw); err != nil {
+		return eachItem{}, err
+	}
+	return eachItem{raw: raw, index: index}, nil
+}
+
+func quote(s string) string {
+	q, err := gocmd.Quote(s)
+	if err != nil {
+		panic(err) // not expected, see newEachItem
+	}
+	return q
+}
+
+func runEach(argv []string) {
+	fs := flag.NewFlagSet(os.Args[0]+" each", flag.ExitOnError)
+	tmpl := fs.String("template", "", "command template, like 'convert {{.}} out/{{.NoExt}}.png'")
+	parallel := fs.Int("P", runtime.NumCPU(), "maximum number of commands running at the same time")
+	null := fs.Bool("0", false, "items are NUL delimited instead of newline delimited, like of find -print0")
+	halt := fs.Bool("halt-on-error", false, "do not start further commands after one failed")
+	timeout := fs.Duration("t", gocmd.DefaultTimeout, "timeout of each command, 0 for none")
+	noColor := fs.Bool("no-color", !isTerminal(os.Stdout), "do not colorize the output prefixes")
+	useTUI := fs.Bool("tui", false, "show a dashboard with a row per command instead of the prefixed output")
+	dryRun := fs.Bool("dry-run", false, "print the commands instead of running them")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s --template 'cmd {{.}}' [flags] < items\n\n", fs.Name())
+		fmt.Fprintf(fs.Output(), "Template data: {{.}} quoted item, {{.Base}} quoted base name, "+
+			"{{.NoExt}} quoted item without extension, {{.Raw}} unquoted item, {{.Index}} 1-based index\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(argv)
+
+	if *tmpl == "" {
+		fs.Usage()
+		log.Fatalf("error: --template required")
+	}
+
+	t, err := template.New("each").Option("missingkey=error").Parse(*tmpl)
+	if err != nil {
+		log.Fatalf("parse template: %v", err)
+	}
+
+	items, err := readItems(os.Stdin, *null)
+	if err != nil {
+		log.Fatalf("read items: %v", err)
+	}
+
+	jobs := make([]gocmd.BatchJob, len(items))
+	commands := make([]string, len(items))
+	for i, item := range items {
+		data, err := newEachItem(item, i+1)
+		if err != nil {
+			log.Fatalf("quote %q: %v", item, err)
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, data); err != nil {
+			log.Fatalf("execute template for %q: %v", item, err)
+		}
+		commands[i] = buf.String()
+		if *dryRun {
+			fmt.Println(commands[i])
+			continue
+		}
+
+		jobs[i] = gocmd.BatchJob{
+			Name: abbreviate(item, 24),
+			Cmd:  gocmd.New(commands[i], gocmd.WithTimeout(*timeout)),
+		}
+	}
+	if *dryRun {
+		return
+	}
+
+	b := gocmd.Batch{Parallel: *parallel, HaltOnError: *halt, Output: os.Stdout, NoColor: *noColor}
+	if printSummary(os.Stdout, commands, runBatchJobs(&b, jobs, commands, "gocmd each", *useTUI, nil)) {
+		os.Exit(1)
+	}
+}
+
+func readItems(r io.Reader, null bool) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	if null {
+		scanner.Split(scanNull)
+	}
+
+	var items []string
+	for scanner.Scan() {
+		item := scanner.Text()
+		if !null {
+			item = strings.TrimSuffix(item, "\r")
+		}
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items, scanner.Err()
+}
+
+// scanNull is a bufio.SplitFunc for NUL delimited tokens.
+func scanNull(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// abbreviate shortens s to at most n runes, keeping its end which tells file names apart.
+func abbreviate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return "…" + string(r[len(r)-n+1:])
+}
@@ -0,0 +1,548 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+)
+
+// stringsFlag is a flag which can be repeated, like --env A=1 --env B=2.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string { return strings.Join(*s, ",") }
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// options are the command line options of gocmd.
+// The env vars TIMEOUT, WORKING_DIR, LINES=1 and NOSH=1 are the defaults of
+// the corresponding flags, for compatibility with earlier versions.
+type options struct {
+	timeout   time.Duration
+	killAfter time.Duration
+	progress  time.Duration
+
+	deadlineEnv string
+
+	heartbeatFile     string
+	heartbeatInterval time.Duration
+	workDir           string
+	lines             bool
+	ts                bool
+	noShell           bool
+	setsid            bool
+	noNetwork         bool
+	hermetic          bool
+	coreDumps         string
+	strace            string
+	ltrace            string
+	maxLoad           float64
+	minMemAvailable   float64
+	onPressure        string
+	readBps           string
+	writeBps          string
+	readBpsN          int64
+	writeBpsN         int64
+	cpus              string
+	cpuList           []int
+	env               stringsFlag
+	labels            stringsFlag
+	redact            stringsFlag
+	redactRes         []*regexp.Regexp
+	secrets           stringsFlag
+	credentialHelper  string
+	credentialEnv     stringsFlag
+	credentialFD      stringsFlag
+	shell             string
+	manifest          string
+	manifestKey       string
+	versionProbe      string
+	require           stringsFlag
+	approve           bool
+	opa               string
+	webhook           string
+	notifySlack       string
+	notifyMail        string
+	approveMatch      string
+
+	json     bool
+	jsonFile string
+	dryRun   bool
+
+	interactive bool
+	pty         bool
+	grace       time.Duration
+
+	quiet       bool
+	verbose     bool
+	veryVerbose bool
+	logFormat   string
+
+	outFile      string
+	errFile      string
+	combinedFile string
+	appendFiles  bool
+	rotateSize   string
+	rotateSizeN  int64
+	rotateKeep   int
+
+	retries           int
+	retryDelay        time.Duration
+	retryOnExitCodes  string
+	retryOnExitCodesN []int
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) (*options, []string, error) {
+	o := &options{
+		timeout: gocmd.DefaultTimeout,
+		workDir: os.Getenv("WORKING_DIR"),
+		lines:   os.Getenv("LINES") == "1",
+		noShell: os.Getenv("NOSH") == "1",
+	}
+
+	if env := os.Getenv("TIMEOUT"); env != "" {
+		timeout, err := time.ParseDuration(env)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parse $TIMEOUT=%s: %w", env, err)
+		}
+		o.timeout = timeout
+	}
+
+	fs.DurationVar(&o.timeout, "t", o.timeout, "shorthand for --timeout")
+	fs.DurationVar(&o.timeout, "timeout", o.timeout, "timeout of the command, 0 for none ($TIMEOUT)")
+	fs.DurationVar(&o.killAfter, "kill-after", 0, "kill the command by SIGKILL if it did not exit this long after the SIGTERM of a timeout")
+	fs.StringVar(&o.deadlineEnv, "deadline-env", "", "export the deadline of the command to it as this env var, and the remaining milliseconds as <name>_MS")
+	fs.DurationVar(&o.progress, "progress", 0, "log the elapsed time, the time left and the output size this often while running")
+	fs.StringVar(&o.heartbeatFile, "heartbeat-file", "", "touch the file while the command is running, for liveness probes")
+	fs.DurationVar(&o.heartbeatInterval, "heartbeat-interval", 10*time.Second, "how often the --heartbeat-file is touched")
+	fs.StringVar(&o.workDir, "w", o.workDir, "shorthand for --workdir")
+	fs.StringVar(&o.workDir, "workdir", o.workDir, "working directory of the command ($WORKING_DIR)")
+	fs.BoolVar(&o.lines, "lines", o.lines, "log the stdout line by line while running ($LINES=1)")
+	fs.BoolVar(&o.ts, "ts", false, "also write the lines of stdout and stderr to stderr while running, stamped with the time since the start, like ts -s")
+	fs.BoolVar(&o.noShell, "no-shell", o.noShell, "execute the command directly instead of by a shell ($NOSH=1)")
+	fs.BoolVar(&o.setsid, "setsid", false, "run the command in a new session, detached from the terminal, like daemons")
+	fs.BoolVar(&o.noNetwork, "no-network", false, "run the command without network, in a network namespace of its own (Linux)")
+	fs.StringVar(&o.readBps, "read-bps", "", "limit the disk reads of the command to this many bytes per second, like 50M, by cgroup v2 (Linux)")
+	fs.StringVar(&o.writeBps, "write-bps", "", "limit the disk writes of the command to this many bytes per second, like 20M, by cgroup v2 (Linux)")
+	fs.Float64Var(&o.maxLoad, "max-load", 0, "pause the command while the load average per CPU is above this, see --on-pressure (Linux)")
+	fs.Float64Var(&o.minMemAvailable, "min-mem-available", 0, "pause the command while the fraction of the memory available is below this, like 0.1, see --on-pressure (Linux)")
+	fs.StringVar(&o.onPressure, "on-pressure", "pause", "what to do to the command under --max-load or --min-mem-available: pause or renice")
+	fs.StringVar(&o.coreDumps, "core-dumps", "", "enable core dumps of the command, and move the core file of a crash into the directory (Linux)")
+	fs.StringVar(&o.strace, "strace", "", "trace the system calls of the command by strace, if found, into the file")
+	fs.StringVar(&o.ltrace, "ltrace", "", "trace the library calls of the command by ltrace, if found, into the file")
+	fs.StringVar(&o.cpus, "cpus", "", "pin the command to the CPUs, like 0-3,6, like taskset -c (Linux)")
+	fs.BoolVar(&o.hermetic, "hermetic", false, "run the command in a minimal env, fixed PATH, LANG=C, TZ=UTC and umask 022, plus the --env ones")
+	fs.Var(&o.env, "env", "environment variable KEY=VAL of the command, can be repeated")
+	fs.Var(&o.labels, "label", "label KEY=VAL of the command, added to the JSON logs and result, can be repeated")
+	fs.Var(&o.redact, "redact", "mask the matches of the regexp, or its first group, in the logged command line, like 'password=(\\S+)', can be repeated")
+	fs.Var(&o.secrets, "secret", "pass the content of the file FILE over an inherited fd announced by $NAME_FD, as NAME=FILE, can be repeated")
+	fs.StringVar(&o.credentialHelper, "credential-helper", "", "command fetching the credentials of --credential-env and --credential-fd, run with the KEY appended, like 'vault kv get -field=value'")
+	fs.Var(&o.credentialEnv, "credential-env", "export the credential of KEY fetched by --credential-helper as $NAME, as NAME=KEY, can be repeated")
+	fs.Var(&o.credentialFD, "credential-fd", "pass the credential of KEY fetched by --credential-helper over an inherited fd announced by $NAME_FD, as NAME=KEY, can be repeated")
+	fs.StringVar(&o.shell, "shell", "", "shell to run the command by, like bash, sh or pwsh")
+	fs.Var(&o.require, "require", "fail before running the command unless the version of a tool satisfies the constraint, like 'git>=2.30', can be repeated")
+	fs.StringVar(&o.manifest, "manifest", "", "append the manifest of each run, the executable, its sha256, args, env digest, times and exit code, as a JSON line to the file")
+	fs.StringVar(&o.manifestKey, "manifest-key", "", "PEM PKCS #8 ed25519 private key file signing the --manifest")
+	fs.StringVar(&o.versionProbe, "version-probe", "", "arg printing the version of the executable, like --version, recorded in the --manifest")
+	fs.StringVar(&o.opa, "opa", "", "URL of the Open Policy Agent rule deciding whether and how the command runs, like http://localhost:8181/v1/data/gocmd/decision, bearer token $OPA_TOKEN")
+	fs.StringVar(&o.webhook, "webhook", "", "URL posted the JSON result of the command when it finished, signed by $WEBHOOK_SECRET if set")
+	fs.StringVar(&o.notifySlack, "notify-slack", "", "Slack incoming webhook URL notified the failure or timeout of the command, with its stderr tail")
+	fs.StringVar(&o.notifyMail, "notify-mail", "", "comma separated addresses mailed the failure or timeout of the command, by the SMTP server $SMTP_ADDR, from $SMTP_FROM, auth by $SMTP_USERNAME and $SMTP_PASSWORD if set")
+	fs.BoolVar(&o.approve, "approve", false, "print the plan of the command and ask on the terminal whether to run it")
+	fs.StringVar(&o.approveMatch, "approve-match", "", "like --approve, for the commands matching the regexp only, like '\\bdelete\\b'")
+	fs.BoolVar(&o.json, "json", false, "print a JSON result instead of logging the outputs")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "print the plan of what would run, as JSON with --json, instead of running it")
+	fs.StringVar(&o.jsonFile, "json-file", "", "write the JSON result to the file, implies --json")
+	fs.BoolVar(&o.interactive, "i", false, "shorthand for --interactive")
+	fs.BoolVar(&o.interactive, "interactive", false, "connect the command to the terminal, for editors and REPLs")
+	fs.BoolVar(&o.pty, "pty", false, "run the command with a pseudo-terminal relaying the one of gocmd, for tools refusing to run otherwise, implies --interactive, linux only")
+	fs.DurationVar(&o.grace, "grace", 10*time.Second, "time the command has to exit after a forwarded SIGINT, SIGTERM or SIGHUP before it is killed, 0 for ever")
+	fs.BoolVar(&o.quiet, "q", false, "print only the output of the command, no logs but errors")
+	fs.BoolVar(&o.verbose, "v", false, "also log the resolved command, env changes and timing")
+	fs.BoolVar(&o.veryVerbose, "vv", false, "like -v, plus the executable, args and attempts")
+	fs.StringVar(&o.logFormat, "log-format", "text", "format of the logs of gocmd: text or json")
+	fs.StringVar(&o.outFile, "out", "", "also write stdout to the file")
+	fs.StringVar(&o.errFile, "err", "", "also write stderr to the file")
+	fs.StringVar(&o.combinedFile, "combined", "", "also write stdout and stderr to the file")
+	fs.BoolVar(&o.appendFiles, "append", false, "append to the --out, --err and --combined files instead of truncating them")
+	fs.StringVar(&o.rotateSize, "rotate-size", "", "rotate the --out, --err and --combined files at this size, like 10M")
+	fs.IntVar(&o.rotateKeep, "rotate-keep", 3, "number of rotated files kept")
+	fs.IntVar(&o.retries, "retries", 0, "number of retries if the command fails or times out")
+	fs.DurationVar(&o.retryDelay, "retry-delay", time.Second, "delay between retries")
+	fs.StringVar(&o.retryOnExitCodes, "retry-on-exit-codes", "", "comma separated exit codes to retry on, any non-zero one if empty")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [flags] [--] command [args...]\n\nFlags:\n", fs.Name())
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return nil, nil, fmt.Errorf("command required")
+	}
+
+	if o.jsonFile != "" {
+		o.json = true
+	}
+	if o.pty {
+		o.interactive = true
+	}
+	if o.setsid && o.interactive {
+		return nil, nil, fmt.Errorf("--setsid detaches the command from the terminal, it can't be --interactive")
+	}
+	if o.onPressure != "pause" && o.onPressure != "renice" {
+		return nil, nil, fmt.Errorf("invalid --on-pressure %q, pause or renice expected", o.onPressure)
+	}
+	if o.logFormat != "text" && o.logFormat != "json" {
+		return nil, nil, fmt.Errorf("invalid --log-format %q, text or json expected", o.logFormat)
+	}
+
+	// editors and REPLs run as long as the user wants to, unless told otherwise
+	if o.interactive && os.Getenv("TIMEOUT") == "" && !isFlagSet(fs, "t", "timeout") {
+		o.timeout = 0
+	}
+
+	for _, code := range strings.Split(o.retryOnExitCodes, ",") {
+		if code = strings.TrimSpace(code); code == "" {
+			continue
+		}
+		n, err := strconv.Atoi(code)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid --retry-on-exit-codes %q: %w", o.retryOnExitCodes, err)
+		}
+		o.retryOnExitCodesN = append(o.retryOnExitCodesN, n)
+	}
+
+	if o.rotateSize != "" {
+		n, err := parseSize(o.rotateSize)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid --rotate-size %q: %w", o.rotateSize, err)
+		}
+		o.rotateSizeN = n
+	}
+
+	if o.readBps != "" {
+		n, err := parseSize(o.readBps)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid --read-bps %q: %w", o.readBps, err)
+		}
+		o.readBpsN = n
+	}
+
+	if o.writeBps != "" {
+		n, err := parseSize(o.writeBps)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid --write-bps %q: %w", o.writeBps, err)
+		}
+		o.writeBpsN = n
+	}
+
+	if o.cpus != "" {
+		cpus, err := parseCPUList(o.cpus)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid --cpus %q: %w", o.cpus, err)
+		}
+		o.cpuList = cpus
+	}
+
+	for _, kv := range o.env {
+		if !strings.Contains(kv, "=") {
+			return nil, nil, fmt.Errorf("invalid --env %q, KEY=VAL expected", kv)
+		}
+	}
+
+	for _, expr := range o.redact {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid --redact %q: %w", expr, err)
+		}
+		o.redactRes = append(o.redactRes, re)
+	}
+
+	for _, kv := range o.labels {
+		if !strings.Contains(kv, "=") {
+			return nil, nil, fmt.Errorf("invalid --label %q, KEY=VAL expected", kv)
+		}
+	}
+
+	for _, kv := range o.secrets {
+		if !strings.Contains(kv, "=") {
+			return nil, nil, fmt.Errorf("invalid --secret %q, NAME=FILE expected", kv)
+		}
+	}
+
+	for _, kv := range append(o.credentialEnv[:len(o.credentialEnv):len(o.credentialEnv)], o.credentialFD...) {
+		if !strings.Contains(kv, "=") {
+			return nil, nil, fmt.Errorf("invalid credential %q, NAME=KEY expected", kv)
+		}
+	}
+	if o.credentialHelper == "" && len(o.credentialEnv)+len(o.credentialFD) > 0 {
+		return nil, nil, fmt.Errorf("--credential-env and --credential-fd require --credential-helper")
+	}
+
+	for _, r := range o.require {
+		if name, _ := splitRequire(r); name == "" || name == r {
+			return nil, nil, fmt.Errorf("invalid --require %q, like git>=2.30 expected", r)
+		}
+	}
+
+	if o.strace != "" && o.ltrace != "" {
+		return nil, nil, fmt.Errorf("--strace and --ltrace can't be combined")
+	}
+
+	if o.manifest == "" && (o.manifestKey != "" || o.versionProbe != "") {
+		return nil, nil, fmt.Errorf("--manifest-key and --version-probe require --manifest")
+	}
+
+	return o, fs.Args(), nil
+}
+
+// envVars returns the --env flags as gocmd.EnvVars.
+func (o *options) envVars() gocmd.EnvVars {
+	env := gocmd.EnvVars{}
+	for _, kv := range o.env {
+		k, v, _ := strings.Cut(kv, "=")
+		env[k] = v
+	}
+	return env
+}
+
+// redactOptions returns the options of the --redact flags.
+func (o *options) redactOptions() []func(*gocmd.Cmd) {
+	var options []func(*gocmd.Cmd)
+	for _, re := range o.redactRes {
+		options = append(options, gocmd.WithRedactedPattern(re))
+	}
+	return options
+}
+
+// secretOptions returns the options of the --secret and credential flags, reading the secret files.
+func (o *options) secretOptions() ([]func(*gocmd.Cmd), error) {
+	var options []func(*gocmd.Cmd)
+	for _, kv := range o.secrets {
+		name, file, _ := strings.Cut(kv, "=")
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read --secret %s: %w", name, err)
+		}
+		options = append(options, gocmd.WithSecretFD(name, data))
+	}
+
+	if o.credentialHelper != "" {
+		p := gocmd.CommandCredentials(o.credentialHelper)
+		for _, kv := range o.credentialEnv {
+			name, key, _ := strings.Cut(kv, "=")
+			options = append(options, gocmd.WithCredentialEnv(p, name, key))
+		}
+		for _, kv := range o.credentialFD {
+			name, key, _ := strings.Cut(kv, "=")
+			options = append(options, gocmd.WithCredentialFD(p, name, key))
+		}
+	}
+	return options, nil
+}
+
+// manifestOption returns the option of the --manifest flags, nil without --manifest.
+func (o *options) manifestOption(lg *logger) (func(*gocmd.Cmd), error) {
+	if o.manifest == "" {
+		return nil, nil
+	}
+
+	var key ed25519.PrivateKey
+	if o.manifestKey != "" {
+		data, err := os.ReadFile(o.manifestKey)
+		if err != nil {
+			return nil, fmt.Errorf("read --manifest-key: %w", err)
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("--manifest-key %s: no PEM block", o.manifestKey)
+		}
+		k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("--manifest-key %s: %w", o.manifestKey, err)
+		}
+		var ok bool
+		if key, ok = k.(ed25519.PrivateKey); !ok {
+			return nil, fmt.Errorf("--manifest-key %s: %T is not an ed25519 key", o.manifestKey, k)
+		}
+	}
+
+	var versionArgs []string
+	if o.versionProbe != "" {
+		versionArgs = []string{o.versionProbe}
+	}
+	return gocmd.WithManifest(key, func(m *gocmd.Manifest) {
+		if err := appendJSONLine(o.manifest, m); err != nil {
+			lg.printf(levelQuiet, "error", fields{"error": err}, "write manifest: %v", err)
+		}
+	}, versionArgs...), nil
+}
+
+// approvalOption returns the option of --approve and --approve-match, nil without them.
+func (o *options) approvalOption() (func(*gocmd.Cmd), error) {
+	if !o.approve && o.approveMatch == "" {
+		return nil, nil
+	}
+	var patterns []*regexp.Regexp
+	if o.approveMatch != "" {
+		re, err := regexp.Compile(o.approveMatch)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --approve-match: %w", err)
+		}
+		patterns = append(patterns, re)
+	}
+
+	// the answer is read from the terminal, piped data is passed to the command
+	in := os.Stdin
+	if !isTerminal(in) {
+		tty, err := os.Open("/dev/tty")
+		if err != nil {
+			return nil, fmt.Errorf("--approve needs a terminal: %w", err)
+		}
+		in = tty
+	}
+	return gocmd.WithApproval(gocmd.PromptApproval(in, os.Stderr), patterns...), nil
+}
+
+// notifier returns the notifier of the --notify-slack and --notify-mail flags, nil if there are none.
+func (o *options) notifier() *gocmd.Notifier {
+	n := &gocmd.Notifier{OnError: func(err error) { fmt.Fprintf(os.Stderr, "warning: notify: %v\n", err) }}
+	if o.notifySlack != "" {
+		n.Transports = append(n.Transports, &gocmd.SlackTransport{URL: o.notifySlack})
+	}
+	if o.notifyMail != "" {
+		n.Transports = append(n.Transports, &gocmd.SMTPTransport{
+			Addr:     os.Getenv("SMTP_ADDR"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+			To:       strings.Split(o.notifyMail, ","),
+		})
+	}
+	if len(n.Transports) == 0 {
+		return nil
+	}
+	return n
+}
+
+// requireOptions returns the options of the --require flags.
+func (o *options) requireOptions() []func(*gocmd.Cmd) {
+	var options []func(*gocmd.Cmd)
+	for _, r := range o.require {
+		options = append(options, gocmd.WithRequiredVersion(splitRequire(r)))
+	}
+	return options
+}
+
+// splitRequire splits a --require like git>=2.30 into the tool and its version constraint.
+func splitRequire(s string) (name, constraint string) {
+	i := strings.IndexAny(s, "<>=!")
+	if i < 0 {
+		return s, ""
+	}
+	return strings.TrimSpace(s[:i]), s[i:]
+}
+
+// labelMap returns the --label flags as a map, nil if there are none.
+func (o *options) labelMap() map[string]string {
+	if len(o.labels) == 0 {
+		return nil
+	}
+	labels := map[string]string{}
+	for _, kv := range o.labels {
+		k, v, _ := strings.Cut(kv, "=")
+		labels[k] = v
+	}
+	return labels
+}
+
+// fileOptions returns the options of the --out, --err and --combined files.
+func (o *options) fileOptions() []func(*gocmd.Cmd) {
+	sinkOptions := []func(*gocmd.FileSink){gocmd.FileAppend(o.appendFiles)}
+	if o.rotateSizeN > 0 {
+		sinkOptions = append(sinkOptions, gocmd.FileRotate(o.rotateSizeN, o.rotateKeep))
+	}
+
+	var options []func(*gocmd.Cmd)
+	if o.outFile != "" {
+		options = append(options, gocmd.WithStdoutFile(o.outFile, sinkOptions...))
+	}
+	if o.errFile != "" {
+		options = append(options, gocmd.WithStderrFile(o.errFile, sinkOptions...))
+	}
+	if o.combinedFile != "" {
+		options = append(options, gocmd.WithCombinedFile(o.combinedFile, sinkOptions...))
+	}
+	return options
+}
+
+// parseSize parses a size in bytes, with an optional K, M or G suffix of powers of 1024.
+func parseSize(s string) (int64, error) {
+	num, unit := strings.TrimSuffix(strings.ToUpper(s), "B"), int64(1)
+	for i, suffix := range []string{"K", "M", "G"} {
+		if strings.HasSuffix(num, suffix) {
+			num, unit = strings.TrimSuffix(num, suffix), 1<<(10*(i+1))
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(strings.TrimSpace(num), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("size must be positive")
+	}
+	return n * unit, nil
+}
+
+// parseCPUList parses a list of CPUs like 0-3,6.
+func parseCPUList(s string) ([]int, error) {
+	var cpus []int
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		first, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(to); err != nil {
+				return nil, err
+			}
+		}
+		if last < first {
+			return nil, fmt.Errorf("invalid range %s", part)
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+func isFlagSet(fs *flag.FlagSet, names ...string) (set bool) {
+	fs.Visit(func(f *flag.Flag) {
+		for _, name := range names {
+			if f.Name == name {
+				set = true
+			}
+		}
+	})
+	return set
+}
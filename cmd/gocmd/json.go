@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+)
+
+// result is the machine-readable result printed by --json.
+type result struct {
+	Command    string                `json:"command"`
+	Labels     gocmd.Labels          `json:"labels,omitempty"`
+	Env        []string              `json:"env,omitempty"`
+	ExitCode   int                   `json:"exit_code"`
+	Duration   string                `json:"duration"`
+	DurationMs float64               `json:"duration_ms"`
+	Stdout     string                `json:"stdout"`
+	Stderr     string                `json:"stderr"`
+	TimedOut   bool                  `json:"timed_out"`
+	Attempts   int                   `json:"attempts"`
+	CoreDump   string                `json:"core_dump,omitempty"`
+	TraceFile  string                `json:"trace_file,omitempty"`
+	Approval   *gocmd.Approval       `json:"approval,omitempty"`
+	Policy     *gocmd.PolicyDecision `json:"policy,omitempty"`
+	Error      string                `json:"error,omitempty"`
+}
+
+func newResult(command string, cmd *gocmd.Cmd, duration time.Duration, err error) result {
+	r := result{
+		Command:    command,
+		Labels:     cmd.Labels(),
+		Env:        cmd.EnvDiff().Strings(),
+		ExitCode:   -1,
+		Duration:   duration.String(),
+		DurationMs: float64(duration) / float64(time.Millisecond),
+		TimedOut:   errors.Is(err, gocmd.ErrTimeout) || errors.Is(err, context.DeadlineExceeded),
+		Approval:   cmd.Approval(),
+		Policy:     cmd.PolicyDecision(),
+	}
+
+	if cmd.Executed {
+		r.ExitCode = cmd.ExitCode()
+		r.Attempts = cmd.Attempts()
+		r.Stdout = cmd.Stdout()
+		r.Stderr = cmd.Stderr()
+		r.CoreDump = cmd.CoreDump()
+		r.TraceFile = cmd.TraceFile()
+	}
+	if err != nil {
+		// the command did not exit by itself, so it has no exit code
+		r.ExitCode = -1
+		r.Error = err.Error()
+	}
+
+	return r
+}
+
+// writeJSON writes the result to the file, or to stdout if file is empty or "-".
+func writeJSON(file string, r result) error {
+	out := os.Stdout
+	if file != "" && file != "-" {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(r)
+}
+
+// appendJSONLine appends v to the file as a line of JSON.
+func appendJSONLine(file string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// log levels of the wrapper logs, -q shows errors only, -v and -vv show more.
+const (
+	levelQuiet = iota - 1
+	levelInfo
+	levelVerbose
+	levelDebug
+)
+
+// fields are the structured data of a log line, printed by --log-format json only.
+type fields map[string]interface{}
+
+// logger writes the logs of gocmd about the command, as text like the standard
+// logger or as JSON lines.
+type logger struct {
+	level  int
+	json   bool
+	out    io.Writer
+	labels map[string]string // of the command, added to every JSON line
+}
+
+func newLogger(o *options) *logger {
+	l := &logger{level: levelInfo, json: o.logFormat == "json", out: os.Stderr, labels: o.labelMap()}
+	switch {
+	case o.quiet:
+		l.level = levelQuiet
+	case o.veryVerbose:
+		l.level = levelDebug
+	case o.verbose:
+		l.level = levelVerbose
+	}
+	return l
+}
+
+func (l *logger) infof(f fields, format string, args ...interface{}) {
+	l.printf(levelInfo, "info", f, format, args...)
+}
+
+func (l *logger) verbosef(f fields, format string, args ...interface{}) {
+	l.printf(levelVerbose, "info", f, format, args...)
+}
+
+func (l *logger) debugf(f fields, format string, args ...interface{}) {
+	l.printf(levelDebug, "debug", f, format, args...)
+}
+
+// fatalf logs the error, even with -q, and exits with 1.
+func (l *logger) fatalf(f fields, format string, args ...interface{}) {
+	l.printf(levelQuiet, "error", f, format, args...)
+	os.Exit(1)
+}
+
+func (l *logger) printf(level int, name string, f fields, format string, args ...interface{}) {
+	if level > l.level {
+		return
+	}
+
+	msg := fmt.Sprintf(format, args...)
+	if !l.json {
+		fmt.Fprintf(l.out, "%s %s\n", time.Now().Format("2006/01/02 15:04:05"), msg)
+		return
+	}
+
+	line := map[string]interface{}{}
+	for k, v := range f {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		line[k] = v
+	}
+	if len(l.labels) > 0 {
+		line["labels"] = l.labels
+	}
+	line["time"] = time.Now().Format(time.RFC3339Nano)
+	line["level"] = name
+	line["msg"] = msg
+
+	b, err := json.Marshal(line)
+	if err != nil {
+		b, _ = json.Marshal(map[string]string{"level": "error", "msg": err.Error()})
+	}
+	_, _ = l.out.Write(append(b, '\n'))
+}
@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"strings"
 	"time"
 
 	"github.com/bingoohuang/gocmd"
@@ -13,51 +15,302 @@ import (
 	"github.com/bingoohuang/gocmd/shellquote"
 )
 
+// subcommands of gocmd, a command of the same name is run by gocmd -- name.
+var subcommands = map[string]func(args []string){
+	"batch":  runBatch,
+	"cron":   runCron,
+	"each":   runEach,
+	"run":    runPreset,
+	"record": runRecord,
+	"replay": runReplay,
+	"serve":  runServe,
+	"ssh":    runSSH,
+}
+
 func main() {
-	flag.Parse()
-	args := flag.Args()
+	if len(os.Args) > 1 {
+		if sub, ok := subcommands[os.Args[1]]; ok {
+			sub(os.Args[2:])
+			return
+		}
+	}
+
+	runCommand(os.Args[1:])
+}
 
-	var (
-		err     error
-		timeout time.Duration
-	)
+func runCommand(argv []string) {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	o, args, err := parseFlags(fs, argv)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+	lg := newLogger(o)
 
-	var options []func(*gocmd.Cmd)
-	if env := os.Getenv("TIMEOUT"); env != "" {
-		timeout, err = time.ParseDuration(env)
-		if err != nil {
-			log.Fatalf("parse $TIMEOUT=%s: %v", env, err)
-		}
-		options = append(options, gocmd.WithTimeout(timeout))
+	options := []func(*gocmd.Cmd){
+		gocmd.WithTimeout(o.timeout),
+		gocmd.WithKillAfter(o.killAfter),
+	}
+
+	if o.workDir != "" {
+		options = append(options, gocmd.WithWorkingDir(o.workDir))
+	}
+
+	if o.hermetic {
+		options = append(options, gocmd.WithHermetic())
+	}
+	if len(o.env) > 0 {
+		options = append(options, gocmd.WithEnv(o.envVars()))
+	}
+
+	if labels := o.labelMap(); labels != nil {
+		options = append(options, gocmd.WithLabels(labels))
+	}
+
+	options = append(options, o.fileOptions()...)
+	options = append(options, o.redactOptions()...)
+	options = append(options, o.requireOptions()...)
+
+	secretOptions, err := o.secretOptions()
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+	options = append(options, secretOptions...)
+
+	if o.deadlineEnv != "" {
+		options = append(options, gocmd.WithDeadlineEnv(o.deadlineEnv))
+	}
+
+	manifestOption, err := o.manifestOption(lg)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+	if manifestOption != nil {
+		options = append(options, manifestOption)
+	}
+
+	if o.opa != "" {
+		options = append(options, gocmd.WithPolicy(&gocmd.OPAPolicy{URL: o.opa, Token: os.Getenv("OPA_TOKEN")}))
+	}
+	if o.webhook != "" {
+		options = append(options, gocmd.WithWebhook(o.webhook, gocmd.WebhookSecret(os.Getenv("WEBHOOK_SECRET")),
+			gocmd.WebhookOnError(func(err error) { log.Printf("warning: %v", err) })))
+	}
+	if n := o.notifier(); n != nil {
+		options = append(options, gocmd.WithNotifier(n))
+	}
+	approvalOption, err := o.approvalOption()
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+	if approvalOption != nil {
+		options = append(options, approvalOption)
+	}
+
+	if o.heartbeatFile != "" {
+		options = append(options, gocmd.WithHeartbeatFile(o.heartbeatInterval, o.heartbeatFile))
+	}
+
+	if o.progress > 0 {
+		options = append(options, gocmd.WithProgress(o.progress, func(p gocmd.ProgressInfo) {
+			if p.Done {
+				return
+			}
+			left := "no timeout"
+			if p.Remaining >= 0 {
+				left = p.Remaining.Round(100*time.Millisecond).String() + " left"
+			}
+			f := fields{"elapsed": p.Elapsed.String(), "remaining": p.Remaining.String(),
+				"stdout_bytes": p.StdoutBytes, "stderr_bytes": p.StderrBytes,
+				"stdout_lines": p.StdoutLines, "stderr_lines": p.StderrLines}
+			stats := ""
+			if s := p.Stats; s != nil {
+				f["cpu_percent"], f["cpu_time"], f["rss_bytes"] = s.CPUPercent, s.CPUTime.String(), s.RSSBytes
+				f["read_bytes"], f["write_bytes"] = s.ReadBytes, s.WriteBytes
+				stats = fmt.Sprintf(", %.0f%% CPU, %d bytes read, %d bytes written", s.CPUPercent, s.ReadBytes, s.WriteBytes)
+			}
+			lg.infof(f, "running %s, %s, %d stdout lines, %d stderr lines%s",
+				p.Elapsed.Round(100*time.Millisecond), left, p.StdoutLines, p.StderrLines, stats)
+		}), gocmd.WithProcessStats(o.progress))
 	}
 
-	if env := os.Getenv("WORKING_DIR"); env != "" {
-		options = append(options, gocmd.WithWorkingDir(env))
+	if o.retries > 0 {
+		options = append(options, gocmd.WithRetry(gocmd.RetryPolicy{
+			Retries:     o.retries,
+			Delay:       o.retryDelay,
+			OnExitCodes: o.retryOnExitCodesN,
+			OnAttempt: func(attempt, exitCode int, err error) {
+				f := fields{"attempt": attempt, "attempts": o.retries + 1, "exit_code": exitCode, "error": err}
+				if err != nil {
+					lg.infof(f, "attempt %d/%d failed: %v, retrying in %s", attempt, o.retries+1, err, o.retryDelay)
+				} else {
+					lg.infof(f, "attempt %d/%d failed with exit code %d, retrying in %s", attempt, o.retries+1, exitCode, o.retryDelay)
+				}
+			},
+		}))
 	}
 
-	if env := os.Getenv("LINES"); env == "1" {
+	if o.ts {
+		options = append(options, gocmd.WithAnnotatedOutput(os.Stderr, gocmd.AnnotateRelative()))
+	}
+	if o.lines && !o.quiet {
 		options = append(options, gocmd.WithStdout(linestream.New(func(line string) {
-			log.Printf("line: %s", line)
+			lg.infof(fields{"line": line}, "line: %s", line)
 		})))
 	}
 
-	shell := shellquote.QuoteMust(args...)
-
-	if env := os.Getenv("NOSH"); env == "1" {
-		shell = ""
+	var shell string
+	switch {
+	case o.noShell:
 		options = append(options, gocmd.WithCmd(exec.Command(args[0], args[1:]...)))
+	case o.shell != "":
+		shell, err = shellquote.QuoteDialect(shellquote.DialectOf(o.shell), args...)
+		options = append(options, gocmd.WithShell(o.shell))
+	default:
+		shell, err = gocmd.Quote(args...)
+	}
+	if err != nil {
+		lg.fatalf(fields{"error": err}, "quote the command: %v", err)
 	}
 
-	if shell != "" {
-		log.Printf("shell: %q", shell)
+	switch {
+	case o.pty:
+		options = append(options, ptyOptions()...)
+	case o.interactive:
+		options = append(options, gocmd.WithInheritedStdio())
+	case o.quiet && !o.json:
+		options = append(options, gocmd.WithStdStreams())
+	}
+	if o.setsid {
+		options = append(options, gocmd.WithSetsid(true))
+	}
+	if o.readBpsN > 0 || o.writeBpsN > 0 {
+		options = append(options, gocmd.WithIOThrottle(o.readBpsN, o.writeBpsN))
+	}
+	var governor *gocmd.Governor
+	if o.maxLoad > 0 || o.minMemAvailable > 0 {
+		governor = &gocmd.Governor{MaxLoad: o.maxLoad, MinMemAvailable: o.minMemAvailable}
+		action := "pausing"
+		if o.onPressure == "renice" {
+			governor.Action, action = gocmd.Renice, "renicing"
+		}
+		governor.OnChange = func(pressured bool, load gocmd.HostLoad) {
+			f := fields{"load1": load.Load1, "cpus": load.CPUs, "mem_available": load.MemAvailable, "mem_total": load.MemTotal}
+			if pressured {
+				lg.infof(f, "host under pressure, %s the command", action)
+			} else {
+				lg.infof(f, "host pressure subsided, resuming the command")
+			}
+		}
+		options = append(options, gocmd.WithGovernor(governor))
+	}
+	if o.noNetwork {
+		options = append(options, gocmd.WithNoNetwork())
+	}
+	if o.strace != "" {
+		options = append(options, gocmd.WithTraceSyscalls(o.strace))
+	}
+	if o.ltrace != "" {
+		options = append(options, gocmd.WithTraceLibraryCalls(o.ltrace))
+	}
+	if o.coreDumps != "" {
+		options = append(options, gocmd.WithCoreDumps(&gocmd.CoreDumps{Dir: o.coreDumps}))
+	}
+	if len(o.cpuList) > 0 {
+		options = append(options, gocmd.WithCPUAffinity(o.cpuList...))
+	}
+	if !o.interactive && !isTerminal(os.Stdin) {
+		// pass piped data through, a terminal is left alone, the command
+		// would be stopped reading it from its own process group
+		options = append(options, gocmd.WithStdin(os.Stdin))
 	}
 
 	cmd := gocmd.New(shell, options...)
-	if err := cmd.Run(context.TODO()); err != nil {
-		log.Fatalf("error: %v", err)
+	if o.dryRun {
+		printPlan(cmd.Plan(), o.json)
+		return
+	}
+	if shell != "" && !o.json {
+		lg.infof(fields{"shell": cmd.Redacted()}, "shell: %q", cmd.Redacted())
+	}
+	lg.verbosef(fields{"workdir": cmd.WorkingDir, "timeout": o.timeout.String()},
+		"workdir: %q, timeout: %s", cmd.WorkingDir, o.timeout)
+	if diff := cmd.EnvDiff().Strings(); len(diff) > 0 {
+		lg.verbosef(fields{"env": diff}, "env: %s", strings.Join(diff, " "))
+	}
+	if len(o.redactRes) == 0 {
+		lg.debugf(fields{"path": cmd.Cmd.Path, "args": cmd.Cmd.Args}, "exec: %s %q", cmd.Cmd.Path, cmd.Cmd.Args)
+	} else {
+		lg.debugf(fields{"path": cmd.Cmd.Path}, "exec: %s", cmd.Cmd.Path)
+	}
+
+	if governor != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			if err := governor.Run(ctx); err != nil && ctx.Err() == nil {
+				lg.printf(levelQuiet, "error", fields{"error": err}, "governor: %v", err)
+			}
+		}()
+	}
+
+	restoreTerminal := func() {}
+	if o.pty {
+		restoreTerminal = attachPTY(lg, cmd)
+	}
+	stopForwarding := forwardSignals(lg, cmd, o.grace, o.interactive)
+	start := time.Now()
+	err = cmd.Run(context.TODO())
+	duration := time.Since(start)
+	stopForwarding()
+	restoreTerminal()
+	if cmd.Executed {
+		lg.verbosef(fields{"duration": duration.String(), "duration_ms": float64(duration) / float64(time.Millisecond), "exit_code": cmd.ExitCode()},
+			"duration: %s, exitCode: %d", duration.Round(time.Millisecond), cmd.ExitCode())
+		// the process state is nil when the output was not waited for, after a timeout or cancel
+		pid := 0
+		if cmd.Cmd.Process != nil {
+			pid = cmd.Cmd.Process.Pid
+		}
+		lg.debugf(fields{"attempts": cmd.Attempts(), "pid": pid},
+			"attempts: %d, pid: %d", cmd.Attempts(), pid)
+	}
+
+	if o.json {
+		if err := writeJSON(o.jsonFile, newResult(cmd.Redacted(), cmd, duration, err)); err != nil {
+			lg.fatalf(fields{"error": err}, "write json: %v", err)
+		}
+		if err != nil {
+			os.Exit(1)
+		}
+		return
 	}
 
-	log.Printf("stdout: %s", cmd.Stdout())
-	log.Printf("stderr: %s", cmd.Stderr())
-	log.Printf("exitCode: %d", cmd.ExitCode())
+	if err != nil {
+		lg.fatalf(fields{"error": err, "duration_ms": float64(duration) / float64(time.Millisecond)}, "error: %v", err)
+	}
+
+	code, signaled := exitCode(cmd)
+	if o.interactive || o.quiet {
+		os.Exit(code)
+	}
+
+	lg.infof(fields{"stdout": cmd.Stdout()}, "stdout: %s", cmd.Stdout())
+	lg.infof(fields{"stderr": cmd.Stderr()}, "stderr: %s", cmd.Stderr())
+	lg.infof(fields{"exit_code": cmd.ExitCode()}, "exitCode: %d", cmd.ExitCode())
+	if core := cmd.CoreDump(); core != "" {
+		lg.infof(fields{"core_dump": core}, "core dumped: %s", core)
+	}
+	if trace := cmd.TraceFile(); trace != "" {
+		lg.infof(fields{"trace_file": trace}, "trace: %s", trace)
+	} else if o.strace != "" || o.ltrace != "" {
+		lg.infof(fields{}, "trace: strace or ltrace not found, the command was not traced")
+	}
+	if signaled {
+		os.Exit(code)
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/bingoohuang/gocmd"
+)
+
+// ptyOptions run the command with a pseudo-terminal of --pty, connected to
+// the stdin and stdout of gocmd.
+func ptyOptions() []func(*gocmd.Cmd) {
+	return []func(*gocmd.Cmd){gocmd.WithPTY(), gocmd.WithStdin(os.Stdin), gocmd.WithStdout(os.Stdout)}
+}
+
+// attachPTY puts the terminal of gocmd, if stdin is one, in raw mode, so
+// that the keys, like Ctrl-C, go to the terminal of the command, whose size
+// follows the one of the terminal. The returned func restores the terminal.
+func attachPTY(lg *logger, cmd *gocmd.Cmd) (restore func()) {
+	if !isTerminal(os.Stdin) {
+		return func() {}
+	}
+
+	resize := func() {
+		var rows, cols uint16
+		size, err := stty("size")
+		if err == nil {
+			_, err = fmt.Sscan(size, &rows, &cols)
+		}
+		if err == nil {
+			err = cmd.SetWinsize(rows, cols)
+		}
+		if err != nil {
+			lg.verbosef(fields{"error": err}, "resize the terminal: %v", err)
+		}
+	}
+	resize()
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	go func() {
+		for range winch {
+			resize()
+		}
+	}()
+
+	old, err := stty("-g")
+	if err == nil {
+		_, err = stty("raw", "-echo")
+	}
+	if err != nil {
+		lg.infof(fields{"error": err}, "raw mode of the terminal: %v", err)
+		old = ""
+	}
+
+	return func() {
+		signal.Stop(winch)
+		close(winch)
+		if old != "" {
+			_, _ = stty(strings.TrimSpace(old))
+		}
+	}
+}
+
+// stty runs stty on the terminal of stdin.
+func stty(args ...string) (string, error) {
+	c := exec.Command("stty", args...)
+	c.Stdin = os.Stdin
+	out, err := c.Output()
+	return string(out), err
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+)
+
+// session is a recorded run of a command, written by gocmd record and re-rendered by gocmd replay.
+type session struct {
+	Command    string    `json:"command"`
+	Start      time.Time `json:"start"`
+	DurationMs float64   `json:"duration_ms"`
+	ExitCode   int       `json:"exit_code"`
+	Error      string    `json:"error,omitempty"`
+	Events     []event   `json:"events"`
+}
+
+// event is a chunk of output of a session, at Ms milliseconds after its start.
+type event struct {
+	Ms     float64 `json:"ms"`
+	Stream string  `json:"stream"` // stdout or stderr
+	Data   string  `json:"data"`
+}
+
+// recorder collects the events of a session, it is written by the stdout and stderr goroutines.
+type recorder struct {
+	mu     sync.Mutex
+	start  time.Time
+	events []event
+}
+
+func (r *recorder) writer(stream string, out io.Writer) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		r.mu.Lock()
+		r.events = append(r.events, event{
+			Ms:     float64(time.Since(r.start)) / float64(time.Millisecond),
+			Stream: stream,
+			Data:   string(p),
+		})
+		r.mu.Unlock()
+		return out.Write(p)
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+func runRecord(argv []string) {
+	fs := flag.NewFlagSet(os.Args[0]+" record", flag.ExitOnError)
+	output := fs.String("o", "session.json", "file to write the session to")
+	timeout := fs.Duration("t", gocmd.DefaultTimeout, "timeout of the command, 0 for none")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [flags] -- command...\n\nFlags:\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(argv)
+
+	args := fs.Args()
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	command, err := gocmd.Quote(args...)
+	if err != nil {
+		log.Fatalf("quote %q: %v", args, err)
+	}
+
+	r := &recorder{start: time.Now()}
+	cmd := gocmd.New(command,
+		gocmd.WithTimeout(*timeout),
+		gocmd.WithStdout(r.writer("stdout", os.Stdout)),
+		gocmd.WithStderr(r.writer("stderr", os.Stderr)),
+	)
+	err = cmd.Run(context.TODO())
+
+	s := session{
+		Command:    command,
+		Start:      r.start,
+		DurationMs: float64(time.Since(r.start)) / float64(time.Millisecond),
+		Events:     r.events,
+	}
+	if err != nil {
+		// the command did not start, or did not exit by itself, so it has no exit code
+		s.ExitCode = -1
+		s.Error = err.Error()
+	} else if cmd.Executed {
+		s.ExitCode = cmd.ExitCode()
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		log.Fatalf("write session: %v", err)
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		log.Fatalf("write session: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatalf("write session: %v", err)
+	}
+	log.Printf("recorded %q, exit code %d, to %s", command, s.ExitCode, *output)
+}
+
+func runReplay(argv []string) {
+	fs := flag.NewFlagSet(os.Args[0]+" replay", flag.ExitOnError)
+	speed := fs.String("speed", "1x", "replay speed, like 2x or 0.5x, 0 for no delays")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [flags] session.json\n\nFlags:\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(argv)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	factor, err := strconv.ParseFloat(strings.TrimSuffix(*speed, "x"), 64)
+	if err != nil || factor < 0 {
+		log.Fatalf("invalid speed %q", *speed)
+	}
+
+	b, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("read session: %v", err)
+	}
+	var s session
+	if err := json.Unmarshal(b, &s); err != nil {
+		log.Fatalf("parse session %s: %v", fs.Arg(0), err)
+	}
+
+	log.Printf("replaying %q recorded at %s", s.Command, s.Start.Format(time.RFC3339))
+	start := time.Now()
+	for _, e := range s.Events {
+		if factor > 0 {
+			time.Sleep(time.Until(start.Add(time.Duration(e.Ms / factor * float64(time.Millisecond)))))
+		}
+		out := os.Stdout
+		if e.Stream == "stderr" {
+			out = os.Stderr
+		}
+		_, _ = io.WriteString(out, e.Data)
+	}
+
+	if s.Error != "" {
+		log.Printf("error: %s", s.Error)
+	}
+	log.Printf("exitCode: %d, duration: %s", s.ExitCode, time.Duration(s.DurationMs*float64(time.Millisecond)).Round(time.Millisecond))
+	switch {
+	case s.ExitCode > 0:
+		os.Exit(s.ExitCode)
+	case s.ExitCode < 0:
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bingoohuang/gocmd"
+)
+
+func runPreset(argv []string) {
+	fs := flag.NewFlagSet(os.Args[0]+" run", flag.ExitOnError)
+	file := fs.String("config", configFile(), "config file of the presets")
+	dryRun := fs.Bool("dry-run", false, "print the command instead of running it")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [flags] <preset> [args...]\n\nFlags:\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(argv)
+
+	c, err := loadConfig(*file)
+	if err != nil {
+		log.Fatalf("load config: %v", err)
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		printPresets(fs.Output(), c)
+		os.Exit(2)
+	}
+
+	name, args := fs.Arg(0), fs.Args()[1:]
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	p, ok := c.Presets[name]
+	if !ok {
+		log.Fatalf("preset %s not found in %s", name, *file)
+	}
+
+	command, err := p.command(name, args)
+	if err != nil {
+		log.Fatalf("preset %s: %v", name, err)
+	}
+	if *dryRun {
+		fmt.Println(command)
+		return
+	}
+
+	options := []func(*gocmd.Cmd){gocmd.WithStdStreams()}
+	if p.Timeout != nil {
+		options = append(options, gocmd.WithTimeout(*p.Timeout))
+	}
+	if p.Workdir != "" {
+		options = append(options, gocmd.WithWorkingDir(expandHome(p.Workdir)))
+	}
+	if len(p.Env) > 0 {
+		options = append(options, gocmd.WithEnv(p.Env))
+	}
+	if p.Retries > 0 {
+		options = append(options, gocmd.WithRetry(gocmd.RetryPolicy{
+			Retries: p.Retries,
+			Delay:   p.RetryDelay,
+			OnAttempt: func(attempt, exitCode int, err error) {
+				log.Printf("attempt %d/%d failed (exit code %d, error %v), retrying in %s", attempt, p.Retries+1, exitCode, err, p.RetryDelay)
+			},
+		}))
+	}
+	if !isTerminal(os.Stdin) {
+		options = append(options, gocmd.WithStdin(os.Stdin))
+	}
+
+	cmd := gocmd.New(command, options...)
+	if err := cmd.Run(context.TODO()); err != nil {
+		log.Fatalf("error: %v", err)
+	}
+	os.Exit(cmd.ExitCode())
+}
+
+func printPresets(w io.Writer, c *config) {
+	if len(c.Presets) == 0 {
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nPRESET\tDESCRIPTION")
+	for _, name := range c.presetNames() {
+		fmt.Fprintf(tw, "%s\t%s\n", name, c.Presets[name].Description)
+	}
+	_ = tw.Flush()
+}
+
+// expandHome expands a leading ~/ of the path to the home directory.
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
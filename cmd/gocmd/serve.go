@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/bingoohuang/gocmd/cron"
+	"github.com/bingoohuang/gocmd/server"
+	"gopkg.in/yaml.v3"
+)
+
+func runServe(argv []string) {
+	fs := flag.NewFlagSet(os.Args[0]+" serve", flag.ExitOnError)
+	listen := fs.String("listen", ":8080", "address to listen on")
+	allow := fs.String("allow", "", "comma separated executables jobs may run, like git,kubectl, matched exactly, any if empty")
+	allowEnv := fs.String("allow-env", "", "comma separated env vars jobs may set with --allow, like GIT_DIR, none if empty")
+	tokenFile := fs.String("token-file", "", "file of the bearer token required by requests")
+	parallel := fs.Int("P", runtime.NumCPU(), "maximum number of jobs running at the same time")
+	timeout := fs.Duration("t", gocmd.DefaultTimeout, "timeout of jobs not specifying one")
+	logURL := fs.String("log-url", "", "endpoint the output lines of jobs are posted to as JSON batches")
+	logS3 := fs.String("log-s3", "", "s3://bucket/prefix the gzipped output of jobs is uploaded to, by the AWS_ env credentials")
+	limitLabel := fs.String("limit-label", "tenant", "label of the jobs whose values --rate and --concurrency are counted per")
+	rate := fs.Int("rate", 0, "maximum number of jobs submitted per minute per --limit-label value, 0 for no limit")
+	concurrency := fs.Int("concurrency", 0, "maximum number of jobs queued or running per --limit-label value, 0 for no limit")
+	retainAge := fs.Duration("retain-age", 0, "delete the jobs finished for longer, like 24h, 0 to keep them")
+	retainSize := fs.String("retain-size", "", "delete the oldest finished jobs while the logs of all jobs take more, like 512M")
+	retainPerLabel := fs.String("retain-per-label", "", "comma separated label=N keeping the newest N finished jobs per value of the label, like tenant=100")
+	s3Endpoint := fs.String("s3-endpoint", "", "endpoint of --log-s3, like http://minio:9000, the one of AWS_REGION if empty")
+	maxQueued := fs.Int("max-queued", 0, "answer GET /readyz by 503 while more jobs are queued, 0 for always ready")
+	configPath := fs.String("config", "", "YAML file of the allow list, timeout, token file, OPA policy, presets and schedules, overriding the flags, reloaded on SIGHUP")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [flags]\n\nFlags:\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(argv)
+
+	base := serveConfig{Timeout: timeout, TokenFile: *tokenFile}
+	if *allow != "" {
+		base.Allow = strings.Split(*allow, ",")
+	}
+	if *allowEnv != "" {
+		base.AllowEnv = strings.Split(*allowEnv, ",")
+	}
+	options, err := base.load(*configPath)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+	if *maxQueued > 0 {
+		options = append(options, server.WithMaxQueued(*maxQueued))
+	}
+	if *rate > 0 || *concurrency > 0 {
+		options = append(options, server.WithLimiter(&gocmd.Limiter{Label: *limitLabel, PerMinute: *rate, Concurrent: *concurrency}))
+	}
+	if *retainAge > 0 || *retainSize != "" || *retainPerLabel != "" {
+		r := server.Retention{MaxAge: *retainAge}
+		if *retainSize != "" {
+			n, err := parseSize(*retainSize)
+			if err != nil {
+				log.Fatalf("error: invalid --retain-size %q: %v", *retainSize, err)
+			}
+			r.MaxBytes = n
+		}
+		if *retainPerLabel != "" {
+			r.MaxPerLabel = map[string]int{}
+			for _, p := range strings.Split(*retainPerLabel, ",") {
+				k, v, _ := strings.Cut(p, "=")
+				n, err := strconv.Atoi(v)
+				if k == "" || err != nil || n < 0 {
+					log.Fatalf("error: invalid --retain-per-label %q, expected label=N", p)
+				}
+				r.MaxPerLabel[k] = n
+			}
+		}
+		options = append(options, server.WithRetention(r, time.Minute))
+	}
+	if *logURL != "" {
+		options = append(options, server.WithLogURL(*logURL))
+	}
+	if *logS3 != "" {
+		location, ok := strings.CutPrefix(*logS3, "s3://")
+		bucket, prefix, _ := strings.Cut(location, "/")
+		if !ok || bucket == "" {
+			log.Fatalf("error: invalid --log-s3 %q, expected s3://bucket/prefix", *logS3)
+		}
+		region := os.Getenv("AWS_REGION")
+		if region == "" {
+			region = "us-east-1"
+		}
+		endpoint := *s3Endpoint
+		if endpoint == "" {
+			endpoint = "https://s3." + region + ".amazonaws.com"
+		}
+		options = append(options, server.WithLogObject(func(id string) *gocmd.S3Sink {
+			s := gocmd.NewS3Sink(endpoint, bucket, path.Join(prefix, id+".log.gz"), gocmd.S3Region(region),
+				gocmd.S3Credentials(os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")))
+			s.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+			return s
+		}))
+	}
+
+	s := server.New(*parallel, options...)
+	if s.Token == "" {
+		log.Printf("warning: no --token-file, anyone reaching %s can run commands", *listen)
+	}
+	go reloadOnHangup(s, base, *configPath)
+
+	log.Printf("listening on %s", *listen)
+	log.Fatal(http.ListenAndServe(*listen, s))
+}
+
+// serveConfig is the --config file of gocmd serve, the settings which can be
+// reloaded on SIGHUP, like
+//
+//	allow: [git, kubectl, ./backup.sh]
+//	allow_env: [GIT_DIR]
+//	timeout: 5m
+//	token_file: /etc/gocmd/token
+//	opa: http://localhost:8181/v1/data/gocmd/decision
+//	presets:
+//	  backup: {command: ./backup.sh, timeout: 1h}
+//	schedules:
+//	  - name: nightly
+//	    spec: "0 2 * * *"
+//	    job: {preset: backup, args: [db1]}
+type serveConfig struct {
+	Allow     []string       `yaml:"allow"`
+	AllowEnv  []string       `yaml:"allow_env"`
+	Timeout   *time.Duration `yaml:"timeout"`
+	TokenFile string         `yaml:"token_file"`
+	// OPA is the URL of the Open Policy Agent rule evaluated on the jobs, bearer token $OPA_TOKEN.
+	OPA       string                   `yaml:"opa"`
+	Presets   map[string]server.Preset `yaml:"presets"`
+	Schedules []server.Schedule        `yaml:"schedules"`
+}
+
+// load returns the server options of the settings, the ones of the file
+// overriding the ones of c, the flags, if file is not empty. The token file is
+// read again.
+func (c serveConfig) load(file string) ([]func(*server.Server), error) {
+	if file != "" {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var f serveConfig
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		if err := dec.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("parse %s: %w", file, err)
+		}
+		if f.Allow != nil {
+			c.Allow = f.Allow
+		}
+		if f.AllowEnv != nil {
+			c.AllowEnv = f.AllowEnv
+		}
+		if f.Timeout != nil {
+			c.Timeout = f.Timeout
+		}
+		if f.TokenFile != "" {
+			c.TokenFile = f.TokenFile
+		}
+		if f.OPA != "" {
+			c.OPA = f.OPA
+		}
+		if err := f.checkSchedules(); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", file, err)
+		}
+		c.Presets, c.Schedules = f.Presets, f.Schedules
+	}
+
+	var token string
+	if c.TokenFile != "" {
+		b, err := os.ReadFile(c.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("read token file: %w", err)
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	var policy gocmd.Policy
+	if c.OPA != "" {
+		policy = &gocmd.OPAPolicy{URL: c.OPA, Token: os.Getenv("OPA_TOKEN")}
+	}
+	return []func(*server.Server){
+		server.WithAllow(c.Allow...),
+		server.WithAllowEnv(c.AllowEnv...),
+		server.WithTimeout(*c.Timeout),
+		server.WithToken(token),
+		server.WithPolicy(policy),
+		server.WithPresets(c.Presets),
+		server.WithSchedules(c.Schedules...),
+	}, nil
+}
+
+// checkSchedules checks the schedules have unique names, valid specs and known presets.
+func (c serveConfig) checkSchedules() error {
+	names := map[string]bool{}
+	for _, sc := range c.Schedules {
+		if sc.Name == "" {
+			return errors.New("schedule name required")
+		}
+		if names[sc.Name] {
+			return fmt.Errorf("schedule %s: duplicate name", sc.Name)
+		}
+		names[sc.Name] = true
+		if _, err := cron.Parse(sc.Spec); err != nil {
+			return fmt.Errorf("schedule %s: %w", sc.Name, err)
+		}
+		if _, ok := c.Presets[sc.Job.Preset]; sc.Job.Preset != "" && !ok {
+			return fmt.Errorf("schedule %s: unknown preset %s", sc.Name, sc.Job.Preset)
+		}
+	}
+	return nil
+}
+
+// reloadOnHangup reloads the settings of the server on SIGHUP, the queued and
+// running jobs are not affected. An invalid config keeps the current settings.
+func reloadOnHangup(s *server.Server, base serveConfig, file string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		options, err := base.load(file)
+		if err != nil {
+			log.Printf("reload: %v, keeping the current settings", err)
+			continue
+		}
+		changes := s.Reload(options...)
+		if len(changes) == 0 {
+			log.Printf("reloaded, no changes")
+		}
+		for _, change := range changes {
+			log.Printf("reloaded %s", change)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+)
+
+// forwardSignals forwards SIGINT, SIGTERM and SIGHUP received by gocmd to the
+// process group of the command, like a shell does to its foreground job, and
+// kills the group if the command did not exit grace after the first signal.
+// The returned func stops forwarding.
+func forwardSignals(lg *logger, cmd *gocmd.Cmd, grace time.Duration, interactive bool) (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	go func() {
+		var kill *time.Timer
+		for sig := range sigs {
+			// an interactive command is in the foreground process group of the
+			// terminal, which delivered Ctrl-C to it already
+			if interactive && sig == syscall.SIGINT {
+				continue
+			}
+
+			lg.verbosef(fields{"signal": sig.String()}, "forwarding %s", sig)
+			if err := cmd.Signal(sig); err != nil && !errors.Is(err, gocmd.ErrNotRunning) {
+				lg.infof(fields{"signal": sig.String(), "error": err}, "forward %s: %v", sig, err)
+			}
+			// a command paused by --max-load handles the signal once continued, like jobs killed by shells
+			_ = cmd.Signal(syscall.SIGCONT)
+
+			if kill == nil && grace > 0 {
+				first := sig
+				kill = time.AfterFunc(grace, func() {
+					lg.infof(fields{"grace": grace.String()}, "command did not exit %s after %s, killing it", grace, first)
+					_ = cmd.Signal(syscall.SIGKILL)
+				})
+			}
+		}
+		if kill != nil {
+			kill.Stop()
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigs)
+		close(sigs)
+	}
+}
+
+// exitCode returns the exit code of the command for gocmd to exit with,
+// 128 plus the signal number if it was killed by a signal, like shells do.
+func exitCode(cmd *gocmd.Cmd) (code int, signaled bool) {
+	if ps := cmd.Cmd.ProcessState; ps != nil {
+		if ws, ok := ps.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			return 128 + int(ws.Signal()), true
+		}
+	}
+	return cmd.ExitCode(), false
+}
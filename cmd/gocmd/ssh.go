@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/bingoohuang/gocmd/ssh"
+)
+
+func runSSH(argv []string) {
+	fs := flag.NewFlagSet(os.Args[0]+" ssh", flag.ExitOnError)
+	parallel := fs.Int("P", 10, "maximum number of hosts running the command at the same time")
+	timeout := fs.Duration("t", gocmd.DefaultTimeout, "timeout of the command on each host, 0 for none")
+	connectTimeout := fs.Duration("connect-timeout", 10*time.Second, "timeout of connecting to each host")
+	identity := fs.String("i", "", "private key file to authenticate with")
+	var sshOptions stringsFlag
+	fs.Var(&sshOptions, "o", "ssh option, like StrictHostKeyChecking=no, can be repeated")
+	jump := fs.String("J", "", "bastions to connect through, like ops@bastion1,bastion2:2222")
+	forwardAgent := fs.Bool("A", false, "forward the ssh-agent to the hosts")
+	hostKey := fs.String("host-key", "config", "host key verification: config, strict, or tofu to trust new hosts on first use")
+	knownHosts := fs.String("known-hosts", "", "known hosts file verifying the host keys")
+	halt := fs.Bool("halt-on-error", false, "do not start on further hosts after one failed")
+	inventory := fs.String("inventory", "", "file of the hosts, one per line, instead of the hosts argument")
+	maxFailures := fs.String("max-failures", "", "do not start on further hosts once more hosts failed, a number or a percentage like 20%")
+	noColor := fs.Bool("no-color", !isTerminal(os.Stdout), "do not colorize the output prefixes")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [flags] [user@]host[:port][,host2,...] -- command...\n", fs.Name())
+		fmt.Fprintf(fs.Output(), "       %s --inventory FILE [flags] -- command...\n\nFlags:\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(argv)
+
+	args := fs.Args()
+	var inv ssh.Inventory
+	if *inventory != "" {
+		inv = ssh.FileInventory(*inventory)
+	} else if len(args) > 0 {
+		hosts, err := ssh.ParseHosts(args[0])
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+		if len(hosts) == 0 {
+			log.Fatalf("error: no hosts")
+		}
+		inv, args = ssh.StaticInventory(hosts), args[1:]
+	}
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if inv == nil || len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	jumps, err := ssh.ParseHosts(*jump)
+	if err != nil {
+		log.Fatalf("error: -J: %v", err)
+	}
+	policy, err := ssh.ParseHostKeyPolicy(*hostKey)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
+	// like ssh, the words of the command are joined by spaces and interpreted by the remote shell
+	command := strings.Join(args, " ")
+	f := &ssh.FanOut{
+		Executor: ssh.Executor{
+			ConnectTimeout: *connectTimeout,
+			IdentityFile:   *identity,
+			Jump:           jumps,
+			ForwardAgent:   *forwardAgent,
+			HostKeyPolicy:  policy,
+			KnownHosts:     *knownHosts,
+			Options:        sshOptions,
+		},
+		Inventory:   inv,
+		Parallel:    *parallel,
+		Options:     []func(*gocmd.Cmd){gocmd.WithTimeout(*timeout)},
+		Output:      os.Stdout,
+		NoColor:     *noColor,
+		HaltOnError: *halt,
+	}
+	if *maxFailures != "" {
+		var err error
+		if percent, ok := strings.CutSuffix(*maxFailures, "%"); ok {
+			f.MaxFailureRatio, err = strconv.ParseFloat(percent, 64)
+			f.MaxFailureRatio /= 100
+		} else {
+			f.MaxFailures, err = strconv.Atoi(*maxFailures)
+		}
+		if err != nil || f.MaxFailures < 0 || f.MaxFailureRatio < 0 {
+			log.Fatalf("error: invalid --max-failures %q", *maxFailures)
+		}
+	}
+
+	report, err := f.Run(context.TODO(), command)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+	commands := make([]string, len(report.Hosts))
+	for i := range commands {
+		commands[i] = command
+	}
+	failed := printSummary(os.Stdout, commands, report.Results)
+	fmt.Println(report)
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+)
+
+// tuiLogLines is the number of last lines of a command kept for its log view.
+const tuiLogLines = 1000
+
+var spinner = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// tui is the --tui dashboard of batch and each, with a row per command showing
+// a spinner, the elapsed time, the status and the last line of output.
+// A row can be focused to view its scrolling log.
+//
+// Keys are read from the terminal in cbreak mode by stty: up/down or k/j
+// select a row, enter or l focuses it, esc, q or h goes back. Without stty,
+// the number of a row and enter focuses it, a blank line goes back.
+type tui struct {
+	mu     sync.Mutex
+	out    io.Writer
+	title  string
+	rows   []*tuiRow
+	byCmd  map[*gocmd.Cmd]*tuiRow
+	cursor int
+	focus  int // the focused row, -1 for the overview
+	frame  int
+	width  int
+	height int
+
+	tty     *os.File
+	sttyOld string // stty settings to restore, if cbreak mode is on
+	stopped chan struct{}
+	done    chan struct{}
+}
+
+type tuiRow struct {
+	name, command string
+	start, end    time.Time
+	status        string // empty while queued or running
+	failed        bool
+	log           []tuiLine
+}
+
+type tuiLine struct {
+	text   string
+	stderr bool
+}
+
+// tuiStream is the gocmd.LineSink of the stdout or stderr of a row.
+type tuiStream struct {
+	t      *tui
+	r      *tuiRow
+	stderr bool
+}
+
+func (s *tuiStream) Start() error { return nil }
+func (s *tuiStream) Close() error { return nil }
+
+func (s *tuiStream) WriteLine(line string) error {
+	s.t.appendLine(s.r, line, s.stderr)
+	return nil
+}
+
+// newTUI creates a dashboard of the jobs, whose output it captures too.
+// The jobs are run by the batch, on which it sets OnStart, OnDone and OnSkip.
+func newTUI(title string, b *gocmd.Batch, jobs []gocmd.BatchJob, commands []string) *tui {
+	t := &tui{
+		out:     os.Stdout,
+		title:   title,
+		byCmd:   map[*gocmd.Cmd]*tuiRow{},
+		focus:   -1,
+		width:   80,
+		height:  24,
+		stopped: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	for i, job := range jobs {
+		r := &tuiRow{name: job.Name, command: commands[i]}
+		// alongside the writers of the options of the command
+		gocmd.WithStdoutSink(gocmd.Lines(&tuiStream{t: t, r: r}))(job.Cmd)
+		gocmd.WithStderrSink(gocmd.Lines(&tuiStream{t: t, r: r, stderr: true}))(job.Cmd)
+		t.rows = append(t.rows, r)
+		t.byCmd[job.Cmd] = r
+	}
+
+	b.Output = nil
+	b.OnStart = t.started
+	b.OnDone = t.finished
+	b.OnSkip = t.skipped
+	return t
+}
+
+func (t *tui) appendLine(r *tuiRow, line string, stderr bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r.log = append(r.log, tuiLine{text: strings.TrimRight(line, "\r"), stderr: stderr})
+	if len(r.log) > tuiLogLines {
+		r.log = append(r.log[:0], r.log[len(r.log)-tuiLogLines:]...)
+	}
+}
+
+func (t *tui) started(job gocmd.BatchJob) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.byCmd[job.Cmd].start = time.Now()
+}
+
+// finished marks the row of the job done, the sinks of its output, which
+// write its last lines, are closed before.
+func (t *tui) finished(res gocmd.BatchResult) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r := t.byCmd[res.Cmd]
+	r.end = time.Now()
+	r.failed = res.Failed()
+	switch {
+	case res.Err != nil:
+		r.status = "error: " + res.Err.Error()
+	case res.ExitCode != 0:
+		r.status = "exit " + strconv.Itoa(res.ExitCode)
+	default:
+		r.status = "ok"
+	}
+}
+
+// skipped marks the row of the job skipped, like once the batch halted on an error.
+func (t *tui) skipped(job gocmd.BatchJob) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.byCmd[job.Cmd].status = "skipped"
+}
+
+// start switches to the alternate screen and starts rendering,
+// an interrupt cancels the batch by cancel.
+func (t *tui) start(cancel context.CancelFunc) {
+	fmt.Fprint(t.out, "\x1b[?1049h\x1b[?25l")
+
+	if tty, err := os.Open("/dev/tty"); err == nil {
+		t.tty = tty
+		if old, err := t.stty("-g"); err == nil {
+			if _, err := t.stty("-icanon", "-echo", "min", "1"); err == nil {
+				t.sttyOld = strings.TrimSpace(old)
+			}
+		}
+		go t.readKeys()
+	}
+	t.resize()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(sig)
+		select {
+		case <-sig:
+			cancel()
+		case <-t.stopped:
+		}
+	}()
+
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.stopped:
+				return
+			case <-ticker.C:
+				t.mu.Lock()
+				t.frame++
+				frame := t.frame
+				t.mu.Unlock()
+				if frame%10 == 0 {
+					t.resize()
+				}
+				t.render()
+			}
+		}
+	}()
+}
+
+// stop stops rendering, restores the terminal and leaves the alternate screen.
+func (t *tui) stop() {
+	close(t.stopped)
+	<-t.done
+
+	if t.sttyOld != "" {
+		_, _ = t.stty(t.sttyOld)
+	}
+	fmt.Fprint(t.out, "\x1b[?25h\x1b[?1049l")
+}
+
+func (t *tui) stty(args ...string) (string, error) {
+	c := exec.Command("stty", args...)
+	c.Stdin = t.tty
+	out, err := c.Output()
+	return string(out), err
+}
+
+func (t *tui) resize() {
+	if t.tty == nil {
+		return
+	}
+	s, err := t.stty("size")
+	if err != nil {
+		return
+	}
+
+	var height, width int
+	if _, err := fmt.Sscan(s, &height, &width); err == nil && height > 0 && width > 0 {
+		t.mu.Lock()
+		t.height, t.width = height, width
+		t.mu.Unlock()
+	}
+}
+
+func (t *tui) readKeys() {
+	if t.sttyOld == "" {
+		scanner := bufio.NewScanner(t.tty)
+		for scanner.Scan() {
+			n, err := strconv.Atoi(strings.TrimSpace(scanner.Text()))
+			t.mu.Lock()
+			if err == nil && n >= 1 && n <= len(t.rows) {
+				t.cursor, t.focus = n-1, n-1
+			} else {
+				t.focus = -1
+			}
+			t.mu.Unlock()
+		}
+		return
+	}
+
+	buf := make([]byte, 16)
+	for {
+		n, err := t.tty.Read(buf)
+		if err != nil {
+			return
+		}
+		t.key(string(buf[:n]))
+		t.render()
+	}
+}
+
+func (t *tui) key(k string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch k {
+	case "k", "\x1b[A":
+		if t.cursor > 0 {
+			t.cursor--
+		}
+	case "j", "\x1b[B":
+		if t.cursor < len(t.rows)-1 {
+			t.cursor++
+		}
+	case "\n", "\r", "l", "\x1b[C":
+		t.focus = t.cursor
+	case "\x1b", "q", "h", "\x1b[D":
+		t.focus = -1
+	}
+	if t.focus >= 0 {
+		t.focus = t.cursor
+	}
+}
+
+func (t *tui) render() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var lines []string
+	if t.focus >= 0 {
+		lines = t.renderLog(t.rows[t.focus])
+	} else {
+		lines = t.renderOverview()
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(line)
+		b.WriteString("\x1b[K")
+	}
+	b.WriteString("\x1b[J")
+	_, _ = io.WriteString(t.out, b.String())
+}
+
+func (t *tui) renderOverview() []string {
+	var running, done, failed int
+	nameWidth := 4
+	for _, r := range t.rows {
+		switch {
+		case r.status != "":
+			done++
+		case !r.start.IsZero():
+			running++
+		}
+		if r.failed {
+			failed++
+		}
+		if n := len([]rune(r.name)); n > nameWidth {
+			nameWidth = n
+		}
+	}
+
+	lines := []string{
+		t.header(fmt.Sprintf("%s  %d/%d done, %d running, %d failed", t.title, done, len(t.rows), running, failed),
+			"↑/↓ select, enter log, ctrl-c cancel"),
+	}
+
+	// scroll to keep the cursor visible
+	visible := t.height - 1
+	first := 0
+	if t.cursor >= visible {
+		first = t.cursor - visible + 1
+	}
+	for i := first; i < len(t.rows) && i < first+visible; i++ {
+		r := t.rows[i]
+		icon, status, last := "·", "queued", ""
+		switch {
+		case r.status != "" && r.failed:
+			icon, status = "\x1b[31m✘\x1b[0m", "\x1b[31m"+r.status+"\x1b[0m"
+		case r.status != "":
+			icon, status = "\x1b[32m✔\x1b[0m", "\x1b[32m"+r.status+"\x1b[0m"
+		case !r.start.IsZero():
+			icon, status = "\x1b[36m"+spinner[t.frame%len(spinner)]+"\x1b[0m", "running"
+		}
+		if len(r.log) > 0 {
+			last = r.log[len(r.log)-1].text
+		}
+
+		cursor := "  "
+		if i == t.cursor {
+			cursor = "\x1b[1m›\x1b[0m "
+		}
+		lines = append(lines, fmt.Sprintf("%s%s %-*s %8s  %s  %s", cursor, icon, nameWidth, r.name,
+			elapsed(r.start, r.end), status, truncate(last, t.width-nameWidth-32)))
+	}
+	return lines
+}
+
+func (t *tui) renderLog(r *tuiRow) []string {
+	status := r.status
+	if status == "" && !r.start.IsZero() {
+		status = "running"
+	} else if status == "" {
+		status = "queued"
+	}
+
+	lines := []string{
+		t.header(fmt.Sprintf("%s  %s  %s  %s", r.name, status, elapsed(r.start, r.end), r.command), "esc back"),
+	}
+
+	log := r.log
+	if visible := t.height - 1; len(log) > visible {
+		log = log[len(log)-visible:]
+	}
+	for _, l := range log {
+		text := truncate(l.text, t.width)
+		if l.stderr {
+			text = "\x1b[31m" + text + "\x1b[0m"
+		}
+		lines = append(lines, text)
+	}
+	return lines
+}
+
+func (t *tui) header(left, right string) string {
+	pad := t.width - len([]rune(left)) - len([]rune(right))
+	if pad < 1 {
+		return "\x1b[1m" + truncate(left, t.width) + "\x1b[0m"
+	}
+	return "\x1b[1m" + left + "\x1b[0m" + strings.Repeat(" ", pad) + "\x1b[2m" + right + "\x1b[0m"
+}
+
+func elapsed(start, end time.Time) string {
+	switch {
+	case start.IsZero():
+		return "-"
+	case end.IsZero():
+		return time.Since(start).Round(100 * time.Millisecond).String()
+	default:
+		return end.Sub(start).Round(100 * time.Millisecond).String()
+	}
+}
+
+var ansiRe = regexp.MustCompile(`\x1b\[[0-9;?]*[a-zA-Z]`)
+
+// truncate shortens s to at most n runes, dropping escape sequences and
+// control characters of the output which would break the layout.
+func truncate(s string, n int) string {
+	if n < 1 {
+		return ""
+	}
+
+	s = strings.ReplaceAll(ansiRe.ReplaceAllString(s, ""), "\t", "    ")
+	r := []rune(strings.Map(func(r rune) rune {
+		if r < ' ' {
+			return -1
+		}
+		return r
+	}, s))
+	if len(r) <= n {
+		return string(r)
+	}
+	return string(r[:n-1]) + "…"
+}
@@ -3,12 +3,24 @@
 package gocmd
 
 import (
+	"os"
 	"os/exec"
 	"syscall"
 )
 
+// defaultShell is the shell commands are run by.
+const defaultShell = "/bin/bash"
+
 func createBaseCommand(c *Cmd) *exec.Cmd {
-	return exec.Command("/bin/bash", "-c", c.Command)
+	return exec.Command(defaultShell, "-c", c.Command)
+}
+
+// commandUser returns the user the command is run as.
+func commandUser(cmd *exec.Cmd) *PolicyUser {
+	if cmd.SysProcAttr != nil && cmd.SysProcAttr.Credential != nil {
+		return &PolicyUser{Uid: int(cmd.SysProcAttr.Credential.Uid), Gid: int(cmd.SysProcAttr.Credential.Gid)}
+	}
+	return &PolicyUser{Uid: os.Getuid(), Gid: os.Getgid()}
 }
 
 // WithUser allows the command to be run as a different
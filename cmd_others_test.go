@@ -8,10 +8,12 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/bingoohuang/gocmd"
+	"github.com/bingoohuang/gocmd/shellquote"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -113,6 +115,23 @@ func TestWithCustomStderr(t *testing.T) {
 	assertEqualWithLineBreak(t, "StderrBuf\nStdoutBuf", c.Combined())
 }
 
+func TestCombinedByLines(t *testing.T) {
+	c := gocmd.New("printf ab; sleep 0.01; echo x >&2; sleep 0.01; echo c; printf y >&2; sleep 0.01; printf z")
+	assert.Nil(t, c.Run(context.TODO()))
+
+	// the unterminated last lines are separate lines, in the order they arrived
+	assert.Equal(t, "x\nabc\ny\nz", c.Combined())
+}
+
+func TestWithoutCombined(t *testing.T) {
+	c := gocmd.New("echo out; echo err >&2", gocmd.WithoutCombined())
+	assert.Nil(t, c.Run(context.TODO()))
+
+	assert.Equal(t, "out\n", c.Stdout())
+	assert.Equal(t, "err\n", c.Stderr())
+	assert.Equal(t, "", c.Combined())
+}
+
 func TestWithCustomStdout(t *testing.T) {
 	writer := bytes.Buffer{}
 	c := gocmd.New(">&2 echo StderrBuf; sleep 0.01; echo StdoutBuf;", gocmd.WithStdout(&writer))
@@ -124,6 +143,31 @@ func TestWithCustomStdout(t *testing.T) {
 	assertEqualWithLineBreak(t, "StderrBuf\nStdoutBuf", c.Combined())
 }
 
+func TestWithStdin(t *testing.T) {
+	c := gocmd.New("grep -c error", gocmd.WithStdin(strings.NewReader("error 1\nok\nerror 2\n")))
+	assert.Nil(t, c.Run(context.TODO()))
+	assertEqualWithLineBreak(t, "2", c.Stdout())
+}
+
+func TestCommand_StdinPipe(t *testing.T) {
+	c := gocmd.New("read password; echo \"got $password\"; cat")
+	stdin, err := c.StdinPipe()
+	assert.Nil(t, err)
+	_, err = c.StdinPipe()
+	assert.NotNil(t, err)
+
+	done := make(chan error)
+	go func() { done <- c.Run(context.TODO()) }()
+	_, err = stdin.Write([]byte("secret\nmore\n"))
+	assert.Nil(t, err)
+	assert.Nil(t, stdin.Close())
+	assert.Nil(t, <-done)
+	assert.Equal(t, "got secret\nmore\n", c.Stdout())
+
+	_, err = c.StdinPipe()
+	assert.NotNil(t, err)
+}
+
 func TestWithEnvironmentVariables(t *testing.T) {
 	c := gocmd.New("echo $Env", gocmd.WithEnv(map[string]string{"Env": "value"}))
 	c.Run(context.TODO())
@@ -183,3 +227,104 @@ func TestCommand_WithValidTimeout(t *testing.T) {
 
 	assert.Nil(t, err)
 }
+
+func TestQuote(t *testing.T) {
+	sh, err := gocmd.Quote("echo", "it's $HOME", "*")
+	assert.Nil(t, err)
+
+	c := gocmd.New(sh)
+	assert.Equal(t, shellquote.POSIX, c.Dialect())
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, "it's $HOME *\n", c.Stdout())
+
+	c = gocmd.New("", gocmd.WithCmd(exec.Command("pwsh", "-Command")))
+	assert.Equal(t, shellquote.PowerShell, c.Dialect())
+}
+
+func TestCommand_WithShell(t *testing.T) {
+	c := gocmd.New("echo $0", gocmd.WithShell("sh"))
+	err := c.Run(context.TODO())
+
+	assert.Nil(t, err)
+	assert.Equal(t, "sh\n", c.Stdout())
+}
+
+func TestCommand_WithoutSetpgidTimeout(t *testing.T) {
+	c := gocmd.New("sleep 3", gocmd.WithSetpgid(false), gocmd.WithTimeout(100*time.Millisecond))
+	err := c.Run(context.TODO())
+
+	assert.ErrorIs(t, err, gocmd.ErrTimeout)
+}
+
+func TestCommand_Signal(t *testing.T) {
+	c := gocmd.New(`trap 'echo got HUP; exit 7' HUP; echo ready; while true; do sleep 0.01; done`)
+	assert.ErrorIs(t, c.Signal(syscall.SIGHUP), gocmd.ErrNotRunning)
+
+	done := make(chan error, 1)
+	go func() { done <- c.Run(context.TODO()) }()
+
+	// wait for the trap to be set
+	for i := 0; i < 100 && c.Signal(syscall.Signal(0)) != nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.Nil(t, c.Signal(syscall.SIGHUP))
+
+	assert.Nil(t, <-done)
+	assert.Equal(t, 7, c.ExitCode())
+	assert.Equal(t, "ready\ngot HUP\n", c.Stdout())
+	assert.ErrorIs(t, c.Signal(syscall.SIGHUP), gocmd.ErrNotRunning)
+}
+
+func TestCommand_WithKillAfter(t *testing.T) {
+	c := gocmd.New(`trap '' TERM; while true; do sleep 0.01; done`,
+		gocmd.WithTimeout(100*time.Millisecond), gocmd.WithKillAfter(100*time.Millisecond))
+
+	start := time.Now()
+	err := c.Run(context.TODO())
+	assert.ErrorIs(t, err, gocmd.ErrTimeout)
+	assert.True(t, time.Since(start) >= 200*time.Millisecond)
+
+	ws := c.Cmd.ProcessState.Sys().(syscall.WaitStatus)
+	assert.True(t, ws.Signaled())
+	assert.Equal(t, syscall.SIGKILL, ws.Signal())
+}
+
+func TestCommand_Cancel(t *testing.T) {
+	c := gocmd.New("sleep 5", gocmd.WithRetry(gocmd.RetryPolicy{Retries: 3}))
+	assert.ErrorIs(t, c.Cancel("by user"), gocmd.ErrNotRunning)
+
+	go func() {
+		for !c.Status().Running {
+			time.Sleep(10 * time.Millisecond)
+		}
+		_ = c.Cancel("idle timeout")
+		_ = c.Cancel("by policy")
+	}()
+
+	start := time.Now()
+	err := c.Run(context.TODO())
+	assert.ErrorIs(t, err, gocmd.ErrCanceled)
+	assert.Equal(t, "canceled: idle timeout", err.Error())
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.Equal(t, "idle timeout", c.Status().StopReason)
+	assert.Equal(t, 1, c.Attempts())
+
+	c = gocmd.New("sleep 1", gocmd.WithTimeout(50*time.Millisecond))
+	assert.ErrorIs(t, c.Run(context.TODO()), gocmd.ErrTimeout)
+	assert.Equal(t, "timeout", c.Status().StopReason)
+}
+
+func TestCommand_WithSetsid(t *testing.T) {
+	c := gocmd.New("ps -o sid= -p $$; echo $$", gocmd.WithSetsid(true))
+	assert.Nil(t, c.Run(context.TODO()))
+	ids := strings.Fields(c.Stdout())
+	assert.Len(t, ids, 2)
+	assert.Equal(t, ids[1], ids[0], "the shell leads its session")
+
+	// the timeout signals the process group of the session leader
+	c = gocmd.New("sleep 3 & wait", gocmd.WithSetsid(true), gocmd.WithTimeout(100*time.Millisecond))
+	start := time.Now()
+	assert.ErrorIs(t, c.Run(context.TODO()), gocmd.ErrTimeout)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
@@ -31,6 +31,22 @@ func TestCommand_Execute(t *testing.T) {
 	assertEqualWithLineBreak(t, "hello", c.Stdout())
 }
 
+func TestCommand_StdoutBytes(t *testing.T) {
+	c := gocmd.New("echo hello")
+	assert.Nil(t, c.Run(context.TODO()))
+
+	assertEqualWithLineBreak(t, "hello", string(c.StdoutBytes()))
+	assert.Equal(t, len(c.Stdout()), c.StdoutLen())
+	assert.Equal(t, 0, c.StderrLen())
+
+	var buf bytes.Buffer
+	n, err := c.WriteStdoutTo(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(c.StdoutLen()), n)
+	assert.Equal(t, c.Stdout(), buf.String())
+	assert.Equal(t, c.Stdout(), string(c.StdoutBytes()))
+}
+
 func TestCommand_ExitCode(t *testing.T) {
 	c := gocmd.New("exit 120")
 
@@ -5,8 +5,16 @@ import (
 	"syscall"
 )
 
+// defaultShell is the shell commands are run by.
+const defaultShell = `cmd.exe`
+
 func createBaseCommand(c *Cmd) *exec.Cmd {
-	return exec.Command(`cmd.exe`, "/C", c.Command)
+	return exec.Command(defaultShell, "/C", c.Command)
+}
+
+// commandUser returns the user the command is run as, unknown on Windows.
+func commandUser(*exec.Cmd) *PolicyUser {
+	return nil
 }
 
 // WithUser allows the command to be run as a different
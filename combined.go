@@ -0,0 +1,86 @@
+package gocmd
+
+import (
+	"bytes"
+	"sync"
+)
+
+// streams of the output
+const (
+	stdoutStream = iota
+	stderrStream
+)
+
+// maxPendingLine is the length above which an unterminated line is written to
+// CombinedBuf as it is, so that a stream without line endings does not use
+// memory without bounds.
+const maxPendingLine = 64 << 10
+
+// combinedLines keeps the unterminated lines of stdout and stderr until they
+// are completed, so that the lines of CombinedBuf are not split by the writes
+// of the other stream.
+type combinedLines struct {
+	mu      sync.Mutex
+	pending [2][]byte
+	// since tells the arrival order of the pending lines, by the seq of their first write
+	since [2]uint64
+	seq   uint64
+}
+
+// combinedWriter writes a stream to CombinedBuf by whole lines.
+type combinedWriter struct {
+	c      *Cmd
+	stream int
+}
+
+func (w *combinedWriter) Write(p []byte) (int, error) {
+	if w.c.noCombined {
+		return len(p), nil
+	}
+
+	l := &w.c.combined
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// the pending line starts by this write if there was none, or it was completed
+	starts := len(l.pending[w.stream]) == 0
+	pending := append(l.pending[w.stream], p...)
+	if i := bytes.LastIndexByte(pending, '\n'); i >= 0 {
+		_, _ = w.c.writeBuffer(&w.c.CombinedBuf, pending[:i+1])
+		pending = append(pending[:0], pending[i+1:]...)
+		starts = true
+	}
+	if len(pending) > maxPendingLine {
+		_, _ = w.c.writeBuffer(&w.c.CombinedBuf, pending)
+		pending = pending[:0]
+	}
+	if starts {
+		l.seq++
+		l.since[w.stream] = l.seq
+	}
+	l.pending[w.stream] = pending
+	return len(p), nil
+}
+
+// flushCombined writes the unterminated last lines to CombinedBuf, in the
+// order they started arriving, as separate lines.
+func (c *Cmd) flushCombined() {
+	l := &c.combined
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	order := []int{stdoutStream, stderrStream}
+	if l.since[stderrStream] < l.since[stdoutStream] {
+		order = []int{stderrStream, stdoutStream}
+	}
+	sep := false
+	for _, i := range order {
+		if pending := l.pending[i]; len(pending) > 0 {
+			if sep {
+				_, _ = c.writeBuffer(&c.CombinedBuf, []byte{'\n'})
+			}
+			_, _ = c.writeBuffer(&c.CombinedBuf, pending)
+			l.pending[i], sep = pending[:0], true
+		}
+	}
+}
@@ -0,0 +1,224 @@
+// Package container runs gocmd commands in containers by the docker CLI, or a
+// compatible one like podman, building or pulling their image first, with the
+// working directory mounted, a one-call hermetic execution environment.
+//
+//	e := container.Env{Dockerfile: "ci/Dockerfile", Workdir: "."}
+//	c, err := e.Run(ctx, "make test", gocmd.WithTimeout(10*time.Minute))
+//	fmt.Println(c.ExitCode(), c.Stdout())
+package container
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bingoohuang/gocmd"
+)
+
+// Mount is a bind mount of a container.
+type Mount struct {
+	Source   string // on the host
+	Target   string // in the container
+	ReadOnly bool
+}
+
+// WorkdirTarget is where Env.Workdir is mounted in the container, and the working directory of the commands.
+const WorkdirTarget = "/work"
+
+// Env is a container environment, its image is built from Dockerfile if not
+// empty, else pulled if missing, by the first Prepare or Run which succeeds.
+type Env struct {
+	// Engine is the container CLI, "docker" if empty, like "podman".
+	Engine string
+	// Image is the image to run, the tag of the built image if Dockerfile is
+	// not empty, "gocmd-" and a hash of the Dockerfile and its context if empty.
+	Image string
+	// Dockerfile, if not empty, is the Dockerfile the image is built from.
+	Dockerfile string
+	// BuildContext is the build context, the directory of the Dockerfile if empty.
+	BuildContext string
+	// Pull pulls Image even if it is present, for a moving tag like latest.
+	Pull bool
+	// Workdir, if not empty, is the directory mounted at WorkdirTarget, the
+	// working directory of the commands.
+	Workdir string
+	Mounts  []Mount
+	// User is the user of the commands, like "1000:1000", the one of the image if empty.
+	User string
+	// Network is the network of the container, like "none", the default one if empty.
+	Network string
+	// Shell runs the commands, "sh" if empty.
+	Shell string
+
+	mu    sync.Mutex
+	image string // once prepared
+}
+
+func (e *Env) engine() string {
+	if e.Engine == "" {
+		return "docker"
+	}
+	return e.Engine
+}
+
+// Prepare builds or pulls the image, unless it was already, and returns it.
+func (e *Env) Prepare(ctx context.Context) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.image == "" {
+		image, err := e.prepare(ctx)
+		if err != nil {
+			return "", err
+		}
+		e.image = image
+	}
+	return e.image, nil
+}
+
+func (e *Env) prepare(ctx context.Context) (string, error) {
+	if e.Dockerfile != "" {
+		image := e.Image
+		if image == "" {
+			tag, err := e.buildTag()
+			if err != nil {
+				return "", err
+			}
+			image = tag
+		}
+		build := gocmd.New("", gocmd.WithCmd(exec.Command(e.engine(), "build", "-t", image, "-f", e.Dockerfile, e.buildContext())),
+			gocmd.WithTimeout(0))
+		if err := succeed(ctx, build); err != nil {
+			return "", fmt.Errorf("build %s: %w", image, err)
+		}
+		return image, nil
+	}
+
+	if e.Image == "" {
+		return "", fmt.Errorf("image or dockerfile required")
+	}
+	if !e.Pull {
+		inspect := gocmd.New("", gocmd.WithCmd(exec.Command(e.engine(), "image", "inspect", e.Image)))
+		if err := succeed(ctx, inspect); err == nil {
+			return e.Image, nil
+		}
+	}
+	pull := gocmd.New("", gocmd.WithCmd(exec.Command(e.engine(), "pull", e.Image)), gocmd.WithTimeout(0))
+	if err := succeed(ctx, pull); err != nil {
+		return "", fmt.Errorf("pull %s: %w", e.Image, err)
+	}
+	return e.Image, nil
+}
+
+// buildTag returns the tag of the image built from the Dockerfile, by a hash
+// of its content and of the path of its context.
+func (e *Env) buildTag() (string, error) {
+	dockerfile, err := os.ReadFile(e.Dockerfile)
+	if err != nil {
+		return "", err
+	}
+	buildContext, err := filepath.Abs(e.buildContext())
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	h.Write(dockerfile)
+	h.Write([]byte(buildContext))
+	return "gocmd-" + hex.EncodeToString(h.Sum(nil))[:12], nil
+}
+
+func (e *Env) buildContext() string {
+	if e.BuildContext == "" {
+		return filepath.Dir(e.Dockerfile)
+	}
+	return e.BuildContext
+}
+
+// Args returns the arguments of the engine running the command in a container of the image.
+func (e *Env) Args(image, name, command string) ([]string, error) {
+	args := []string{"run", "--rm", "-i", "--init", "--name", name}
+	if e.Workdir != "" {
+		dir, err := filepath.Abs(e.Workdir)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "-v", dir+":"+WorkdirTarget, "-w", WorkdirTarget)
+	}
+	for _, m := range e.Mounts {
+		source, err := filepath.Abs(m.Source)
+		if err != nil {
+			return nil, err
+		}
+		v := source + ":" + m.Target
+		if m.ReadOnly {
+			v += ":ro"
+		}
+		args = append(args, "-v", v)
+	}
+	if e.User != "" {
+		args = append(args, "--user", e.User)
+	}
+	if e.Network != "" {
+		args = append(args, "--network", e.Network)
+	}
+	shell := e.Shell
+	if shell == "" {
+		shell = "sh"
+	}
+	return append(args, image, shell, "-c", command), nil
+}
+
+// Run prepares the image, and runs the command in a container of it, removed
+// once it exited. The signals stopping the command, like by its timeout, are
+// proxied to the container by the engine, which is removed by force if the
+// command did not exit by itself. It returns the command, nil if the image
+// could not be prepared, and the error of its Run.
+func (e *Env) Run(ctx context.Context, command string, options ...func(*gocmd.Cmd)) (*gocmd.Cmd, error) {
+	image, err := e.Prepare(ctx)
+	if err != nil {
+		return nil, err
+	}
+	name, err := containerName()
+	if err != nil {
+		return nil, err
+	}
+	args, err := e.Args(image, name, command)
+	if err != nil {
+		return nil, err
+	}
+
+	c := gocmd.New("", append([]func(*gocmd.Cmd){gocmd.WithCmd(exec.Command(e.engine(), args...))}, options...)...)
+	if err := c.Run(ctx); err != nil {
+		// even if ctx is done
+		_ = gocmd.New("", gocmd.WithCmd(exec.Command(e.engine(), "rm", "-f", name))).Run(context.Background())
+		return c, err
+	}
+	return c, nil
+}
+
+func containerName() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "gocmd-" + hex.EncodeToString(b), nil
+}
+
+// succeed runs the command, a non-zero exit code is an error with its stderr.
+func succeed(ctx context.Context, c *gocmd.Cmd) error {
+	if err := c.Run(ctx); err != nil {
+		return err
+	}
+	if code := c.ExitCode(); code != 0 {
+		return fmt.Errorf("exit code %d: %s", code, strings.TrimSpace(c.Stderr()))
+	}
+	return nil
+}
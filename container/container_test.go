@@ -0,0 +1,75 @@
+//go:build !windows
+
+package container_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/gocmd/container"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDocker writes a fake docker logging its arguments, which has no images
+// and runs the commands locally.
+func fakeDocker(t *testing.T, dir string) (engine, log string) {
+	log = filepath.Join(dir, "log")
+	engine = filepath.Join(dir, "docker")
+	script := `#!/bin/sh
+echo "$@" >> ` + log + `
+case "$1" in
+image) exit 1;;
+run) eval last=\${$#}; exec sh -c "$last";;
+esac
+`
+	assert.Nil(t, os.WriteFile(engine, []byte(script), 0o755))
+	return engine, log
+}
+
+func TestEnvPull(t *testing.T) {
+	dir := t.TempDir()
+	engine, log := fakeDocker(t, dir)
+
+	e := container.Env{Engine: engine, Image: "alpine:3", Workdir: dir, Network: "none",
+		Mounts: []container.Mount{{Source: "/etc/hosts", Target: "/etc/hosts", ReadOnly: true}}}
+	c, err := e.Run(context.TODO(), "echo hello; exit 2")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, c.ExitCode())
+	assert.Equal(t, "hello\n", c.Stdout())
+
+	// the image is prepared once
+	_, err = e.Run(context.TODO(), "true")
+	assert.Nil(t, err)
+
+	lines := readLines(t, log)
+	assert.Len(t, lines, 4)
+	assert.Equal(t, "image inspect alpine:3", lines[0])
+	assert.Equal(t, "pull alpine:3", lines[1])
+	assert.Regexp(t, `^run --rm -i --init --name gocmd-[0-9a-f]{12} -v `+dir+`:/work -w /work `+
+		`-v /etc/hosts:/etc/hosts:ro --network none alpine:3 sh -c echo hello; exit 2$`, lines[2])
+}
+
+func TestEnvBuild(t *testing.T) {
+	dir := t.TempDir()
+	engine, log := fakeDocker(t, dir)
+	dockerfile := filepath.Join(dir, "Dockerfile")
+	assert.Nil(t, os.WriteFile(dockerfile, []byte("FROM alpine:3\n"), 0o644))
+
+	e := container.Env{Engine: engine, Dockerfile: dockerfile}
+	image, err := e.Prepare(context.TODO())
+	assert.Nil(t, err)
+	assert.Regexp(t, `^gocmd-[0-9a-f]{12}$`, image)
+	assert.Equal(t, []string{"build -t " + image + " -f " + dockerfile + " " + dir}, readLines(t, log))
+
+	_, err = (&container.Env{Engine: engine}).Prepare(context.TODO())
+	assert.Error(t, err)
+}
+
+func readLines(t *testing.T, path string) []string {
+	b, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	return strings.Split(strings.TrimSpace(string(b)), "\n")
+}
@@ -0,0 +1,167 @@
+package gocmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// CoreDumps collects the core dumps of the crashes of a command, see WithCoreDumps.
+type CoreDumps struct {
+	// Dir is the directory the core files are moved into, they are left
+	// where the kernel wrote them if empty.
+	Dir string
+	// SetPattern sets the core pattern of the kernel to Dir/core.%e.%p.%t
+	// before the command is started, which is system wide and needs root.
+	SetPattern bool
+}
+
+// WithCoreDumps raises the soft core size limit of the command to its hard
+// limit, and looks for the core file once it crashed by a signal dumping
+// core, like SIGSEGV or SIGABRT, so that crashes of wrapped native tools can
+// be debugged. The path of the core file is reported by CoreDump and Status.
+// Core files are found where the core pattern of the kernel, like the
+// default "core", puts them, relative ones in the working directory of the
+// command; the ones piped to a handler like systemd-coredump are kept by it,
+// see coredumpctl. Linux only, Run fails on other platforms.
+//
+// Example:
+//
+//	c := gocmd.New("./legacy-converter in.dat", gocmd.WithCoreDumps(&gocmd.CoreDumps{Dir: "/var/crash/converter"}))
+//	c.Run(ctx)
+//	if core := c.CoreDump(); core != "" {
+//		log.Printf("converter crashed, core dumped to %s", core)
+//	}
+func WithCoreDumps(d *CoreDumps) func(c *Cmd) {
+	return func(c *Cmd) {
+		var pattern, dir string
+		var started time.Time
+		c.beforeStart = append(c.beforeStart, func(cmd *exec.Cmd) error {
+			c.mu.Lock()
+			c.coreDump = ""
+			c.mu.Unlock()
+
+			setting := ""
+			if d.SetPattern {
+				abs, err := filepath.Abs(d.Dir)
+				if err != nil {
+					return err
+				}
+				if err := os.MkdirAll(abs, 0o755); err != nil {
+					return err
+				}
+				setting = filepath.Join(abs, "core.%e.%p.%t")
+			}
+			var err error
+			if pattern, err = corePattern(setting); err != nil {
+				return err
+			}
+			if dir = cmd.Dir; dir == "" {
+				if dir, err = os.Getwd(); err != nil {
+					return err
+				}
+			}
+			started = time.Now().Add(-time.Second) // of the resolution of the modification times
+
+			execByShell(cmd, `ulimit -S -c "$(ulimit -H -c)"`)
+			return nil
+		})
+		c.flushers = append(c.flushers, func() {
+			state := c.Cmd.ProcessState
+			if state == nil || !dumpedCore(state) {
+				return
+			}
+			core := findCore(pattern, dir, started)
+			if core == "" {
+				return
+			}
+			if d.Dir != "" && filepath.Dir(core) != filepath.Clean(d.Dir) {
+				// like core.4242, so that the cores of other runs are not overwritten
+				name, pid := filepath.Base(core), strconv.Itoa(state.Pid())
+				if !strings.Contains(name, pid) {
+					name += "." + pid
+				}
+				moved := filepath.Join(d.Dir, name)
+				if os.MkdirAll(d.Dir, 0o755) == nil && os.Rename(core, moved) == nil {
+					core = moved
+				}
+			}
+
+			c.mu.Lock()
+			c.coreDump = core
+			c.mu.Unlock()
+		})
+	}
+}
+
+// CoreDump returns the path of the core file of the last attempt of the
+// command, found by WithCoreDumps, empty if it did not crash or none was found.
+func (c *Cmd) CoreDump() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.coreDump
+}
+
+// dumpedCore tells whether the process, or a process of the shell running it, was killed by a signal dumping core.
+func dumpedCore(state *os.ProcessState) bool {
+	ws, ok := state.Sys().(syscall.WaitStatus)
+	if !ok {
+		return false
+	}
+	if ws.CoreDump() {
+		return true
+	}
+	if !ws.Exited() || ws.ExitStatus() <= 128 {
+		return false
+	}
+	// shells exit with 128 + the signal of the commands they waited for
+	switch syscall.Signal(ws.ExitStatus() - 128) {
+	case syscall.SIGQUIT, syscall.SIGILL, syscall.SIGTRAP, syscall.SIGABRT, syscall.SIGBUS,
+		syscall.SIGFPE, syscall.SIGSEGV, syscall.SIGXCPU, syscall.SIGXFSZ, syscall.SIGSYS:
+		return true
+	}
+	return false
+}
+
+// findCore returns the newest core file of the pattern modified since the time, in the dir if the pattern is relative.
+func findCore(pattern, dir string, since time.Time) string {
+	if pattern == "" || strings.HasPrefix(pattern, "|") {
+		return ""
+	}
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+	coreDir, base := filepath.Split(pattern)
+	if strings.Contains(coreDir, "%") {
+		return ""
+	}
+	prefix, _, _ := strings.Cut(base, "%")
+	if prefix == "" {
+		return ""
+	}
+
+	entries, err := os.ReadDir(coreDir)
+	if err != nil {
+		return ""
+	}
+	var core string
+	var newest time.Time
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), prefix) {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil || !fi.Mode().IsRegular() || fi.ModTime().Before(since) {
+			continue
+		}
+		if core == "" || fi.ModTime().After(newest) {
+			core, newest = filepath.Join(coreDir, e.Name()), fi.ModTime()
+		}
+	}
+	return core
+}
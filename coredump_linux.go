@@ -0,0 +1,22 @@
+package gocmd
+
+import (
+	"os"
+	"strings"
+)
+
+const corePatternFile = "/proc/sys/kernel/core_pattern"
+
+// corePattern sets the core pattern of the kernel if not empty, and returns it.
+func corePattern(set string) (string, error) {
+	if set != "" {
+		if err := os.WriteFile(corePatternFile, []byte(set), 0o644); err != nil {
+			return "", err
+		}
+	}
+	b, err := os.ReadFile(corePatternFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
@@ -0,0 +1,35 @@
+package gocmd_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithCoreDumps(t *testing.T) {
+	pattern, err := os.ReadFile("/proc/sys/kernel/core_pattern")
+	if err != nil || strings.HasPrefix(string(pattern), "|") || strings.Contains(string(pattern), "/") {
+		t.Skipf("core pattern %q not in the working directory", pattern)
+	}
+
+	work, crashes := t.TempDir(), t.TempDir()
+	c := gocmd.New("sleep 0.1; kill -SEGV $$", gocmd.WithWorkingDir(work), gocmd.WithCoreDumps(&gocmd.CoreDumps{Dir: crashes}))
+	assert.Nil(t, c.Run(context.TODO()))
+	core := c.CoreDump()
+	if core == "" {
+		t.Skip("no core dumped, limited by the hard limit?")
+	}
+	assert.Equal(t, crashes, filepath.Dir(core))
+	assert.Equal(t, core, c.Status().CoreDump)
+	_, err = os.Stat(core)
+	assert.Nil(t, err)
+
+	c = gocmd.New("exit 3", gocmd.WithWorkingDir(work), gocmd.WithCoreDumps(&gocmd.CoreDumps{}))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, "", c.CoreDump())
+}
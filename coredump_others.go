@@ -0,0 +1,9 @@
+//go:build !linux
+
+package gocmd
+
+import "fmt"
+
+func corePattern(string) (string, error) {
+	return "", fmt.Errorf("core dumps: %w", ErrNotSupported)
+}
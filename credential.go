@@ -0,0 +1,142 @@
+package gocmd
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/gocmd/shellquote"
+)
+
+// CredentialProvider fetches secrets by key, like from Vault or the AWS Secrets Manager.
+type CredentialProvider interface {
+	Credential(ctx context.Context, key string) (string, error)
+}
+
+// CredentialFunc adapts a function to a CredentialProvider.
+type CredentialFunc func(ctx context.Context, key string) (string, error)
+
+// Credential calls f.
+func (f CredentialFunc) Credential(ctx context.Context, key string) (string, error) {
+	return f(ctx, key)
+}
+
+// WithCredentialEnv exports the credential of the key fetched from p when the
+// command is run as the env var name. The credential is masked in the
+// command lines displayed by Redacted, Status and the errors of Run.
+//
+// Example:
+//
+//	vault := gocmd.CachedCredentials(gocmd.CommandCredentials("vault kv get -field=value"), 5*time.Minute)
+//	c := gocmd.New("./deploy.sh", gocmd.WithCredentialEnv(vault, "DB_PASSWORD", "secret/db"))
+func WithCredentialEnv(p CredentialProvider, name, key string) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.credentials = append(c.credentials, credential{p: p, name: name, key: key})
+	}
+}
+
+// WithCredentialFD passes the credential of the key fetched from p when the
+// command is run over an inherited pipe, like WithSecretFD.
+func WithCredentialFD(p CredentialProvider, name, key string) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.credentials = append(c.credentials, credential{p: p, name: name, key: key, fd: true})
+	}
+}
+
+type credential struct {
+	p         CredentialProvider
+	name, key string
+	fd        bool
+}
+
+// resolvedCredentials are the credentials of a Run.
+type resolvedCredentials struct {
+	env     []string
+	secrets []secretFD
+	masks   []*regexp.Regexp
+}
+
+// resolveCredentials fetches the credentials of the command, for a Run.
+func (c *Cmd) resolveCredentials(ctx context.Context) error {
+	var r resolvedCredentials
+	for _, cr := range c.credentials {
+		value, err := cr.p.Credential(ctx, cr.key)
+		if err != nil {
+			return fmt.Errorf("fetch credential %s of %s: %w", cr.key, cr.name, err)
+		}
+		if cr.fd {
+			r.secrets = append(r.secrets, secretFD{name: cr.name, data: []byte(value)})
+		} else {
+			r.env = append(r.env, cr.name+"="+value)
+		}
+		if value != "" {
+			r.masks = append(r.masks, regexp.MustCompile(regexp.QuoteMeta(value)))
+		}
+	}
+
+	c.mu.Lock()
+	c.resolved = r
+	c.mu.Unlock()
+	return nil
+}
+
+// CachedCredentials caches the credentials fetched from p for ttl, so that
+// commands run often do not hit the secrets store every time. Errors are not cached.
+func CachedCredentials(p CredentialProvider, ttl time.Duration) CredentialProvider {
+	return &credentialCache{p: p, ttl: ttl, entries: map[string]cachedCredential{}}
+}
+
+type cachedCredential struct {
+	value   string
+	expires time.Time
+}
+
+type credentialCache struct {
+	p   CredentialProvider
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedCredential
+}
+
+func (cc *credentialCache) Credential(ctx context.Context, key string) (string, error) {
+	cc.mu.Lock()
+	e, ok := cc.entries[key]
+	cc.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.value, nil
+	}
+
+	value, err := cc.p.Credential(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	cc.mu.Lock()
+	cc.entries[key] = cachedCredential{value: value, expires: time.Now().Add(cc.ttl)}
+	cc.mu.Unlock()
+	return value, nil
+}
+
+// CommandCredentials returns a CredentialProvider running the helper command
+// with the key appended as its last arg, like git credential helpers, the
+// credential being its stdout without the trailing newline.
+//
+// Example:
+//
+//	gocmd.CommandCredentials("aws secretsmanager get-secret-value --query SecretString --output text --secret-id")
+func CommandCredentials(helper string) CredentialProvider {
+	return CredentialFunc(func(ctx context.Context, key string) (string, error) {
+		c := New(helper + " " + shellquote.QuoteMust(key))
+		if err := c.Run(ctx); err != nil {
+			return "", err
+		}
+		if code := c.ExitCode(); code != 0 {
+			return "", fmt.Errorf("%s exited with %d: %s", c.Redacted(), code, strings.TrimSpace(c.Stderr()))
+		}
+		return strings.TrimRight(c.Stdout(), "\r\n"), nil
+	})
+}
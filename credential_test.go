@@ -0,0 +1,49 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithCredential(t *testing.T) {
+	fetches := 0
+	p := gocmd.CachedCredentials(gocmd.CredentialFunc(func(ctx context.Context, key string) (string, error) {
+		fetches++
+		if key == "missing" {
+			return "", errors.New("not found")
+		}
+		return "pw-" + key, nil
+	}), time.Minute)
+
+	for i := 0; i < 2; i++ {
+		c := gocmd.New(`echo $DB; cat <&"$API_FD"; echo; test pw-db = pw-db`,
+			gocmd.WithCredentialEnv(p, "DB", "db"),
+			gocmd.WithCredentialFD(p, "API", "api"))
+		assert.Nil(t, c.Run(context.TODO()))
+		assert.Equal(t, "pw-db\npw-api\n", c.Stdout())
+		assert.Equal(t, `echo $DB; cat <&"$API_FD"; echo; test *** = ***`, c.Redacted())
+	}
+	assert.Equal(t, 2, fetches)
+
+	c := gocmd.New("true", gocmd.WithCredentialEnv(p, "X", "missing"))
+	err := c.Run(context.TODO())
+	assert.ErrorContains(t, err, "fetch credential missing of X: not found")
+	assert.False(t, c.Executed)
+}
+
+func TestCommandCredentials(t *testing.T) {
+	p := gocmd.CommandCredentials("printf '%s-secret\n'")
+	v, err := p.Credential(context.TODO(), "a b")
+	assert.Nil(t, err)
+	assert.Equal(t, "a b-secret", v)
+
+	_, err = gocmd.CommandCredentials("exit 3;").Credential(context.TODO(), "x")
+	assert.ErrorContains(t, err, "exited with 3")
+}
@@ -0,0 +1,226 @@
+// Package cron runs gocmd commands on cron schedules, in the foreground of a
+// process, like in containers where no cron daemon is around.
+//
+//	s := cron.Scheduler{
+//		Schedule: cron.MustParse("*/5 * * * *"),
+//		Overlap:  cron.OverlapSkip,
+//		Command:  func() *gocmd.Cmd { return gocmd.New("backup.sh", gocmd.WithTimeout(time.Hour)) },
+//	}
+//	s.Run(ctx)
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule tells when a command is run next.
+type Schedule interface {
+	// Next returns the first time after t when the command is run,
+	// the zero time if there is none.
+	Next(t time.Time) time.Time
+}
+
+// Every is a Schedule running a command every Duration.
+type Every time.Duration
+
+// Next implements Schedule.
+func (e Every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// field is the bit set of the allowed values of a spec field.
+type field uint64
+
+func (f field) has(v int) bool { return f&(1<<uint(v)) != 0 }
+
+type bounds struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minutes = bounds{min: 0, max: 59}
+	hours   = bounds{min: 0, max: 23}
+	doms    = bounds{min: 1, max: 31}
+	months  = bounds{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is Sunday too
+	dows = bounds{min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// SpecSchedule is a Schedule of the 5 fields of a crontab line.
+type SpecSchedule struct {
+	minute, hour, dom, month, dow field
+	// domStar or dowStar tells the field is *, a day then has to match both
+	// fields, otherwise any of them, like cron does.
+	domStar, dowStar bool
+}
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a schedule, which is either the 5 fields of a crontab line
+// (minute, hour, day of month, month, day of week) with lists, ranges, steps
+// and names like "*/15 9-17 * * mon-fri", a descriptor like @daily or @hourly,
+// or "@every <duration>" like "@every 90s".
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := descriptors[strings.ToLower(spec)]; ok {
+		spec = d
+	}
+
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("parse %q: %w", spec, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("parse %q: duration must be positive", spec)
+		}
+		return Every(d), nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("parse %q: expected 5 fields, got %d", spec, len(fields))
+	}
+
+	var s SpecSchedule
+	var err error
+	for i, p := range []struct {
+		f *field
+		b bounds
+	}{{&s.minute, minutes}, {&s.hour, hours}, {&s.dom, doms}, {&s.month, months}, {&s.dow, dows}} {
+		if *p.f, err = parseField(fields[i], p.b); err != nil {
+			return nil, fmt.Errorf("parse %q: field %d: %w", spec, i+1, err)
+		}
+	}
+	if s.dow.has(7) {
+		s.dow |= 1
+	}
+	s.domStar = isStar(fields[2])
+	s.dowStar = isStar(fields[4])
+
+	return &s, nil
+}
+
+// MustParse is like Parse but panics on errors.
+func MustParse(spec string) Schedule {
+	s, err := Parse(spec)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func isStar(s string) bool { return s == "*" || s == "?" }
+
+func parseField(s string, b bounds) (field, error) {
+	var f field
+	for _, part := range strings.Split(s, ",") {
+		r, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			r = part[:i]
+		}
+
+		lo, hi := b.min, b.max
+		switch {
+		case isStar(r):
+		case strings.Contains(r, "-"):
+			i := strings.Index(r, "-")
+			var err error
+			if lo, err = b.value(r[:i]); err != nil {
+				return 0, err
+			}
+			if hi, err = b.value(r[i+1:]); err != nil {
+				return 0, err
+			}
+		default:
+			var err error
+			if lo, err = b.value(r); err != nil {
+				return 0, err
+			}
+			// a/step runs from a to the maximum, a alone is just a
+			if !strings.Contains(part, "/") {
+				hi = lo
+			}
+		}
+		if lo > hi {
+			return 0, fmt.Errorf("invalid range %q", part)
+		}
+
+		for v := lo; v <= hi; v += step {
+			f |= 1 << uint(v)
+		}
+	}
+	return f, nil
+}
+
+func (b bounds) value(s string) (int, error) {
+	if v, ok := b.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if v < b.min || v > b.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", v, b.min, b.max)
+	}
+	return v, nil
+}
+
+// Next implements Schedule, the result is in the location of t.
+// It returns the zero time if there is no time within 5 years, like for February 30th.
+func (s *SpecSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if !s.month.has(int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.hour.has(t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.minute.has(t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (s *SpecSchedule) dayMatches(t time.Time) bool {
+	dom, dow := s.dom.has(t.Day()), s.dow.has(int(t.Weekday()))
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,45 @@
+package cron_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd/cron"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNext(t *testing.T) {
+	from := time.Date(2024, 2, 28, 10, 7, 30, 0, time.UTC) // a Wednesday
+	for spec, expected := range map[string]string{
+		"* * * * *":           "2024-02-28 10:08",
+		"*/5 * * * *":         "2024-02-28 10:10",
+		"0 * * * *":           "2024-02-28 11:00",
+		"@daily":              "2024-02-29 00:00",
+		"30 9 * * mon-fri":    "2024-02-29 09:30",
+		"0 0 * * sun":         "2024-03-03 00:00",
+		"0 0 * * 7":           "2024-03-03 00:00",
+		"0 0 1 * *":           "2024-03-01 00:00",
+		"0 0 29 feb *":        "2024-02-29 00:00",
+		"0 12 1,15 * *":       "2024-03-01 12:00",
+		"0 0 13 * fri":        "2024-03-01 00:00", // day of month or day of week
+		"15-45/15 8-10 * * *": "2024-02-28 10:15",
+		"@yearly":             "2025-01-01 00:00",
+	} {
+		s, err := cron.Parse(spec)
+		assert.Nil(t, err, spec)
+		assert.Equal(t, expected, s.Next(from).Format("2006-01-02 15:04"), spec)
+	}
+
+	assert.True(t, cron.MustParse("0 0 30 2 *").Next(from).IsZero())
+	assert.Equal(t, from.Add(90*time.Second), cron.MustParse("@every 90s").Next(from))
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8",
+		"5-1 * * * *", "*/0 * * * *", "x * * * *", "@every", "@every -1s",
+	} {
+		_, err := cron.Parse(spec)
+		assert.Error(t, err, spec)
+	}
+}
@@ -0,0 +1,280 @@
+package cron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+)
+
+// Overlap tells what to do when a run is due while the previous one is still running.
+type Overlap int
+
+const (
+	// OverlapSkip skips the run.
+	OverlapSkip Overlap = iota
+	// OverlapAllow runs it anyway, in parallel to the previous ones.
+	OverlapAllow
+	// OverlapQueue runs it after the previous one, up to Scheduler.QueueDepth
+	// runs wait, the runs due while the queue is full are skipped.
+	OverlapQueue
+	// OverlapKill cancels the previous runs, and runs it right away.
+	OverlapKill
+)
+
+// ParseOverlap parses an Overlap, one of skip, allow, queue and kill.
+func ParseOverlap(s string) (Overlap, error) {
+	switch s {
+	case "skip":
+		return OverlapSkip, nil
+	case "allow":
+		return OverlapAllow, nil
+	case "queue":
+		return OverlapQueue, nil
+	case "kill":
+		return OverlapKill, nil
+	}
+	return 0, fmt.Errorf("invalid overlap %q, expected skip, allow, queue or kill", s)
+}
+
+func (o Overlap) String() string {
+	switch o {
+	case OverlapAllow:
+		return "allow"
+	case OverlapQueue:
+		return "queue"
+	case OverlapKill:
+		return "kill"
+	}
+	return "skip"
+}
+
+// CatchUp tells what to do with the runs missed while the scheduler was not
+// running, or could not run them in time, like while the host was suspended.
+type CatchUp int
+
+const (
+	// CatchUpNone does not run the missed runs.
+	CatchUpNone CatchUp = iota
+	// CatchUpOnce runs the last missed run, once for all of them, like anacron.
+	CatchUpOnce
+	// CatchUpAll runs all the missed runs, subject to the Overlap.
+	CatchUpAll
+)
+
+// ParseCatchUp parses a CatchUp, one of none, once and all.
+func ParseCatchUp(s string) (CatchUp, error) {
+	switch s {
+	case "none":
+		return CatchUpNone, nil
+	case "once":
+		return CatchUpOnce, nil
+	case "all":
+		return CatchUpAll, nil
+	}
+	return 0, fmt.Errorf("invalid catch-up %q, expected none, once or all", s)
+}
+
+func (c CatchUp) String() string {
+	switch c {
+	case CatchUpOnce:
+		return "once"
+	case CatchUpAll:
+		return "all"
+	}
+	return "none"
+}
+
+// Run is a run of a Scheduler.
+type Run struct {
+	Scheduled time.Time // when the run was due, without jitter
+	Start     time.Time
+	Duration  time.Duration
+	ExitCode  int
+	Err       error // the error of Cmd.Run
+	Skipped   bool  // not run, because of OverlapSkip or a full queue
+	Missed    bool  // not run when it was due, reported before the catch-up
+	CatchUp   bool  // run late for missed runs
+}
+
+// Failed tells if the run did not run successfully.
+func (r Run) Failed() bool {
+	return r.Skipped || r.Missed || r.Err != nil || r.ExitCode != 0
+}
+
+// Scheduler runs a command on a Schedule.
+type Scheduler struct {
+	Schedule Schedule
+	// Command creates the command of a run, a Cmd is run only once.
+	Command func() *gocmd.Cmd
+	// Overlap tells what to do when a run is due while the previous one is still running.
+	Overlap Overlap
+	// QueueDepth is the number of runs waiting by OverlapQueue, 1 if 0.
+	QueueDepth int
+	// Jitter, if not zero, delays each run by a random duration up to Jitter,
+	// so that many schedulers with the same schedule do not run at the same time.
+	Jitter time.Duration
+	// Since, if not zero, is when the scheduler last ran, like the time of the
+	// last run in a history, the runs due after it were missed.
+	Since time.Time
+	// Grace is how late a run can be started before it is missed, 1m if 0.
+	Grace time.Duration
+	// CatchUp tells what to do with the missed runs.
+	CatchUp CatchUp
+	// OnRun, if not nil, is called when a run finished, was skipped or
+	// missed, from the goroutine running it.
+	OnRun func(Run)
+
+	mu      sync.Mutex
+	running map[*gocmd.Cmd]bool
+	queue   []Run // by OverlapQueue
+}
+
+// ErrNoNextRun is returned by Scheduler.Run if the schedule has no next run.
+var ErrNoNextRun = errors.New("schedule has no next run")
+
+// maxMissed is the number of the last missed runs reported, and caught up by
+// CatchUpAll, the ones before are not, like most of the runs of a schedule
+// every second missed for a day.
+const maxMissed = 1000
+
+// Run runs the command on the schedule until the context is done, which
+// also kills the running commands. It returns after they exited.
+func (s *Scheduler) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	grace := s.Grace
+	if grace <= 0 {
+		grace = time.Minute
+	}
+	last := s.Since
+	if last.IsZero() {
+		last = time.Now()
+	}
+
+	for {
+		next := s.Schedule.Next(last)
+		if next.IsZero() {
+			return ErrNoNextRun
+		}
+
+		if now := time.Now(); now.Sub(next) > grace {
+			var missed []Run
+			for ; !next.IsZero() && now.Sub(next) > grace; next = s.Schedule.Next(next) {
+				if len(missed) == maxMissed {
+					missed = missed[1:]
+				}
+				missed = append(missed, Run{Scheduled: next, Missed: true})
+				last = next
+			}
+			for _, r := range missed {
+				s.report(r)
+			}
+			switch s.CatchUp {
+			case CatchUpOnce:
+				s.dispatch(ctx, &wg, Run{Scheduled: last, CatchUp: true})
+			case CatchUpAll:
+				for _, r := range missed {
+					s.dispatch(ctx, &wg, Run{Scheduled: r.Scheduled, CatchUp: true})
+				}
+			}
+			continue
+		}
+
+		delay := time.Until(next)
+		if s.Jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(s.Jitter)))
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		s.dispatch(ctx, &wg, Run{Scheduled: next})
+		last = next
+	}
+}
+
+// dispatch starts the run, or skips, queues it or cancels the previous ones by the Overlap.
+func (s *Scheduler) dispatch(ctx context.Context, wg *sync.WaitGroup, r Run) {
+	s.mu.Lock()
+	busy := len(s.running) > 0
+	switch {
+	case busy && s.Overlap == OverlapSkip:
+		s.mu.Unlock()
+		r.Skipped = true
+		s.report(r)
+		return
+	case busy && s.Overlap == OverlapQueue:
+		depth := s.QueueDepth
+		if depth <= 0 {
+			depth = 1
+		}
+		full := len(s.queue) >= depth
+		if !full {
+			s.queue = append(s.queue, r)
+		}
+		s.mu.Unlock()
+		if full {
+			r.Skipped = true
+			s.report(r)
+		}
+		return
+	case busy && s.Overlap == OverlapKill:
+		for c := range s.running {
+			_ = c.Cancel("overlapped by the run of " + r.Scheduled.Format(time.RFC3339))
+		}
+	}
+
+	c := s.Command()
+	if s.running == nil {
+		s.running = map[*gocmd.Cmd]bool{}
+	}
+	s.running[c] = true
+	s.mu.Unlock()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			s.report(s.run(ctx, c, r))
+
+			s.mu.Lock()
+			delete(s.running, c)
+			if len(s.queue) == 0 || ctx.Err() != nil {
+				s.queue = nil
+				s.mu.Unlock()
+				return
+			}
+			r, s.queue = s.queue[0], s.queue[1:]
+			c = s.Command()
+			s.running[c] = true
+			s.mu.Unlock()
+		}
+	}()
+}
+
+func (s *Scheduler) run(ctx context.Context, c *gocmd.Cmd, r Run) Run {
+	r.Start = time.Now()
+	r.Err = c.Run(ctx)
+	r.Duration = time.Since(r.Start)
+	if c.Executed {
+		r.ExitCode = c.ExitCode()
+	}
+	return r
+}
+
+func (s *Scheduler) report(r Run) {
+	if s.OnRun != nil {
+		s.OnRun(r)
+	}
+}
@@ -0,0 +1,140 @@
+//go:build !windows
+
+package cron_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/bingoohuang/gocmd/cron"
+	"github.com/stretchr/testify/assert"
+)
+
+func runScheduler(s *cron.Scheduler, d time.Duration) []cron.Run {
+	var mu sync.Mutex
+	var runs []cron.Run
+	s.OnRun = func(r cron.Run) {
+		mu.Lock()
+		runs = append(runs, r)
+		mu.Unlock()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	_ = s.Run(ctx)
+	return runs
+}
+
+func TestSchedulerOverlapSkip(t *testing.T) {
+	runs := runScheduler(&cron.Scheduler{
+		Schedule: cron.Every(40 * time.Millisecond),
+		Command:  func() *gocmd.Cmd { return gocmd.New("sleep 0.1") },
+	}, 330*time.Millisecond)
+
+	var ran, skipped int
+	for _, r := range runs {
+		if r.Skipped {
+			skipped++
+		} else {
+			ran++
+		}
+	}
+	assert.True(t, ran >= 2, "ran %d", ran)
+	assert.True(t, skipped >= 2, "skipped %d", skipped)
+}
+
+func TestSchedulerStartFailure(t *testing.T) {
+	runs := runScheduler(&cron.Scheduler{
+		Schedule: cron.Every(40 * time.Millisecond),
+		Command:  func() *gocmd.Cmd { return gocmd.New("true", gocmd.WithShell("no-such-shell-xyz")) },
+	}, 150*time.Millisecond)
+
+	assert.NotEmpty(t, runs)
+	for _, r := range runs {
+		assert.True(t, r.Failed())
+		assert.Contains(t, r.Err.Error(), "no-such-shell-xyz")
+		assert.Equal(t, 0, r.ExitCode)
+	}
+}
+
+func TestSchedulerOverlapAllow(t *testing.T) {
+	runs := runScheduler(&cron.Scheduler{
+		Schedule: cron.Every(40 * time.Millisecond),
+		Overlap:  cron.OverlapAllow,
+		Command:  func() *gocmd.Cmd { return gocmd.New("sleep 0.1; exit 3") },
+	}, 330*time.Millisecond)
+
+	assert.True(t, len(runs) >= 4, "runs %d", len(runs))
+	for _, r := range runs {
+		assert.False(t, r.Skipped)
+		// the last ones are killed by the end of the scheduler
+		assert.True(t, r.ExitCode == 3 || r.Err != nil, "%+v", r)
+	}
+}
+
+func TestSchedulerOverlapQueue(t *testing.T) {
+	runs := runScheduler(&cron.Scheduler{
+		Schedule: cron.Every(20 * time.Millisecond),
+		Overlap:  cron.OverlapQueue,
+		Command:  func() *gocmd.Cmd { return gocmd.New("sleep 0.1") },
+	}, 330*time.Millisecond)
+
+	var ran, skipped int
+	for _, r := range runs {
+		if r.Skipped {
+			skipped++
+		} else if r.Err == nil {
+			ran++
+			// a queued run starts right after the previous one, late
+			assert.True(t, r.Start.Sub(r.Scheduled) < 250*time.Millisecond, "%+v", r)
+		}
+	}
+	assert.True(t, ran >= 2, "ran %d", ran)
+	assert.True(t, skipped >= 5, "skipped %d", skipped)
+}
+
+func TestSchedulerOverlapKill(t *testing.T) {
+	runs := runScheduler(&cron.Scheduler{
+		Schedule: cron.Every(50 * time.Millisecond),
+		Overlap:  cron.OverlapKill,
+		Command:  func() *gocmd.Cmd { return gocmd.New("sleep 10", gocmd.WithTimeout(0)) },
+	}, 230*time.Millisecond)
+
+	assert.True(t, len(runs) >= 3, "runs %d", len(runs))
+	for _, r := range runs[:len(runs)-1] {
+		assert.True(t, errors.Is(r.Err, gocmd.ErrCanceled), "%+v", r)
+		assert.Contains(t, r.Err.Error(), "overlapped by the run of")
+	}
+}
+
+func TestSchedulerCatchUp(t *testing.T) {
+	for _, catchUp := range []cron.CatchUp{cron.CatchUpNone, cron.CatchUpOnce, cron.CatchUpAll} {
+		t.Run(catchUp.String(), func(t *testing.T) {
+			runs := runScheduler(&cron.Scheduler{
+				Schedule: cron.Every(time.Second),
+				Since:    time.Now().Add(-3500 * time.Millisecond),
+				Grace:    100 * time.Millisecond,
+				Overlap:  cron.OverlapAllow,
+				CatchUp:  catchUp,
+				Command:  func() *gocmd.Cmd { return gocmd.New("true") },
+			}, 200*time.Millisecond)
+
+			var missed, caughtUp int
+			for _, r := range runs {
+				if r.Missed {
+					missed++
+				}
+				if r.CatchUp {
+					caughtUp++
+					assert.Nil(t, r.Err)
+				}
+			}
+			assert.Equal(t, 3, missed)
+			assert.Equal(t, map[cron.CatchUp]int{cron.CatchUpNone: 0, cron.CatchUpOnce: 1, cron.CatchUpAll: 3}[catchUp], caughtUp)
+		})
+	}
+}
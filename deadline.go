@@ -0,0 +1,34 @@
+package gocmd
+
+import (
+	"strconv"
+	"time"
+)
+
+// WithDeadlineEnv exports the deadline of the command, by its timeout or the
+// deadline of the context, to it as the env var name, in RFC 3339 format, and
+// the milliseconds remaining when it is started as name_MS, so that
+// cooperative scripts can stop in time instead of being killed mid-write.
+// Nothing is exported if the command has no deadline.
+//
+// Example:
+//
+//	c := gocmd.New(`timeout $((DEADLINE_MS / 1000 - 5)) ./sync.sh`,
+//		gocmd.WithTimeout(time.Hour), gocmd.WithDeadlineEnv("DEADLINE"))
+func WithDeadlineEnv(name string) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.deadlineEnv = name
+	}
+}
+
+// deadlineEnv returns a copy of env with the env vars of WithDeadlineEnv.
+func deadlineEnv(env []string, name string, deadline time.Time) []string {
+	remaining := time.Until(deadline).Milliseconds()
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return append(env[:len(env):len(env)],
+		name+"="+deadline.UTC().Format(time.RFC3339Nano),
+		name+"_MS="+strconv.FormatInt(remaining, 10))
+}
@@ -0,0 +1,33 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithDeadlineEnv(t *testing.T) {
+	start := time.Now()
+	c := gocmd.New("echo $DEADLINE $DEADLINE_MS", gocmd.WithTimeout(time.Minute), gocmd.WithDeadlineEnv("DEADLINE"))
+	assert.Nil(t, c.Run(context.TODO()))
+
+	fields := strings.Fields(c.Stdout())
+	assert.Len(t, fields, 2)
+	deadline, err := time.Parse(time.RFC3339Nano, fields[0])
+	assert.Nil(t, err)
+	assert.WithinDuration(t, start.Add(time.Minute), deadline, time.Second)
+	ms, err := strconv.Atoi(fields[1])
+	assert.Nil(t, err)
+	assert.InDelta(t, 60000, ms, 1000)
+
+	c = gocmd.New("echo ${DEADLINE-none}", gocmd.WithTimeout(0), gocmd.WithDeadlineEnv("DEADLINE"))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, "none\n", c.Stdout())
+}
@@ -0,0 +1,98 @@
+package gocmd
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// EnvChange is an env var of a command differing from the one of the parent process.
+type EnvChange struct {
+	Key string `json:"key"`
+	// Op is "added", "overridden" or "removed".
+	Op    string `json:"op"`
+	Value string `json:"value,omitempty"`
+	Old   string `json:"old,omitempty"`
+}
+
+// String returns the change like +KEY=VALUE, ~KEY=VALUE (was OLD) or -KEY.
+func (e EnvChange) String() string {
+	switch e.Op {
+	case "added":
+		return "+" + e.Key + "=" + e.Value
+	case "overridden":
+		return "~" + e.Key + "=" + e.Value + " (was " + e.Old + ")"
+	default:
+		return "-" + e.Key
+	}
+}
+
+// EnvDiff are the env vars of a command differing from the ones of the parent process, sorted by key.
+type EnvDiff []EnvChange
+
+// Strings returns the changes as strings.
+func (d EnvDiff) Strings() []string {
+	s := make([]string, len(d))
+	for i, e := range d {
+		s[i] = e.String()
+	}
+	return s
+}
+
+// Removed returns the keys of the env vars removed, like the ones stripped by WithHermetic.
+func (d EnvDiff) Removed() []string {
+	var keys []string
+	for _, e := range d {
+		if e.Op == "removed" {
+			keys = append(keys, e.Key)
+		}
+	}
+	return keys
+}
+
+// EnvDiff returns the env vars added, overridden or removed for the command
+// relative to the ones of the current process, to tell why a command behaves
+// differently than in a shell. It is the env of the last attempt once run,
+// including the ones of WithDeadlineEnv and WithCredentialEnv, values are
+// masked like by Redacted.
+func (c *Cmd) EnvDiff() EnvDiff {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.envDiff()
+}
+
+func (c *Cmd) envDiff() EnvDiff {
+	env := c.env
+	if env == nil {
+		env = c.Env
+	}
+	parent, child := envMap(os.Environ()), envMap(env)
+
+	var diff EnvDiff
+	for k, v := range child {
+		if old, ok := parent[k]; !ok {
+			diff = append(diff, EnvChange{Key: k, Op: "added", Value: c.redact(v)})
+		} else if old != v {
+			diff = append(diff, EnvChange{Key: k, Op: "overridden", Value: c.redact(v), Old: c.redact(old)})
+		}
+	}
+	for k := range parent {
+		if _, ok := child[k]; !ok {
+			diff = append(diff, EnvChange{Key: k, Op: "removed"})
+		}
+	}
+	sort.Slice(diff, func(i, j int) bool { return diff[i].Key < diff[j].Key })
+	return diff
+}
+
+// envMap returns the env vars as a map, the last one of a key winning like for exec.
+func envMap(env []string) map[string]string {
+	m := make(map[string]string, len(env))
+	for _, kv := range env {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			m[k] = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,43 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvDiff(t *testing.T) {
+	t.Setenv("GOCMD_OLD", "old")
+	t.Setenv("GOCMD_GONE", "x")
+	p := gocmd.CredentialFunc(func(context.Context, string) (string, error) { return "s3cret", nil })
+
+	c := gocmd.New("true",
+		gocmd.WithEnv(gocmd.EnvVars{"GOCMD_NEW": "new", "GOCMD_OLD": "changed"}),
+		gocmd.WithDeadlineEnv("GOCMD_DEADLINE"),
+		gocmd.WithCredentialEnv(p, "GOCMD_TOKEN", "token"),
+		func(c *gocmd.Cmd) {
+			var env []string
+			for _, kv := range c.Env {
+				if !strings.HasPrefix(kv, "GOCMD_GONE=") {
+					env = append(env, kv)
+				}
+			}
+			c.Env = env
+		})
+	assert.Equal(t, []string{"-GOCMD_GONE", "+GOCMD_NEW=new", "~GOCMD_OLD=changed (was old)"}, c.EnvDiff().Strings())
+
+	c.Timeout = time.Minute
+	assert.Nil(t, c.Run(context.TODO()))
+	diff := c.Status().Env
+	assert.Len(t, diff, 6)
+	assert.Equal(t, "GOCMD_DEADLINE", diff[0].Key)
+	assert.Equal(t, gocmd.EnvChange{Key: "GOCMD_TOKEN", Op: "added", Value: "***"}, diff[5])
+	assert.Equal(t, "old", os.Getenv("GOCMD_OLD"))
+}
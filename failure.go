@@ -0,0 +1,84 @@
+package gocmd
+
+import (
+	"regexp"
+	"sort"
+)
+
+// FailureKind tells why a command failed, like by a network or an authentication error.
+type FailureKind string
+
+// Common failure kinds, a classifier can return any others.
+const (
+	FailureNone    FailureKind = ""
+	FailureNetwork FailureKind = "network"
+	FailureAuth    FailureKind = "auth"
+	FailureUser    FailureKind = "user"
+	FailureUnknown FailureKind = "unknown"
+)
+
+// WithFailureClassifier classifies the failures of the command by its stderr,
+// but the lines expected by WithExpectedStderr, and exit code, after each attempt which exited with an exit code not
+// classified as Success, see WithExitCodeMap. The kind is reported by
+// Failure, Status and batch results, and can be retried on by RetryPolicy.OnFailures.
+//
+// Example:
+//
+//	c := gocmd.New("git fetch", gocmd.WithFailureClassifier(gocmd.FailurePatterns(map[gocmd.FailureKind]string{
+//		gocmd.FailureNetwork: `Could not resolve host|Connection (refused|timed out)`,
+//		gocmd.FailureAuth:    `Permission denied|Authentication failed`,
+//	})))
+func WithFailureClassifier(f func(stderr string, code int) FailureKind) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.classifier = f
+	}
+}
+
+// FailurePatterns returns a classifier of WithFailureClassifier returning the
+// kind of the pattern matching stderr, the first one by name if many do, or
+// FailureUnknown. It panics if a pattern is not a valid regular expression.
+func FailurePatterns(patterns map[FailureKind]string) func(stderr string, code int) FailureKind {
+	type pattern struct {
+		kind FailureKind
+		re   *regexp.Regexp
+	}
+
+	var ps []pattern
+	for kind, p := range patterns {
+		ps = append(ps, pattern{kind: kind, re: regexp.MustCompile(p)})
+	}
+	sort.Slice(ps, func(i, j int) bool { return ps[i].kind < ps[j].kind })
+
+	return func(stderr string, _ int) FailureKind {
+		for _, p := range ps {
+			if p.re.MatchString(stderr) {
+				return p.kind
+			}
+		}
+		return FailureUnknown
+	}
+}
+
+// Failure returns the kind of the failure of the command by WithFailureClassifier,
+// FailureNone if it did not fail or there is no classifier.
+func (c *Cmd) Failure() FailureKind {
+	c.checkExecuted("Failure")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.failure
+}
+
+// classify classifies the failure of the last attempt.
+func (c *Cmd) classify() {
+	kind := FailureNone
+	if c.classifier != nil && c.outcome() != Success {
+		kind = c.classifier(c.unexpectedStderr(), c.exitCode)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.failure = kind
+}
@@ -0,0 +1,43 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommand_WithFailureClassifier(t *testing.T) {
+	classify := gocmd.WithFailureClassifier(gocmd.FailurePatterns(map[gocmd.FailureKind]string{
+		gocmd.FailureNetwork: `Could not resolve host|Connection refused`,
+		gocmd.FailureAuth:    `Permission denied`,
+	}))
+
+	c := gocmd.New("echo 'ssh: Could not resolve host x' >&2; exit 255", classify,
+		gocmd.WithRetry(gocmd.RetryPolicy{Retries: 2, OnFailures: []gocmd.FailureKind{gocmd.FailureNetwork}}))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, gocmd.FailureNetwork, c.Failure())
+	assert.Equal(t, gocmd.FailureNetwork, c.Status().Failure)
+	assert.Equal(t, 3, c.Attempts())
+
+	c = gocmd.New("echo 'Permission denied (publickey)' >&2; exit 255", classify,
+		gocmd.WithRetry(gocmd.RetryPolicy{Retries: 2, OnFailures: []gocmd.FailureKind{gocmd.FailureNetwork}}))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, gocmd.FailureAuth, c.Failure())
+	assert.Equal(t, 1, c.Attempts())
+
+	c = gocmd.New("echo oops >&2; exit 1", classify)
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, gocmd.FailureUnknown, c.Failure())
+
+	c = gocmd.New("echo 'Permission denied' >&2", classify)
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, gocmd.FailureNone, c.Failure(), "successful commands are not classified")
+
+	var b gocmd.Batch
+	results := b.Run(context.TODO(), gocmd.BatchJob{Name: "auth", Cmd: gocmd.New("echo 'Permission denied' >&2; exit 1", classify)})
+	assert.Equal(t, gocmd.FailureAuth, results[0].Failure)
+}
@@ -0,0 +1,158 @@
+package gocmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// FileSink is a Sink writing the output of a command to a file, optionally rotating it by size.
+// It is opened when the command is run and closed after, it is safe to be written
+// by stdout and stderr at the same time.
+type FileSink struct {
+	Path string
+	// Append appends to an existing file, instead of truncating it.
+	Append bool
+	// MaxSize, if not zero, rotates the file before a write would make it larger
+	// than MaxSize bytes, Path is renamed to Path.1, Path.1 to Path.2 and so on.
+	MaxSize int64
+	// MaxBackups is the number of rotated files kept, at least 1.
+	MaxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// NewFileSink creates a FileSink of the path.
+func NewFileSink(path string, options ...func(*FileSink)) *FileSink {
+	s := &FileSink{Path: path}
+	for _, o := range options {
+		o(s)
+	}
+	return s
+}
+
+// FileAppend sets if the FileSink appends to an existing file.
+func FileAppend(append bool) func(*FileSink) {
+	return func(s *FileSink) {
+		s.Append = append
+	}
+}
+
+// FileRotate rotates the FileSink when it exceeds maxSize bytes, keeping maxBackups rotated files.
+func FileRotate(maxSize int64, maxBackups int) func(*FileSink) {
+	return func(s *FileSink) {
+		s.MaxSize = maxSize
+		s.MaxBackups = maxBackups
+	}
+}
+
+// Start opens the file, it is called by Cmd.Run.
+func (s *FileSink) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f != nil {
+		return nil
+	}
+	return s.open(s.Append)
+}
+
+func (s *FileSink) open(append bool) error {
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if append {
+		flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(s.Path, flag, 0o644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.f, s.size = f, fi.Size()
+	return nil
+}
+
+// ErrSinkClosed is returned by writes to a closed sink.
+var ErrSinkClosed = errors.New("sink closed")
+
+// Write writes p to the file, rotating it before if needed.
+func (s *FileSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return 0, fmt.Errorf("write %s: %w", s.Path, ErrSinkClosed)
+	}
+	if s.MaxSize > 0 && s.size > 0 && s.size+int64(len(p)) > s.MaxSize {
+		if err := s.rotate(); err != nil {
+			return 0, fmt.Errorf("rotate %s: %w", s.Path, err)
+		}
+	}
+
+	n, err := s.f.Write(p)
+	s.size += int64(n)
+	return n, err
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+	s.f = nil
+
+	backups := s.MaxBackups
+	if backups < 1 {
+		backups = 1
+	}
+	for i := backups - 1; i >= 1; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", s.Path, i), fmt.Sprintf("%s.%d", s.Path, i+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(s.Path, s.Path+".1"); err != nil {
+		return err
+	}
+
+	return s.open(false)
+}
+
+// Close closes the file.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
+// WithStdoutFile also writes stdout to the file at path.
+//
+// Example:
+//
+//	c := gocmd.New("make", gocmd.WithStdoutFile("make.log", gocmd.FileRotate(10<<20, 3)))
+//	c.Run(context.TODO())
+func WithStdoutFile(path string, options ...func(*FileSink)) func(c *Cmd) {
+	return WithStdoutSink(NewFileSink(path, options...))
+}
+
+// WithStderrFile also writes stderr to the file at path.
+func WithStderrFile(path string, options ...func(*FileSink)) func(c *Cmd) {
+	return WithStderrSink(NewFileSink(path, options...))
+}
+
+// WithCombinedFile also writes stdout and stderr to the file at path.
+func WithCombinedFile(path string, options ...func(*FileSink)) func(c *Cmd) {
+	return WithCombinedSink(NewFileSink(path, options...))
+}
@@ -0,0 +1,64 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	return string(b)
+}
+
+func TestWithFiles(t *testing.T) {
+	dir := t.TempDir()
+	out, errf, combined := filepath.Join(dir, "out.log"), filepath.Join(dir, "err.log"), filepath.Join(dir, "run.log")
+	assert.Nil(t, os.WriteFile(combined, []byte("old\n"), 0o644))
+
+	c := gocmd.New("echo hello; sleep 0.05; echo oops >&2",
+		gocmd.WithStdoutFile(out),
+		gocmd.WithStderrFile(errf),
+		gocmd.WithCombinedFile(combined, gocmd.FileAppend(true)),
+	)
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, "hello\n", c.Stdout())
+	assert.Equal(t, "hello\n", readFile(t, out))
+	assert.Equal(t, "oops\n", readFile(t, errf))
+	assert.Equal(t, "old\nhello\noops\n", readFile(t, combined))
+
+	c = gocmd.New("echo again", gocmd.WithStdoutFile(out))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, "again\n", readFile(t, out))
+
+	c = gocmd.New("echo x", gocmd.WithStdoutFile(filepath.Join(dir, "missing", "out.log")))
+	assert.Error(t, c.Run(context.TODO()))
+}
+
+func TestFileSinkRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	s := gocmd.NewFileSink(path, gocmd.FileRotate(10, 2))
+	assert.Nil(t, s.Start())
+	for _, p := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeee\n", "ffff\n", "gggg\n"} {
+		_, err := s.Write([]byte(p))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, s.Close())
+
+	assert.Equal(t, "gggg\n", readFile(t, path))
+	assert.Equal(t, "eeee\nffff\n", readFile(t, path+".1"))
+	assert.Equal(t, "cccc\ndddd\n", readFile(t, path+".2"))
+	_, err := os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = s.Write([]byte("x"))
+	assert.ErrorIs(t, err, gocmd.ErrSinkClosed)
+}
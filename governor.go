@@ -0,0 +1,202 @@
+package gocmd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// HostLoad is the pressure on the host, probed by a Governor.
+type HostLoad struct {
+	Load1        float64 // load average of the last minute
+	CPUs         int
+	MemAvailable uint64 // bytes
+	MemTotal     uint64 // bytes
+}
+
+// GovernorAction is what a Governor does to its commands while the host is under pressure.
+type GovernorAction int
+
+const (
+	// Pause stops the commands by SIGSTOP, and continues them by SIGCONT.
+	Pause GovernorAction = iota
+	// Renice lowers the priority of the commands to Governor.Nice, and raises it
+	// back to 0, which needs CAP_SYS_NICE, else they keep running niced.
+	Renice
+)
+
+// Governor pauses or renices the low priority commands registered by
+// WithGovernor while the host is under pressure, like when it is shared with
+// production services, and resumes them once the pressure subsided, when the
+// load and the available memory are 10% below and above the thresholds, so
+// that it does not flap. Paused commands may time out.
+//
+// Example:
+//
+//	g := &gocmd.Governor{MaxLoad: 1.5, MinMemAvailable: 0.1}
+//	go g.Run(ctx)
+//	c := gocmd.New("./reindex.sh", gocmd.WithGovernor(g))
+type Governor struct {
+	// MaxLoad is the load average per CPU above which the host is under pressure, 0 to ignore it.
+	MaxLoad float64
+	// MinMemAvailable is the fraction of the memory available below which the host is under pressure, 0 to ignore it.
+	MinMemAvailable float64
+	Action          GovernorAction
+	// Nice is the niceness of reniced commands, 19 if 0.
+	Nice int
+	// Interval is how often the host is probed, 5s if 0.
+	Interval time.Duration
+	// Probe probes the host, from /proc/loadavg and /proc/meminfo by default, on Linux only.
+	Probe func() (HostLoad, error)
+	// OnChange, if not nil, is called when the host gets under pressure or the pressure subsided.
+	OnChange func(pressured bool, load HostLoad)
+
+	mu        sync.Mutex
+	pressured bool
+	cmds      map[*Cmd]bool // registered commands, true if the action was applied to them
+}
+
+// WithGovernor registers the command to the governor while it is running.
+func WithGovernor(g *Governor) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.watchers = append(c.watchers, func(ctx context.Context) {
+			g.register(c)
+			<-ctx.Done()
+			g.unregister(c)
+		})
+	}
+}
+
+// Run probes the host every Interval and applies the action to the commands
+// while it is under pressure, until ctx is done or probing fails, resuming them then.
+func (g *Governor) Run(ctx context.Context) error {
+	interval := g.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	probe := g.Probe
+	if probe == nil {
+		probe = probeHost
+	}
+	defer g.update(false, HostLoad{})
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		load, err := probe()
+		if err != nil {
+			return fmt.Errorf("probe host: %w", err)
+		}
+		g.update(g.underPressure(load), load)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Pressured tells if the host is under pressure.
+func (g *Governor) Pressured() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.pressured
+}
+
+// underPressure tells if the host is under pressure by the load, with a margin
+// of 10% to get out of it.
+func (g *Governor) underPressure(load HostLoad) bool {
+	margin := 1.0
+	if g.Pressured() {
+		margin = 0.9
+	}
+
+	if g.MaxLoad > 0 && load.CPUs > 0 && load.Load1/float64(load.CPUs) > g.MaxLoad*margin {
+		return true
+	}
+	if g.MinMemAvailable > 0 && load.MemTotal > 0 &&
+		float64(load.MemAvailable)/float64(load.MemTotal) < g.MinMemAvailable/margin {
+		return true
+	}
+	return false
+}
+
+func (g *Governor) update(pressured bool, load HostLoad) {
+	g.mu.Lock()
+	changed := g.pressured != pressured
+	g.pressured = pressured
+	for c, applied := range g.cmds {
+		if applied != pressured {
+			g.apply(c, pressured)
+			g.cmds[c] = pressured
+		}
+	}
+	g.mu.Unlock()
+
+	if changed && g.OnChange != nil {
+		g.OnChange(pressured, load)
+	}
+}
+
+func (g *Governor) register(c *Cmd) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.cmds == nil {
+		g.cmds = map[*Cmd]bool{}
+	}
+	g.cmds[c] = g.pressured
+	if g.pressured {
+		g.apply(c, true)
+	}
+}
+
+func (g *Governor) unregister(c *Cmd) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.cmds[c] && g.Action == Pause {
+		// continue it, so that it can handle the SIGTERM of a timeout
+		g.apply(c, false)
+	}
+	delete(g.cmds, c)
+}
+
+// apply applies the action to the command, or reverts it, errors are ignored
+// as the command may have exited already.
+func (g *Governor) apply(c *Cmd, on bool) {
+	switch g.Action {
+	case Pause:
+		sig := syscall.SIGCONT
+		if on {
+			sig = syscall.SIGSTOP
+		}
+		_ = c.Signal(sig)
+	case Renice:
+		nice := 0
+		if on {
+			if nice = g.Nice; nice == 0 {
+				nice = 19
+			}
+		}
+		_ = c.renice(nice)
+	}
+}
+
+// renice sets the niceness of the running command, of its process group if it has one of its own.
+func (c *Cmd) renice(nice int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.process == nil {
+		return ErrNotRunning
+	}
+	if c.Setpgid || c.Setsid {
+		return syscall.Setpriority(syscall.PRIO_PGRP, c.process.Pid, nice)
+	}
+	return syscall.Setpriority(syscall.PRIO_PROCESS, c.process.Pid, nice)
+}
@@ -0,0 +1,53 @@
+package gocmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// probeHost reads the load average of /proc/loadavg and the memory of /proc/meminfo.
+func probeHost() (HostLoad, error) {
+	load := HostLoad{CPUs: runtime.NumCPU()}
+
+	b, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return load, err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return load, fmt.Errorf("invalid /proc/loadavg %q", b)
+	}
+	if load.Load1, err = strconv.ParseFloat(fields[0], 64); err != nil {
+		return load, fmt.Errorf("invalid /proc/loadavg %q: %w", b, err)
+	}
+
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return load, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// like MemAvailable:    1234 kB
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			load.MemTotal = kb << 10
+		case "MemAvailable:":
+			load.MemAvailable = kb << 10
+		}
+	}
+	return load, s.Err()
+}
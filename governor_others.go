@@ -0,0 +1,9 @@
+//go:build !linux
+
+package gocmd
+
+import "fmt"
+
+func probeHost() (HostLoad, error) {
+	return HostLoad{}, fmt.Errorf("host load: %w", ErrNotSupported)
+}
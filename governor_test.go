@@ -0,0 +1,80 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestGovernor(action gocmd.GovernorAction) (*gocmd.Governor, *int32, func() []bool) {
+	var pressured int32 = 1
+	var mu sync.Mutex
+	var changes []bool
+	g := &gocmd.Governor{
+		MaxLoad:  1,
+		Action:   action,
+		Interval: 10 * time.Millisecond,
+		Probe: func() (gocmd.HostLoad, error) {
+			switch atomic.LoadInt32(&pressured) {
+			case 1:
+				return gocmd.HostLoad{Load1: 4, CPUs: 2}, nil
+			case 2:
+				return gocmd.HostLoad{Load1: 1.9, CPUs: 2}, nil
+			default:
+				return gocmd.HostLoad{Load1: 0.1, CPUs: 2}, nil
+			}
+		},
+		OnChange: func(pressured bool, _ gocmd.HostLoad) {
+			mu.Lock()
+			changes = append(changes, pressured)
+			mu.Unlock()
+		},
+	}
+	return g, &pressured, func() []bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]bool(nil), changes...)
+	}
+}
+
+func TestGovernorPause(t *testing.T) {
+	g, pressured, changes := newTestGovernor(gocmd.Pause)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go g.Run(ctx)
+	for !g.Pressured() {
+		time.Sleep(time.Millisecond)
+	}
+
+	time.AfterFunc(100*time.Millisecond, func() { atomic.StoreInt32(pressured, 2) })
+	time.AfterFunc(300*time.Millisecond, func() { atomic.StoreInt32(pressured, 0) })
+	start := time.Now()
+	c := gocmd.New("sleep 0.05", gocmd.WithGovernor(g))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.GreaterOrEqual(t, time.Since(start), 300*time.Millisecond)
+	// load 1.9 on 2 CPUs is not 10% below the max load of 1 per CPU
+	assert.Equal(t, []bool{true, false}, changes())
+}
+
+func TestGovernorRenice(t *testing.T) {
+	g, _, _ := newTestGovernor(gocmd.Renice)
+	g.Nice = 10
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go g.Run(ctx)
+	for !g.Pressured() {
+		time.Sleep(time.Millisecond)
+	}
+
+	c := gocmd.New("sleep 0.1; ps -o ni= -p $$", gocmd.WithGovernor(g))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, "10", strings.TrimSpace(c.Stdout()))
+}
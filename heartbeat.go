@@ -0,0 +1,59 @@
+package gocmd
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// WithHeartbeat calls f when the command is started and then every interval
+// while it is running, for external watchdogs, like sd_notify WATCHDOG=1 of
+// systemd WatchdogSec. The interval is one second if not positive.
+func WithHeartbeat(interval time.Duration, f func()) func(c *Cmd) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	return func(c *Cmd) {
+		c.watchers = append(c.watchers, func(ctx context.Context) {
+			f()
+
+			t := time.NewTicker(interval)
+			defer t.Stop()
+			for {
+				select {
+				case <-t.C:
+					f()
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+	}
+}
+
+// WithHeartbeatFile touches the file at path, creating it if needed, when the
+// command is started and then every interval while it is running, so that a
+// liveness probe can check how old the file is, like
+//
+//	test $(( $(date +%s) - $(stat -c %Y /tmp/alive) )) -lt 30
+//
+// Errors touching the file are ignored, the probe fails then.
+func WithHeartbeatFile(interval time.Duration, path string) func(c *Cmd) {
+	return WithHeartbeat(interval, func() { _ = touch(path) })
+}
+
+// touch sets the modification time of the file to now, creating it if it does not exist.
+func touch(path string) error {
+	now := time.Now()
+	err := os.Chtimes(path, now, now)
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,38 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithHeartbeat(t *testing.T) {
+	var beats int32
+	c := gocmd.New("sleep 0.25", gocmd.WithHeartbeat(50*time.Millisecond, func() { atomic.AddInt32(&beats, 1) }))
+	assert.Nil(t, c.Run(context.TODO()))
+
+	n := atomic.LoadInt32(&beats)
+	assert.GreaterOrEqual(t, n, int32(3))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, n, atomic.LoadInt32(&beats), "no heartbeats after the command exited")
+}
+
+func TestWithHeartbeatFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alive")
+	start := time.Now().Add(-time.Second)
+
+	c := gocmd.New("sleep 0.1", gocmd.WithHeartbeatFile(20*time.Millisecond, path))
+	assert.Nil(t, c.Run(context.TODO()))
+
+	fi, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.True(t, fi.ModTime().After(start))
+}
@@ -0,0 +1,49 @@
+package gocmd
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// HermeticUmask is the umask of the commands run by WithHermetic.
+const HermeticUmask = 0o022
+
+// hermeticEnv is the whole env of the commands run by WithHermetic.
+var hermeticEnv = []string{
+	"PATH=/usr/local/bin:/usr/bin:/bin",
+	"LANG=C",
+	"LC_ALL=C",
+	"TZ=UTC",
+}
+
+// WithHermetic runs the command in a minimal env instead of the inherited
+// one, PATH=/usr/local/bin:/usr/bin:/bin, LANG=C, LC_ALL=C and TZ=UTC, with
+// the umask HermeticUmask, so that it behaves the same on any host, whatever
+// the locale, time zone, tools and settings of the user running it. The env
+// vars of later options, like WithEnv, are added to it. The env vars it
+// stripped are reported by EnvDiff, as removed, see EnvDiff.Removed.
+// Commands created by WithCmd are resolved by the PATH of the current
+// process, the ones run by a shell by the PATH above.
+//
+// Example:
+//
+//	c := gocmd.New("make dist", gocmd.WithHermetic(), gocmd.WithEnv(gocmd.EnvVars{"GOFLAGS": "-trimpath"}))
+//	c.Run(ctx)
+//	log.Printf("stripped %v", c.EnvDiff().Removed())
+func WithHermetic() func(c *Cmd) {
+	return func(c *Cmd) {
+		c.Env = append([]string(nil), hermeticEnv...)
+		c.beforeStart = append(c.beforeStart, func(cmd *exec.Cmd) error {
+			// the umask is one of the process
+			execByShell(cmd, "umask "+strconv.FormatInt(HermeticUmask, 8))
+			return nil
+		})
+	}
+}
+
+// execByShell makes the command started by a shell running the script, like
+// setting limits of the process, then exec-ing the command.
+func execByShell(cmd *exec.Cmd, script string) {
+	cmd.Args = append([]string{defaultShell, "-c", script + ` && exec "$0" "$@"`, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = defaultShell
+}
@@ -0,0 +1,40 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithHermetic(t *testing.T) {
+	t.Setenv("GOCMD_LEAK", "x")
+	t.Setenv("TZ", "Asia/Shanghai")
+	dir := t.TempDir()
+	defer syscall.Umask(syscall.Umask(0o077))
+
+	c := gocmd.New("touch f && stat -c %a f && env | sort",
+		gocmd.WithHermetic(), gocmd.WithEnv(gocmd.EnvVars{"GOCMD_KEPT": "1"}), gocmd.WithWorkingDir(dir))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, 0, c.ExitCode(), c.Stderr())
+
+	lines := strings.Split(strings.TrimSpace(c.Stdout()), "\n")
+	assert.Equal(t, "644", lines[0])
+	assert.Contains(t, lines, "GOCMD_KEPT=1")
+	assert.Contains(t, lines, "TZ=UTC")
+	assert.Contains(t, lines, "LANG=C")
+	assert.NotContains(t, c.Stdout(), "GOCMD_LEAK")
+
+	removed := c.EnvDiff().Removed()
+	assert.Contains(t, removed, "GOCMD_LEAK")
+	assert.NotContains(t, removed, "TZ")
+	_, err := os.Stat(filepath.Join(dir, "f"))
+	assert.Nil(t, err)
+}
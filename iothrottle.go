@@ -0,0 +1,36 @@
+package gocmd
+
+import "fmt"
+
+// WithIOThrottle limits the disk bandwidth of the command to readBps and
+// writeBps bytes per second, 0 for no limit, so that backups and syncs do not
+// saturate the disks of the host. The command is moved right after it
+// started into a new cgroup v2 by the io.max of all its disks, under the
+// cgroup of the current process, which must be delegated to it, like by
+// systemd-run -p Delegate=yes, and have no processes itself but if it is the
+// root one. The cgroup is removed after the command exited.
+// The processes the command starts inherit it, the ones it started before
+// it was set do not. Run fails on other platforms than Linux.
+//
+// Example:
+//
+//	c := gocmd.New("rsync -a /data backup:/data", gocmd.WithIOThrottle(50<<20, 20<<20))
+func WithIOThrottle(readBps, writeBps int64) func(c *Cmd) {
+	return func(c *Cmd) {
+		var cgroup string
+		c.afterStart = append(c.afterStart, func(pid int) error {
+			if readBps < 0 || writeBps < 0 {
+				return fmt.Errorf("io throttle: negative bandwidth")
+			}
+			var err error
+			cgroup, err = throttleIO(pid, readBps, writeBps)
+			return err
+		})
+		c.flushers = append(c.flushers, func() {
+			if cgroup != "" {
+				removeCgroup(cgroup)
+				cgroup = ""
+			}
+		})
+	}
+}
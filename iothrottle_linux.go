@@ -0,0 +1,115 @@
+package gocmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// throttleIO moves the process into a new cgroup limiting its io, and returns the cgroup.
+func throttleIO(pid int, readBps, writeBps int64) (string, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return "", errors.New("io throttle: cgroup v2 required")
+	}
+	parent, err := ownCgroup()
+	if err != nil {
+		return "", fmt.Errorf("io throttle: %w", err)
+	}
+	if err := enableController(parent, "io"); err != nil {
+		return "", fmt.Errorf("io throttle: enable io controller of %s: %w", parent, err)
+	}
+
+	cgroup := filepath.Join(parent, "gocmd-"+strconv.Itoa(pid))
+	if err := os.Mkdir(cgroup, 0o755); err != nil {
+		return "", fmt.Errorf("io throttle: %w", err)
+	}
+
+	if err := setIOMax(cgroup, readBps, writeBps); err != nil {
+		removeCgroup(cgroup)
+		return "", fmt.Errorf("io throttle: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(cgroup, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0o644); err != nil {
+		removeCgroup(cgroup)
+		return "", fmt.Errorf("io throttle: move %d to %s: %w", pid, cgroup, err)
+	}
+	return cgroup, nil
+}
+
+// ownCgroup returns the directory of the cgroup v2 of the current process.
+func ownCgroup() (string, error) {
+	b, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		if path, ok := strings.CutPrefix(s.Text(), "0::"); ok {
+			return filepath.Join(cgroupRoot, path), nil
+		}
+	}
+	return "", errors.New("no cgroup v2 in /proc/self/cgroup")
+}
+
+// enableController enables the controller for the children of the cgroup.
+func enableController(cgroup, controller string) error {
+	enabled, err := os.ReadFile(filepath.Join(cgroup, "cgroup.subtree_control"))
+	if err != nil {
+		return err
+	}
+	for _, c := range strings.Fields(string(enabled)) {
+		if c == controller {
+			return nil
+		}
+	}
+	return os.WriteFile(filepath.Join(cgroup, "cgroup.subtree_control"), []byte("+"+controller), 0o644)
+}
+
+// setIOMax sets the io.max of the cgroup for all the disks, failing if it could not for any.
+func setIOMax(cgroup string, readBps, writeBps int64) error {
+	limit := func(bps int64) string {
+		if bps == 0 {
+			return "max"
+		}
+		return strconv.FormatInt(bps, 10)
+	}
+
+	disks, err := filepath.Glob("/sys/block/*/dev")
+	if err != nil {
+		return err
+	}
+	var errs []error
+	set := 0
+	for _, disk := range disks {
+		name := filepath.Base(filepath.Dir(disk))
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") || strings.HasPrefix(name, "zram") {
+			continue
+		}
+		dev, err := os.ReadFile(disk)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		line := fmt.Sprintf("%s rbps=%s wbps=%s", strings.TrimSpace(string(dev)), limit(readBps), limit(writeBps))
+		if err := os.WriteFile(filepath.Join(cgroup, "io.max"), []byte(line), 0o644); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		set++
+	}
+	if set == 0 {
+		return fmt.Errorf("set io.max: %w", errors.Join(append(errs, errors.New("no disk"))...))
+	}
+	return nil
+}
+
+// removeCgroup removes the cgroup, which fails while processes started by the command are still in it.
+func removeCgroup(cgroup string) {
+	_ = os.Remove(cgroup)
+}
@@ -0,0 +1,29 @@
+package gocmd_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithIOThrottle(t *testing.T) {
+	c := gocmd.New("sleep 5", gocmd.WithIOThrottle(-1, 0))
+	assert.ErrorContains(t, c.Run(context.TODO()), "negative bandwidth")
+
+	if _, err := os.Stat("/sys/fs/cgroup/cgroup.controllers"); err != nil {
+		t.Skip("no cgroup v2")
+	}
+
+	c = gocmd.New("sleep 0.1; cat /proc/self/cgroup; cat /sys/fs/cgroup$(cut -d: -f3 /proc/self/cgroup)/io.max",
+		gocmd.WithIOThrottle(1<<20, 0))
+	if err := c.Run(context.TODO()); err != nil {
+		t.Skipf("no delegated cgroup: %v", err)
+	}
+	assert.Contains(t, c.Stdout(), "/gocmd-")
+	assert.Contains(t, c.Stdout(), "rbps=1048576 wbps=max")
+	assert.False(t, strings.Contains(c.Stderr(), "No such file"))
+}
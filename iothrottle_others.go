@@ -0,0 +1,11 @@
+//go:build !linux
+
+package gocmd
+
+import "fmt"
+
+func throttleIO(pid int, readBps, writeBps int64) (string, error) {
+	return "", fmt.Errorf("io throttle: %w", ErrNotSupported)
+}
+
+func removeCgroup(string) {}
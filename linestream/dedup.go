@@ -0,0 +1,92 @@
+package linestream
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultRepeatedFormat is the default format of the marker line emitted by Dedup.
+const DefaultRepeatedFormat = "last line repeated %d times"
+
+// Dedup is a LineProcessor stage which collapses runs of identical consecutive
+// lines into the first line plus a "last line repeated N times" marker, the
+// way syslog does, so a child spinning in a tight error loop can't flood logs.
+//
+//	dedup := linestream.NewDedup(func(line string) { log.Print(line) }, 10*time.Second)
+//	c := gocmd.New("...", gocmd.WithStdout(linestream.New(dedup.Process)))
+//	c.Run(ctx)
+//	dedup.Flush()
+//
+// The marker of a run is emitted when a different line arrives, on Flush, or
+// when the run has lasted longer than the window, in which case counting
+// starts over. A zero window never emits a marker before the run ends.
+type Dedup struct {
+	next   LineProcessor
+	window time.Duration
+	format string
+
+	mu       sync.Mutex
+	last     string
+	hasLast  bool
+	repeated int
+	since    time.Time
+}
+
+// NewDedup creates a Dedup stage passing deduplicated lines to next.
+func NewDedup(next LineProcessor, window time.Duration, options ...func(*Dedup)) *Dedup {
+	d := &Dedup{
+		next:   next,
+		window: window,
+		format: DefaultRepeatedFormat,
+	}
+	for _, o := range options {
+		o(d)
+	}
+	return d
+}
+
+// DedupFormat sets the fmt format of the marker line, which receives the repeat count.
+func DedupFormat(format string) func(*Dedup) {
+	return func(d *Dedup) {
+		d.format = format
+	}
+}
+
+// Process is the LineProcessor of the stage.
+func (d *Dedup) Process(line string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.hasLast && line == d.last {
+		d.repeated++
+		if d.window > 0 && time.Since(d.since) >= d.window {
+			d.emitRepeated()
+		}
+		return
+	}
+
+	d.emitRepeated()
+	d.last, d.hasLast = line, true
+	d.since = time.Now()
+	d.next(line)
+}
+
+// Flush emits the marker of the pending run, if any.
+func (d *Dedup) Flush() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.emitRepeated()
+}
+
+func (d *Dedup) emitRepeated() {
+	if d.repeated == 0 {
+		return
+	}
+
+	n := d.repeated
+	d.repeated = 0
+	d.since = time.Now()
+	d.next(fmt.Sprintf(d.format, n))
+}
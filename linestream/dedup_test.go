@@ -0,0 +1,44 @@
+package linestream_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd/linestream"
+	"github.com/go-test/deep"
+)
+
+func TestDedup(t *testing.T) {
+	var gotLines []string
+	d := linestream.NewDedup(func(line string) {
+		gotLines = append(gotLines, line)
+	}, 0)
+
+	out := linestream.New(d.Process)
+	_, _ = out.Write([]byte("foo\nerr\nerr\nerr\nbar\nbar\n"))
+	d.Flush()
+
+	expectLines := []string{"foo", "err", "last line repeated 2 times", "bar", "last line repeated 1 times"}
+	if diffs := deep.Equal(gotLines, expectLines); diffs != nil {
+		t.Error(diffs)
+	}
+}
+
+func TestDedupWindow(t *testing.T) {
+	var gotLines []string
+	d := linestream.NewDedup(func(line string) {
+		gotLines = append(gotLines, line)
+	}, 10*time.Millisecond, linestream.DedupFormat("(x%d)"))
+
+	d.Process("err")
+	d.Process("err")
+	time.Sleep(20 * time.Millisecond)
+	d.Process("err")
+	d.Process("err")
+	d.Flush()
+
+	expectLines := []string{"err", "(x2)", "(x1)"}
+	if diffs := deep.Equal(gotLines, expectLines); diffs != nil {
+		t.Error(diffs)
+	}
+}
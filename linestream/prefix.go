@@ -0,0 +1,107 @@
+package linestream
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Color is an ANSI foreground color code used to colorize prefixes.
+type Color int
+
+// ANSI foreground colors, in the order docker-compose cycles through them.
+const (
+	NoColor Color = 0
+	Cyan    Color = 36
+	Yellow  Color = 33
+	Green   Color = 32
+	Magenta Color = 35
+	Blue    Color = 34
+	Red     Color = 31
+)
+
+// Colors is the palette ColorOf cycles through.
+var Colors = []Color{Cyan, Yellow, Green, Magenta, Blue, Red}
+
+// ColorOf returns a stable color for the i-th command of a parallel run.
+func ColorOf(i int) Color {
+	if i < 0 {
+		i = -i
+	}
+	return Colors[i%len(Colors)]
+}
+
+// Prefixer is an io.Writer which prepends a label to each line before writing
+// it to the underlying writer, like `docker-compose up` does:
+//
+//	web_1  | listening on :8080
+//	db_1   | ready to accept connections
+//
+// Many Prefixers may share one underlying writer, each line is written by a
+// single Write call guarded by the shared locker, so lines are never split.
+type Prefixer struct {
+	*LineStream
+
+	w      io.Writer
+	mu     sync.Locker
+	label  string
+	width  int
+	color  Color
+	prefix string
+}
+
+// NewPrefixer creates a Prefixer writing lines prefixed by label to w.
+func NewPrefixer(w io.Writer, label string, options ...func(*Prefixer)) *Prefixer {
+	p := &Prefixer{
+		w:     w,
+		mu:    &sync.Mutex{},
+		label: label,
+	}
+	for _, o := range options {
+		o(p)
+	}
+
+	p.prefix = p.buildPrefix()
+	p.LineStream = New(p.writeLine)
+	return p
+}
+
+// PrefixColor colorizes the prefix with c.
+func PrefixColor(c Color) func(*Prefixer) {
+	return func(p *Prefixer) {
+		p.color = c
+	}
+}
+
+// PrefixWidth pads the label to width, so that prefixes of different commands line up.
+func PrefixWidth(width int) func(*Prefixer) {
+	return func(p *Prefixer) {
+		p.width = width
+	}
+}
+
+// PrefixLocker sets the locker guarding the underlying writer.
+// Prefixers writing to the same writer concurrently must share the same locker.
+func PrefixLocker(mu sync.Locker) func(*Prefixer) {
+	return func(p *Prefixer) {
+		p.mu = mu
+	}
+}
+
+// Prefix returns the rendered prefix, including color escapes and the separator.
+func (p *Prefixer) Prefix() string { return p.prefix }
+
+func (p *Prefixer) buildPrefix() string {
+	s := fmt.Sprintf("%-*s | ", p.width, p.label)
+	if p.color != NoColor {
+		s = fmt.Sprintf("\x1b[%dm%s\x1b[0m", p.color, s)
+	}
+	return s
+}
+
+func (p *Prefixer) writeLine(line string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, _ = io.WriteString(p.w, p.prefix+line+"\n")
+}
@@ -0,0 +1,68 @@
+package linestream_test
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/bingoohuang/gocmd/linestream"
+)
+
+func TestPrefixer(t *testing.T) {
+	var buf bytes.Buffer
+	p := linestream.NewPrefixer(&buf, "web", linestream.PrefixWidth(5))
+
+	if _, err := p.Write([]byte("foo\nba")); err != nil {
+		t.Fatalf("got err '%v', expected nil", err)
+	}
+	if _, err := p.Write([]byte("r\nbaz")); err != nil {
+		t.Fatalf("got err '%v', expected nil", err)
+	}
+	p.Flush()
+
+	expect := "web   | foo\nweb   | bar\nweb   | baz\n"
+	if got := buf.String(); got != expect {
+		t.Errorf("got '%s', expected '%s'", got, expect)
+	}
+}
+
+func TestPrefixerColor(t *testing.T) {
+	var buf bytes.Buffer
+	p := linestream.NewPrefixer(&buf, "db", linestream.PrefixColor(linestream.ColorOf(1)))
+	_, _ = p.Write([]byte("ready\n"))
+
+	expect := "\x1b[33mdb | \x1b[0mready\n"
+	if got := buf.String(); got != expect {
+		t.Errorf("got %q, expected %q", got, expect)
+	}
+}
+
+func TestPrefixerSharedWriter(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+	)
+
+	for _, label := range []string{"a", "b"} {
+		p := linestream.NewPrefixer(&buf, label, linestream.PrefixLocker(&mu))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				_, _ = p.Write([]byte("0123456789\n"))
+			}
+		}()
+	}
+	wg.Wait()
+
+	lines := bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n"))
+	if len(lines) != 200 {
+		t.Fatalf("got %d lines, expected 200", len(lines))
+	}
+	for _, line := range lines {
+		if s := string(line); s != "a | 0123456789" && s != "b | 0123456789" {
+			t.Errorf("got interleaved line '%s'", s)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package linestream
+
+import (
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// Progress is a numeric progress update extracted from an output line.
+type Progress struct {
+	Value float64 // the number captured from the line, like 42 for "42%"
+	Line  string  // the line the value was extracted from
+}
+
+// ProgressExtractor is a LineProcessor stage which applies a regexp to each
+// line and publishes the number captured by it on a channel, so that UIs can
+// render progress bars for wrapped tools like ffmpeg, rsync or pip:
+//
+//	pe := linestream.NewProgressExtractor(regexp.MustCompile(`(\d+(?:\.\d+)?)%`), nil)
+//	go func() {
+//	    for p := range pe.Updates() {
+//	        bar.Set(p.Value)
+//	    }
+//	}()
+//	c := gocmd.New("rsync --progress ...", gocmd.WithStdout(linestream.New(pe.Process)))
+//	c.Run(ctx)
+//	pe.Close()
+//
+// The value is taken from the capture group named "progress" if the regexp
+// has one, otherwise from the first capture group. Tools redrawing progress
+// with carriage returns produce many values in one line, the last one wins.
+//
+// Publishing never blocks the command output: the oldest updates are dropped
+// while the channel is full, a UI only needs the latest value anyway, like
+// the final 100%.
+type ProgressExtractor struct {
+	re    *regexp.Regexp
+	group int
+	next  LineProcessor
+	ch    chan Progress
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// DefaultProgressBufferSize is the default capacity of the ProgressExtractor channel.
+const DefaultProgressBufferSize = 16
+
+// NewProgressExtractor creates a ProgressExtractor. Lines are passed on to next if it is not nil.
+func NewProgressExtractor(re *regexp.Regexp, next LineProcessor) *ProgressExtractor {
+	group := 1
+	if i := re.SubexpIndex("progress"); i > 0 {
+		group = i
+	}
+
+	return &ProgressExtractor{
+		re:    re,
+		group: group,
+		next:  next,
+		ch:    make(chan Progress, DefaultProgressBufferSize),
+	}
+}
+
+// Updates returns the channel progress updates are published on.
+// The channel is closed by Close.
+func (p *ProgressExtractor) Updates() <-chan Progress { return p.ch }
+
+// Process is the LineProcessor of the stage.
+func (p *ProgressExtractor) Process(line string) {
+	if p.next != nil {
+		p.next(line)
+	}
+
+	matches := p.re.FindAllStringSubmatch(line, -1)
+	for i := len(matches) - 1; i >= 0; i-- {
+		if p.group >= len(matches[i]) {
+			continue
+		}
+		if v, err := strconv.ParseFloat(matches[i][p.group], 64); err == nil {
+			p.publish(Progress{Value: v, Line: line})
+			return
+		}
+	}
+}
+
+func (p *ProgressExtractor) publish(progress Progress) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return
+	}
+
+	for {
+		select {
+		case p.ch <- progress:
+			return
+		default:
+		}
+		// full, drop the oldest one, unless a reader just took it
+		select {
+		case <-p.ch:
+		default:
+		}
+	}
+}
+
+// Close closes the updates channel, call it after the command finished.
+func (p *ProgressExtractor) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.closed {
+		p.closed = true
+		close(p.ch)
+	}
+}
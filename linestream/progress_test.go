@@ -0,0 +1,62 @@
+package linestream_test
+
+import (
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/bingoohuang/gocmd/linestream"
+	"github.com/go-test/deep"
+)
+
+func TestProgressExtractor(t *testing.T) {
+	var passed []string
+	pe := linestream.NewProgressExtractor(regexp.MustCompile(`(\d+(?:\.\d+)?)%`), func(line string) {
+		passed = append(passed, line)
+	})
+
+	out := linestream.New(pe.Process)
+	_, _ = out.Write([]byte("starting\n 10% done\r 20% done\r 35.5% done\nfinished\n"))
+	pe.Close()
+
+	var got []float64
+	for p := range pe.Updates() {
+		got = append(got, p.Value)
+	}
+
+	if diffs := deep.Equal(got, []float64{35.5}); diffs != nil {
+		t.Error(diffs)
+	}
+	if len(passed) != 3 {
+		t.Errorf("got %d lines passed on, expected 3", len(passed))
+	}
+}
+
+func TestProgressExtractorNamedGroup(t *testing.T) {
+	pe := linestream.NewProgressExtractor(regexp.MustCompile(`(frame)=\s*(?P<progress>\d+)`), nil)
+	pe.Process("frame=  120 fps=30")
+	pe.Close()
+
+	p, ok := <-pe.Updates()
+	if !ok || p.Value != 120 || p.Line != "frame=  120 fps=30" {
+		t.Errorf("got %+v, expected value 120", p)
+	}
+}
+
+func TestProgressExtractorNeverBlocks(t *testing.T) {
+	pe := linestream.NewProgressExtractor(regexp.MustCompile(`(\d+)%`), nil)
+	for i := 1; i <= 100; i++ {
+		pe.Process(strconv.Itoa(i) + "%")
+	}
+	pe.Close()
+	pe.Process("60%") // after Close must not panic
+
+	var got []float64
+	for p := range pe.Updates() {
+		got = append(got, p.Value)
+	}
+	// the oldest ones are dropped, the latest kept
+	if len(got) != linestream.DefaultProgressBufferSize || got[0] != float64(101-linestream.DefaultProgressBufferSize) || got[len(got)-1] != 100 {
+		t.Errorf("got updates %v, expected the last %d up to 100", got, linestream.DefaultProgressBufferSize)
+	}
+}
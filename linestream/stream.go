@@ -131,6 +131,19 @@ LINES:
 	return n, err // implicit
 }
 
+// Flush sends the buffered unterminated line, if any, to the line processor.
+// Call it after the command finished, so that a last line without a trailing
+// newline is not lost.
+func (rw *LineStream) Flush() {
+	if rw.lastChar == 0 {
+		return
+	}
+
+	line := string(rw.buf[0:rw.lastChar])
+	rw.lastChar = 0
+	rw.lineProcessor(line)
+}
+
 // SetLineBufferSize sets the internal line buffer size. The default is DEFAULT_LINE_BUFFER_SIZE.
 // This function must be called immediately after New, and it is not
 // safe to call by multiple goroutines.
@@ -0,0 +1,192 @@
+package gocmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Manifest records what exactly was executed by a run of a command, for
+// supply-chain and compliance audits: the executable with its digest and
+// version, the args, a digest of the env, the times and the exit code. The
+// args are masked like by Redacted, the env is only digested. A signed
+// manifest can be verified by the public key of the signer.
+type Manifest struct {
+	Command string `json:"command"`
+	// Path is the resolved executable, the shell of the commands run by a shell.
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	// Version is the first line of the output of the version probe, if any.
+	Version string   `json:"version,omitempty"`
+	Args    []string `json:"args"`
+	Dir     string   `json:"dir,omitempty"`
+	// EnvSHA256 is the digest of the sorted env vars the command was started with.
+	EnvSHA256 string    `json:"env_sha256"`
+	Labels    Labels    `json:"labels,omitempty"`
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished"`
+	ExitCode  int       `json:"exit_code"`
+	Attempt   int       `json:"attempt"`
+	// Approval is the decision of the approval of WithApproval, if required.
+	Approval *Approval `json:"approval,omitempty"`
+	// Signature is the ed25519 signature of the manifest without it, if signed.
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// ErrInvalidSignature is returned by Manifest.Verify for unsigned or tampered manifests.
+var ErrInvalidSignature = errors.New("invalid manifest signature")
+
+// Sign signs the manifest by the key.
+func (m *Manifest) Sign(key ed25519.PrivateKey) error {
+	payload, err := m.payload()
+	if err != nil {
+		return err
+	}
+	m.Signature = ed25519.Sign(key, payload)
+	return nil
+}
+
+// Verify verifies the signature of the manifest by the public key of its signer.
+func (m *Manifest) Verify(key ed25519.PublicKey) error {
+	payload, err := m.payload()
+	if err != nil {
+		return err
+	}
+	if len(m.Signature) == 0 || !ed25519.Verify(key, payload, m.Signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// payload returns the signed bytes, the JSON of the manifest without its signature.
+func (m *Manifest) payload() ([]byte, error) {
+	unsigned := *m
+	unsigned.Signature = nil
+	return json.Marshal(unsigned)
+}
+
+// WithManifest records the manifest of each run of the command, returned by
+// Manifest, signed by the key if not nil. The executable is digested right
+// before it is started. With versionArgs, like "--version", the executable
+// is run with them first, and the first line of its output is the version.
+// The manifest is kept if f is nil, else passed to f once the command exited.
+//
+// Example:
+//
+//	c := gocmd.New("", gocmd.WithCmd(exec.Command("terraform", "apply", "-auto-approve")),
+//		gocmd.WithManifest(key, func(m *gocmd.Manifest) { audit.Write(m) }, "version"))
+func WithManifest(key ed25519.PrivateKey, f func(*Manifest), versionArgs ...string) func(c *Cmd) {
+	return func(c *Cmd) {
+		var m *Manifest
+		// first, before options like WithSandbox replace the executable
+		c.beforeStart = append([]func(*exec.Cmd) error{func(cmd *exec.Cmd) error {
+			sum, err := fileSHA256(cmd.Path)
+			if err != nil {
+				return err
+			}
+			m = &Manifest{
+				Command: c.Redacted(),
+				Path:    cmd.Path,
+				SHA256:  sum,
+				Args:    c.redactArgs(cmd.Args),
+				Dir:     cmd.Dir,
+				Labels:  c.Labels(),
+			}
+			if len(versionArgs) > 0 {
+				m.Version = probeVersion(cmd.Path, cmd.Env, versionArgs)
+			}
+			c.mu.Lock()
+			m.Approval = c.approval
+			c.mu.Unlock()
+			return nil
+		}}, c.beforeStart...)
+		c.afterStart = append(c.afterStart, func(int) error {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			m.EnvSHA256 = envSHA256(c.env)
+			m.Started, m.Attempt = c.started, c.attempts
+			return nil
+		})
+		c.flushers = append(c.flushers, func() {
+			if m == nil || m.Started.IsZero() {
+				m = nil // not started
+				return
+			}
+			c.mu.Lock()
+			m.Finished, m.ExitCode = c.finished, c.exitCode
+			c.mu.Unlock()
+			if key != nil {
+				_ = m.Sign(key)
+			}
+
+			if f != nil {
+				f(m)
+			} else {
+				c.mu.Lock()
+				c.manifest = m
+				c.mu.Unlock()
+			}
+			m = nil
+		})
+	}
+}
+
+// Manifest returns the manifest of the last run of the command recorded by
+// WithManifest, nil if it was not started or passed to the function of WithManifest.
+func (c *Cmd) Manifest() *Manifest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.manifest
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// probeVersion returns the first line of the output of the executable run with the args, empty if it failed.
+func probeVersion(path string, env, args []string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Env = env
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return ""
+	}
+	line, _, _ := strings.Cut(string(bytes.TrimSpace(out)), "\n")
+	return strings.TrimSpace(line)
+}
+
+func envSHA256(env []string) string {
+	sorted := append([]string(nil), env...)
+	sort.Strings(sorted)
+	h := sha256.New()
+	for _, kv := range sorted {
+		h.Write([]byte(kv))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,63 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithManifest(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	path, err := exec.LookPath("sh")
+	assert.Nil(t, err)
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	sum := sha256.Sum256(data)
+
+	c := gocmd.New("", gocmd.WithCmd(exec.Command(path, "-c", "exit 3", "token=s3cret")),
+		gocmd.WithRedactedArgs(3), gocmd.WithLabels(map[string]string{"job": "j1"}),
+		gocmd.WithManifest(key, nil, "-c", "echo v1.2.3; echo more"))
+	assert.Nil(t, c.Run(context.TODO()))
+
+	m := c.Manifest()
+	if assert.NotNil(t, m) {
+		assert.Equal(t, path, m.Path)
+		assert.Equal(t, hex.EncodeToString(sum[:]), m.SHA256)
+		assert.Equal(t, "v1.2.3", m.Version)
+		assert.Equal(t, []string{path, "-c", "exit 3", "***"}, m.Args)
+		assert.Equal(t, 3, m.ExitCode)
+		assert.Equal(t, 1, m.Attempt)
+		assert.Equal(t, "j1", m.Labels["job"])
+		assert.Len(t, m.EnvSHA256, 64)
+		assert.False(t, m.Finished.Before(m.Started))
+
+		assert.Nil(t, m.Verify(pub))
+		m.ExitCode = 0
+		assert.ErrorIs(t, m.Verify(pub), gocmd.ErrInvalidSignature)
+	}
+}
+
+func TestWithManifestFunc(t *testing.T) {
+	var manifests []*gocmd.Manifest
+	c := gocmd.New("exit 1", gocmd.WithRetry(gocmd.RetryPolicy{Retries: 1}),
+		gocmd.WithManifest(nil, func(m *gocmd.Manifest) { manifests = append(manifests, m) }))
+	assert.Nil(t, c.Run(context.TODO()))
+
+	assert.Nil(t, c.Manifest())
+	if assert.Len(t, manifests, 2) {
+		assert.Equal(t, 1, manifests[0].Attempt)
+		assert.Equal(t, 2, manifests[1].Attempt)
+		assert.Equal(t, "exit 1", manifests[1].Command)
+		assert.Empty(t, manifests[1].Signature)
+	}
+}
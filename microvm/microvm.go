@@ -0,0 +1,246 @@
+// Package microvm runs commands in Firecracker microVMs, for fully untrusted
+// code, like the one submitted by the users of a service. Experimental.
+//
+// The VM boots the kernel on the read-only root filesystem image, whose init
+// is the guest agent, with the shared directory image attached as the second
+// drive, /dev/vdb, since Firecracker has no shared filesystem. The agent
+// connects to the vsock Port of the host, CID 2, reads the request, a JSON
+// line like {"command": "make test"}, runs it by sh -c, streams its output as
+// frames, and sends its exit code before powering the VM off. A frame is a
+// kind byte, 1 for stdout, 2 for stderr and 3 for the exit code, the length of
+// the payload as a big-endian uint32, and the payload, a big-endian int32 for
+// the exit code.
+//
+//	vm := microvm.VM{Kernel: "vmlinux", RootFS: "agent.ext4", Shared: "work.ext4"}
+//	code, err := vm.Run(ctx, "python3 /shared/main.py", os.Stdout, os.Stderr)
+package microvm
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+)
+
+// Frame kinds of the guest agent.
+const (
+	FrameStdout = 1
+	FrameStderr = 2
+	FrameExit   = 3
+)
+
+// ErrNoExitCode is returned by VM.Run if the VM exited before the agent sent the exit code.
+var ErrNoExitCode = errors.New("microvm exited without an exit code")
+
+// VM is a microVM configuration, each Run boots a VM of its own.
+type VM struct {
+	// Firecracker is the firecracker executable, "firecracker" if empty.
+	Firecracker string
+	// Kernel is the uncompressed kernel image.
+	Kernel string
+	// BootArgs are the kernel command line, "console=ttyS0 reboot=k panic=1 pci=off" if empty.
+	BootArgs string
+	// RootFS is the root filesystem image, attached read-only, whose init is the guest agent.
+	RootFS string
+	// Shared, if not empty, is the image of the shared directory, attached read-write.
+	Shared string
+	// VCPUs is the number of vCPUs, 1 if 0.
+	VCPUs int
+	// MemoryMiB is the memory size, 256 if 0.
+	MemoryMiB int
+	// Port is the vsock port the agent connects to, 1024 if 0.
+	Port uint32
+	// Console, if not nil, receives the serial console of the VM, the boot logs.
+	Console io.Writer
+	// BootTimeout is how long the agent has to connect once the VM started, 10s if 0.
+	BootTimeout time.Duration
+}
+
+// request is the request sent to the guest agent.
+type request struct {
+	Command string `json:"command"`
+}
+
+// Config returns the firecracker configuration of a VM whose vsock is the unix socket of the path.
+func (v *VM) Config(vsock string) ([]byte, error) {
+	bootArgs, vcpus, memory := v.BootArgs, v.VCPUs, v.MemoryMiB
+	if bootArgs == "" {
+		bootArgs = "console=ttyS0 reboot=k panic=1 pci=off"
+	}
+	if vcpus <= 0 {
+		vcpus = 1
+	}
+	if memory <= 0 {
+		memory = 256
+	}
+
+	type drive struct {
+		DriveID      string `json:"drive_id"`
+		PathOnHost   string `json:"path_on_host"`
+		IsRootDevice bool   `json:"is_root_device"`
+		IsReadOnly   bool   `json:"is_read_only"`
+	}
+	drives := []drive{{DriveID: "rootfs", PathOnHost: v.RootFS, IsRootDevice: true, IsReadOnly: true}}
+	if v.Shared != "" {
+		drives = append(drives, drive{DriveID: "shared", PathOnHost: v.Shared})
+	}
+	return json.MarshalIndent(map[string]interface{}{
+		"boot-source": map[string]interface{}{"kernel_image_path": v.Kernel, "boot_args": bootArgs},
+		"drives":      drives,
+		"machine-config": map[string]interface{}{
+			"vcpu_count":   vcpus,
+			"mem_size_mib": memory,
+		},
+		"vsock": map[string]interface{}{"guest_cid": 3, "uds_path": vsock},
+	}, "", "  ")
+}
+
+// Run boots a VM, runs the command in it by the guest agent, streaming its
+// output to stdout and stderr, and returns its exit code. The VM is killed
+// once the command exited, or ctx is done.
+func (v *VM) Run(ctx context.Context, command string, stdout, stderr io.Writer) (int, error) {
+	dir, err := os.MkdirTemp("", "gocmd-microvm-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(dir)
+
+	vsock := filepath.Join(dir, "vsock.sock")
+	config, err := v.Config(vsock)
+	if err != nil {
+		return 0, err
+	}
+	configFile := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(configFile, config, 0o600); err != nil {
+		return 0, err
+	}
+
+	// the connections of the guest to the port arrive on the socket of the port
+	port := v.Port
+	if port == 0 {
+		port = 1024
+	}
+	ln, err := net.Listen("unix", vsock+"_"+strconv.FormatUint(uint64(port), 10))
+	if err != nil {
+		return 0, err
+	}
+	defer ln.Close()
+
+	firecracker := v.Firecracker
+	if firecracker == "" {
+		firecracker = "firecracker"
+	}
+	console := v.Console
+	if console == nil {
+		console = io.Discard
+	}
+	vmCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	c := gocmd.New("", gocmd.WithCmd(exec.Command(firecracker, "--no-api", "--config-file", configFile)),
+		gocmd.WithTimeout(0), gocmd.WithStdout(console), gocmd.WithStderr(console), gocmd.WithMaxBuffer(64*1024))
+	exited := make(chan error, 1)
+	go func() { exited <- c.Run(vmCtx) }()
+
+	conn, err := accept(ctx, ln, v.BootTimeout, exited)
+	if err != nil {
+		stop()
+		return 0, err
+	}
+	defer conn.Close()
+	go func() {
+		<-vmCtx.Done()
+		_ = conn.Close()
+	}()
+
+	if err := json.NewEncoder(conn).Encode(request{Command: command}); err != nil {
+		return 0, fmt.Errorf("send request: %w", err)
+	}
+	code, err := readFrames(bufio.NewReader(conn), stdout, stderr)
+	stop()
+	<-exited
+	if err != nil && ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	return code, err
+}
+
+// accept waits for the connection of the agent, until the boot timeout, or the VM exited.
+func accept(ctx context.Context, ln net.Listener, timeout time.Duration, exited <-chan error) (net.Conn, error) {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	type accepted struct {
+		conn net.Conn
+		err  error
+	}
+	ch := make(chan accepted, 1)
+	go func() {
+		conn, err := ln.Accept()
+		ch <- accepted{conn, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case a := <-ch:
+		return a.conn, a.err
+	case err := <-exited:
+		if err == nil {
+			err = ErrNoExitCode
+		}
+		return nil, fmt.Errorf("microvm exited before the agent connected: %w", err)
+	case <-timer.C:
+		return nil, fmt.Errorf("agent did not connect in %s", timeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// readFrames copies the output frames to stdout and stderr, until the exit frame.
+func readFrames(r io.Reader, stdout, stderr io.Writer) (int, error) {
+	var header [5]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return 0, ErrNoExitCode
+			}
+			return 0, err
+		}
+		n := int64(binary.BigEndian.Uint32(header[1:]))
+		switch header[0] {
+		case FrameStdout, FrameStderr:
+			w := stdout
+			if header[0] == FrameStderr {
+				w = stderr
+			}
+			if w == nil {
+				w = io.Discard
+			}
+			if _, err := io.CopyN(w, r, n); err != nil {
+				return 0, err
+			}
+		case FrameExit:
+			var code [4]byte
+			if n != 4 {
+				return 0, fmt.Errorf("invalid exit frame of %d bytes", n)
+			}
+			if _, err := io.ReadFull(r, code[:]); err != nil {
+				return 0, err
+			}
+			return int(int32(binary.BigEndian.Uint32(code[:]))), nil
+		default:
+			return 0, fmt.Errorf("invalid frame kind %d", header[0])
+		}
+	}
+}
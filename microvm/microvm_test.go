@@ -0,0 +1,100 @@
+//go:build !windows
+
+package microvm_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/gocmd/microvm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv("FAKE_FIRECRACKER") != "" {
+		fakeFirecracker()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// fakeFirecracker plays the guest agent, echoing the command to stdout and
+// stderr, and exiting with its length.
+func fakeFirecracker() {
+	var config struct {
+		Vsock struct {
+			UDSPath string `json:"uds_path"`
+		} `json:"vsock"`
+	}
+	b, _ := os.ReadFile(os.Args[len(os.Args)-1])
+	_ = json.Unmarshal(b, &config)
+	if os.Getenv("FAKE_FIRECRACKER") == "crash" {
+		os.Exit(1)
+	}
+
+	conn, err := net.Dial("unix", config.Vsock.UDSPath+"_1024")
+	if err != nil {
+		os.Exit(2)
+	}
+	line, _ := readLine(conn)
+	var req struct{ Command string }
+	_ = json.Unmarshal(line, &req)
+
+	frame := func(kind byte, payload []byte) {
+		header := []byte{kind, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+		_, _ = conn.Write(append(header, payload...))
+	}
+	frame(microvm.FrameStdout, []byte(req.Command+"\n"))
+	frame(microvm.FrameStderr, []byte("err "+req.Command+"\n"))
+	code := make([]byte, 4)
+	binary.BigEndian.PutUint32(code, uint32(len(req.Command)))
+	frame(microvm.FrameExit, code)
+	_ = conn.Close()
+}
+
+func readLine(conn net.Conn) ([]byte, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		if _, err := conn.Read(b); err != nil {
+			return line, err
+		}
+		if b[0] == '\n' {
+			return line, nil
+		}
+		line = append(line, b[0])
+	}
+}
+
+func TestVMRun(t *testing.T) {
+	t.Setenv("FAKE_FIRECRACKER", "1")
+
+	vm := microvm.VM{Firecracker: os.Args[0], Kernel: "vmlinux", RootFS: "agent.ext4", Shared: "work.ext4"}
+	var stdout, stderr bytes.Buffer
+	code, err := vm.Run(context.TODO(), "make test", &stdout, &stderr)
+	assert.Nil(t, err)
+	assert.Equal(t, 9, code)
+	assert.Equal(t, "make test\n", stdout.String())
+	assert.Equal(t, "err make test\n", stderr.String())
+
+	t.Setenv("FAKE_FIRECRACKER", "crash")
+	_, err = vm.Run(context.TODO(), "make test", &stdout, &stderr)
+	assert.ErrorContains(t, err, "exited before the agent connected")
+}
+
+func TestVMConfig(t *testing.T) {
+	vm := microvm.VM{Kernel: "vmlinux", RootFS: "agent.ext4", VCPUs: 2}
+	config, err := vm.Config("/tmp/v.sock")
+	assert.Nil(t, err)
+	for _, s := range []string{`"kernel_image_path": "vmlinux"`, `"vcpu_count": 2`, `"mem_size_mib": 256`,
+		`"uds_path": "/tmp/v.sock"`, `"is_read_only": true`} {
+		assert.True(t, strings.Contains(string(config), s), s)
+	}
+}
@@ -0,0 +1,82 @@
+package nats_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd/nats"
+	"github.com/stretchr/testify/assert"
+)
+
+type message struct{ subject, data string }
+
+// serve runs a fake NATS server accepting one connection, sending the
+// messages published to it on the returned channel, and the CONNECT line first.
+func serve(t *testing.T, info string) (string, <-chan message) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	messages := make(chan message, 10)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		defer close(messages)
+
+		io.WriteString(conn, "INFO "+info+"\r\n")
+		io.WriteString(conn, "PING\r\n")
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			switch fields[0] {
+			case "CONNECT":
+				messages <- message{subject: "CONNECT", data: strings.TrimSpace(line[8:])}
+			case "PING":
+				io.WriteString(conn, "PONG\r\n")
+			case "PUB":
+				n, _ := strconv.Atoi(fields[2])
+				data := make([]byte, n+2)
+				io.ReadFull(r, data)
+				messages <- message{subject: fields[1], data: string(data[:n])}
+			}
+		}
+	}()
+	return "nats://secret@" + l.Addr().String(), messages
+}
+
+func TestPublish(t *testing.T) {
+	url, messages := serve(t, `{"server_id":"test"}`)
+	c, err := nats.Dial(url)
+	assert.Nil(t, err)
+
+	connect := <-messages
+	assert.Contains(t, connect.data, `"auth_token":"secret"`)
+
+	assert.Nil(t, c.Publish("logs.a", []byte("hello")))
+	assert.Nil(t, c.Publish("logs.b", []byte("")))
+	assert.Error(t, c.Publish("logs a", []byte("x")))
+	assert.Nil(t, c.Flush(time.Second))
+	assert.Equal(t, message{"logs.a", "hello"}, <-messages)
+	assert.Equal(t, message{"logs.b", ""}, <-messages)
+	assert.Nil(t, c.Close())
+}
+
+func TestTLSRequired(t *testing.T) {
+	url, _ := serve(t, `{"tls_required":true}`)
+	_, err := nats.Dial(url)
+	assert.ErrorContains(t, err, "TLS required")
+}
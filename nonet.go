@@ -0,0 +1,17 @@
+package gocmd
+
+// WithNoNetwork runs the command in a new network namespace of its own, with
+// no network interface but a loopback one which is down, so that untrusted
+// converters or parsers can not send data away, without containers. A new
+// user namespace mapping the current user to itself is created too if the
+// current user is not root, which needs unprivileged user namespaces to be
+// enabled. Run fails on other platforms than Linux.
+//
+// Example:
+//
+//	c := gocmd.New("pdftotext untrusted.pdf out.txt", gocmd.WithNoNetwork())
+func WithNoNetwork() func(c *Cmd) {
+	return func(c *Cmd) {
+		c.beforeStart = append(c.beforeStart, isolateNetwork)
+	}
+}
@@ -0,0 +1,21 @@
+package gocmd
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+func isolateNetwork(cmd *exec.Cmd) error {
+	attr := cmd.SysProcAttr
+	attr.Cloneflags |= syscall.CLONE_NEWNET
+	if uid := os.Geteuid(); uid != 0 {
+		// creating a network namespace needs CAP_SYS_ADMIN, which the
+		// command has in a new user namespace
+		gid := os.Getegid()
+		attr.Cloneflags |= syscall.CLONE_NEWUSER
+		attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}}
+		attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}}
+	}
+	return nil
+}
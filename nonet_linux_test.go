@@ -0,0 +1,27 @@
+package gocmd_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithNoNetwork(t *testing.T) {
+	netns, err := os.Readlink("/proc/self/ns/net")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	c := gocmd.New("readlink /proc/self/ns/net; tail -n +3 /proc/net/dev | cut -d: -f1", gocmd.WithNoNetwork())
+	if err := c.Run(context.TODO()); err != nil {
+		t.Skipf("no network namespaces: %v", err)
+	}
+
+	lines := strings.Fields(c.Stdout())
+	assert.NotEqual(t, netns, lines[0])
+	assert.Equal(t, []string{"lo"}, lines[1:])
+}
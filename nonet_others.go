@@ -0,0 +1,12 @@
+//go:build !linux
+
+package gocmd
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+func isolateNetwork(*exec.Cmd) error {
+	return fmt.Errorf("network namespace: %w", ErrNotSupported)
+}
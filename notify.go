@@ -0,0 +1,280 @@
+package gocmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NotificationKind tells why a Notifier notifies.
+type NotificationKind string
+
+const (
+	// NotifyFailure is a command which failed, by its exit code or an error of Run.
+	NotifyFailure NotificationKind = "failure"
+	// NotifyTimeout is a command which timed out.
+	NotifyTimeout NotificationKind = "timeout"
+	// NotifyRestartStorm is a command restarted too often, see Notifier.Restarted.
+	NotifyRestartStorm NotificationKind = "restart storm"
+)
+
+// Notification is an alert sent by a Notifier.
+type Notification struct {
+	Kind NotificationKind `json:"kind"`
+	Time time.Time        `json:"time"`
+	Host string           `json:"host"`
+	// Command is the command line, masked like by Redacted.
+	Command  string `json:"command"`
+	Labels   Labels `json:"labels,omitempty"`
+	ExitCode int    `json:"exit_code"`
+	// Error is the error of Run, or the reason of the last restart of a restart storm.
+	Error string `json:"error,omitempty"`
+	// StderrTail are the last lines of the captured stderr.
+	StderrTail []string `json:"stderr_tail,omitempty"`
+}
+
+// Subject returns a one line summary of the notification, like
+// "gocmd failure on web1: ./backup.sh (exit code 3)".
+func (n Notification) Subject() string {
+	s := fmt.Sprintf("gocmd %s on %s: %s", n.Kind, n.Host, n.Command)
+	if n.Kind == NotifyFailure && n.Error == "" {
+		s += fmt.Sprintf(" (exit code %d)", n.ExitCode)
+	}
+	return s
+}
+
+// Text returns the notification as plain text, the subject, the labels, the
+// error and the stderr tail.
+func (n Notification) Text() string {
+	var b strings.Builder
+	b.WriteString(n.Subject() + "\n")
+	if len(n.Labels) > 0 {
+		b.WriteString("labels: " + n.Labels.String() + "\n")
+	}
+	if n.Error != "" {
+		b.WriteString("error: " + n.Error + "\n")
+	}
+	if len(n.StderrTail) > 0 {
+		b.WriteString("stderr:\n")
+		for _, line := range n.StderrTail {
+			b.WriteString("  " + line + "\n")
+		}
+	}
+	return b.String()
+}
+
+// NotifyTransport sends notifications, like SMTPTransport or SlackTransport.
+type NotifyTransport interface {
+	Send(ctx context.Context, n Notification) error
+}
+
+// NotifyTransportFunc is a NotifyTransport of a func.
+type NotifyTransportFunc func(ctx context.Context, n Notification) error
+
+// Send implements NotifyTransport.
+func (f NotifyTransportFunc) Send(ctx context.Context, n Notification) error {
+	return f(ctx, n)
+}
+
+// Notifier sends notifications of failed and timed out commands, and of
+// restart storms of supervised ones, with their labels and the tail of their
+// stderr, by its transports, the alerting of commands run like cron jobs.
+//
+// Example:
+//
+//	n := &gocmd.Notifier{Transports: []gocmd.NotifyTransport{
+//		&gocmd.SlackTransport{URL: os.Getenv("SLACK_WEBHOOK_URL")},
+//		&gocmd.SMTPTransport{Addr: "smtp.example.com:587", From: "cron@example.com", To: []string{"ops@example.com"}},
+//	}}
+//	c := gocmd.New("./backup.sh", gocmd.WithNotifier(n))
+type Notifier struct {
+	Transports []NotifyTransport
+	// TailLines is the number of lines of the stderr tail, 20 if zero.
+	TailLines int
+	// StormRestarts and StormWindow tell a restart storm, StormRestarts
+	// restarts within StormWindow, 5 and 10m if zero. It is notified once per
+	// StormWindow.
+	StormRestarts int
+	StormWindow   time.Duration
+	// OnError, if not nil, is called with the errors of the transports.
+	OnError func(error)
+
+	mu       sync.Mutex
+	restarts []time.Time
+	stormed  time.Time // when the last restart storm was notified
+}
+
+// WithNotifier notifies the failure or timeout of the command by the
+// notifier, once Run returned, after its retries.
+func WithNotifier(n *Notifier) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.afterRun = append(c.afterRun, func(err error) {
+			if kind, failed := c.notificationKind(err); failed {
+				n.Notify(context.Background(), n.notification(kind, c, err))
+			}
+		})
+	}
+}
+
+// notificationKind tells if the command failed, and how.
+func (c *Cmd) notificationKind(err error) (NotificationKind, bool) {
+	switch {
+	case errors.Is(err, ErrTimeout):
+		return NotifyTimeout, true
+	case err != nil:
+		return NotifyFailure, true
+	}
+	return NotifyFailure, c.outcome() != Success
+}
+
+// Restarted records a restart of the command, like by a Supervisor, and
+// notifies a restart storm once there were StormRestarts within StormWindow.
+func (n *Notifier) Restarted(c *Cmd, reason string) {
+	restarts, window := n.StormRestarts, n.StormWindow
+	if restarts <= 0 {
+		restarts = 5
+	}
+	if window <= 0 {
+		window = 10 * time.Minute
+	}
+
+	now := time.Now()
+	n.mu.Lock()
+	n.restarts = append(n.restarts, now)
+	for len(n.restarts) > 0 && now.Sub(n.restarts[0]) > window {
+		n.restarts = n.restarts[1:]
+	}
+	storm := len(n.restarts) >= restarts && now.Sub(n.stormed) > window
+	if storm {
+		n.stormed = now
+	}
+	count := len(n.restarts)
+	n.mu.Unlock()
+
+	if storm {
+		nt := n.notification(NotifyRestartStorm, c, nil)
+		nt.Error = fmt.Sprintf("%d restarts within %s, last by %s", count, window, reason)
+		n.Notify(context.Background(), nt)
+	}
+}
+
+// notification returns the notification of the command.
+func (n *Notifier) notification(kind NotificationKind, c *Cmd, err error) Notification {
+	host, _ := os.Hostname()
+	nt := Notification{
+		Kind:     kind,
+		Time:     time.Now(),
+		Host:     host,
+		Command:  c.Redacted(),
+		Labels:   c.Labels(),
+		ExitCode: c.exitCode,
+	}
+	if err != nil {
+		nt.Error = err.Error()
+	}
+	tail := n.TailLines
+	if tail <= 0 {
+		tail = 20
+	}
+	nt.StderrTail = lastLines(c.StderrBuf.String(), tail)
+	return nt
+}
+
+// lastLines returns the last n lines of s.
+func lastLines(s string, n int) []string {
+	s = strings.TrimRight(s, "\n")
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(s, "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+// Notify sends the notification by all transports, the errors are reported to OnError.
+func (n *Notifier) Notify(ctx context.Context, nt Notification) {
+	for _, t := range n.Transports {
+		if err := t.Send(ctx, nt); err != nil && n.OnError != nil {
+			n.OnError(err)
+		}
+	}
+}
+
+// SlackTransport posts notifications to a Slack incoming webhook, or any
+// endpoint accepting {"text": "..."}, like Mattermost.
+type SlackTransport struct {
+	URL string
+	// Client is a client with a timeout of 10s if nil.
+	Client *http.Client
+}
+
+// Send implements NotifyTransport.
+func (t *SlackTransport) Send(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(map[string]string{"text": "*" + n.Subject() + "*\n" + strings.TrimPrefix(n.Text(), n.Subject()+"\n")})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := t.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("slack: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("slack: %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	return nil
+}
+
+// SMTPTransport mails notifications by an SMTP server, with STARTTLS if the
+// server supports it.
+type SMTPTransport struct {
+	// Addr is the host:port of the server, like smtp.example.com:587.
+	Addr string
+	// Username and Password, if not empty, authenticate by PLAIN auth.
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// Send implements NotifyTransport.
+func (t *SMTPTransport) Send(_ context.Context, n Notification) error {
+	var auth smtp.Auth
+	if t.Username != "" {
+		host, _, _ := net.SplitHostPort(t.Addr)
+		auth = smtp.PlainAuth("", t.Username, t.Password, host)
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", t.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(t.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", strings.NewReplacer("\r", " ", "\n", " ").Replace(n.Subject()))
+	fmt.Fprintf(&msg, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(n.Text(), "\n", "\r\n"))
+	if err := smtp.SendMail(t.Addr, auth, t.From, t.To, msg.Bytes()); err != nil {
+		return fmt.Errorf("smtp %s: %w", t.Addr, err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithNotifier(t *testing.T) {
+	texts := make(chan string, 2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		texts <- body["text"]
+	}))
+	defer ts.Close()
+
+	var notes []gocmd.Notification
+	n := &gocmd.Notifier{
+		TailLines: 2,
+		Transports: []gocmd.NotifyTransport{
+			&gocmd.SlackTransport{URL: ts.URL},
+			gocmd.NotifyTransportFunc(func(_ context.Context, n gocmd.Notification) error {
+				notes = append(notes, n)
+				return nil
+			}),
+		},
+	}
+
+	c := gocmd.New("echo one >&2; echo two >&2; echo three >&2; exit 3",
+		gocmd.WithLabels(map[string]string{"job": "backup"}), gocmd.WithNotifier(n))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Len(t, notes, 1)
+	assert.Equal(t, gocmd.NotifyFailure, notes[0].Kind)
+	assert.Equal(t, 3, notes[0].ExitCode)
+	assert.Equal(t, []string{"two", "three"}, notes[0].StderrTail)
+	assert.Equal(t, gocmd.Labels{"job": "backup"}, notes[0].Labels)
+	assert.True(t, strings.HasSuffix(notes[0].Subject(), "(exit code 3)"))
+
+	text := <-texts
+	assert.Contains(t, text, "labels: job=backup")
+	assert.Contains(t, text, "stderr:\n  two\n  three\n")
+
+	c = gocmd.New("sleep 10", gocmd.WithTimeout(50*time.Millisecond), gocmd.WithNotifier(n))
+	assert.ErrorIs(t, c.Run(context.TODO()), gocmd.ErrTimeout)
+	assert.Len(t, notes, 2)
+	assert.Equal(t, gocmd.NotifyTimeout, notes[1].Kind)
+	<-texts
+
+	c = gocmd.New("echo ok", gocmd.WithNotifier(n))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Len(t, notes, 2)
+}
+
+func TestNotifierTransportError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_token", http.StatusForbidden)
+	}))
+	defer ts.Close()
+
+	var errs []error
+	n := &gocmd.Notifier{
+		Transports: []gocmd.NotifyTransport{&gocmd.SlackTransport{URL: ts.URL}},
+		OnError:    func(err error) { errs = append(errs, err) },
+	}
+	assert.Nil(t, gocmd.New("exit 1", gocmd.WithNotifier(n)).Run(context.TODO()))
+	assert.Len(t, errs, 1)
+	assert.EqualError(t, errs[0], "slack: 403 Forbidden: invalid_token")
+}
@@ -0,0 +1,24 @@
+package gocmd
+
+import "fmt"
+
+// WithOOMScoreAdj sets the oom_score_adj of the command right after it
+// started, from -1000 to 1000, so that a sacrificial helper command with a
+// high score is killed before the host service under memory pressure.
+// Lowering it below the one of the current process needs CAP_SYS_RESOURCE.
+// The processes the command starts inherit it, the ones it started before
+// it was set do not. Run fails on other platforms than Linux.
+//
+// Example:
+//
+//	c := gocmd.New("./thumbnailer", gocmd.WithOOMScoreAdj(1000))
+func WithOOMScoreAdj(n int) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.afterStart = append(c.afterStart, func(pid int) error {
+			if n < -1000 || n > 1000 {
+				return fmt.Errorf("oom_score_adj %d out of [-1000, 1000]", n)
+			}
+			return setOOMScoreAdj(pid, n)
+		})
+	}
+}
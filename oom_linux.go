@@ -0,0 +1,12 @@
+package gocmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+func setOOMScoreAdj(pid, n int) error {
+	path := fmt.Sprintf("/proc/%d/oom_score_adj", pid)
+	return os.WriteFile(path, []byte(strconv.Itoa(n)), 0o644)
+}
@@ -0,0 +1,19 @@
+package gocmd_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithOOMScoreAdj(t *testing.T) {
+	c := gocmd.New("sleep 0.1; cat /proc/$$/oom_score_adj", gocmd.WithOOMScoreAdj(1000))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, "1000", strings.TrimSpace(c.Stdout()))
+
+	c = gocmd.New("sleep 5", gocmd.WithOOMScoreAdj(2000))
+	assert.ErrorContains(t, c.Run(context.TODO()), "out of [-1000, 1000]")
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package gocmd
+
+import "fmt"
+
+func setOOMScoreAdj(pid, n int) error {
+	return fmt.Errorf("oom_score_adj: %w", ErrNotSupported)
+}
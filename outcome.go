@@ -0,0 +1,91 @@
+package gocmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Outcome classifies the exit code of a command.
+type Outcome int
+
+const (
+	// Success is an exit code of a successful run, like 0.
+	Success Outcome = iota + 1
+	// Retryable is an exit code of a failure which may pass on a retry, like 24 of rsync,
+	// files vanished while copying them.
+	Retryable
+	// Fatal is an exit code of a failure which a retry will not fix.
+	Fatal
+)
+
+var outcomeNames = map[Outcome]string{Success: "success", Retryable: "retryable", Fatal: "fatal"}
+
+func (o Outcome) String() string {
+	if name, ok := outcomeNames[o]; ok {
+		return name
+	}
+	return fmt.Sprintf("Outcome(%d)", int(o))
+}
+
+// ParseOutcome parses success, retryable or fatal.
+func ParseOutcome(s string) (Outcome, error) {
+	for o, name := range outcomeNames {
+		if strings.EqualFold(s, name) {
+			return o, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid outcome %q, success, retryable or fatal expected", s)
+}
+
+// MarshalText marshals the outcome as its name.
+func (o Outcome) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText unmarshals the name of an outcome.
+func (o *Outcome) UnmarshalText(b []byte) error {
+	v, err := ParseOutcome(string(b))
+	if err != nil {
+		return err
+	}
+	*o = v
+	return nil
+}
+
+// WithExitCodeMap classifies exit codes of the command, 0 is Success and other
+// codes are Fatal unless mapped otherwise. A retry policy set by WithRetry
+// retries the codes mapped to Retryable only, the ones mapped to Success or
+// Fatal never, and a Batch does not count codes mapped to Success as failures.
+// Later mappings of the same code override earlier ones.
+//
+// Example:
+//
+//	c := gocmd.New("rsync -a src/ dst/",
+//		gocmd.WithExitCodeMap(map[int]gocmd.Outcome{24: gocmd.Retryable}),
+//		gocmd.WithRetry(gocmd.RetryPolicy{Retries: 3, Delay: time.Second}))
+func WithExitCodeMap(m map[int]Outcome) func(c *Cmd) {
+	return func(c *Cmd) {
+		if c.exitCodeMap == nil {
+			c.exitCodeMap = make(map[int]Outcome, len(m))
+		}
+		for code, o := range m {
+			c.exitCodeMap[code] = o
+		}
+	}
+}
+
+// Outcome returns the classification of the exit code of the command by WithExitCodeMap.
+func (c *Cmd) Outcome() Outcome {
+	c.checkExecuted("Outcome")
+	return c.outcome()
+}
+
+func (c *Cmd) outcome() Outcome {
+	if o, ok := c.exitCodeMap[c.exitCode]; ok {
+		return o
+	}
+	if c.exitCode == 0 {
+		return Success
+	}
+	return Fatal
+}
@@ -0,0 +1,56 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommand_WithExitCodeMap(t *testing.T) {
+	m := gocmd.WithExitCodeMap(map[int]gocmd.Outcome{24: gocmd.Retryable, 1: gocmd.Success, 0: gocmd.Fatal})
+	retry := gocmd.WithRetry(gocmd.RetryPolicy{Retries: 2})
+
+	c := gocmd.New("exit 24", m, retry)
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, gocmd.Retryable, c.Outcome())
+	assert.Equal(t, 3, c.Attempts())
+
+	c = gocmd.New("exit 1", m, retry)
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, gocmd.Success, c.Outcome())
+	assert.Equal(t, 1, c.Attempts())
+
+	c = gocmd.New("exit 0", m, retry)
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, gocmd.Fatal, c.Status().Outcome)
+	assert.Equal(t, 1, c.Attempts())
+
+	c = gocmd.New("exit 5", m)
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, gocmd.Fatal, c.Outcome())
+
+	var b gocmd.Batch
+	results := b.Run(context.TODO(),
+		gocmd.BatchJob{Name: "ok", Cmd: gocmd.New("exit 1", m)},
+		gocmd.BatchJob{Name: "fatal", Cmd: gocmd.New("exit 0", m)},
+	)
+	assert.False(t, results[0].Failed())
+	assert.True(t, results[1].Failed())
+}
+
+func TestOutcomeJSON(t *testing.T) {
+	var m map[int]gocmd.Outcome
+	assert.Nil(t, json.Unmarshal([]byte(`{"24": "Retryable", "1": "success"}`), &m))
+	assert.Equal(t, map[int]gocmd.Outcome{24: gocmd.Retryable, 1: gocmd.Success}, m)
+
+	b, err := json.Marshal(m)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"1":"success","24":"retryable"}`, string(b))
+
+	assert.NotNil(t, json.Unmarshal([]byte(`{"1": "maybe"}`), &m))
+}
@@ -0,0 +1,104 @@
+package gocmd
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// DefaultOutputDeadline is how long Run waits for a stopped command to exit
+// and write its last output, without an OutputDeadline.
+const DefaultOutputDeadline = time.Second
+
+// WithOutputDeadline sets how long Run waits for the output of the command
+// once it exited, if processes it started in the background keep its stdout
+// or stderr open, and how long it waits for a timed out or canceled command to
+// exit after SIGTERM, and write its last output, without KillAfter.
+//
+// Run returns once the output of the command was written to its buffers,
+// writers and sinks, and the sinks were flushed and closed, so that nothing is
+// missing, or written after. The output written after the deadline is dropped.
+// Without a deadline, Run waits for the output of an exited command as long as
+// its stdout and stderr are open, and DefaultOutputDeadline for a stopped one.
+//
+// Example:
+//
+//	gocmd.New("./start-daemon.sh", gocmd.WithOutputDeadline(2*time.Second))
+func WithOutputDeadline(d time.Duration) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.OutputDeadline = d
+	}
+}
+
+// Flusher is implemented by sinks buffering output, like the unterminated last
+// line of Lines. Run flushes the sinks after each attempt, once all its output
+// was written to them, so that the output of attempts is not mixed, and before
+// it returns.
+type Flusher interface {
+	Flush() error
+}
+
+// flushSinks flushes the sinks implementing Flusher, returning their errors joined.
+func (c *Cmd) flushSinks() error {
+	var errs []error
+	for _, s := range c.sinks {
+		if f, ok := s.(Flusher); ok {
+			errs = append(errs, f.Flush())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// errOutputClosed is returned to the writes of the output after the deadline.
+var errOutputClosed = errors.New("output closed")
+
+// outputGate writes the output of an attempt until it is closed, which waits
+// for the write in progress, so that nothing is written after Run returned.
+type outputGate struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closed bool
+}
+
+// newOutputGate returns a gate of w, nil if w is nil, for exec.Cmd to discard the output then.
+func newOutputGate(w io.Writer) (io.Writer, func()) {
+	if w == nil {
+		return nil, func() {}
+	}
+	g := &outputGate{w: w}
+	return g, g.close
+}
+
+func (g *outputGate) Write(p []byte) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.closed {
+		return 0, errOutputClosed
+	}
+	return g.w.Write(p)
+}
+
+func (g *outputGate) close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.closed = true
+}
+
+// waitOutput waits for the stopped command to exit, up to the output deadline.
+func (c *Cmd) waitOutput(done <-chan error) {
+	d := c.OutputDeadline
+	if d <= 0 {
+		d = DefaultOutputDeadline
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case err := <-done:
+		c.getExitCode(err)
+	case <-t.C:
+	}
+}
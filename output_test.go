@@ -0,0 +1,39 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputOfStoppedCommand(t *testing.T) {
+	c := gocmd.New("trap 'echo bye; exit 1' TERM; echo start; sleep 10 & wait",
+		gocmd.WithTimeout(200*time.Millisecond))
+	err := c.Run(context.TODO())
+	assert.True(t, errors.Is(err, gocmd.ErrTimeout))
+	assert.Equal(t, "start\nbye\n", c.Stdout())
+}
+
+func TestOutputDeadline(t *testing.T) {
+	c := gocmd.New("echo hi; sleep 2 &", gocmd.WithOutputDeadline(100*time.Millisecond))
+	start := time.Now()
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, "hi\n", c.Stdout())
+}
+
+func TestFlushSinksPerAttempt(t *testing.T) {
+	marker := t.TempDir() + "/tried"
+	out := &recordSink{}
+	c := gocmd.New("test -e "+marker+" && echo b || { touch "+marker+"; printf a; exit 1; }",
+		gocmd.WithStdoutSink(gocmd.Lines(out)),
+		gocmd.WithRetry(gocmd.RetryPolicy{Retries: 1}))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, []string{"a", "b"}, out.lines)
+}
@@ -0,0 +1,307 @@
+package gocmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Pipeline runs commands connected like a shell pipeline, the stdout of each
+// stage feeding the stdin of the next one, with the settings of each stage
+// Cmd: its timeout, WithMaxBuffer to bound the output it keeps, and
+// WithRetry. The output of a stage with retries is passed on once it
+// succeeded, after reading all its input, so that every attempt gets it.
+// Like with pipefail, a failing stage fails the pipeline, Run tells which
+// one by a StageError. A stage stopped because the next one exited, like
+// the producer of yes | head -1, is not a failure.
+//
+// Example:
+//
+//	p := gocmd.NewPipeline(
+//		gocmd.New("zcat access.log.gz", gocmd.WithMaxBuffer(4096)),
+//		gocmd.New("grep ' 500 '", gocmd.WithTimeout(time.Minute)),
+//		gocmd.New("wc -l"))
+//	err := p.Run(ctx) // errors.As(err, &stageErr) tells the failed stage
+//	fmt.Println(p.Stages[2].Stdout())
+type Pipeline struct {
+	Stages []*Cmd
+
+	captures []*capture
+	budget   *Budget // set by WithBudget
+}
+
+// capture is an output of a stage kept by Capture or CaptureFile.
+type capture struct {
+	stage int
+	name  string
+	path  string // of CaptureFile, else kept in buf
+	buf   bytes.Buffer
+}
+
+// NewPipeline creates a pipeline of the stages.
+func NewPipeline(stages ...*Cmd) *Pipeline {
+	return &Pipeline{Stages: stages}
+}
+
+// Capture keeps the stdout of the stage, from 0, in a buffer named name, got by
+// Captured after Run, while it still feeds the next stage, like tee, so that the
+// intermediate outputs of a failing pipeline can be looked at without running
+// the earlier stages again. Only the successful attempt of a stage with
+// retries is kept.
+//
+// Example:
+//
+//	p := gocmd.NewPipeline(extract, transform, load).Capture(1, "transformed")
+//	if err := p.Run(ctx); err != nil {
+//		log.Printf("%v, transformed: %s", err, p.Captured("transformed"))
+//	}
+func (p *Pipeline) Capture(stage int, name string) *Pipeline {
+	p.captures = append(p.captures, &capture{stage: stage, name: name})
+	return p
+}
+
+// CaptureFile is like Capture, writing the stdout of the stage to the file of
+// the path, truncated by Run.
+func (p *Pipeline) CaptureFile(stage int, name, path string) *Pipeline {
+	p.captures = append(p.captures, &capture{stage: stage, name: name, path: path})
+	return p
+}
+
+// Captured returns the output kept by Capture under the name, or by
+// CaptureFile read from its file.
+func (p *Pipeline) Captured(name string) (string, error) {
+	for _, c := range p.captures {
+		if c.name != name {
+			continue
+		}
+		if c.path == "" {
+			return c.buf.String(), nil
+		}
+		data, err := os.ReadFile(c.path)
+		return string(data), err
+	}
+	return "", fmt.Errorf("no capture named %q", name)
+}
+
+// StageError is the error of a Pipeline telling which stage failed.
+type StageError struct {
+	Stage    int    // index of the stage, from 0
+	Command  string // redacted command line of the stage
+	ExitCode int
+	// Stderr of the stage, as kept by its buffer, but the lines expected by WithExpectedStderr.
+	Stderr string
+	// Err is the error of the Run of the stage, nil if it exited by itself.
+	Err error
+}
+
+func (e *StageError) Error() string {
+	msg := fmt.Sprintf("stage %d %q", e.Stage+1, e.Command)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	} else {
+		msg += fmt.Sprintf(": exit code %d", e.ExitCode)
+	}
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		lines := strings.Split(stderr, "\n")
+		msg += ": " + lines[len(lines)-1]
+	}
+	return msg
+}
+
+func (e *StageError) Unwrap() error { return e.Err }
+
+// Run runs the stages, it returns a StageError of the first failed stage.
+func (p *Pipeline) Run(ctx context.Context) (err error) {
+	if len(p.Stages) == 0 {
+		return errors.New("empty pipeline")
+	}
+
+	if p.budget != nil {
+		if p.budget.Remaining() <= 0 {
+			return p.budget.exhausted()
+		}
+		var charge func()
+		var budgetCtx bool
+		ctx, charge, budgetCtx = p.budget.withDeadline(ctx)
+		defer charge()
+		if budgetCtx {
+			defer func() {
+				if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					err = fmt.Errorf("%w: %w", p.budget.exhausted(), err)
+				}
+			}()
+		}
+	}
+
+	n := len(p.Stages)
+	tees, closeTees, err := p.openCaptures()
+	if err != nil {
+		return err
+	}
+	defer closeTees()
+
+	readers := make([]*io.PipeReader, n)
+	writers := make([]*pipeWriter, n)
+	for i := 0; i < n-1; i++ {
+		r, w := io.Pipe()
+		readers[i+1] = r
+		writers[i] = &pipeWriter{w: w, upstream: p.Stages[i]}
+	}
+
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i, c := range p.Stages {
+		var out []io.Writer
+		out = append(out, tees[i]...)
+		if writers[i] != nil {
+			// last, as a broken pipe stops the writing
+			out = append(out, writers[i])
+		}
+		held := connectStage(c, readers[i], out)
+
+		wg.Add(1)
+		go func(i int, c *Cmd) {
+			defer wg.Done()
+
+			errs[i] = c.Run(ctx)
+			if held != nil && errs[i] == nil {
+				_, _ = io.MultiWriter(out...).Write(held.Bytes())
+			}
+			if w := writers[i]; w != nil {
+				_ = w.w.Close()
+			}
+			if r := readers[i]; r != nil {
+				// the stages before get a SIGPIPE if they write more
+				_ = r.Close()
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	for i, c := range p.Stages {
+		if writers[i] != nil && writers[i].broken() {
+			continue
+		}
+		if errs[i] != nil || (c.Executed && c.Outcome() != Success) {
+			e := &StageError{Stage: i, Command: c.Redacted(), Err: errs[i]}
+			if c.Executed {
+				e.ExitCode, e.Stderr = c.ExitCode(), c.unexpectedStderr()
+			}
+			return e
+		}
+	}
+	return nil
+}
+
+// openCaptures opens the captures, returning their writers by stage.
+func (p *Pipeline) openCaptures() (tees [][]io.Writer, closeAll func(), err error) {
+	tees = make([][]io.Writer, len(p.Stages))
+	var files []*os.File
+	closeAll = func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}
+	for _, c := range p.captures {
+		if c.stage < 0 || c.stage >= len(p.Stages) {
+			closeAll()
+			return nil, nil, fmt.Errorf("capture %q: no stage %d", c.name, c.stage)
+		}
+		c.buf.Reset()
+		if c.path == "" {
+			tees[c.stage] = append(tees[c.stage], &c.buf)
+			continue
+		}
+		f, err := os.Create(c.path)
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("capture %q: %w", c.name, err)
+		}
+		files = append(files, f)
+		tees[c.stage] = append(tees[c.stage], f)
+	}
+	return tees, closeAll, nil
+}
+
+// connectStage connects the stdin of the stage to r, if not nil, and its
+// stdout to out. The stdin of a stage with retries is read fully before it is
+// started and its stdout is held, the returned buffer, until it succeeded.
+func connectStage(c *Cmd, r *io.PipeReader, out []io.Writer) (held *bytes.Buffer) {
+	if c.retry.Retries == 0 {
+		if r != nil {
+			c.stdin = r
+		}
+		c.stdoutWriters = append(c.stdoutWriters, out...)
+		return nil
+	}
+
+	var input []byte
+	loaded := false
+	if len(out) > 0 {
+		held = &bytes.Buffer{}
+		c.stdoutWriters = append(c.stdoutWriters, held)
+	}
+	c.beforeStart = append(c.beforeStart, func(cmd *exec.Cmd) error {
+		if r != nil {
+			if !loaded {
+				var err error
+				if input, err = io.ReadAll(r); err != nil {
+					return fmt.Errorf("read input: %w", err)
+				}
+				loaded = true
+			}
+			cmd.Stdin = bytes.NewReader(input)
+		}
+		if held != nil {
+			held.Reset()
+		}
+		return nil
+	})
+	return held
+}
+
+// pipeWriter writes the stdout of a stage to the next one, signaling the
+// stage by SIGPIPE once the next one exited, as the kernel does for a shell
+// pipeline, so that it does not block writing.
+type pipeWriter struct {
+	w        *io.PipeWriter
+	upstream *Cmd
+
+	mu         sync.Mutex
+	brokenPipe bool
+}
+
+func (p *pipeWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	if errors.Is(err, io.ErrClosedPipe) {
+		p.mu.Lock()
+		p.brokenPipe = true
+		p.mu.Unlock()
+		_ = p.upstream.Signal(syscall.SIGPIPE)
+	}
+	return n, err
+}
+
+// broken tells if the next stage exited before the stage wrote all its output.
+func (p *pipeWriter) broken() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.brokenPipe
+}
+
+// Plan returns the plan of the pipeline, whose Steps are its stages.
+func (p *Pipeline) Plan() Plan {
+	plan := Plan{Kind: "pipeline"}
+	for _, c := range p.Stages {
+		plan.Steps = append(plan.Steps, c.Plan())
+	}
+	return plan
+}
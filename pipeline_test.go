@@ -0,0 +1,117 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipeline(t *testing.T) {
+	p := gocmd.NewPipeline(
+		gocmd.New("printf 'b\\na\\nc\\n'"),
+		gocmd.New("sort"),
+		gocmd.New("tr a-z A-Z"))
+	assert.Nil(t, p.Run(context.TODO()))
+	assert.Equal(t, "A\nB\nC\n", p.Stages[2].Stdout())
+}
+
+func TestPipelineStageError(t *testing.T) {
+	p := gocmd.NewPipeline(
+		gocmd.New("echo hello"),
+		gocmd.New("cat; echo 'no space left' >&2; exit 3"),
+		gocmd.New("cat"))
+	err := p.Run(context.TODO())
+
+	var stageErr *gocmd.StageError
+	assert.True(t, errors.As(err, &stageErr))
+	assert.Equal(t, 1, stageErr.Stage)
+	assert.Equal(t, 3, stageErr.ExitCode)
+	assert.Equal(t, "no space left\n", stageErr.Stderr)
+	assert.Contains(t, err.Error(), "no space left")
+	assert.Equal(t, "hello\n", p.Stages[2].Stdout())
+}
+
+func TestPipelineStageTimeout(t *testing.T) {
+	p := gocmd.NewPipeline(
+		gocmd.New("echo hello"),
+		gocmd.New("cat; sleep 10", gocmd.WithTimeout(100*time.Millisecond)),
+		gocmd.New("cat"))
+	start := time.Now()
+	err := p.Run(context.TODO())
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	var stageErr *gocmd.StageError
+	assert.True(t, errors.As(err, &stageErr))
+	assert.Equal(t, 1, stageErr.Stage)
+	assert.True(t, errors.Is(err, gocmd.ErrTimeout))
+}
+
+func TestPipelineBrokenPipe(t *testing.T) {
+	p := gocmd.NewPipeline(
+		gocmd.New("yes", gocmd.WithMaxBuffer(1024)),
+		gocmd.New("head -1"))
+	assert.Nil(t, p.Run(context.TODO()))
+	assert.Equal(t, "y\n", p.Stages[1].Stdout())
+	assert.Equal(t, 1024, p.Stages[0].StdoutBuf.Len())
+}
+
+func TestPipelineRetry(t *testing.T) {
+	marker := t.TempDir() + "/tried"
+	p := gocmd.NewPipeline(
+		gocmd.New("printf 'a\\nb\\n'"),
+		gocmd.New("test -e "+marker+" || { touch "+marker+"; echo partial; exit 1; }; tr a-z A-Z",
+			gocmd.WithRetry(gocmd.RetryPolicy{Retries: 1})),
+		gocmd.New("cat"))
+	assert.Nil(t, p.Run(context.TODO()))
+	assert.Equal(t, "A\nB\n", p.Stages[2].Stdout())
+}
+
+func TestPipelinePlan(t *testing.T) {
+	p := gocmd.NewPipeline(gocmd.New("yes"), gocmd.New("head -1", gocmd.WithTimeout(time.Second)))
+	plan := p.Plan().String()
+	assert.True(t, strings.HasPrefix(plan, "pipeline of 2: yes | head -1\n"), plan)
+	assert.Contains(t, plan, "  2. head -1\n")
+	assert.Contains(t, plan, "timeout: 1s\n")
+}
+
+func TestMaxBuffer(t *testing.T) {
+	c := gocmd.New("echo hello; echo world >&2", gocmd.WithMaxBuffer(3))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, "hel", c.Stdout())
+	assert.Equal(t, "wor", c.Stderr())
+
+	// one stream only, the order of the lines of stdout and stderr in the combined output is not known
+	c = gocmd.New("echo hello; echo world", gocmd.WithMaxBuffer(3))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, "hel", c.Combined())
+}
+
+func TestPipelineCapture(t *testing.T) {
+	path := t.TempDir() + "/sorted"
+	p := gocmd.NewPipeline(
+		gocmd.New("printf 'b\\na\\n'"),
+		gocmd.New("sort"),
+		gocmd.New("grep -q x")).
+		Capture(0, "raw").
+		CaptureFile(1, "sorted", path)
+	err := p.Run(context.TODO())
+
+	var stageErr *gocmd.StageError
+	assert.True(t, errors.As(err, &stageErr))
+	assert.Equal(t, 2, stageErr.Stage)
+	raw, err := p.Captured("raw")
+	assert.Nil(t, err)
+	assert.Equal(t, "b\na\n", raw)
+	sorted, err := p.Captured("sorted")
+	assert.Nil(t, err)
+	assert.Equal(t, "a\nb\n", sorted)
+	_, err = p.Captured("missing")
+	assert.NotNil(t, err)
+}
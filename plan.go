@@ -0,0 +1,156 @@
+package gocmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bingoohuang/gocmd/shellquote"
+)
+
+// Plan describes what a command or a batch of commands would run, to review
+// complex compositions before running them, like by a --dry-run, rendered as
+// text by String or as JSON. Secrets are masked like by Redacted.
+type Plan struct {
+	Name string `json:"name,omitempty"`
+	// Kind is "command", "batch" or "pipeline".
+	Kind string `json:"kind"`
+	// Command is the command line, Exec the executable and args it is executed by, shell quoted.
+	Command string        `json:"command,omitempty"`
+	Exec    string        `json:"exec,omitempty"`
+	Dir     string        `json:"dir,omitempty"`
+	Timeout time.Duration `json:"timeout,omitempty"`
+	Retries int           `json:"retries,omitempty"`
+	// Priority is the one of a batch job.
+	Priority int `json:"priority,omitempty"`
+	// Env are the env vars differing from the ones of the current process, like by EnvDiff.
+	Env []string `json:"env,omitempty"`
+	// Secrets are the names of the secrets and credentials passed, and how.
+	Secrets []string `json:"secrets,omitempty"`
+	Labels  Labels   `json:"labels,omitempty"`
+
+	// Parallel, HaltOnError and MaxFailures are the ones of a batch, whose Steps are started in order.
+	// The Steps of a pipeline are its stages.
+	Parallel    int    `json:"parallel,omitempty"`
+	HaltOnError bool   `json:"halt_on_error,omitempty"`
+	MaxFailures int    `json:"max_failures,omitempty"`
+	Steps       []Plan `json:"steps,omitempty"`
+}
+
+// Plan returns the plan of the command.
+func (c *Cmd) Plan() Plan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p := Plan{
+		Kind:    "command",
+		Command: c.Redacted(),
+		Dir:     c.WorkingDir,
+		Timeout: c.Timeout,
+		Retries: c.retry.Retries,
+		Env:     c.envDiff().Strings(),
+		Labels:  c.Labels(),
+	}
+	if c.Cmd != nil {
+		p.Exec = shellquote.QuoteMust(c.redactArgs(c.Cmd.Args)...)
+	}
+	for _, s := range c.secrets {
+		p.Secrets = append(p.Secrets, s.name+"_FD (fd)")
+	}
+	for _, cr := range c.credentials {
+		if cr.fd {
+			p.Secrets = append(p.Secrets, cr.name+"_FD (fd, credential "+cr.key+")")
+		} else {
+			p.Secrets = append(p.Secrets, cr.name+" (env, credential "+cr.key+")")
+		}
+	}
+	return p
+}
+
+// Plan returns the plan of running the jobs by the batch.
+func (b *Batch) Plan(jobs ...BatchJob) Plan {
+	p := Plan{Kind: "batch", Parallel: b.Parallel, HaltOnError: b.HaltOnError, MaxFailures: b.MaxFailures}
+	if p.Parallel < 1 {
+		p.Parallel = 1
+	}
+	for _, job := range jobs {
+		step := job.Cmd.Plan()
+		step.Name = job.Name
+		step.Priority = job.Priority
+		p.Steps = append(p.Steps, step)
+	}
+	return p
+}
+
+// String renders the plan as an indented text tree, like
+//
+//	batch of 2, parallel 2, halt on error
+//	  1. web: make web
+//	     exec: bash -c 'make web'
+//	     timeout: 5m0s
+//	  2. api: make api
+//	     ...
+func (p Plan) String() string {
+	var b strings.Builder
+	p.render(&b, "")
+	return b.String()
+}
+
+func (p Plan) render(b *strings.Builder, indent string) {
+	if p.Kind == "batch" {
+		fmt.Fprintf(b, "batch of %d, parallel %d", len(p.Steps), p.Parallel)
+		if p.HaltOnError {
+			b.WriteString(", halt on error")
+		}
+		if p.MaxFailures > 0 {
+			fmt.Fprintf(b, ", halt after %d failures", p.MaxFailures)
+		}
+		b.WriteString("\n")
+		p.renderSteps(b, indent)
+		return
+	}
+	if p.Kind == "pipeline" {
+		commands := make([]string, len(p.Steps))
+		for i, step := range p.Steps {
+			commands[i] = step.Command
+		}
+		fmt.Fprintf(b, "pipeline of %d: %s\n", len(p.Steps), strings.Join(commands, " | "))
+		p.renderSteps(b, indent)
+		return
+	}
+
+	if p.Name != "" {
+		b.WriteString(p.Name + ": ")
+	}
+	b.WriteString(p.Command + "\n")
+	detail := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(b, "%s%s: %s\n", indent, name, value)
+		}
+	}
+	if p.Exec != p.Command {
+		detail("exec", p.Exec)
+	}
+	detail("dir", p.Dir)
+	if p.Timeout > 0 {
+		detail("timeout", p.Timeout.String())
+	}
+	if p.Retries > 0 {
+		detail("retries", fmt.Sprint(p.Retries))
+	}
+	if p.Priority != 0 {
+		detail("priority", fmt.Sprint(p.Priority))
+	}
+	detail("env", strings.Join(p.Env, " "))
+	detail("secrets", strings.Join(p.Secrets, ", "))
+	detail("labels", p.Labels.String())
+}
+
+// renderSteps renders the steps numbered.
+func (p Plan) renderSteps(b *strings.Builder, indent string) {
+	for i, step := range p.Steps {
+		number := fmt.Sprintf("%s  %d. ", indent, i+1)
+		b.WriteString(number)
+		step.render(b, strings.Repeat(" ", len(number)))
+	}
+}
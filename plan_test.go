@@ -0,0 +1,44 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"encoding/json"
+	"os/exec"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlan(t *testing.T) {
+	b := gocmd.Batch{Parallel: 2, HaltOnError: true}
+	p := b.Plan(
+		gocmd.BatchJob{Name: "web", Cmd: gocmd.New("make web token=s3cret",
+			gocmd.WithShell("sh"),
+			gocmd.WithTimeout(5*time.Minute),
+			gocmd.WithWorkingDir("/src"),
+			gocmd.WithEnv(gocmd.EnvVars{"GOCMD_PLAN": "1"}),
+			gocmd.WithSecretFD("KEY", []byte("k")),
+			gocmd.WithLabels(map[string]string{"team": "web"}),
+			gocmd.WithRedactedPattern(regexp.MustCompile(`token=(\S+)`)))},
+		gocmd.BatchJob{Name: "api", Cmd: gocmd.New("", gocmd.WithCmd(exec.Command("go", "build", "./api")), gocmd.WithTimeout(0))},
+	)
+
+	assert.Equal(t, `batch of 2, parallel 2, halt on error
+  1. web: make web token=***
+     exec: sh -c 'make web token=***'
+     dir: /src
+     timeout: 5m0s
+     env: +GOCMD_PLAN=1
+     secrets: KEY_FD (fd)
+     labels: team=web
+  2. api: go build ./api
+`, p.String())
+
+	b2, err := json.Marshal(p.Steps[1])
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"name": "api", "kind": "command", "command": "go build ./api", "exec": "go build ./api"}`, string(b2))
+}
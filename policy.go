@@ -0,0 +1,240 @@
+package gocmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrPolicyDenied is wrapped by the error of Run if the command was denied by the policy of WithPolicy.
+var ErrPolicyDenied = errors.New("denied by policy")
+
+// PolicyInput is the resolved command evaluated by a Policy. The command
+// line and args are masked like by Redacted, the env vars are the ones
+// differing from the ones of the current process, like by EnvDiff, with
+// their values masked by the patterns of WithRedactedPattern.
+type PolicyInput struct {
+	Command string            `json:"command"`
+	Path    string            `json:"path"`
+	Args    []string          `json:"args"`
+	Dir     string            `json:"dir,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	// User is the one the command is run as, nil if unknown, like on Windows.
+	User    *PolicyUser   `json:"user,omitempty"`
+	Labels  Labels        `json:"labels,omitempty"`
+	Timeout time.Duration `json:"timeout"`
+}
+
+// PolicyUser is the user a command is run as.
+type PolicyUser struct {
+	Uid int `json:"uid"`
+	Gid int `json:"gid"`
+}
+
+// PolicyDecision is the decision of a Policy on a command, which may mutate
+// it, like forcing limits, before it is run.
+type PolicyDecision struct {
+	Allow bool `json:"allow"`
+	// Reasons tell why the command is denied, or mutated.
+	Reasons []string `json:"reasons,omitempty"`
+	// Timeout, if not empty, is forced as the timeout, like "5m".
+	Timeout string `json:"timeout,omitempty"`
+	// Env are forced env vars, Labels added labels.
+	Env    map[string]string `json:"env,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	// Limits are forced limits, like the ones of a Spec.
+	Limits SpecLimits `json:"limits,omitempty"`
+}
+
+// Policy decides whether a command may run, and how, like by centrally
+// managed policies of an Open Policy Agent, see OPAPolicy.
+type Policy interface {
+	Evaluate(ctx context.Context, in PolicyInput) (PolicyDecision, error)
+}
+
+// PolicyFunc is a Policy of a func.
+type PolicyFunc func(ctx context.Context, in PolicyInput) (PolicyDecision, error)
+
+// Evaluate implements Policy.
+func (f PolicyFunc) Evaluate(ctx context.Context, in PolicyInput) (PolicyDecision, error) {
+	return f(ctx, in)
+}
+
+// WithPolicy evaluates the policy on the resolved command when it is run,
+// once per Run, before the approval of WithApproval. Run fails with an
+// error wrapping ErrPolicyDenied, without starting it, if the policy denies
+// it or fails, and the mutations of an allowing decision are applied to it.
+// The decision is reported by PolicyDecision.
+//
+// Example:
+//
+//	opa := &gocmd.OPAPolicy{URL: "http://localhost:8181/v1/data/gocmd/decision"}
+//	c := gocmd.New("terraform apply -auto-approve", gocmd.WithPolicy(opa))
+func WithPolicy(p Policy) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.policy = p
+	}
+}
+
+// PolicyDecision returns the decision of the policy of WithPolicy, nil if
+// the command was not run or the policy failed.
+func (c *Cmd) PolicyDecision() *PolicyDecision {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.policyDecision
+}
+
+// policyInput returns the input of the policy of the command.
+func (c *Cmd) policyInput() PolicyInput {
+	in := PolicyInput{
+		Command: c.Redacted(),
+		Path:    c.Cmd.Path,
+		Args:    c.redactArgs(c.Cmd.Args),
+		Dir:     c.WorkingDir,
+		User:    commandUser(c.Cmd),
+		Labels:  c.Labels(),
+		Timeout: c.Timeout,
+	}
+	c.mu.Lock()
+	diff := c.envDiff()
+	c.mu.Unlock()
+	for _, e := range diff {
+		if e.Op == "removed" {
+			continue
+		}
+		if in.Env == nil {
+			in.Env = map[string]string{}
+		}
+		in.Env[e.Key] = e.Value
+	}
+	return in
+}
+
+// checkPolicy evaluates the policy of the command, if any, and applies the
+// mutations of its decision.
+func (c *Cmd) checkPolicy(ctx context.Context) error {
+	if c.policy == nil {
+		return nil
+	}
+	d, err := c.policy.Evaluate(ctx, c.policyInput())
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrPolicyDenied, c.Redacted(), err)
+	}
+	c.mu.Lock()
+	c.policyDecision = &d
+	c.mu.Unlock()
+	if !d.Allow {
+		err := fmt.Errorf("%w: %s", ErrPolicyDenied, c.Redacted())
+		if len(d.Reasons) > 0 {
+			err = fmt.Errorf("%w: %s", err, strings.Join(d.Reasons, ", "))
+		}
+		return err
+	}
+	return c.mutate(d)
+}
+
+// mutate applies the mutations of the decision to the command.
+func (c *Cmd) mutate(d PolicyDecision) error {
+	var v specErrors
+	v.duration("timeout", d.Timeout)
+	d.Limits.validate(&v)
+	if err := v.err(); err != nil {
+		return fmt.Errorf("%w: %s: invalid decision: %w", ErrPolicyDenied, c.Redacted(), err)
+	}
+
+	options := d.Limits.options()
+	if d.Timeout != "" {
+		timeout, _ := time.ParseDuration(d.Timeout)
+		options = append(options, WithTimeout(timeout))
+	}
+	if len(d.Env) > 0 {
+		options = append(options, WithEnv(d.Env))
+	}
+	if len(d.Labels) > 0 {
+		options = append(options, WithLabels(d.Labels))
+	}
+	for _, o := range options {
+		o(c)
+	}
+	return nil
+}
+
+// OPAPolicy is a Policy evaluated by an Open Policy Agent server, by its
+// data API, POST {"input": PolicyInput} to URL, so that policy bundles are
+// managed centrally. The result of the rule is either a PolicyDecision, or a
+// bool allowing the command as it is, like the ones of
+//
+//	package gocmd
+//
+//	default allow := false
+//	allow if not startswith(input.path, "/usr/local/bin/unvetted")
+//	reasons contains "kubectl delete is not allowed" if input.args[1] == "delete"
+//	limits := {"max_buffer": 1048576} if input.labels.tenant != "ops"
+//	decision := {"allow": allow, "reasons": reasons, "limits": object.union({}, limits)}
+//
+// An undefined result denies the command.
+type OPAPolicy struct {
+	// URL is the one of the rule, like http://localhost:8181/v1/data/gocmd/decision.
+	URL string
+	// Token, if not empty, is the bearer token of the requests.
+	Token string
+	// Client is http.DefaultClient with a timeout of 10s if nil.
+	Client *http.Client
+}
+
+// Evaluate implements Policy.
+func (p *OPAPolicy) Evaluate(ctx context.Context, in PolicyInput) (PolicyDecision, error) {
+	body, err := json.Marshal(map[string]interface{}{"input": in})
+	if err != nil {
+		return PolicyDecision{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return PolicyDecision{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.Token)
+	}
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return PolicyDecision{}, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return PolicyDecision{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return PolicyDecision{}, fmt.Errorf("opa %s: %s: %s", p.URL, resp.Status, bytes.TrimSpace(data))
+	}
+
+	var r struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return PolicyDecision{}, fmt.Errorf("opa %s: %w", p.URL, err)
+	}
+	var d PolicyDecision
+	switch {
+	case len(r.Result) == 0:
+		d.Reasons = []string{"undefined policy decision"}
+	case json.Unmarshal(r.Result, &d.Allow) == nil:
+	default:
+		if err := json.Unmarshal(r.Result, &d); err != nil {
+			return PolicyDecision{}, fmt.Errorf("opa %s: result: %w", p.URL, err)
+		}
+	}
+	return d, nil
+}
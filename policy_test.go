@@ -0,0 +1,84 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithPolicy(t *testing.T) {
+	var input gocmd.PolicyInput
+	policy := gocmd.PolicyFunc(func(_ context.Context, in gocmd.PolicyInput) (gocmd.PolicyDecision, error) {
+		input = in
+		if in.Labels["tenant"] != "ops" {
+			return gocmd.PolicyDecision{Reasons: []string{"tenant not allowed"}}, nil
+		}
+		return gocmd.PolicyDecision{Allow: true, Timeout: "5s", Env: map[string]string{"FORCED": "1"},
+			Limits: gocmd.SpecLimits{MaxBuffer: 4}}, nil
+	})
+
+	marker := t.TempDir() + "/ran"
+	c := gocmd.New("touch "+marker, gocmd.WithPolicy(policy), gocmd.WithLabels(map[string]string{"tenant": "acme"}))
+	err := c.Run(context.TODO())
+	assert.ErrorIs(t, err, gocmd.ErrPolicyDenied)
+	assert.EqualError(t, err, "denied by policy: touch "+marker+": tenant not allowed")
+	assert.NoFileExists(t, marker)
+	assert.False(t, c.PolicyDecision().Allow)
+
+	c = gocmd.New("echo $FORCED $TOKEN", gocmd.WithPolicy(policy), gocmd.WithLabels(map[string]string{"tenant": "ops"}),
+		gocmd.WithEnv(gocmd.EnvVars{"TOKEN": "password=s3cret"}))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, "1 pa", c.Stdout()) // max buffer of 4
+	assert.Equal(t, 5*time.Second, c.Timeout)
+	assert.Equal(t, "/bin/bash", input.Path)
+	assert.Equal(t, []string{"/bin/bash", "-c", "echo $FORCED $TOKEN"}, input.Args)
+	assert.Equal(t, "password=s3cret", input.Env["TOKEN"])
+	assert.Equal(t, os.Getuid(), input.User.Uid)
+}
+
+func TestOPAPolicy(t *testing.T) {
+	var results = []string{
+		`{"result": {"allow": true, "limits": {"max_buffer": 2}}}`,
+		`{"result": false}`,
+		`{}`,
+	}
+	var inputs []gocmd.PolicyInput
+	opa := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/data/gocmd/decision", r.URL.Path)
+		assert.Equal(t, "Bearer t0ken", r.Header.Get("Authorization"))
+		var body struct {
+			Input gocmd.PolicyInput `json:"input"`
+		}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		inputs = append(inputs, body.Input)
+		w.Write([]byte(results[0]))
+		results = results[1:]
+	}))
+	defer opa.Close()
+
+	policy := &gocmd.OPAPolicy{URL: opa.URL + "/v1/data/gocmd/decision", Token: "t0ken"}
+	c := gocmd.New("echo hello", gocmd.WithPolicy(policy))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, "he", c.Stdout())
+	assert.Equal(t, "echo hello", inputs[0].Command)
+
+	c = gocmd.New("echo hello", gocmd.WithPolicy(policy))
+	assert.EqualError(t, c.Run(context.TODO()), "denied by policy: echo hello")
+
+	c = gocmd.New("echo hello", gocmd.WithPolicy(policy))
+	assert.EqualError(t, c.Run(context.TODO()), "denied by policy: echo hello: undefined policy decision")
+
+	opa.Close()
+	c = gocmd.New("echo hello", gocmd.WithPolicy(policy))
+	assert.ErrorIs(t, c.Run(context.TODO()), gocmd.ErrPolicyDenied)
+	assert.Nil(t, c.PolicyDecision())
+}
@@ -0,0 +1,103 @@
+package gocmd
+
+import (
+	"context"
+	"time"
+)
+
+// ProcessStats are the I/O and CPU statistics of a running command, sampled
+// by WithProcessStats.
+type ProcessStats struct {
+	// ReadBytes and WriteBytes are the bytes the process caused to be read
+	// from and written to storage so far.
+	ReadBytes  uint64 `json:"read_bytes"`
+	WriteBytes uint64 `json:"write_bytes"`
+	// CPUTime is the user and system CPU time of the process so far.
+	CPUTime time.Duration `json:"cpu_time"`
+	// CPUPercent is the CPU usage since the previous sample, 100 per CPU fully used.
+	CPUPercent float64   `json:"cpu_percent"`
+	RSSBytes   uint64    `json:"rss_bytes"`
+	Sampled    time.Time `json:"sampled"`
+}
+
+// WithProcessStats samples the I/O and CPU statistics of the command every
+// interval while it is running, from /proc/<pid>/io and /proc/<pid>/stat, so
+// that runaway commands can be spotted before they finish. The last sample
+// is reported by ProcessStats, Status and the progress of WithProgress. The
+// statistics are the ones of the process of the command, not of the
+// processes it started, like the ones of a shell pipeline. The interval is
+// one second if not positive. Linux only, nothing is sampled on other platforms.
+//
+// Example:
+//
+//	c := gocmd.New("./etl.sh", gocmd.WithProcessStats(5*time.Second), gocmd.WithProgress(time.Minute, func(p gocmd.ProgressInfo) {
+//		if p.Stats != nil && p.Stats.CPUPercent > 90 {
+//			log.Printf("etl busy, %.0f%% CPU, %d bytes written", p.Stats.CPUPercent, p.Stats.WriteBytes)
+//		}
+//	}))
+func WithProcessStats(interval time.Duration) func(c *Cmd) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	return func(c *Cmd) {
+		c.watchers = append(c.watchers, func(ctx context.Context) {
+			c.mu.Lock()
+			c.stats = nil
+			pid := 0
+			if c.process != nil {
+				pid = c.process.Pid
+			}
+			c.mu.Unlock()
+			if pid == 0 {
+				return
+			}
+
+			var prev *ProcessStats
+			sample := func() {
+				s, err := readProcessStats(pid)
+				if err != nil {
+					return // exited, or not supported
+				}
+				if prev != nil {
+					if wall := s.Sampled.Sub(prev.Sampled); wall > 0 {
+						s.CPUPercent = 100 * float64(s.CPUTime-prev.CPUTime) / float64(wall)
+					}
+				}
+				prev = &s
+
+				c.mu.Lock()
+				c.stats = &s
+				c.mu.Unlock()
+			}
+
+			sample()
+			t := time.NewTicker(interval)
+			defer t.Stop()
+			for {
+				select {
+				case <-t.C:
+					sample()
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+	}
+}
+
+// ProcessStats returns the last statistics sampled by WithProcessStats, nil if none.
+func (c *Cmd) ProcessStats() *ProcessStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.processStats()
+}
+
+func (c *Cmd) processStats() *ProcessStats {
+	if c.stats == nil {
+		return nil
+	}
+	s := *c.stats
+	return &s
+}
@@ -0,0 +1,74 @@
+package gocmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is the unit of the CPU times of /proc/<pid>/stat, USER_HZ, 100 on all Linux platforms.
+const clockTicks = 100
+
+// readProcessStats reads the statistics of the process from /proc/<pid>/io and /proc/<pid>/stat.
+func readProcessStats(pid int) (ProcessStats, error) {
+	s := ProcessStats{Sampled: time.Now()}
+
+	_, fields, err := procStat(pid)
+	if err != nil {
+		return s, err
+	}
+	utime, _ := strconv.ParseUint(fields[14-3], 10, 64)
+	stime, _ := strconv.ParseUint(fields[15-3], 10, 64)
+	rss, _ := strconv.ParseUint(fields[24-3], 10, 64)
+	s.CPUTime = time.Duration(utime+stime) * time.Second / clockTicks
+	s.RSSBytes = rss * uint64(os.Getpagesize())
+
+	f, err := os.Open(fmt.Sprintf("/proc/%d/io", pid))
+	if err != nil {
+		return s, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// like read_bytes: 4096
+		k, v, ok := strings.Cut(sc.Text(), ": ")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			continue
+		}
+		switch k {
+		case "read_bytes":
+			s.ReadBytes = n
+		case "write_bytes":
+			s.WriteBytes = n
+		}
+	}
+	return s, sc.Err()
+}
+
+// procStat returns the name of the process and the fields of /proc/<pid>/stat
+// after it, fields[n-3] being the nth one, like fields[4-3] the ppid.
+func procStat(pid int) (name string, fields []string, err error) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return "", nil, err
+	}
+	// the name in parentheses may contain spaces and parentheses
+	start, end := bytes.IndexByte(stat, '('), bytes.LastIndexByte(stat, ')')
+	if start < 0 || end < start {
+		return "", nil, fmt.Errorf("invalid /proc/%d/stat", pid)
+	}
+	fields = strings.Fields(string(stat[end+1:]))
+	if len(fields) < 22 {
+		return "", nil, fmt.Errorf("invalid /proc/%d/stat", pid)
+	}
+	return string(stat[start+1 : end]), fields, nil
+}
@@ -0,0 +1,37 @@
+package gocmd_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithProcessStats(t *testing.T) {
+	var mu sync.Mutex
+	var reported []*gocmd.ProcessStats
+	c := gocmd.New("end=$((SECONDS+2)); while [ $SECONDS -lt $end ]; do :; done",
+		gocmd.WithProcessStats(200*time.Millisecond),
+		gocmd.WithProgress(500*time.Millisecond, func(p gocmd.ProgressInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			reported = append(reported, p.Stats)
+		}))
+	assert.Nil(t, c.Run(context.TODO()))
+
+	s := c.ProcessStats()
+	if assert.NotNil(t, s) {
+		assert.Greater(t, s.CPUTime, 200*time.Millisecond)
+		assert.Greater(t, s.CPUPercent, 10.0)
+		assert.NotZero(t, s.RSSBytes)
+		assert.Equal(t, s, c.Status().Stats)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.NotEmpty(t, reported)
+	assert.NotNil(t, reported[0])
+}
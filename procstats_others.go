@@ -0,0 +1,9 @@
+//go:build !linux
+
+package gocmd
+
+import "fmt"
+
+func readProcessStats(int) (ProcessStats, error) {
+	return ProcessStats{}, fmt.Errorf("process stats: %w", ErrNotSupported)
+}
@@ -0,0 +1,71 @@
+package gocmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ProcessNode is a process of the tree of a running command.
+type ProcessNode struct {
+	Pid      int           `json:"pid"`
+	PPid     int           `json:"ppid"`
+	Name     string        `json:"name"`
+	Args     []string      `json:"args,omitempty"`
+	RSSBytes uint64        `json:"rss_bytes"`
+	Children []ProcessNode `json:"children,omitempty"`
+}
+
+// ProcessTree returns a snapshot of the process of the running command and
+// all its descendants, from /proc, to find which grandchild hangs, or to
+// account for the resources of all of them. Processes which were reparented,
+// like daemons double forking, are not in it. It returns ErrNotRunning if the
+// command is not running. Linux only, ErrNotSupported on other platforms.
+//
+// Example:
+//
+//	tree, err := c.ProcessTree()
+//	fmt.Print(tree) // 4242 bash 3.1MiB
+//	                //   4243 make 12.0MiB ...
+func (c *Cmd) ProcessTree() (*ProcessNode, error) {
+	c.mu.Lock()
+	p := c.process
+	c.mu.Unlock()
+	if p == nil {
+		return nil, ErrNotRunning
+	}
+	return processTree(p.Pid)
+}
+
+// TotalRSS returns the RSS of the process and of all its descendants.
+func (n *ProcessNode) TotalRSS() uint64 {
+	total := n.RSSBytes
+	for i := range n.Children {
+		total += n.Children[i].TotalRSS()
+	}
+	return total
+}
+
+// Walk calls f with the process and all its descendants, depth first, with their depth from 0.
+func (n *ProcessNode) Walk(f func(p *ProcessNode, depth int)) {
+	n.walk(f, 0)
+}
+
+func (n *ProcessNode) walk(f func(p *ProcessNode, depth int), depth int) {
+	f(n, depth)
+	for i := range n.Children {
+		n.Children[i].walk(f, depth+1)
+	}
+}
+
+// String renders the tree indented by depth, a process per line.
+func (n *ProcessNode) String() string {
+	var b strings.Builder
+	n.Walk(func(p *ProcessNode, depth int) {
+		fmt.Fprintf(&b, "%s%d %s %.1fMiB", strings.Repeat("  ", depth), p.Pid, p.Name, float64(p.RSSBytes)/(1<<20))
+		if len(p.Args) > 1 {
+			b.WriteString(" " + strings.Join(p.Args[1:], " "))
+		}
+		b.WriteString("\n")
+	})
+	return b.String()
+}
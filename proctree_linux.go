@@ -0,0 +1,54 @@
+package gocmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// processTree reads the process and its descendants from /proc.
+func processTree(root int) (*ProcessNode, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := map[int]*ProcessNode{}
+	children := map[int][]int{}
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		name, fields, err := procStat(pid)
+		if err != nil {
+			continue // exited meanwhile
+		}
+		ppid, _ := strconv.Atoi(fields[4-3])
+		rss, _ := strconv.ParseUint(fields[24-3], 10, 64)
+		nodes[pid] = &ProcessNode{Pid: pid, PPid: ppid, Name: name, RSSBytes: rss * uint64(os.Getpagesize())}
+		children[ppid] = append(children[ppid], pid)
+	}
+	if nodes[root] == nil {
+		return nil, fmt.Errorf("process %d: %w", root, ErrNotRunning)
+	}
+
+	var build func(pid int) ProcessNode
+	build = func(pid int) ProcessNode {
+		n := nodes[pid]
+		if cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid)); err == nil && len(cmdline) > 0 {
+			n.Args = strings.Split(string(bytes.TrimSuffix(cmdline, []byte{0})), "\x00")
+		}
+		pids := children[pid]
+		sort.Ints(pids)
+		for _, child := range pids {
+			n.Children = append(n.Children, build(child))
+		}
+		return *n
+	}
+	tree := build(root)
+	return &tree, nil
+}
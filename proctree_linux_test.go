@@ -0,0 +1,39 @@
+package gocmd_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessTree(t *testing.T) {
+	c := gocmd.New("sleep 10 & (sleep 11; true) & wait")
+	_, err := c.ProcessTree()
+	assert.True(t, errors.Is(err, gocmd.ErrNotRunning))
+
+	go c.Run(context.TODO())
+	defer c.Cancel("done")
+
+	var tree *gocmd.ProcessNode
+	assert.Eventually(t, func() bool {
+		tree, err = c.ProcessTree()
+		return err == nil && len(tree.Children) == 2 && len(tree.Children[1].Children) == 1
+	}, 3*time.Second, 20*time.Millisecond)
+
+	assert.Equal(t, "bash", tree.Name)
+	assert.Equal(t, c.Status().Pid, tree.Pid)
+	assert.Equal(t, "sleep", tree.Children[0].Name)
+	assert.Equal(t, []string{"sleep", "10"}, tree.Children[0].Args)
+	assert.Equal(t, []string{"sleep", "11"}, tree.Children[1].Children[0].Args)
+	assert.Equal(t, tree.Pid, tree.Children[0].PPid)
+
+	count := 0
+	tree.Walk(func(*gocmd.ProcessNode, int) { count++ })
+	assert.Equal(t, 4, count)
+	assert.Greater(t, tree.TotalRSS(), tree.RSSBytes)
+	assert.Contains(t, tree.String(), "\n    ")
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package gocmd
+
+import "fmt"
+
+func processTree(int) (*ProcessNode, error) {
+	return nil, fmt.Errorf("process tree: %w", ErrNotSupported)
+}
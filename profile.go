@@ -0,0 +1,139 @@
+package gocmd
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Profile is a named bundle of options, like "untrusted", "build" or
+// "interactive", so that teams define how kinds of commands are run once and
+// apply it consistently. Profiles are composed by MergeProfiles, which
+// detects the ones setting the same setting differently.
+//
+// Example:
+//
+//	var Untrusted = gocmd.NewProfile("untrusted", gocmd.WithHermetic(), gocmd.WithNoNetwork(),
+//		gocmd.WithTimeout(10*time.Second), gocmd.WithMaxBuffer(1<<20))
+//
+//	c := gocmd.New(script, Untrusted.Options...)
+type Profile struct {
+	Name    string
+	Options []func(*Cmd)
+}
+
+// NewProfile creates a profile of the options.
+func NewProfile(name string, options ...func(*Cmd)) Profile {
+	return Profile{Name: name, Options: options}
+}
+
+// With returns a copy of the profile with the options appended, which
+// override the ones of the profile, like options passed to New after it.
+func (p Profile) With(options ...func(*Cmd)) Profile {
+	p.Options = append(p.Options[:len(p.Options):len(p.Options)], options...)
+	return p
+}
+
+// Option returns an option applying all options of the profile.
+func (p Profile) Option() func(c *Cmd) {
+	return func(c *Cmd) {
+		for _, o := range p.Options {
+			o(c)
+		}
+	}
+}
+
+// ProfileConflictError is the error of MergeProfiles for profiles setting
+// the same setting of a command differently.
+type ProfileConflictError struct {
+	// Setting is the name of the field of the Cmd, or Env.NAME for env vars.
+	Setting  string
+	Profiles [2]string
+}
+
+func (e *ProfileConflictError) Error() string {
+	return fmt.Sprintf("profiles %s and %s set %s differently", e.Profiles[0], e.Profiles[1], e.Setting)
+}
+
+// MergeProfiles merges the profiles into one of the name, whose options are
+// the ones of the profiles in order. Options adding to a command, like
+// writers, sinks, labels or hooks, are combined, while settings of a single
+// value, like the timeout, the working directory, the shell or an env var,
+// must not be set differently by two profiles, it returns a
+// *ProfileConflictError then, instead of letting the last one silently win.
+// Settings are found by applying the options to a probe command, funcs are
+// compared by their code.
+//
+// Example:
+//
+//	ci, err := gocmd.MergeProfiles("ci", Build, Untrusted)
+//	if err != nil {
+//		log.Fatal(err) // profiles build and untrusted set Timeout differently
+//	}
+func MergeProfiles(name string, profiles ...Profile) (Profile, error) {
+	merged := Profile{Name: name}
+	set := map[string]interface{}{}
+	by := map[string]string{}
+	for _, p := range profiles {
+		s := profileSettings(p.Options)
+		keys := make([]string, 0, len(s))
+		for k := range s {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if old, ok := set[k]; ok && old != s[k] {
+				return Profile{}, &ProfileConflictError{Setting: k, Profiles: [2]string{by[k], p.Name}}
+			}
+			set[k], by[k] = s[k], p.Name
+		}
+		merged.Options = append(merged.Options, p.Options...)
+	}
+	return merged, nil
+}
+
+// profileSettings returns the settings changed by the options.
+func profileSettings(options []func(*Cmd)) map[string]interface{} {
+	c := New("")
+	before := c.settings()
+	for _, o := range options {
+		o(c)
+	}
+	after := c.settings()
+	for k, v := range after {
+		if before[k] == v {
+			delete(after, k)
+		}
+	}
+	return after
+}
+
+// settings returns the comparable settings of the command, by name.
+func (c *Cmd) settings() map[string]interface{} {
+	s := map[string]interface{}{}
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f, name := v.Field(i), v.Type().Field(i).Name
+		switch f.Kind() {
+		case reflect.Bool:
+			s[name] = f.Bool()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			s[name] = f.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			s[name] = f.Uint()
+		case reflect.String:
+			s[name] = f.String()
+		case reflect.Ptr, reflect.Func:
+			s[name] = f.Pointer()
+		}
+	}
+	// replaced by WithCmd and WithShell
+	s["Cmd"] = c.Cmd.Path + "\x00" + strings.Join(c.Cmd.Args, "\x00")
+	for _, kv := range c.Env {
+		if k, val, ok := strings.Cut(kv, "="); ok {
+			s["Env."+k] = val
+		}
+	}
+	return s
+}
@@ -0,0 +1,46 @@
+package gocmd_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeProfiles(t *testing.T) {
+	build := gocmd.NewProfile("build", gocmd.WithTimeout(10*time.Minute), gocmd.WithLabels(map[string]string{"purpose": "build"}))
+	quiet := gocmd.NewProfile("quiet", gocmd.WithEnv(gocmd.EnvVars{"CI": "true"}), gocmd.WithLabels(map[string]string{"tenant": "a"}))
+
+	ci, err := gocmd.MergeProfiles("ci", build, quiet)
+	assert.Nil(t, err)
+	assert.Equal(t, "ci", ci.Name)
+	c := gocmd.New("echo $CI", ci.Options...)
+	assert.Equal(t, 10*time.Minute, c.Timeout)
+	assert.Equal(t, "build", c.Labels()["purpose"])
+	assert.Equal(t, "a", c.Labels()["tenant"])
+
+	// the same settings are no conflict
+	_, err = gocmd.MergeProfiles("ci", build, build.With(gocmd.WithEnv(gocmd.EnvVars{"CI": "true"})))
+	assert.Nil(t, err)
+
+	untrusted := gocmd.NewProfile("untrusted", gocmd.WithTimeout(10*time.Second))
+	_, err = gocmd.MergeProfiles("ci", build, untrusted)
+	var conflict *gocmd.ProfileConflictError
+	assert.True(t, errors.As(err, &conflict))
+	assert.Equal(t, "Timeout", conflict.Setting)
+	assert.Equal(t, [2]string{"build", "untrusted"}, conflict.Profiles)
+
+	_, err = gocmd.MergeProfiles("ci", quiet, gocmd.NewProfile("loud", gocmd.WithEnv(gocmd.EnvVars{"CI": "false"})))
+	assert.EqualError(t, err, "profiles quiet and loud set Env.CI differently")
+}
+
+func TestProfileWith(t *testing.T) {
+	untrusted := gocmd.NewProfile("untrusted", gocmd.WithTimeout(10*time.Second))
+	short := untrusted.With(gocmd.WithTimeout(time.Second))
+	assert.Len(t, untrusted.Options, 1)
+
+	c := gocmd.New("", short.Option())
+	assert.Equal(t, time.Second, c.Timeout)
+}
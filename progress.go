@@ -0,0 +1,126 @@
+package gocmd
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ProgressInfo is the progress of a running command, reported by WithProgress.
+type ProgressInfo struct {
+	Attempt int
+	Elapsed time.Duration // since the attempt was started
+	// Remaining is the time left until the timeout or the deadline of the context,
+	// -1 if there is none.
+	Remaining   time.Duration
+	StdoutBytes int64
+	StderrBytes int64
+	StdoutLines int64
+	StderrLines int64
+	// Stats are the last statistics sampled by WithProcessStats, nil without it.
+	Stats *ProcessStats
+	// Done is set on the last report of an attempt, after the command exited.
+	Done bool
+}
+
+// WithProgress calls f every interval while the command is running, and once
+// more after it exited, with the progress so far, to drive progress bars and
+// heartbeat logs. The interval is one second if not positive.
+// The bytes and lines are counted per attempt.
+//
+// Example:
+//
+//	c := gocmd.New("make", gocmd.WithProgress(10*time.Second, func(p gocmd.ProgressInfo) {
+//		log.Printf("make running %s, %s left, %d lines", p.Elapsed, p.Remaining, p.StdoutLines)
+//	}))
+func WithProgress(interval time.Duration, f func(ProgressInfo)) func(c *Cmd) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	return func(c *Cmd) {
+		var stdout, stderr counter
+		c.stdoutWriters = append(c.stdoutWriters, &stdout)
+		c.stderrWriters = append(c.stderrWriters, &stderr)
+		c.flushers = append(c.flushers, stdout.reset, stderr.reset)
+
+		c.watchers = append(c.watchers, func(ctx context.Context) {
+			start := time.Now()
+			deadline, hasDeadline := ctx.Deadline()
+			attempt := c.Status().Attempts
+
+			report := func(done bool) {
+				p := ProgressInfo{
+					Attempt:     attempt,
+					Elapsed:     time.Since(start),
+					Remaining:   -1,
+					StdoutBytes: atomic.LoadInt64(&stdout.bytes),
+					StderrBytes: atomic.LoadInt64(&stderr.bytes),
+					StdoutLines: atomic.LoadInt64(&stdout.lines),
+					StderrLines: atomic.LoadInt64(&stderr.lines),
+					Stats:       c.ProcessStats(),
+					Done:        done,
+				}
+				if hasDeadline {
+					if p.Remaining = time.Until(deadline); p.Remaining < 0 {
+						p.Remaining = 0
+					}
+				}
+				f(p)
+			}
+
+			t := time.NewTicker(interval)
+			defer t.Stop()
+			for {
+				select {
+				case <-t.C:
+					report(false)
+				case <-ctx.Done():
+					report(true)
+					return
+				}
+			}
+		})
+	}
+}
+
+// counter counts the bytes and lines written to it.
+type counter struct {
+	bytes, lines int64
+}
+
+func (c *counter) Write(p []byte) (int, error) {
+	atomic.AddInt64(&c.bytes, int64(len(p)))
+	atomic.AddInt64(&c.lines, int64(bytes.Count(p, []byte{'\n'})))
+	return len(p), nil
+}
+
+func (c *counter) reset() {
+	atomic.StoreInt64(&c.bytes, 0)
+	atomic.StoreInt64(&c.lines, 0)
+}
+
+// watch starts the watchers of a started command, the returned func stops
+// them when it exited and waits for them.
+func (c *Cmd) watch(ctx context.Context) (stop func()) {
+	if len(c.watchers) == 0 {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for _, w := range c.watchers {
+		wg.Add(1)
+		go func(w func(context.Context)) {
+			defer wg.Done()
+			w(ctx)
+		}(w)
+	}
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
@@ -0,0 +1,48 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithProgress(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		reports []gocmd.ProgressInfo
+	)
+	c := gocmd.New("echo a; echo b >&2; sleep 0.25; echo c",
+		gocmd.WithTimeout(10*time.Second),
+		gocmd.WithProgress(50*time.Millisecond, func(p gocmd.ProgressInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			reports = append(reports, p)
+		}))
+	assert.Nil(t, c.Run(context.TODO()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.GreaterOrEqual(t, len(reports), 3)
+
+	first, last := reports[0], reports[len(reports)-1]
+	assert.False(t, first.Done)
+	assert.Equal(t, 1, first.Attempt)
+	assert.Greater(t, first.Remaining, 9*time.Second)
+
+	assert.True(t, last.Done)
+	assert.Equal(t, int64(4), last.StdoutBytes)
+	assert.Equal(t, int64(2), last.StdoutLines)
+	assert.Equal(t, int64(1), last.StderrLines)
+	assert.GreaterOrEqual(t, last.Elapsed, 200*time.Millisecond)
+
+	c = gocmd.New("true", gocmd.WithTimeout(0), gocmd.WithProgress(time.Minute, func(p gocmd.ProgressInfo) {
+		assert.Equal(t, time.Duration(-1), p.Remaining)
+	}))
+	assert.Nil(t, c.Run(context.TODO()))
+}
@@ -0,0 +1,154 @@
+package gocmd
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// ptyState is the pseudo-terminal of the running attempt of a command run WithPTY.
+type ptyState struct {
+	mu         sync.Mutex
+	rows, cols uint16
+	master     *os.File
+	slave      *os.File
+	copied     chan struct{} // closed once the output of the master was copied
+}
+
+// WithPTY runs the command with a pseudo-terminal as its stdin, stdout and
+// stderr, and its controlling terminal, for the tools which behave
+// differently, or refuse to run, without a terminal, like top, docker -t or
+// sudo. The output of the terminal is the stdout of the command, its stderr
+// included, with lines ending by \r\n and the input echoed, like on a
+// terminal, unless the command turns it off. The input of WithStdin or
+// StdinPipe is written to the terminal, followed by an end of file (^D).
+// The terminal is 24 rows by 80 columns, see SetWinsize. Linux only.
+//
+// Example:
+//
+//	c := gocmd.New("top -b -n 1", gocmd.WithPTY())
+//	_ = c.SetWinsize(50, 200)
+//	err := c.Run(ctx)
+func WithPTY() func(c *Cmd) {
+	return func(c *Cmd) {
+		c.Setsid = true
+		c.pty = &ptyState{rows: 24, cols: 80}
+		c.beforeStart = append(c.beforeStart, func(cmd *exec.Cmd) error {
+			return c.pty.open(cmd, c.stdin)
+		})
+		c.afterStart = append(c.afterStart, func(int) error {
+			// else the master does not get EOF once the command exited
+			c.pty.closeSlave()
+			return nil
+		})
+		c.afterExit = append(c.afterExit, func() { c.pty.drain(c.OutputDeadline) })
+		c.flushers = append(c.flushers, c.pty.close)
+	}
+}
+
+// SetWinsize sets the size of the pseudo-terminal of WithPTY, the one of the
+// next run if it is not running, else the command gets a SIGWINCH.
+func (c *Cmd) SetWinsize(rows, cols uint16) error {
+	if c.pty == nil {
+		return errNoPTY
+	}
+	p := c.pty
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.rows, p.cols = rows, cols
+	if p.master == nil {
+		return nil
+	}
+	return setWinsize(p.master, rows, cols)
+}
+
+var errNoPTY = errors.New("command not run WithPTY")
+
+// open opens the terminal of an attempt, copying the input to it, and its
+// output to the stdout of cmd, which it replaces.
+func (p *ptyState) open(cmd *exec.Cmd, stdin io.Reader) error {
+	master, slave, err := openPTY()
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := setWinsize(master, p.rows, p.cols); err != nil {
+		master.Close()
+		slave.Close()
+		return err
+	}
+	p.master, p.slave, p.copied = master, slave, make(chan struct{})
+
+	stdout := cmd.Stdout
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr.Setctty = true
+	cmd.SysProcAttr.Ctty = 0
+
+	go func() {
+		defer close(p.copied)
+		if stdout == nil {
+			stdout = io.Discard
+		}
+		// reads fail by EIO once the command, and the processes it started, closed the terminal
+		_, _ = io.Copy(stdout, master)
+	}()
+	if stdin != nil {
+		go func() {
+			if _, err := io.Copy(master, stdin); err == nil {
+				_, _ = master.Write([]byte{4}) // ^D, the end of file of a terminal
+			}
+		}()
+	}
+	return nil
+}
+
+func (p *ptyState) closeSlave() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.slave != nil {
+		_ = p.slave.Close()
+		p.slave = nil
+	}
+}
+
+// drain waits for the output of the terminal to be copied, up to the output
+// deadline, in case processes started by the command keep it open.
+func (p *ptyState) drain(deadline time.Duration) {
+	p.mu.Lock()
+	copied := p.copied
+	p.mu.Unlock()
+	if copied == nil {
+		return
+	}
+
+	if deadline <= 0 {
+		deadline = DefaultOutputDeadline
+	}
+	t := time.NewTimer(deadline)
+	defer t.Stop()
+	select {
+	case <-copied:
+	case <-t.C:
+		p.close()
+	}
+}
+
+func (p *ptyState) close() {
+	p.closeSlave()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.master != nil {
+		_ = p.master.Close()
+		p.master = nil
+	}
+}
@@ -0,0 +1,66 @@
+package gocmd
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// openPTY opens a new pseudo-terminal, its master and slave side.
+func openPTY() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var n uint32
+	unlock := int32(0)
+	var ioctlErr error
+	rc, err := master.SyscallConn()
+	if err == nil {
+		// not by Fd, which would make the reads of the master blocking, not stopped by Close
+		err = rc.Control(func(fd uintptr) {
+			if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); errno != 0 {
+				ioctlErr = fmt.Errorf("ioctl TIOCGPTN: %w", errno)
+				return
+			}
+			if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); errno != 0 {
+				ioctlErr = fmt.Errorf("ioctl TIOCSPTLCK: %w", errno)
+			}
+		})
+	}
+	if err == nil {
+		err = ioctlErr
+	}
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+// setWinsize sets the size of the terminal of the master, which sends SIGWINCH to its foreground process group.
+func setWinsize(master *os.File, rows, cols uint16) error {
+	ws := struct{ rows, cols, x, y uint16 }{rows: rows, cols: cols}
+	rc, err := master.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ioctlErr error
+	err = rc.Control(func(fd uintptr) {
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&ws))); errno != 0 {
+			ioctlErr = fmt.Errorf("ioctl TIOCSWINSZ: %w", errno)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return ioctlErr
+}
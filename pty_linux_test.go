@@ -0,0 +1,43 @@
+package gocmd_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithPTY(t *testing.T) {
+	c := gocmd.New(`test -t 0 && test -t 1 && test -t 2 && echo tty; stty size; echo err >&2`, gocmd.WithPTY())
+	assert.Nil(t, c.SetWinsize(50, 200))
+	err := c.Run(context.TODO())
+	if errors.Is(err, gocmd.ErrNotSupported) {
+		t.Skip(err)
+	}
+	assert.Nil(t, err)
+	assert.Equal(t, "tty\r\n50 200\r\nerr\r\n", c.Stdout())
+	assert.Equal(t, "", c.Stderr())
+
+	assert.Error(t, gocmd.New("true").SetWinsize(24, 80))
+}
+
+func TestWithPTYStdin(t *testing.T) {
+	c := gocmd.New(`stty -echo; read -r l; echo "got $l"; cat`, gocmd.WithPTY(),
+		gocmd.WithStdin(strings.NewReader("hello\n")), gocmd.WithTimeout(5*time.Second))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Contains(t, c.Stdout(), "got hello\r\n")
+}
+
+func TestWithPTYResize(t *testing.T) {
+	c := gocmd.New(`trap 'stty size; exit 0' WINCH; while :; do sleep 0.05; done`, gocmd.WithPTY(), gocmd.WithTimeout(5*time.Second))
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		_ = c.SetWinsize(30, 100)
+	}()
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, "30 100\r\n", c.Stdout())
+}
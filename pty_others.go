@@ -0,0 +1,16 @@
+//go:build !linux
+
+package gocmd
+
+import (
+	"fmt"
+	"os"
+)
+
+func openPTY() (master, slave *os.File, err error) {
+	return nil, nil, fmt.Errorf("pty: %w", ErrNotSupported)
+}
+
+func setWinsize(master *os.File, rows, cols uint16) error {
+	return fmt.Errorf("pty: %w", ErrNotSupported)
+}
@@ -0,0 +1,230 @@
+package gocmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Usage is the resource usage of runs of commands, accounted by a Meter.
+type Usage struct {
+	// Runs is the number of attempts started.
+	Runs     int64         `json:"runs"`
+	WallTime time.Duration `json:"wall_time"`
+	// CPUTime is the user and system CPU time, from the rusage of the commands,
+	// including the one of their children they waited for.
+	CPUTime time.Duration `json:"cpu_time"`
+	// OutputBytes are the bytes written to stdout and stderr.
+	OutputBytes int64 `json:"output_bytes"`
+}
+
+// Add returns the sum of the usages.
+func (u Usage) Add(o Usage) Usage {
+	return Usage{
+		Runs:        u.Runs + o.Runs,
+		WallTime:    u.WallTime + o.WallTime,
+		CPUTime:     u.CPUTime + o.CPUTime,
+		OutputBytes: u.OutputBytes + o.OutputBytes,
+	}
+}
+
+// UsageStore stores the cumulative usage per key, like in a database shared
+// by the hosts of a service.
+type UsageStore interface {
+	// Add adds the usage to the one of the key, and returns the new total.
+	Add(key string, u Usage) (Usage, error)
+	// Get returns the usage of the key, zero if none.
+	Get(key string) (Usage, error)
+}
+
+// MemoryUsageStore is a UsageStore in memory, its zero value is ready to use.
+type MemoryUsageStore struct {
+	mu    sync.Mutex
+	usage map[string]Usage
+}
+
+// Add implements UsageStore.
+func (s *MemoryUsageStore) Add(key string, u Usage) (Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.usage == nil {
+		s.usage = map[string]Usage{}
+	}
+	total := s.usage[key].Add(u)
+	s.usage[key] = total
+	return total, nil
+}
+
+// Get implements UsageStore.
+func (s *MemoryUsageStore) Get(key string) (Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.usage[key], nil
+}
+
+// Snapshot returns a copy of the usage of all keys.
+func (s *MemoryUsageStore) Snapshot() map[string]Usage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usage := make(map[string]Usage, len(s.usage))
+	for k, u := range s.usage {
+		usage[k] = u
+	}
+	return usage
+}
+
+// Reset forgets the usage of the key, like at the start of a billing period.
+func (s *MemoryUsageStore) Reset(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.usage, key)
+}
+
+// ErrQuotaExceeded is matched by the QuotaError of commands whose key exceeded its quota.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaError is the error of Quota for a key which used up its quota.
+type QuotaError struct {
+	Key   string
+	Usage Usage
+	Quota Usage
+}
+
+func (e *QuotaError) Error() string {
+	var exceeded []string
+	if e.Quota.Runs > 0 && e.Usage.Runs >= e.Quota.Runs {
+		exceeded = append(exceeded, fmt.Sprintf("%d runs", e.Quota.Runs))
+	}
+	if e.Quota.WallTime > 0 && e.Usage.WallTime >= e.Quota.WallTime {
+		exceeded = append(exceeded, fmt.Sprintf("%s wall time", e.Quota.WallTime))
+	}
+	if e.Quota.CPUTime > 0 && e.Usage.CPUTime >= e.Quota.CPUTime {
+		exceeded = append(exceeded, fmt.Sprintf("%s CPU time", e.Quota.CPUTime))
+	}
+	if e.Quota.OutputBytes > 0 && e.Usage.OutputBytes >= e.Quota.OutputBytes {
+		exceeded = append(exceeded, fmt.Sprintf("%d output bytes", e.Quota.OutputBytes))
+	}
+	return fmt.Sprintf("%s: %q used %s", ErrQuotaExceeded, e.Key, strings.Join(exceeded, ", "))
+}
+
+// Is makes errors.Is(err, ErrQuotaExceeded) true.
+func (e *QuotaError) Is(target error) bool { return target == ErrQuotaExceeded }
+
+// Quota returns a Meter.Check denying the runs of keys which used up any of
+// the non-zero fields of the quota, by a *QuotaError.
+func Quota(quota Usage) func(key string, usage Usage) error {
+	return func(key string, u Usage) error {
+		if (quota.Runs > 0 && u.Runs >= quota.Runs) ||
+			(quota.WallTime > 0 && u.WallTime >= quota.WallTime) ||
+			(quota.CPUTime > 0 && u.CPUTime >= quota.CPUTime) ||
+			(quota.OutputBytes > 0 && u.OutputBytes >= quota.OutputBytes) {
+			return &QuotaError{Key: key, Usage: u, Quota: quota}
+		}
+		return nil
+	}
+}
+
+// Meter accounts the resource usage of commands per key, the value of a
+// label of the commands, like tenant, into its Store, and enforces quotas
+// by Check, the metering layer of services running commands for others.
+//
+// Example:
+//
+//	store := &gocmd.MemoryUsageStore{}
+//	m := &gocmd.Meter{Label: "tenant", Store: store, Check: gocmd.Quota(gocmd.Usage{CPUTime: time.Hour})}
+//	c := gocmd.New(cmd, gocmd.WithLabels(map[string]string{"tenant": tenant}), gocmd.WithMeter(m))
+//	if err := c.Run(ctx); errors.Is(err, gocmd.ErrQuotaExceeded) {
+//		http.Error(w, err.Error(), http.StatusPaymentRequired)
+//	}
+type Meter struct {
+	// Label is the label whose values are the keys, commands without it share the empty key.
+	Label string
+	// Store is the store of the usage, a MemoryUsageStore if nil.
+	Store UsageStore
+	// Check, if not nil, is called with the usage of the key before a run, an
+	// error denies it, like the one of Quota.
+	Check func(key string, usage Usage) error
+	// OnUsage, if not nil, is called after each attempt with its usage and the
+	// new total of the key, or the error of the store.
+	OnUsage func(key string, attempt, total Usage, err error)
+
+	once sync.Once
+}
+
+func (m *Meter) store() UsageStore {
+	m.once.Do(func() {
+		if m.Store == nil {
+			m.Store = &MemoryUsageStore{}
+		}
+	})
+	return m.Store
+}
+
+// Usage returns the usage of the key.
+func (m *Meter) Usage(key string) (Usage, error) {
+	return m.store().Get(key)
+}
+
+// WithMeter accounts the usage of each attempt of the command by the meter,
+// keyed by the value of its label of Meter.Label, and checks the quota of
+// the key before it is run, Run fails with the error of Meter.Check, without
+// starting the command, if it is denied, or if the usage can't be read.
+func WithMeter(m *Meter) func(c *Cmd) {
+	return func(c *Cmd) {
+		var output counter
+		var started time.Time
+		c.meters = append(c.meters, m)
+		c.stdoutWriters = append(c.stdoutWriters, &output)
+		c.stderrWriters = append(c.stderrWriters, &output)
+		c.afterStart = append(c.afterStart, func(int) error {
+			started = time.Now()
+			return nil
+		})
+		c.flushers = append(c.flushers, func() {
+			defer output.reset()
+			if started.IsZero() {
+				return // not started
+			}
+			u := Usage{Runs: 1, WallTime: time.Since(started), OutputBytes: output.bytes}
+			if ps := c.Cmd.ProcessState; ps != nil {
+				u.CPUTime = ps.UserTime() + ps.SystemTime()
+			}
+			started = time.Time{}
+
+			key := c.labels[m.Label]
+			total, err := m.store().Add(key, u)
+			if m.OnUsage != nil {
+				m.OnUsage(key, u, total, err)
+			}
+		})
+	}
+}
+
+// Allow returns the error of Check on the usage of the key, nil if it may
+// run, like to deny a job before it is queued.
+func (m *Meter) Allow(key string) error {
+	if m.Check == nil {
+		return nil
+	}
+	u, err := m.store().Get(key)
+	if err != nil {
+		return fmt.Errorf("usage of %q: %w", key, err)
+	}
+	return m.Check(key, u)
+}
+
+// checkMeters checks the quotas of the command by its meters.
+func (c *Cmd) checkMeters() error {
+	for _, m := range c.meters {
+		if err := m.Allow(c.labels[m.Label]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
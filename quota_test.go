@@ -0,0 +1,73 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuota(t *testing.T) {
+	check := gocmd.Quota(gocmd.Usage{Runs: 2, CPUTime: time.Second})
+	assert.Nil(t, check("acme", gocmd.Usage{Runs: 1, CPUTime: time.Millisecond}))
+
+	err := check("acme", gocmd.Usage{Runs: 2, CPUTime: 2 * time.Second})
+	assert.EqualError(t, err, `quota exceeded: "acme" used 2 runs, 1s CPU time`)
+	assert.ErrorIs(t, err, gocmd.ErrQuotaExceeded)
+	var qe *gocmd.QuotaError
+	assert.True(t, errors.As(err, &qe))
+	assert.Equal(t, int64(2), qe.Usage.Runs)
+}
+
+func TestWithMeter(t *testing.T) {
+	store := &gocmd.MemoryUsageStore{}
+	var keys []string
+	var attempts []gocmd.Usage
+	m := &gocmd.Meter{
+		Label: "tenant",
+		Store: store,
+		Check: gocmd.Quota(gocmd.Usage{Runs: 3}),
+		OnUsage: func(key string, attempt, total gocmd.Usage, err error) {
+			assert.Nil(t, err)
+			keys = append(keys, key)
+			attempts = append(attempts, attempt)
+		},
+	}
+	acme := gocmd.WithLabels(map[string]string{"tenant": "acme"})
+
+	c := gocmd.New("echo hello; echo oops >&2", gocmd.WithShell("sh"), acme, gocmd.WithMeter(m))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, []gocmd.Usage{attempts[0]}, attempts)
+	assert.Equal(t, int64(1), attempts[0].Runs)
+	assert.Equal(t, int64(len("hello\noops\n")), attempts[0].OutputBytes)
+	assert.True(t, attempts[0].WallTime > 0)
+
+	// each attempt is accounted
+	c = gocmd.New("exit 3", gocmd.WithShell("sh"), acme, gocmd.WithMeter(m), gocmd.WithRetry(gocmd.RetryPolicy{Retries: 1}))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, 2, c.Attempts())
+	u, err := m.Usage("acme")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), u.Runs)
+	assert.Equal(t, int64(len("hello\noops\n")), u.OutputBytes)
+	assert.Equal(t, map[string]gocmd.Usage{"acme": u}, store.Snapshot())
+
+	marker := t.TempDir() + "/ran"
+	err = gocmd.New("touch "+marker, acme, gocmd.WithMeter(m)).Run(context.TODO())
+	assert.ErrorIs(t, err, gocmd.ErrQuotaExceeded)
+	_, err = os.Stat(marker)
+	assert.True(t, os.IsNotExist(err))
+
+	// other keys have their own quota
+	assert.Nil(t, gocmd.New("true", gocmd.WithMeter(m)).Run(context.TODO()))
+	assert.Equal(t, []string{"acme", "acme", "acme", ""}, keys)
+
+	store.Reset("acme")
+	assert.Nil(t, gocmd.New("true", acme, gocmd.WithMeter(m)).Run(context.TODO()))
+}
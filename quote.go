@@ -0,0 +1,22 @@
+package gocmd
+
+import (
+	"github.com/bingoohuang/gocmd/shellquote"
+)
+
+// Quote returns the args quoted for the shell New runs commands by on this
+// platform, that is bash on linux and darwin, and cmd.exe on windows.
+//
+// Example:
+//
+//	sh, _ := gocmd.Quote("a.sh", "arg 1", "$HOME")
+//	c := gocmd.New(sh)
+func Quote(args ...string) (string, error) {
+	return shellquote.QuoteDialect(shellquote.DialectOf(defaultShell), args...)
+}
+
+// Dialect returns the quoting dialect of the shell the command runs by,
+// which follows the executable set by WithCmd.
+func (c *Cmd) Dialect() shellquote.Dialect {
+	return shellquote.DialectOf(c.Cmd.Path)
+}
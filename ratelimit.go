@@ -0,0 +1,188 @@
+package gocmd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is matched by the RateLimitError of commands exceeding the limits of a Limiter.
+var ErrRateLimited = errors.New("rate limited")
+
+// RateLimitError is the error of a run exceeding the limits of a Limiter.
+type RateLimitError struct {
+	Key string
+	// Limit is the exceeded one, "runs per minute" or "concurrent runs".
+	Limit string
+	// RetryAfter is when a run of the key is allowed again, 1s for concurrent
+	// runs, as it is not known when a running one exits.
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s: %s of %q exceeded, retry after %s", ErrRateLimited, e.Limit, e.Key, e.RetryAfter)
+}
+
+// Is makes errors.Is(err, ErrRateLimited) true.
+func (e *RateLimitError) Is(target error) bool { return target == ErrRateLimited }
+
+// Limiter limits the runs of commands per key, the value of a label of the
+// commands, like tenant, to a number of runs started per minute and a number
+// of runs at the same time, so that a multi-tenant service does not let one
+// tenant monopolize its capacity. A run exceeding them fails right away with a
+// *RateLimitError, instead of waiting.
+//
+// Example:
+//
+//	l := &gocmd.Limiter{Label: "tenant", PerMinute: 60, Concurrent: 4}
+//	c := gocmd.New(cmd, gocmd.WithLabels(map[string]string{"tenant": tenant}), gocmd.WithLimiter(l))
+//	var rle *gocmd.RateLimitError
+//	if err := c.Run(ctx); errors.As(err, &rle) {
+//		w.Header().Set("Retry-After", strconv.Itoa(int(rle.RetryAfter.Seconds())))
+//	}
+type Limiter struct {
+	// Label is the label whose values are the keys, commands without it share the empty key.
+	Label string
+	// PerMinute is the maximum number of runs started per minute per key, in any
+	// sliding window of a minute, 0 for no limit.
+	PerMinute int
+	// Concurrent is the maximum number of runs at the same time per key, 0 for no limit.
+	Concurrent int
+
+	mu    sync.Mutex
+	keys  map[string]*limiterKey
+	swept time.Time // when the idle keys were deleted
+}
+
+// limiterKey is the state of a key of a Limiter.
+type limiterKey struct {
+	starts  []time.Time // of the runs of the last minute
+	running int
+}
+
+// WithLimiter limits the runs of the command by the limiter, keyed by the
+// value of its label of Limiter.Label. A run is counted once, whatever its
+// retries, Run fails with a *RateLimitError, without starting the command,
+// if it exceeds the limits.
+func WithLimiter(l *Limiter) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.limiters = append(c.limiters, l)
+	}
+}
+
+// Acquire counts a run of the key, which must call release once it is done,
+// or returns a *RateLimitError if it exceeds the limits.
+func (l *Limiter) Acquire(key string) (release func(), err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.keys == nil {
+		l.keys = map[string]*limiterKey{}
+	}
+	now := time.Now()
+	if now.Sub(l.swept) >= time.Minute {
+		l.sweep(now)
+	}
+	k := l.keys[key]
+	if k == nil {
+		k = &limiterKey{}
+		l.keys[key] = k
+	}
+	k.expire(now)
+	if l.PerMinute > 0 && len(k.starts) >= l.PerMinute {
+		retryAfter := k.starts[len(k.starts)-l.PerMinute].Add(time.Minute).Sub(now)
+		return nil, &RateLimitError{Key: key, Limit: "runs per minute", RetryAfter: ceilSecond(retryAfter)}
+	}
+	if l.Concurrent > 0 && k.running >= l.Concurrent {
+		return nil, &RateLimitError{Key: key, Limit: "concurrent runs", RetryAfter: time.Second}
+	}
+
+	k.starts = append(k.starts, now)
+	k.running++
+	var once sync.Once
+	return func() { once.Do(func() { l.release(key) }) }, nil
+}
+
+func (l *Limiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.keys[key].running--
+}
+
+// sweep deletes the keys without runs in the last minute.
+func (l *Limiter) sweep(now time.Time) {
+	for key, k := range l.keys {
+		if k.expire(now); k.running == 0 && len(k.starts) == 0 {
+			delete(l.keys, key)
+		}
+	}
+	l.swept = now
+}
+
+// expire forgets the runs started a minute ago.
+func (k *limiterKey) expire(now time.Time) {
+	for len(k.starts) > 0 && now.Sub(k.starts[0]) >= time.Minute {
+		k.starts = k.starts[1:]
+	}
+}
+
+// Running returns the number of runs of the key running.
+func (l *Limiter) Running(key string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if k := l.keys[key]; k != nil {
+		return k.running
+	}
+	return 0
+}
+
+// LimiterKeyState is the state of a key of a Limiter.
+type LimiterKeyState struct {
+	Running int `json:"running"`
+	// LastMinute is the number of runs started in the last minute.
+	LastMinute int `json:"last_minute"`
+}
+
+// Snapshot returns the state of the keys with runs running, or started in the last minute.
+func (l *Limiter) Snapshot() map[string]LimiterKeyState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	keys := make(map[string]LimiterKeyState, len(l.keys))
+	for key, k := range l.keys {
+		if k.expire(now); k.running > 0 || len(k.starts) > 0 {
+			keys[key] = LimiterKeyState{Running: k.running, LastMinute: len(k.starts)}
+		}
+	}
+	return keys
+}
+
+// ceilSecond rounds d up to a whole second, like for a Retry-After header.
+func ceilSecond(d time.Duration) time.Duration {
+	return time.Duration(math.Ceil(d.Seconds())) * time.Second
+}
+
+// acquireLimiters counts the run of the command by its limiters, the
+// returned func releases it.
+func (c *Cmd) acquireLimiters() (func(), error) {
+	var releases []func()
+	release := func() {
+		for _, r := range releases {
+			r()
+		}
+	}
+	for _, l := range c.limiters {
+		r, err := l.Acquire(c.labels[l.Label])
+		if err != nil {
+			release()
+			return nil, err
+		}
+		releases = append(releases, r)
+	}
+	return release, nil
+}
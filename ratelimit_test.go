@@ -0,0 +1,72 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	l := &gocmd.Limiter{Label: "tenant", PerMinute: 3, Concurrent: 2}
+
+	r1, err := l.Acquire("acme")
+	assert.Nil(t, err)
+	r2, err := l.Acquire("acme")
+	assert.Nil(t, err)
+	_, err = l.Acquire("acme")
+	var rle *gocmd.RateLimitError
+	assert.True(t, errors.As(err, &rle))
+	assert.Equal(t, "concurrent runs", rle.Limit)
+	assert.Equal(t, time.Second, rle.RetryAfter)
+	assert.ErrorIs(t, err, gocmd.ErrRateLimited)
+	assert.Equal(t, 2, l.Running("acme"))
+
+	// other keys are not limited by it
+	r3, err := l.Acquire("other")
+	assert.Nil(t, err)
+	r3()
+
+	r1()
+	r1() // released once
+	assert.Equal(t, 1, l.Running("acme"))
+	r4, err := l.Acquire("acme")
+	assert.Nil(t, err)
+	r2()
+	r4()
+
+	_, err = l.Acquire("acme")
+	assert.EqualError(t, err, `rate limited: runs per minute of "acme" exceeded, retry after 1m0s`)
+	assert.True(t, errors.As(err, &rle))
+	assert.Equal(t, "runs per minute", rle.Limit)
+	assert.Equal(t, 0, l.Running("acme"))
+	assert.Equal(t, map[string]gocmd.LimiterKeyState{
+		"acme":  {LastMinute: 3},
+		"other": {LastMinute: 1},
+	}, l.Snapshot())
+}
+
+func TestWithLimiter(t *testing.T) {
+	l := &gocmd.Limiter{Label: "tenant", Concurrent: 1}
+	acme := gocmd.WithLabels(map[string]string{"tenant": "acme"})
+
+	c := gocmd.New("sleep 10", acme, gocmd.WithLimiter(l))
+	done := make(chan error)
+	go func() { done <- c.Run(context.TODO()) }()
+	assert.Eventually(t, func() bool { return c.Status().Running }, 5*time.Second, 10*time.Millisecond)
+
+	marker := t.TempDir() + "/ran"
+	assert.ErrorIs(t, gocmd.New("touch "+marker, acme, gocmd.WithLimiter(l)).Run(context.TODO()), gocmd.ErrRateLimited)
+	assert.NoFileExists(t, marker)
+	assert.Nil(t, gocmd.New("true", gocmd.WithLimiter(l)).Run(context.TODO()))
+
+	assert.Nil(t, c.Cancel("done"))
+	<-done
+	assert.Equal(t, 0, l.Running("acme"))
+	assert.Nil(t, gocmd.New("true", acme, gocmd.WithLimiter(l)).Run(context.TODO()))
+}
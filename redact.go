@@ -0,0 +1,100 @@
+package gocmd
+
+import (
+	"regexp"
+
+	"github.com/bingoohuang/gocmd/shellquote"
+)
+
+// redactedMask replaces the secrets in redacted command lines.
+const redactedMask = "***"
+
+// WithRedactedArgs masks the args of the indices, 0 being the executable, in
+// the command lines displayed by Redacted, Status and the errors of Run.
+// The args are the ones of commands executed directly by WithCmd, use
+// WithRedactedPattern for commands run by the shell.
+//
+// Example:
+//
+//	c := gocmd.New("", gocmd.WithCmd(exec.Command("mysql", "-u", "root", "-p"+password)), gocmd.WithRedactedArgs(3))
+func WithRedactedArgs(indices ...int) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.redactedArgs = append(c.redactedArgs, indices...)
+	}
+}
+
+// WithRedactedPattern masks the matches of re in the command lines displayed
+// by Redacted, Status and the errors of Run, only the first submatch if re
+// has one.
+//
+// Example:
+//
+//	c := gocmd.New("curl -u admin:"+password+" https://example.com",
+//		gocmd.WithRedactedPattern(regexp.MustCompile(`-u \S+:(\S+)`)))
+//	c.Redacted() // curl -u admin:*** https://example.com
+func WithRedactedPattern(re *regexp.Regexp) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.redactedPatterns = append(c.redactedPatterns, re)
+	}
+}
+
+// Redacted returns the command line to display, with the secrets masked as
+// told by WithRedactedArgs and WithRedactedPattern, and the credentials of
+// WithCredentialEnv and WithCredentialFD.
+func (c *Cmd) Redacted() string {
+	line := c.Command
+	if line == "" && c.Cmd != nil {
+		args := append([]string(nil), c.Cmd.Args...)
+		for _, i := range c.redactedArgs {
+			if i >= 0 && i < len(args) {
+				args[i] = redactedMask
+			}
+		}
+		line = shellquote.QuoteMust(args...)
+	}
+	return c.redact(line)
+}
+
+// redactArgs returns the args with the secrets masked, like Redacted.
+func (c *Cmd) redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		redacted[i] = c.redact(arg)
+	}
+	for _, i := range c.redactedArgs {
+		if i >= 0 && i < len(redacted) {
+			redacted[i] = redactedMask
+		}
+	}
+	return redacted
+}
+
+// redact masks the secrets of WithRedactedPattern and the credentials in s.
+func (c *Cmd) redact(s string) string {
+	for _, re := range c.redactedPatterns {
+		s = redact(re, s)
+	}
+	for _, re := range c.resolved.masks {
+		s = redact(re, s)
+	}
+	return s
+}
+
+// redact masks the matches of re in s, or their first submatches if re has any.
+func redact(re *regexp.Regexp, s string) string {
+	if re.NumSubexp() == 0 {
+		return re.ReplaceAllLiteralString(s, redactedMask)
+	}
+
+	var b []byte
+	last := 0
+	for _, m := range re.FindAllStringSubmatchIndex(s, -1) {
+		if m[2] < 0 {
+			continue
+		}
+		b = append(b, s[last:m[2]]...)
+		b = append(b, redactedMask...)
+		last = m[3]
+	}
+	return string(append(b, s[last:]...))
+}
@@ -0,0 +1,27 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"os/exec"
+	"regexp"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommand_WithRedacted(t *testing.T) {
+	c := gocmd.New("curl -u admin:s3cret --data token=abc https://example.com",
+		gocmd.WithRedactedPattern(regexp.MustCompile(`-u \S+:(\S+)`)),
+		gocmd.WithRedactedPattern(regexp.MustCompile(`token=\w+`)))
+	assert.Equal(t, "curl -u admin:*** --data *** https://example.com", c.Redacted())
+	assert.Equal(t, c.Redacted(), c.Status().Command)
+
+	c = gocmd.New("", gocmd.WithCmd(exec.Command("/nonexistent/mysql", "-u", "root", "-ps3cret")), gocmd.WithRedactedArgs(3, 9))
+	assert.Equal(t, "/nonexistent/mysql -u root '***'", c.Redacted())
+	err := c.Run(context.TODO())
+	assert.NotNil(t, err)
+	assert.NotContains(t, err.Error(), "s3cret")
+}
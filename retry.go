@@ -0,0 +1,115 @@
+package gocmd
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"time"
+)
+
+// RetryPolicy tells if and when a failed command is run again.
+// A command failed if it exited with a non-zero exit code or timed out.
+type RetryPolicy struct {
+	// Retries is the maximum number of runs after the first one.
+	Retries int
+	// Delay is the time to wait before running the command again.
+	Delay time.Duration
+	// OnExitCodes are the exit codes to retry on, any non-zero one if empty.
+	// Codes classified by WithExitCodeMap are retried if Retryable only.
+	OnExitCodes []int
+	// OnFailures, if not empty, are the failure kinds of WithFailureClassifier
+	// to retry on, instead of OnExitCodes.
+	OnFailures []FailureKind
+	// OnAttempt, if not nil, is called after each failed attempt which is retried.
+	// The err is the error of Run, like a wrapped ErrTimeout, exitCode is 0 then.
+	OnAttempt func(attempt, exitCode int, err error)
+}
+
+// WithRetry sets the retry policy of the command.
+// The stdin of the command is not replayed on retries.
+//
+// Example:
+//
+//	c := gocmd.New("curl -fsS https://example.com", gocmd.WithRetry(gocmd.RetryPolicy{
+//		Retries: 3,
+//		Delay:   2 * time.Second,
+//	}))
+//	c.Run(context.TODO())
+func WithRetry(p RetryPolicy) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.retry = p
+	}
+}
+
+// Attempts returns how many times the command was run.
+func (c *Cmd) Attempts() int {
+	c.checkExecuted("Attempts")
+	return c.attempts
+}
+
+func (p RetryPolicy) shouldRetry(c *Cmd, err error) bool {
+	if err != nil {
+		return errors.Is(err, ErrTimeout)
+	}
+	if o, ok := c.exitCodeMap[c.exitCode]; ok {
+		return o == Retryable
+	}
+	if c.exitCode == 0 {
+		return false
+	}
+	if len(p.OnFailures) > 0 {
+		for _, kind := range p.OnFailures {
+			if kind == c.failure {
+				return true
+			}
+		}
+		return false
+	}
+	if len(p.OnExitCodes) == 0 {
+		return true
+	}
+	for _, code := range p.OnExitCodes {
+		if code == c.exitCode {
+			return true
+		}
+	}
+	return false
+}
+
+// resetForRetry prepares the command to be run again, an exec.Cmd can't be reused.
+func (c *Cmd) resetForRetry(template *exec.Cmd) {
+	c.Cmd = cloneCmd(template)
+	c.StdoutBuf.Reset()
+	c.StderrBuf.Reset()
+	c.CombinedBuf.Reset()
+	c.exitCode = 0
+	c.failure = FailureNone
+}
+
+// cloneCmd returns an unstarted copy of cmd.
+func cloneCmd(cmd *exec.Cmd) *exec.Cmd {
+	return &exec.Cmd{
+		Path:        cmd.Path,
+		Args:        cmd.Args,
+		Env:         cmd.Env,
+		Dir:         cmd.Dir,
+		Stdin:       cmd.Stdin,
+		Stdout:      cmd.Stdout,
+		Stderr:      cmd.Stderr,
+		ExtraFiles:  cmd.ExtraFiles,
+		SysProcAttr: cmd.SysProcAttr,
+	}
+}
+
+// sleepContext sleeps for d, it returns false if the context is done before.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
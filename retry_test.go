@@ -0,0 +1,59 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommand_WithRetry(t *testing.T) {
+	counter := filepath.Join(t.TempDir(), "counter")
+	var failed []int
+	c := gocmd.New(`echo x >> `+counter+`; n=$(wc -l < `+counter+`); echo attempt $n; [ $n -ge 3 ] || exit 75`,
+		gocmd.WithRetry(gocmd.RetryPolicy{
+			Retries:     5,
+			Delay:       time.Millisecond,
+			OnExitCodes: []int{75},
+			OnAttempt: func(attempt, exitCode int, err error) {
+				failed = append(failed, exitCode)
+			},
+		}))
+
+	err := c.Run(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, c.ExitCode())
+	assert.Equal(t, 3, c.Attempts())
+	assert.Equal(t, []int{75, 75}, failed)
+	assert.Equal(t, "attempt 3\n", c.Stdout())
+}
+
+func TestCommand_WithRetryGivesUp(t *testing.T) {
+	c := gocmd.New("exit 1", gocmd.WithRetry(gocmd.RetryPolicy{Retries: 2}))
+
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, 1, c.ExitCode())
+	assert.Equal(t, 3, c.Attempts())
+}
+
+func TestCommand_WithRetryOtherExitCode(t *testing.T) {
+	c := gocmd.New("exit 2", gocmd.WithRetry(gocmd.RetryPolicy{Retries: 2, OnExitCodes: []int{75}}))
+
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, 2, c.ExitCode())
+	assert.Equal(t, 1, c.Attempts())
+}
+
+func TestCommand_WithRetryTimeout(t *testing.T) {
+	c := gocmd.New("sleep 1", gocmd.WithTimeout(10*time.Millisecond),
+		gocmd.WithRetry(gocmd.RetryPolicy{Retries: 1}))
+
+	err := c.Run(context.TODO())
+	assert.ErrorIs(t, err, gocmd.ErrTimeout)
+	assert.Equal(t, 2, c.Attempts())
+}
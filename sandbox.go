@@ -0,0 +1,196 @@
+package gocmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Sandbox runs commands in a gVisor sandbox by runsc, whose kernel in user
+// space filters the syscalls of the commands, an isolation between the one of
+// a container and the one of a VM, without a VM. The command, its env and its
+// working directory are translated to an OCI bundle run by runsc. The
+// credentials of WithCredentialEnv and the secrets passed by fds are not
+// passed into the sandbox. Linux only.
+//
+// Example:
+//
+//	s := &gocmd.Sandbox{Mounts: []gocmd.Mount{{Source: "in", Target: "/in", ReadOnly: true}}, MemoryBytes: 512 << 20}
+//	c := gocmd.New("./convert /in/untrusted.doc", gocmd.WithWorkingDir(work), gocmd.WithSandbox(s))
+type Sandbox struct {
+	// Runsc is the runsc executable, "runsc" if empty.
+	Runsc string
+	// Flags are the global flags of runsc, like "--rootless" or "--platform=systrap".
+	Flags []string
+	// RootFS is the root filesystem of the sandbox, mounted read-only, "/" if empty.
+	RootFS string
+	// Mounts are bind mounts of the sandbox, the working directory of the
+	// command is mounted read-write at the same path.
+	Mounts []Mount
+	// Network keeps the network of the host, the sandbox has none else.
+	Network bool
+	// MemoryBytes, CPUs and Pids, if not zero, limit the memory, the number of
+	// CPUs, like 0.5, and the number of processes of the sandbox.
+	MemoryBytes int64
+	CPUs        float64
+	Pids        int64
+	// Fallback runs the commands without the sandbox if runsc is not found,
+	// Run fails with ErrNotSupported else.
+	Fallback bool
+}
+
+// Mount is a bind mount.
+type Mount struct {
+	Source   string // on the host
+	Target   string // in the sandbox
+	ReadOnly bool
+}
+
+// WithSandbox runs the command in the gVisor sandbox.
+func WithSandbox(s *Sandbox) func(c *Cmd) {
+	return func(c *Cmd) {
+		var bundle, id, runsc string
+		c.beforeStart = append(c.beforeStart, func(cmd *exec.Cmd) error {
+			path, err := exec.LookPath(s.runsc())
+			if err != nil {
+				if s.Fallback {
+					return nil
+				}
+				return fmt.Errorf("sandbox: %w: %v", ErrNotSupported, err)
+			}
+			if bundle, err = os.MkdirTemp("", "gocmd-sandbox-"); err != nil {
+				return err
+			}
+			spec, err := s.Spec(cmd)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(filepath.Join(bundle, "config.json"), spec, 0o600); err != nil {
+				return err
+			}
+			if id, err = sandboxID(); err != nil {
+				return err
+			}
+
+			runsc = path
+			cmd.Path = path
+			cmd.Args = append(append([]string{s.runsc()}, s.Flags...), "run", "--bundle", bundle, id)
+			return nil
+		})
+		c.flushers = append(c.flushers, func() {
+			if bundle == "" {
+				return
+			}
+			// the sandbox is left running if runsc was killed
+			args := append(append([]string(nil), s.Flags...), "delete", "--force", id)
+			_ = exec.Command(runsc, args...).Run()
+			_ = os.RemoveAll(bundle)
+			bundle = ""
+		})
+	}
+}
+
+func (s *Sandbox) runsc() string {
+	if s.Runsc == "" {
+		return "runsc"
+	}
+	return s.Runsc
+}
+
+// Spec returns the OCI runtime spec running the command in the sandbox, the config.json of its bundle.
+func (s *Sandbox) Spec(cmd *exec.Cmd) ([]byte, error) {
+	type mount struct {
+		Destination string   `json:"destination"`
+		Type        string   `json:"type"`
+		Source      string   `json:"source"`
+		Options     []string `json:"options,omitempty"`
+	}
+	bind := func(source, target string, readOnly bool) (mount, error) {
+		source, err := filepath.Abs(source)
+		if err != nil {
+			return mount{}, err
+		}
+		mode := "rw"
+		if readOnly {
+			mode = "ro"
+		}
+		return mount{Destination: target, Type: "bind", Source: source, Options: []string{"rbind", mode}}, nil
+	}
+
+	mounts := []mount{
+		{Destination: "/proc", Type: "proc", Source: "proc"},
+		{Destination: "/dev", Type: "tmpfs", Source: "tmpfs"},
+		{Destination: "/tmp", Type: "tmpfs", Source: "tmpfs"},
+	}
+	cwd := "/"
+	if cmd.Dir != "" {
+		dir, err := filepath.Abs(cmd.Dir)
+		if err != nil {
+			return nil, err
+		}
+		m, err := bind(dir, dir, false)
+		if err != nil {
+			return nil, err
+		}
+		mounts, cwd = append(mounts, m), dir
+	}
+	for _, m := range s.Mounts {
+		b, err := bind(m.Source, m.Target, m.ReadOnly)
+		if err != nil {
+			return nil, err
+		}
+		mounts = append(mounts, b)
+	}
+
+	namespaces := []map[string]string{{"type": "pid"}, {"type": "ipc"}, {"type": "uts"}, {"type": "mount"}}
+	if !s.Network {
+		namespaces = append(namespaces, map[string]string{"type": "network"})
+	}
+	resources := map[string]interface{}{}
+	if s.MemoryBytes > 0 {
+		resources["memory"] = map[string]int64{"limit": s.MemoryBytes}
+	}
+	if s.CPUs > 0 {
+		const period = 100000
+		resources["cpu"] = map[string]int64{"quota": int64(s.CPUs * period), "period": period}
+	}
+	if s.Pids > 0 {
+		resources["pids"] = map[string]int64{"limit": s.Pids}
+	}
+
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	rootFS := s.RootFS
+	if rootFS == "" {
+		rootFS = "/"
+	}
+	args := append([]string{cmd.Path}, cmd.Args[1:]...)
+	return json.MarshalIndent(map[string]interface{}{
+		"ociVersion": "1.0.2",
+		"process": map[string]interface{}{
+			"user":            map[string]int{"uid": os.Getuid(), "gid": os.Getgid()},
+			"args":            args,
+			"env":             env,
+			"cwd":             cwd,
+			"noNewPrivileges": true,
+		},
+		"root":     map[string]interface{}{"path": rootFS, "readonly": true},
+		"hostname": "sandbox",
+		"mounts":   mounts,
+		"linux":    map[string]interface{}{"namespaces": namespaces, "resources": resources},
+	}, "", "  ")
+}
+
+func sandboxID() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "gocmd-" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,69 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithSandbox(t *testing.T) {
+	// a fake runsc printing the spec of the bundle, and logging the deletes
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	fake := filepath.Join(dir, "runsc")
+	script := "#!/bin/sh\ncase \"$1\" in\nrun) cat \"$3/config.json\";;\ndelete) echo \"$@\" > " + log + ";;\nesac\n"
+	assert.Nil(t, os.WriteFile(fake, []byte(script), 0o755))
+
+	s := &gocmd.Sandbox{Runsc: fake, Mounts: []gocmd.Mount{{Source: "/etc", Target: "/in", ReadOnly: true}}, MemoryBytes: 1 << 20}
+	c := gocmd.New("echo hello", gocmd.WithWorkingDir(dir), gocmd.WithEnv(gocmd.EnvVars{"SANDBOXED": "1"}), gocmd.WithSandbox(s))
+	assert.Nil(t, c.Run(context.TODO()))
+
+	var spec struct {
+		Process struct {
+			Args []string
+			Env  []string
+			Cwd  string
+		}
+		Root   struct{ Readonly bool }
+		Mounts []struct {
+			Destination string
+			Options     []string
+		}
+		Linux struct {
+			Namespaces []struct{ Type string }
+			Resources  struct{ Memory struct{ Limit int64 } }
+		}
+	}
+	assert.Nil(t, json.Unmarshal([]byte(c.Stdout()), &spec))
+	assert.Equal(t, "echo hello", spec.Process.Args[len(spec.Process.Args)-1])
+	assert.Contains(t, spec.Process.Env, "SANDBOXED=1")
+	assert.Equal(t, dir, spec.Process.Cwd)
+	assert.True(t, spec.Root.Readonly)
+	assert.Equal(t, "/in", spec.Mounts[len(spec.Mounts)-1].Destination)
+	assert.Equal(t, []string{"rbind", "ro"}, spec.Mounts[len(spec.Mounts)-1].Options)
+	assert.Equal(t, "network", spec.Linux.Namespaces[len(spec.Linux.Namespaces)-1].Type)
+	assert.Equal(t, int64(1<<20), spec.Linux.Resources.Memory.Limit)
+
+	deleted, err := os.ReadFile(log)
+	assert.Nil(t, err)
+	assert.Regexp(t, `^delete --force gocmd-[0-9a-f]{12}\n$`, string(deleted))
+}
+
+func TestWithSandboxFallback(t *testing.T) {
+	s := &gocmd.Sandbox{Runsc: "no-such-runsc"}
+	c := gocmd.New("echo hello", gocmd.WithSandbox(s))
+	assert.True(t, errors.Is(c.Run(context.TODO()), gocmd.ErrNotSupported))
+
+	s.Fallback = true
+	c = gocmd.New("echo hello", gocmd.WithSandbox(s))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, "hello\n", c.Stdout())
+}
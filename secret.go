@@ -0,0 +1,66 @@
+package gocmd
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// WithSecretFD passes the secret data to the command over a pipe it inherits,
+// whose file descriptor is exported as the env var name_FD, like TOKEN_FD=3,
+// so that secrets do not show in its command line or environment, which other
+// users and crash reports may see. The pipe is written again for every attempt.
+//
+// Example:
+//
+//	c := gocmd.New(`curl -H @- https://example.com <&"$AUTH_FD"`,
+//		gocmd.WithSecretFD("AUTH", []byte("Authorization: Bearer "+token)))
+func WithSecretFD(name string, data []byte) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.secrets = append(c.secrets, secretFD{name: name, data: data})
+	}
+}
+
+type secretFD struct {
+	name string
+	data []byte
+}
+
+// passSecrets adds a pipe per secret to the extra files of cmd, and its fd to
+// its env, writing the secrets in the background. The returned func closes the
+// read ends of the parent, once the command started or failed to.
+func passSecrets(cmd *exec.Cmd, secrets []secretFD) (closeReaders func(), err error) {
+	var readers []*os.File
+	closeReaders = func() {
+		for _, r := range readers {
+			_ = r.Close()
+		}
+	}
+	if len(secrets) == 0 {
+		return closeReaders, nil
+	}
+
+	files := cmd.ExtraFiles[:len(cmd.ExtraFiles):len(cmd.ExtraFiles)]
+	env := cmd.Env[:len(cmd.Env):len(cmd.Env)]
+	for _, s := range secrets {
+		r, w, err := os.Pipe()
+		if err != nil {
+			closeReaders()
+			return nil, err
+		}
+		readers = append(readers, r)
+
+		// fds 0, 1 and 2 are stdin, stdout and stderr, the extra files follow
+		env = append(env, s.name+"_FD="+strconv.Itoa(3+len(files)))
+		files = append(files, r)
+
+		go func(w *os.File, data []byte) {
+			// fails with EPIPE if the command exits without reading it
+			_, _ = w.Write(data)
+			_ = w.Close()
+		}(w, s.data)
+	}
+
+	cmd.ExtraFiles, cmd.Env = files, env
+	return closeReaders, nil
+}
@@ -0,0 +1,28 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithSecretFD(t *testing.T) {
+	c := gocmd.New(`echo $A_FD $B_FD; cat <&"$A_FD"; echo; cat <&"$B_FD"; echo; env | grep -c s3cret; exit 1`,
+		gocmd.WithSecretFD("A", []byte("s3cret-a")),
+		gocmd.WithSecretFD("B", []byte("s3cret-b")),
+		gocmd.WithRetry(gocmd.RetryPolicy{Retries: 1}))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, 2, c.Status().Attempts)
+	assert.Equal(t, "3 4\ns3cret-a\ns3cret-b\n0\n", c.Stdout())
+}
+
+func TestWithSecretFDUnread(t *testing.T) {
+	c := gocmd.New("true", gocmd.WithSecretFD("BIG", []byte(strings.Repeat("x", 1<<20))))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, 0, c.ExitCode())
+}
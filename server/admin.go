@@ -0,0 +1,122 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+)
+
+// recentFailures is the number of the last failed jobs of Debug.
+const recentFailures = 10
+
+// Debug is the runtime introspection of a server, answered by GET /debug.
+type Debug struct {
+	Started    time.Time `json:"started"`
+	Uptime     string    `json:"uptime"`
+	Goroutines int       `json:"goroutines"`
+	// Parallel is the maximum number of jobs running at the same time.
+	Parallel int         `json:"parallel"`
+	Running  []JobStatus `json:"running"`
+	// Queued is the number of jobs waiting for a slot.
+	Queued int `json:"queued"`
+	// Limiter is the state of the keys of the Limiter, if any.
+	Limiter map[string]gocmd.LimiterKeyState `json:"limiter,omitempty"`
+	// RecentFailures are the last failed jobs, the last finished first.
+	RecentFailures []JobStatus      `json:"recent_failures"`
+	Store          StoreStats       `json:"store"`
+	Schedules      []ScheduleStatus `json:"schedules"`
+}
+
+// WithMaxQueued makes the server not ready while more than n jobs are queued.
+func WithMaxQueued(n int) func(*Server) {
+	return func(s *Server) {
+		s.MaxQueued = n
+	}
+}
+
+// Ready returns why the server is not ready to take more jobs, nil if it is,
+// answered by GET /readyz.
+func (s *Server) Ready() error {
+	s.mu.RLock()
+	maxQueued := s.MaxQueued
+	s.mu.RUnlock()
+
+	if maxQueued > 0 {
+		if queued := s.queued(); queued > maxQueued {
+			return fmt.Errorf("%d jobs queued, more than %d", queued, maxQueued)
+		}
+	}
+	return nil
+}
+
+func (s *Server) queued() int {
+	n := 0
+	for _, j := range s.store.List() {
+		if j.State == Queued {
+			n++
+		}
+	}
+	return n
+}
+
+// Debug returns the runtime introspection of the server.
+func (s *Server) Debug() Debug {
+	s.mu.RLock()
+	limiter := s.Limiter
+	s.mu.RUnlock()
+
+	d := Debug{
+		Started:        s.started,
+		Uptime:         time.Since(s.started).Round(time.Second).String(),
+		Goroutines:     runtime.NumGoroutine(),
+		Parallel:       cap(s.sem),
+		Running:        []JobStatus{},
+		RecentFailures: []JobStatus{},
+		Store:          s.store.Stats(),
+		Schedules:      s.scheduleStatuses(),
+	}
+	for _, j := range s.store.List() {
+		switch j.State {
+		case Running:
+			d.Running = append(d.Running, j)
+		case Queued:
+			d.Queued++
+		case Failed:
+			d.RecentFailures = append(d.RecentFailures, j)
+		}
+	}
+	sort.SliceStable(d.RecentFailures, func(i, k int) bool {
+		return d.RecentFailures[i].Finished.After(*d.RecentFailures[k].Finished)
+	})
+	if len(d.RecentFailures) > recentFailures {
+		d.RecentFailures = d.RecentFailures[:recentFailures]
+	}
+	if limiter != nil {
+		d.Limiter = limiter.Snapshot()
+	}
+	return d
+}
+
+// serveAdmin answers the probes, which need no token, and tells if it did.
+func (s *Server) serveAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	switch r.URL.Path {
+	case "/healthz":
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	case "/readyz":
+		if err := s.Ready(); err != nil {
+			httpError(w, http.StatusServiceUnavailable, err)
+			return true
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+	default:
+		return false
+	}
+	return true
+}
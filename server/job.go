@@ -0,0 +1,352 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+)
+
+// State is the state of a job.
+type State string
+
+const (
+	Queued    State = "queued"
+	Running   State = "running"
+	Succeeded State = "succeeded"
+	Failed    State = "failed"
+	Canceled  State = "canceled"
+)
+
+// Done tells if the state is a final one.
+func (s State) Done() bool {
+	return s == Succeeded || s == Failed || s == Canceled
+}
+
+// JobRequest is the body of a job submission, its fields are the ones of
+// gocmd.Spec, the ones safe to accept from remote clients, and Preset.
+// Command is run by the shell, Args are executed directly if Command is empty.
+type JobRequest struct {
+	Command string `json:"command,omitempty" yaml:"command,omitempty"`
+	// Preset is the name of a preset of the server, run with the args, see Preset.
+	Preset  string            `json:"preset,omitempty" yaml:"preset,omitempty"`
+	Args    []string          `json:"args,omitempty" yaml:"args,omitempty"`
+	Timeout string            `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Workdir string            `json:"workdir,omitempty" yaml:"workdir,omitempty"`
+	Env     map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// JobStatus is a snapshot of a job.
+type JobStatus struct {
+	ID       string       `json:"id"`
+	Command  string       `json:"command,omitempty"`
+	Args     []string     `json:"args,omitempty"`
+	Labels   gocmd.Labels `json:"labels,omitempty"`
+	State    State        `json:"state"`
+	ExitCode int          `json:"exit_code"`
+	Error    string       `json:"error,omitempty"`
+	Created  time.Time    `json:"created"`
+	Started  *time.Time   `json:"started,omitempty"`
+	Finished *time.Time   `json:"finished,omitempty"`
+	// LogRef is the reference of the uploaded output, like s3://bucket/key.
+	LogRef string `json:"log_ref,omitempty"`
+}
+
+// Job is a command submitted to the server.
+type Job struct {
+	ID string
+
+	cmd     *gocmd.Cmd
+	log     *logBuffer
+	object  *gocmd.S3Sink // the output is uploaded to, if not nil
+	release func()        // of the Limiter of the server, once done
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	mu     sync.Mutex
+	status JobStatus
+}
+
+func newJob(id string, req JobRequest, cmd *gocmd.Cmd, log *logBuffer) *Job {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Job{
+		ID:     id,
+		cmd:    cmd,
+		log:    log,
+		ctx:    ctx,
+		cancel: cancel,
+		status: JobStatus{
+			ID:      id,
+			Command: req.Command,
+			Args:    req.Args,
+			Labels:  cmd.Labels(),
+			State:   Queued,
+			Created: time.Now(),
+		},
+	}
+}
+
+// Status returns a snapshot of the job.
+func (j *Job) Status() JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.status
+}
+
+// Cancel cancels the job, killing its command if it is running.
+func (j *Job) Cancel() {
+	j.cancel()
+}
+
+// run runs the job after acquiring a slot of sem.
+func (j *Job) run(sem chan struct{}) {
+	defer j.log.close()
+	defer j.release()
+
+	select {
+	case sem <- struct{}{}:
+		defer func() { <-sem }()
+	case <-j.ctx.Done():
+		j.finish(Canceled, -1, j.ctx.Err())
+		return
+	}
+
+	now := time.Now()
+	j.mu.Lock()
+	j.status.State = Running
+	j.status.Started = &now
+	j.mu.Unlock()
+
+	err := j.cmd.Run(j.ctx)
+	switch {
+	case j.ctx.Err() != nil:
+		j.finish(Canceled, -1, j.ctx.Err())
+	case err != nil:
+		j.finish(Failed, -1, err)
+	case j.cmd.ExitCode() != 0:
+		j.finish(Failed, j.cmd.ExitCode(), nil)
+	default:
+		j.finish(Succeeded, 0, nil)
+	}
+}
+
+func (j *Job) finish(state State, exitCode int, err error) {
+	now := time.Now()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.status.State = state
+	j.status.ExitCode = exitCode
+	j.status.Finished = &now
+	if err != nil {
+		j.status.Error = err.Error()
+	}
+	if j.object != nil && j.cmd.Executed && j.object.Err() == nil {
+		j.status.LogRef = j.object.Ref()
+	}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Store keeps the jobs of a server in memory.
+type Store struct {
+	mu    sync.Mutex
+	jobs  map[string]*Job
+	stats StoreStats // of the cleanups
+}
+
+// NewStore creates an empty Store.
+func NewStore() *Store {
+	return &Store{jobs: map[string]*Job{}}
+}
+
+// Add adds a job.
+func (s *Store) Add(j *Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[j.ID] = j
+}
+
+// Get returns the job of the id, or nil if there is none.
+func (s *Store) Get(id string) *Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.jobs[id]
+}
+
+// List returns the statuses of all jobs, oldest first.
+func (s *Store) List() []JobStatus {
+	return s.Select(nil)
+}
+
+// Select returns the statuses of the jobs having all the labels, oldest first.
+func (s *Store) Select(labels map[string]string) []JobStatus {
+	s.mu.Lock()
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobs = append(jobs, j)
+	}
+	s.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(jobs))
+	for _, j := range jobs {
+		if st := j.Status(); hasLabels(st.Labels, labels) {
+			statuses = append(statuses, st)
+		}
+	}
+	sort.Slice(statuses, func(i, k int) bool { return statuses[i].Created.Before(statuses[k].Created) })
+	return statuses
+}
+
+func hasLabels(have, want map[string]string) bool {
+	for k, v := range want {
+		if have[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// lineIndexEvery is the number of lines between the offsets of the line
+// index of a logBuffer.
+const lineIndexEvery = 1024
+
+// logBuffer is the combined output of a job, which can be read while it is
+// written. It indexes the offsets of every lineIndexEvery lines, so that the
+// lines of a range, like the last ones, are found without scanning the
+// whole output.
+type logBuffer struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	buf    bytes.Buffer
+	closed bool
+	lines  int   // complete lines
+	index  []int // offsets of the lines 0, lineIndexEvery, 2*lineIndexEvery...
+}
+
+func newLogBuffer() *logBuffer {
+	l := &logBuffer{index: []int{0}}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+func (l *logBuffer) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	base := l.buf.Len()
+	for i, b := range p {
+		if b != '\n' {
+			continue
+		}
+		if l.lines++; l.lines%lineIndexEvery == 0 {
+			l.index = append(l.index, base+i+1)
+		}
+	}
+	n, err := l.buf.Write(p)
+	l.cond.Broadcast()
+	return n, err
+}
+
+func (l *logBuffer) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closed = true
+	l.cond.Broadcast()
+}
+
+// readFrom returns the bytes after offset, blocking until there are some or ctx is done.
+// It returns done true if the log is closed and everything was read.
+func (l *logBuffer) readFrom(ctx context.Context, offset int) (p []byte, done bool) {
+	// wakes the wait below once ctx is done, like for a follower which went away
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.mu.Lock()
+			l.cond.Broadcast()
+			l.mu.Unlock()
+		case <-stop:
+		}
+	}()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for offset >= l.buf.Len() && !l.closed && ctx.Err() == nil {
+		l.cond.Wait()
+	}
+
+	if offset < l.buf.Len() {
+		p = append(p, l.buf.Bytes()[offset:]...)
+	}
+	return p, l.closed && offset+len(p) >= l.buf.Len()
+}
+
+// size returns the number of bytes of the log.
+func (l *logBuffer) size() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.buf.Len()
+}
+
+// totalLines returns the number of lines, including an unterminated last one.
+func (l *logBuffer) totalLines() int {
+	if data := l.buf.Bytes(); len(data) > 0 && data[len(data)-1] != '\n' {
+		return l.lines + 1
+	}
+	return l.lines
+}
+
+// offsetOf returns the offset of the start of the line n, the end of the
+// output past the complete lines, by scanning from the indexed line before it.
+func (l *logBuffer) offsetOf(n int) int {
+	if n > l.lines {
+		return l.buf.Len()
+	}
+	offset := l.index[n/lineIndexEvery]
+	data := l.buf.Bytes()
+	for skip := n % lineIndexEvery; skip > 0; skip-- {
+		offset += bytes.IndexByte(data[offset:], '\n') + 1
+	}
+	return offset
+}
+
+// readLines returns the limit lines from the line from, counted from the
+// end if negative, all the ones after it if limit < 0, their offset, and the
+// number of lines.
+func (l *logBuffer) readLines(from, limit int) (p []byte, offset, total int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	total = l.totalLines()
+	if from < 0 {
+		from += total
+	}
+	if from < 0 {
+		from = 0
+	} else if from > total {
+		from = total
+	}
+	offset, end := l.offsetOf(from), l.buf.Len()
+	if limit >= 0 && from+limit < total {
+		end = l.offsetOf(from + limit)
+	}
+	return append(p, l.buf.Bytes()[offset:end]...), offset, total
+}
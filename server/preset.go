@@ -0,0 +1,103 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/bingoohuang/gocmd"
+)
+
+// Preset is a job configured by the operators, submitted by its name, like
+// {"preset": "backup", "args": ["db1"]}. The args of the request are
+// appended to its command, shell quoted.
+type Preset struct {
+	Command string `json:"command" yaml:"command"`
+	// Timeout, like 1h, is the one of the server if empty, unless the request has one.
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// Labels are added to the ones of the request.
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// ErrUnknownPreset is returned by Submit for a preset the server does not have.
+var ErrUnknownPreset = errors.New("unknown preset")
+
+// WithPresets sets the presets jobs may be submitted by, by name.
+func WithPresets(presets map[string]Preset) func(*Server) {
+	return func(s *Server) {
+		s.Presets = presets
+	}
+}
+
+// expandPreset returns the request of the preset of req, if any.
+func (s *Server) expandPreset(req JobRequest) (JobRequest, error) {
+	if req.Preset == "" {
+		return req, nil
+	}
+	p, ok := s.Presets[req.Preset]
+	if !ok {
+		return req, fmt.Errorf("%w: %s", ErrUnknownPreset, req.Preset)
+	}
+	if req.Command != "" {
+		return req, errors.New("command and preset are exclusive")
+	}
+
+	req.Command = p.Command
+	if len(req.Args) > 0 {
+		args, err := gocmd.Quote(req.Args...)
+		if err != nil {
+			return req, fmt.Errorf("quote args: %w", err)
+		}
+		req.Command += " " + args
+	}
+	req.Args = nil
+	if req.Timeout == "" {
+		req.Timeout = p.Timeout
+	}
+	if len(p.Labels) > 0 {
+		labels := make(map[string]string, len(p.Labels)+len(req.Labels))
+		for k, v := range p.Labels {
+			labels[k] = v
+		}
+		for k, v := range req.Labels {
+			labels[k] = v
+		}
+		req.Labels = labels
+	}
+	return req, nil
+}
+
+// diffPresets returns the presets added, changed and removed, like "preset backup added".
+func diffPresets(old, cur map[string]Preset) []string {
+	var changes []string
+	for _, name := range sortedKeys(old, cur) {
+		o, wasSet := old[name]
+		n, isSet := cur[name]
+		switch {
+		case !wasSet:
+			changes = append(changes, "preset "+name+" added")
+		case !isSet:
+			changes = append(changes, "preset "+name+" removed")
+		case !reflect.DeepEqual(o, n):
+			changes = append(changes, "preset "+name+" changed")
+		}
+	}
+	return changes
+}
+
+// sortedKeys returns the keys of the maps, sorted.
+func sortedKeys(maps ...map[string]Preset) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, m := range maps {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
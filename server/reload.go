@@ -0,0 +1,94 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Reload applies the options to the server while it serves, like on SIGHUP,
+// and returns the settings they changed, like "timeout: 1m0s -> 5m0s" or
+// "schedule backup added". The queued and running jobs keep the settings they
+// were submitted with, the new ones apply to the next submissions. Only the
+// added, changed and removed schedules are started and stopped. Options
+// starting something, like WithRetention, are not meant to be reloaded.
+//
+// Example:
+//
+//	for _, change := range s.Reload(server.WithAllow("git", "kubectl"), server.WithToken(token)) {
+//		log.Printf("reloaded %s", change)
+//	}
+func (s *Server) Reload(options ...func(*Server)) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, oldPresets := s.settings(), s.Presets
+	for _, o := range options {
+		o(s)
+	}
+	changes := diffSettings(old, s.settings())
+	changes = append(changes, diffPresets(oldPresets, s.Presets)...)
+	return append(changes, s.applySchedules()...)
+}
+
+// setting is a reloadable setting of a server, with its value as shown by Reload.
+type setting struct {
+	name  string
+	value interface{}
+	shown string
+}
+
+func (s *Server) settings() []setting {
+	return []setting{
+		{name: "allow", value: s.Allow, shown: fmt.Sprint(s.Allow)},
+		{name: "allow env", value: s.AllowEnv, shown: fmt.Sprint(s.AllowEnv)},
+		// the token is never shown
+		{name: "token", value: s.Token, shown: "***"},
+		{name: "timeout", value: s.Timeout, shown: s.Timeout.String()},
+		{name: "log url", value: s.LogURL, shown: s.LogURL},
+		{name: "limiter", value: s.Limiter, shown: shownPointer(s.Limiter != nil)},
+		{name: "meter", value: s.Meter, shown: shownPointer(s.Meter != nil)},
+		{name: "policy", value: s.Policy, shown: shownPointer(s.Policy != nil)},
+		{name: "max queued", value: s.MaxQueued, shown: fmt.Sprint(s.MaxQueued)},
+	}
+}
+
+func shownPointer(set bool) string {
+	if set {
+		return "set"
+	}
+	return "none"
+}
+
+// diffSettings returns the changes between the old and new settings.
+func diffSettings(old, cur []setting) []string {
+	var changes []string
+	for i, o := range old {
+		n := cur[i]
+		if sameValue(o.value, n.value) {
+			continue
+		}
+		if o.shown == n.shown {
+			changes = append(changes, o.name+" changed")
+		} else {
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", o.name, quoteEmpty(o.shown), quoteEmpty(n.shown)))
+		}
+	}
+	return changes
+}
+
+// sameValue tells if the values are deeply equal, funcs if they are the same func.
+func sameValue(a, b interface{}) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Kind() == reflect.Func && vb.Kind() == reflect.Func {
+		return va.Pointer() == vb.Pointer()
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func quoteEmpty(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return `""`
+	}
+	return s
+}
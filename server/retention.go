@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// Retention is the retention policy of the finished jobs of a Store, and of
+// their logs, so that long-running agents do not run out of memory. Queued
+// and running jobs are never deleted.
+type Retention struct {
+	// MaxAge, if not zero, deletes the jobs finished for longer.
+	MaxAge time.Duration
+	// MaxBytes, if not zero, deletes the oldest finished jobs while the logs
+	// of all jobs take more.
+	MaxBytes int64
+	// MaxPerLabel keeps at most a number of finished jobs per value of the
+	// label keys, the newest ones, like {"tenant": 100}. Jobs without the
+	// label share the empty value.
+	MaxPerLabel map[string]int
+}
+
+// StoreStats are the metrics of a Store and of its cleanups.
+type StoreStats struct {
+	Jobs     int   `json:"jobs"`
+	LogBytes int64 `json:"log_bytes"`
+	// Deleted and DeletedBytes are the jobs deleted by Clean so far, and the bytes of their logs.
+	Deleted      int64 `json:"deleted"`
+	DeletedBytes int64 `json:"deleted_bytes"`
+	// Cleaned is when Clean last ran.
+	Cleaned time.Time `json:"cleaned,omitempty"`
+}
+
+// WithRetention cleans the job store by the retention policy every interval,
+// 1m if zero, until the server is closed.
+func WithRetention(r Retention, every time.Duration) func(*Server) {
+	return func(s *Server) {
+		if every <= 0 {
+			every = time.Minute
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.store.Janitor(s.ctx, r, every)
+		}()
+	}
+}
+
+// Janitor cleans the store by the retention policy every interval, until ctx is done.
+func (s *Store) Janitor(ctx context.Context, r Retention, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			s.Clean(r)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stats returns the metrics of the store.
+func (s *Store) Stats() StoreStats {
+	s.mu.Lock()
+	stats := s.stats
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobs = append(jobs, j)
+	}
+	s.mu.Unlock()
+
+	stats.Jobs = len(jobs)
+	for _, j := range jobs {
+		stats.LogBytes += int64(j.log.size())
+	}
+	return stats
+}
+
+// Clean deletes the finished jobs exceeding the retention policy, and returns their number.
+func (s *Store) Clean(r Retention) int {
+	now := time.Now()
+	type entry struct {
+		job      *Job
+		finished time.Time
+		labels   map[string]string
+		size     int64
+	}
+	s.mu.Lock()
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobs = append(jobs, j)
+	}
+	s.mu.Unlock()
+
+	var total int64
+	var finished []entry
+	for _, j := range jobs {
+		size := int64(j.log.size())
+		total += size
+		if st := j.Status(); st.State.Done() && st.Finished != nil {
+			finished = append(finished, entry{job: j, finished: *st.Finished, labels: st.Labels, size: size})
+		}
+	}
+	// newest first
+	sort.Slice(finished, func(i, k int) bool { return finished[i].finished.After(finished[k].finished) })
+
+	deleted := map[*Job]bool{}
+	for _, e := range finished {
+		if r.MaxAge > 0 && now.Sub(e.finished) > r.MaxAge {
+			deleted[e.job] = true
+		}
+	}
+	for key, limit := range r.MaxPerLabel {
+		counts := map[string]int{}
+		for _, e := range finished {
+			if deleted[e.job] {
+				continue
+			}
+			if v := e.labels[key]; counts[v] < limit {
+				counts[v]++
+			} else {
+				deleted[e.job] = true
+			}
+		}
+	}
+	for _, e := range finished {
+		if deleted[e.job] {
+			total -= e.size
+		}
+	}
+	for i := len(finished) - 1; i >= 0 && r.MaxBytes > 0 && total > r.MaxBytes; i-- {
+		if e := finished[i]; !deleted[e.job] {
+			deleted[e.job] = true
+			total -= e.size
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range finished {
+		if deleted[e.job] {
+			delete(s.jobs, e.job.ID)
+			s.stats.Deleted++
+			s.stats.DeletedBytes += e.size
+		}
+	}
+	s.stats.Cleaned = now
+	return len(deleted)
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/gocmd/cron"
+)
+
+// Schedule submits a job on a cron schedule, labeled schedule=Name, like
+//
+//	server.Schedule{Name: "backup", Spec: "@daily", Job: server.JobRequest{Preset: "backup"}}
+//
+// A job is submitted even if the one of the previous run is still running.
+type Schedule struct {
+	Name string `json:"name" yaml:"name"`
+	// Spec is the schedule, like "*/5 * * * *", @hourly or "@every 10m", see cron.Parse.
+	Spec string     `json:"spec" yaml:"spec"`
+	Job  JobRequest `json:"job" yaml:"job"`
+}
+
+// ScheduleStatus is the state of a Schedule, shown by GET /debug.
+type ScheduleStatus struct {
+	Name string    `json:"name"`
+	Spec string    `json:"spec"`
+	Next time.Time `json:"next,omitempty"`
+	// LastJob is the id of the last job submitted.
+	LastJob string `json:"last_job,omitempty"`
+	// Error is why the schedule is not running, or the last job could not be submitted.
+	Error string `json:"error,omitempty"`
+}
+
+// WithSchedules sets the jobs submitted on cron schedules. On Reload, only the
+// added, changed and removed schedules are started and stopped, and the jobs
+// they submitted keep running.
+func WithSchedules(schedules ...Schedule) func(*Server) {
+	return func(s *Server) {
+		s.Schedules = schedules
+	}
+}
+
+// scheduled is a running Schedule.
+type scheduled struct {
+	schedule Schedule
+	stop     context.CancelFunc
+
+	mu     sync.Mutex
+	status ScheduleStatus
+}
+
+// applySchedules starts and stops the schedules as Schedules changed, and
+// returns the changes, like "schedule backup added". s.mu must be held.
+func (s *Server) applySchedules() []string {
+	want := map[string]Schedule{}
+	for _, sc := range s.Schedules {
+		want[sc.Name] = sc
+	}
+
+	var names []string
+	for name := range want {
+		names = append(names, name)
+	}
+	for name := range s.scheduled {
+		if _, ok := want[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var changes []string
+	for _, name := range names {
+		sc, wanted := want[name]
+		old, running := s.scheduled[name]
+		switch {
+		case running && wanted && reflect.DeepEqual(old.schedule, sc):
+			continue
+		case running && wanted:
+			changes = append(changes, "schedule "+name+" changed")
+		case running:
+			changes = append(changes, "schedule "+name+" removed")
+		default:
+			changes = append(changes, "schedule "+name+" added")
+		}
+		if running {
+			old.stop()
+			delete(s.scheduled, name)
+		}
+		if wanted {
+			s.startSchedule(sc)
+		}
+	}
+	return changes
+}
+
+func (s *Server) startSchedule(sc Schedule) {
+	ctx, stop := context.WithCancel(s.ctx)
+	r := &scheduled{schedule: sc, stop: stop, status: ScheduleStatus{Name: sc.Name, Spec: sc.Spec}}
+	if s.scheduled == nil {
+		s.scheduled = map[string]*scheduled{}
+	}
+	s.scheduled[sc.Name] = r
+
+	spec, err := cron.Parse(sc.Spec)
+	if err != nil {
+		r.status.Error = err.Error()
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		r.run(ctx, s, spec)
+	}()
+}
+
+// run submits the job of the schedule at its times, until ctx is done.
+func (r *scheduled) run(ctx context.Context, s *Server, spec cron.Schedule) {
+	for {
+		next := spec.Next(time.Now())
+		r.mu.Lock()
+		r.status.Next = next
+		r.mu.Unlock()
+		if next.IsZero() {
+			return
+		}
+
+		t := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+
+		req := r.schedule.Job
+		req.Labels = map[string]string{"schedule": r.schedule.Name}
+		for k, v := range r.schedule.Job.Labels {
+			req.Labels[k] = v
+		}
+		j, err := s.Submit(req)
+		r.mu.Lock()
+		if err != nil {
+			r.status.Error = err.Error()
+		} else {
+			r.status.LastJob, r.status.Error = j.ID, ""
+		}
+		r.mu.Unlock()
+	}
+}
+
+// scheduleStatuses returns the states of the schedules, sorted by name.
+func (s *Server) scheduleStatuses() []ScheduleStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	statuses := []ScheduleStatus{}
+	for _, r := range s.scheduled {
+		r.mu.Lock()
+		statuses = append(statuses, r.status)
+		r.mu.Unlock()
+	}
+	sort.Slice(statuses, func(i, k int) bool { return statuses[i].Name < statuses[k].Name })
+	return statuses
+}
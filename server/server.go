@@ -0,0 +1,462 @@
+// Package server exposes gocmd over an HTTP job API, so that a host can act as
+// a minimal command agent:
+//
+//	POST   /jobs              submit a JobRequest, returns the JobStatus
+//	GET    /jobs              list the jobs, ?label=key=value filters them by labels
+//	GET    /jobs/{id}         status of a job
+//	GET    /jobs/{id}/logs    combined output of a job, ?follow=1 streams it until the job is done,
+//	                          ?tail=500 starts at the last lines, ?offset=1000&limit=500 pages by lines,
+//	                          the X-Total-Lines header tells the number of lines
+//	DELETE /jobs/{id}         cancel a job
+//	GET    /stats             StoreStats of the jobs and their logs, and of the cleanups by WithRetention
+//	GET    /debug             Debug of the running jobs, queue depth, limiter state and recent failures
+//	GET    /healthz           liveness probe, without token
+//	GET    /readyz            readiness probe, without token, 503 while more than MaxQueued jobs are queued
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/bingoohuang/gocmd/shellquote"
+)
+
+// Server runs jobs submitted over HTTP.
+type Server struct {
+	// Allow are the executables jobs may run, any if empty, matched exactly,
+	// so that allowing git does not allow /tmp/evil/git.
+	// With an allow list, commands are split into words and executed without a
+	// shell, so that no shell syntax can smuggle in other executables.
+	Allow []string
+	// AllowEnv are the env vars the jobs may set with an allow list, none if
+	// empty, so that no PATH or LD_PRELOAD can smuggle in other executables.
+	AllowEnv []string
+	// Token, if not empty, is required as the bearer token of every request.
+	Token string
+	// Timeout is the timeout of jobs not specifying one, gocmd.DefaultTimeout if zero.
+	Timeout time.Duration
+	// LogURL, if not empty, is the endpoint the output lines of jobs are posted
+	// to by a gocmd.HTTPSink, labeled by the job id and the labels of the job.
+	LogURL string
+	// LogObject, if not nil, returns the sink the combined output of a job is
+	// uploaded to, whose Ref is kept as the LogRef of the job once uploaded.
+	LogObject func(jobID string) *gocmd.S3Sink
+	// Limiter, if not nil, limits the jobs per value of its label, like
+	// tenant, counting the queued ones as running. Submissions exceeding it
+	// are answered by 429 Too Many Requests with a Retry-After.
+	Limiter *gocmd.Limiter
+	// Meter, if not nil, accounts the usage of the jobs per value of its
+	// label. Submissions of keys over their quota are answered by 429 Too
+	// Many Requests.
+	Meter *gocmd.Meter
+	// Policy, if not nil, is evaluated on the command of every job when it is
+	// run, which denies or mutates it, see gocmd.WithPolicy.
+	Policy gocmd.Policy
+	// MaxQueued, if not zero, makes the server not ready, GET /readyz answering
+	// 503, while more jobs are queued, so that orchestrators route the
+	// submissions to other agents.
+	MaxQueued int
+	// Presets are the jobs which can be submitted by name, see Preset.
+	Presets map[string]Preset
+	// Schedules are the jobs submitted on cron schedules, see Schedule.
+	Schedules []Schedule
+
+	// mu guards the settings above against Reload
+	mu        sync.RWMutex
+	scheduled map[string]*scheduled // the running Schedules, by name
+	store     *Store
+	sem       chan struct{}
+	started   time.Time
+
+	// ctx is canceled by Close, which waits for the background goroutines of wg
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates a server running at most parallel jobs at the same time, 1 if less.
+func New(parallel int, options ...func(*Server)) *Server {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	s := &Server{
+		Timeout: gocmd.DefaultTimeout,
+		store:   NewStore(),
+		sem:     make(chan struct{}, parallel),
+		started: time.Now(),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	for _, o := range options {
+		o(s)
+	}
+	s.applySchedules()
+	return s
+}
+
+// Close stops the background work of the server, like the janitor of
+// WithRetention and the schedules, and waits for it. The jobs are not canceled.
+func (s *Server) Close() error {
+	s.cancel()
+	s.wg.Wait()
+	return nil
+}
+
+// WithAllow sets the executables jobs may run.
+func WithAllow(executables ...string) func(*Server) {
+	return func(s *Server) {
+		s.Allow = executables
+	}
+}
+
+// WithAllowEnv sets the env vars the jobs may set with an allow list.
+func WithAllowEnv(keys ...string) func(*Server) {
+	return func(s *Server) {
+		s.AllowEnv = keys
+	}
+}
+
+// WithToken sets the bearer token required by every request.
+func WithToken(token string) func(*Server) {
+	return func(s *Server) {
+		s.Token = token
+	}
+}
+
+// WithTimeout sets the timeout of jobs not specifying one.
+func WithTimeout(timeout time.Duration) func(*Server) {
+	return func(s *Server) {
+		s.Timeout = timeout
+	}
+}
+
+// WithLogURL sets the endpoint the output lines of jobs are posted to.
+func WithLogURL(url string) func(*Server) {
+	return func(s *Server) {
+		s.LogURL = url
+	}
+}
+
+// WithLogObject sets the sink the combined output of a job is uploaded to.
+func WithLogObject(f func(jobID string) *gocmd.S3Sink) func(*Server) {
+	return func(s *Server) {
+		s.LogObject = f
+	}
+}
+
+// WithLimiter sets the limiter of the jobs.
+func WithLimiter(l *gocmd.Limiter) func(*Server) {
+	return func(s *Server) {
+		s.Limiter = l
+	}
+}
+
+// WithMeter sets the meter of the jobs.
+func WithMeter(m *gocmd.Meter) func(*Server) {
+	return func(s *Server) {
+		s.Meter = m
+	}
+}
+
+// WithPolicy sets the policy evaluated on the commands of the jobs.
+func WithPolicy(p gocmd.Policy) func(*Server) {
+	return func(s *Server) {
+		s.Policy = p
+	}
+}
+
+// Store returns the job store of the server.
+func (s *Server) Store() *Store { return s.store }
+
+// ErrNotAllowed is returned by Submit if the executable of a job, or an env var it sets, is not allowed.
+var ErrNotAllowed = errors.New("executable not allowed")
+
+// Submit creates a job for the request and starts running it as soon as a slot is free.
+func (s *Server) Submit(req JobRequest) (*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	req, err := s.expandPreset(req)
+	if err != nil {
+		return nil, err
+	}
+	argv := req.Args
+	if len(s.Allow) > 0 && req.Command != "" {
+		if argv, err = shellquote.Split(req.Command); err != nil {
+			return nil, fmt.Errorf("split command: %w", err)
+		}
+	}
+	if req.Command == "" && len(argv) == 0 {
+		return nil, errors.New("command or args required")
+	}
+	if len(s.Allow) > 0 && !s.allowed(argv[0]) {
+		return nil, fmt.Errorf("%w: %s", ErrNotAllowed, argv[0])
+	}
+	if len(s.Allow) > 0 {
+		for k := range req.Env {
+			if !s.allowedEnv(k) {
+				return nil, fmt.Errorf("%w: env %s", ErrNotAllowed, k)
+			}
+		}
+	}
+
+	// the fields of the request are the ones of the Spec schema
+	spec := gocmd.Spec{
+		Command: req.Command,
+		Args:    argv,
+		Timeout: req.Timeout,
+		Workdir: req.Workdir,
+		Env:     req.Env,
+		Labels:  req.Labels,
+	}
+	if len(argv) > 0 {
+		spec.Command = ""
+	}
+	specOptions, err := spec.Options()
+	if err != nil {
+		return nil, err
+	}
+	if s.Meter != nil {
+		if err := s.Meter.Allow(req.Labels[s.Meter.Label]); err != nil {
+			return nil, err
+		}
+		specOptions = append(specOptions, gocmd.WithMeter(s.Meter))
+	}
+	if s.Policy != nil {
+		specOptions = append(specOptions, gocmd.WithPolicy(s.Policy))
+	}
+	release := func() {}
+	if s.Limiter != nil {
+		if release, err = s.Limiter.Acquire(req.Labels[s.Limiter.Label]); err != nil {
+			return nil, err
+		}
+	}
+
+	id, log := newID(), newLogBuffer()
+	options := append([]func(*gocmd.Cmd){
+		gocmd.WithTimeout(s.Timeout),
+		gocmd.WithStdout(log),
+		gocmd.WithStderr(log),
+	}, specOptions...)
+	if s.LogURL != "" {
+		labels := map[string]string{"job": id}
+		for k, v := range req.Labels {
+			labels[k] = v
+		}
+		sink := gocmd.NewHTTPSink(s.LogURL, gocmd.HTTPLabels(labels))
+		options = append(options, gocmd.WithCombinedSink(sink))
+	}
+	var object *gocmd.S3Sink
+	if s.LogObject != nil {
+		object = s.LogObject(id)
+		options = append(options, gocmd.WithCombinedSink(object))
+	}
+
+	j := newJob(id, req, gocmd.New(spec.Command, options...), log)
+	j.object = object
+	j.release = release
+	s.store.Add(j)
+	go j.run(s.sem)
+
+	return j, nil
+}
+
+func (s *Server) allowed(executable string) bool {
+	for _, a := range s.Allow {
+		if a == executable {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) allowedEnv(key string) bool {
+	for _, k := range s.AllowEnv {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.serveAdmin(w, r) {
+		return
+	}
+	s.mu.RLock()
+	want := s.Token
+	s.mu.RUnlock()
+	if want != "" {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(want)) != 1 {
+			httpError(w, http.StatusUnauthorized, errors.New("invalid token"))
+			return
+		}
+	}
+
+	path := strings.Trim(r.URL.Path, "/")
+	if path == "stats" && r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, s.store.Stats())
+		return
+	}
+	if path == "debug" && r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, s.Debug())
+		return
+	}
+	parts := strings.Split(path, "/")
+	if parts[0] != "jobs" || len(parts) > 3 {
+		httpError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodPost:
+		s.handleSubmit(w, r)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		labels, err := parseLabels(r.URL.Query()["label"])
+		if err != nil {
+			httpError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.store.Select(labels))
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		s.withJob(w, parts[1], func(j *Job) { writeJSON(w, http.StatusOK, j.Status()) })
+	case len(parts) == 2 && r.Method == http.MethodDelete:
+		s.withJob(w, parts[1], func(j *Job) {
+			j.Cancel()
+			writeJSON(w, http.StatusOK, j.Status())
+		})
+	case len(parts) == 3 && parts[2] == "logs" && r.Method == http.MethodGet:
+		s.withJob(w, parts[1], func(j *Job) { s.handleLogs(w, r, j) })
+	default:
+		httpError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (s *Server) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	var req JobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, http.StatusBadRequest, fmt.Errorf("decode job request: %w", err))
+		return
+	}
+
+	j, err := s.Submit(req)
+	var limited *gocmd.RateLimitError
+	switch {
+	case errors.Is(err, ErrNotAllowed):
+		httpError(w, http.StatusForbidden, err)
+	case errors.As(err, &limited):
+		w.Header().Set("Retry-After", strconv.Itoa(int(limited.RetryAfter.Seconds())))
+		httpError(w, http.StatusTooManyRequests, err)
+	case errors.Is(err, gocmd.ErrQuotaExceeded):
+		httpError(w, http.StatusTooManyRequests, err)
+	case err != nil:
+		httpError(w, http.StatusBadRequest, err)
+	default:
+		writeJSON(w, http.StatusCreated, j.Status())
+	}
+}
+
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request, j *Job) {
+	q := r.URL.Query()
+	from, err := lineParam(q, "offset", 0)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit, err := lineParam(q, "limit", -1)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+	if q.Has("tail") {
+		tail, err := lineParam(q, "tail", 0)
+		if err != nil {
+			httpError(w, http.StatusBadRequest, err)
+			return
+		}
+		from, limit = -tail, -1
+		if tail == 0 {
+			limit = 0
+		}
+	}
+
+	follow := q.Get("follow")
+	if follow == "" || follow == "0" || follow == "false" {
+		p, _, total := j.log.readLines(from, limit)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Total-Lines", strconv.Itoa(total))
+		_, _ = w.Write(p)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	flusher, _ := w.(http.Flusher)
+	_, offset, _ := j.log.readLines(from, 0)
+	for {
+		p, done := j.log.readFrom(r.Context(), offset)
+		if _, err := w.Write(p); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if offset += len(p); done || r.Context().Err() != nil {
+			return
+		}
+	}
+}
+
+// lineParam parses a non-negative number of lines of the query.
+func lineParam(q url.Values, name string, value int) (int, error) {
+	if !q.Has(name) {
+		return value, nil
+	}
+	n, err := strconv.Atoi(q.Get(name))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q, a number of lines expected", name, q.Get(name))
+	}
+	return n, nil
+}
+
+func (s *Server) withJob(w http.ResponseWriter, id string, f func(*Job)) {
+	if j := s.store.Get(id); j != nil {
+		f(j)
+	} else {
+		httpError(w, http.StatusNotFound, fmt.Errorf("job %s not found", id))
+	}
+}
+
+// parseLabels parses the label=key=value query params of the jobs list.
+func parseLabels(params []string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, p := range params {
+		k, v, ok := strings.Cut(p, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label %q, key=value expected", p)
+		}
+		labels[k] = v
+	}
+	return labels, nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func httpError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
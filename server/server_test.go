@@ -0,0 +1,500 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/bingoohuang/gocmd/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func do(t *testing.T, ts *httptest.Server, method, path string, body interface{}, v interface{}) int {
+	t.Helper()
+
+	var r io.Reader
+	if body != nil {
+		b, _ := json.Marshal(body)
+		r = bytes.NewReader(b)
+	}
+	req, _ := http.NewRequest(method, ts.URL+path, r)
+	req.Header.Set("Authorization", "Bearer secret")
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer rsp.Body.Close()
+
+	if s, ok := v.(*string); ok {
+		b, _ := io.ReadAll(rsp.Body)
+		*s = string(b)
+	} else if v != nil {
+		assert.Nil(t, json.NewDecoder(rsp.Body).Decode(v))
+	}
+	return rsp.StatusCode
+}
+
+func waitDone(t *testing.T, ts *httptest.Server, id string) server.JobStatus {
+	t.Helper()
+
+	var status server.JobStatus
+	for i := 0; i < 100; i++ {
+		do(t, ts, http.MethodGet, "/jobs/"+id, nil, &status)
+		if status.State.Done() {
+			return status
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("job %s not done: %+v", id, status)
+	return status
+}
+
+func TestServer(t *testing.T) {
+	ts := httptest.NewServer(server.New(2, server.WithToken("secret")))
+	defer ts.Close()
+
+	var status server.JobStatus
+	code := do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Command: "echo hello; sleep 0.05; echo oops >&2; exit 3"}, &status)
+	assert.Equal(t, http.StatusCreated, code)
+	assert.NotEmpty(t, status.ID)
+
+	status = waitDone(t, ts, status.ID)
+	assert.Equal(t, server.Failed, status.State)
+	assert.Equal(t, 3, status.ExitCode)
+
+	var logs string
+	do(t, ts, http.MethodGet, "/jobs/"+status.ID+"/logs", nil, &logs)
+	assert.Equal(t, "hello\noops\n", logs)
+
+	var list []server.JobStatus
+	do(t, ts, http.MethodGet, "/jobs", nil, &list)
+	assert.Len(t, list, 1)
+
+	assert.Equal(t, http.StatusNotFound, do(t, ts, http.MethodGet, "/jobs/nope", nil, nil))
+}
+
+func TestServerLogLines(t *testing.T) {
+	ts := httptest.NewServer(server.New(1, server.WithToken("secret")))
+	defer ts.Close()
+
+	var status server.JobStatus
+	do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Command: "seq 5000; printf end"}, &status)
+	waitDone(t, ts, status.ID)
+
+	for query, want := range map[string]string{
+		"tail=3":              "4999\n5000\nend",
+		"tail=0":              "",
+		"tail=9999":           "",
+		"offset=2047&limit=3": "2048\n2049\n2050\n",
+		"offset=1024&limit=1": "1025\n",
+		"offset=4999":         "5000\nend",
+		"offset=6000":         "",
+		"limit=2":             "1\n2\n",
+		"tail=2&follow=1":     "5000\nend",
+	} {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/jobs/"+status.ID+"/logs?"+query, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rsp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		b, _ := io.ReadAll(rsp.Body)
+		rsp.Body.Close()
+		if query == "tail=9999" {
+			assert.True(t, strings.HasPrefix(string(b), "1\n2\n") && strings.HasSuffix(string(b), "5000\nend"), query)
+			continue
+		}
+		assert.Equal(t, want, string(b), query)
+		if !strings.Contains(query, "follow") {
+			assert.Equal(t, "5001", rsp.Header.Get("X-Total-Lines"), query)
+		}
+	}
+
+	assert.Equal(t, http.StatusBadRequest, do(t, ts, http.MethodGet, "/jobs/"+status.ID+"/logs?tail=-1", nil, nil))
+}
+
+func TestServerFollowAndCancel(t *testing.T) {
+	ts := httptest.NewServer(server.New(1, server.WithToken("secret")))
+	defer ts.Close()
+
+	var status server.JobStatus
+	do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Args: []string{"sh", "-c", "echo a; sleep 0.1; echo b"}}, &status)
+
+	var logs string
+	do(t, ts, http.MethodGet, "/jobs/"+status.ID+"/logs?follow=1", nil, &logs)
+	assert.Equal(t, "a\nb\n", logs)
+	assert.Equal(t, server.Succeeded, waitDone(t, ts, status.ID).State)
+
+	do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Command: "sleep 5"}, &status)
+	assert.Equal(t, http.StatusOK, do(t, ts, http.MethodDelete, "/jobs/"+status.ID, nil, nil))
+	assert.Equal(t, server.Canceled, waitDone(t, ts, status.ID).State)
+}
+
+func TestServerFollowGone(t *testing.T) {
+	s := server.New(1, server.WithToken("secret"))
+	ts := httptest.NewServer(s)
+
+	var status server.JobStatus
+	do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Command: "sleep 5"}, &status)
+	defer s.Store().Get(status.ID).Cancel()
+
+	// a follower going away while the job prints nothing
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/jobs/"+status.ID+"/logs?follow=1", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	if rsp, err := http.DefaultClient.Do(req); err == nil {
+		_, _ = io.ReadAll(rsp.Body)
+		rsp.Body.Close()
+	}
+
+	// Close waits for the handlers, the one of the follower included
+	closed := make(chan struct{})
+	go func() {
+		ts.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(3 * time.Second):
+		t.Fatal("the handler of the follower did not return")
+	}
+}
+
+func TestServerAllowAndToken(t *testing.T) {
+	ts := httptest.NewServer(server.New(1, server.WithToken("secret"), server.WithAllow("echo")))
+	defer ts.Close()
+
+	var status server.JobStatus
+	assert.Equal(t, http.StatusCreated, do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Command: "echo 'a;b' $HOME"}, &status))
+	waitDone(t, ts, status.ID)
+
+	var logs string
+	do(t, ts, http.MethodGet, "/jobs/"+status.ID+"/logs", nil, &logs)
+	assert.Equal(t, "a;b $HOME\n", logs)
+
+	assert.Equal(t, http.StatusForbidden, do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Command: "rm -rf /tmp/x"}, nil))
+	// the allowed basename in another directory
+	assert.Equal(t, http.StatusForbidden, do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Args: []string{"/tmp/evil/echo"}}, nil))
+	// env vars which could run other executables
+	for _, env := range []map[string]string{{"PATH": "/tmp/evil"}, {"LD_PRELOAD": "/tmp/evil.so"}} {
+		assert.Equal(t, http.StatusForbidden, do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Command: "echo hi", Env: env}, nil))
+	}
+
+	rsp, err := http.Post(ts.URL+"/jobs", "application/json", bytes.NewReader([]byte(`{"command":"echo"}`)))
+	assert.Nil(t, err)
+	rsp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, rsp.StatusCode)
+}
+
+func TestServerAllowEnv(t *testing.T) {
+	ts := httptest.NewServer(server.New(1, server.WithToken("secret"), server.WithAllow("printenv"), server.WithAllowEnv("GREETING")))
+	defer ts.Close()
+
+	var status server.JobStatus
+	assert.Equal(t, http.StatusCreated, do(t, ts, http.MethodPost, "/jobs",
+		server.JobRequest{Command: "printenv GREETING", Env: map[string]string{"GREETING": "hello"}}, &status))
+	assert.Equal(t, server.Succeeded, waitDone(t, ts, status.ID).State)
+	assert.Equal(t, http.StatusForbidden, do(t, ts, http.MethodPost, "/jobs",
+		server.JobRequest{Command: "printenv", Env: map[string]string{"PATH": "/tmp"}}, nil))
+}
+
+func TestServerLabels(t *testing.T) {
+	ts := httptest.NewServer(server.New(2, server.WithToken("secret")))
+	defer ts.Close()
+
+	var status server.JobStatus
+	do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Command: "true", Labels: map[string]string{"tenant": "acme"}}, &status)
+	assert.Equal(t, gocmd.Labels{"tenant": "acme"}, status.Labels)
+	do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Command: "true", Labels: map[string]string{"tenant": "other"}}, nil)
+
+	var list []server.JobStatus
+	do(t, ts, http.MethodGet, "/jobs?label=tenant=acme", nil, &list)
+	assert.Len(t, list, 1)
+	assert.Equal(t, status.ID, list[0].ID)
+
+	assert.Equal(t, http.StatusBadRequest, do(t, ts, http.MethodGet, "/jobs?label=tenant", nil, nil))
+}
+
+func TestServerLimiter(t *testing.T) {
+	l := &gocmd.Limiter{Label: "tenant", PerMinute: 1}
+	ts := httptest.NewServer(server.New(2, server.WithToken("secret"), server.WithLimiter(l)))
+	defer ts.Close()
+
+	acme := server.JobRequest{Command: "true", Labels: map[string]string{"tenant": "acme"}}
+	assert.Equal(t, http.StatusCreated, do(t, ts, http.MethodPost, "/jobs", acme, nil))
+	assert.Equal(t, http.StatusCreated, do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Command: "true"}, nil))
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/jobs", bytes.NewReader([]byte(`{"command":"true","labels":{"tenant":"acme"}}`)))
+	req.Header.Set("Authorization", "Bearer secret")
+	rsp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	rsp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, rsp.StatusCode)
+	assert.Equal(t, "60", rsp.Header.Get("Retry-After"))
+}
+
+func TestServerMeter(t *testing.T) {
+	m := &gocmd.Meter{Label: "tenant", Check: gocmd.Quota(gocmd.Usage{Runs: 1})}
+	ts := httptest.NewServer(server.New(2, server.WithToken("secret"), server.WithMeter(m)))
+	defer ts.Close()
+
+	var status server.JobStatus
+	acme := server.JobRequest{Command: "echo hello", Labels: map[string]string{"tenant": "acme"}}
+	assert.Equal(t, http.StatusCreated, do(t, ts, http.MethodPost, "/jobs", acme, &status))
+	waitDone(t, ts, status.ID)
+
+	u, err := m.Usage("acme")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), u.Runs)
+	assert.Equal(t, int64(len("hello\n")), u.OutputBytes)
+	assert.Equal(t, http.StatusTooManyRequests, do(t, ts, http.MethodPost, "/jobs", acme, nil))
+	assert.Equal(t, http.StatusCreated, do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Command: "true"}, nil))
+}
+
+func TestServerReload(t *testing.T) {
+	s := server.New(2, server.WithToken("secret"), server.WithAllow("sleep"))
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	var running server.JobStatus
+	assert.Equal(t, http.StatusCreated, do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Command: "sleep 0.2"}, &running))
+	assert.Equal(t, http.StatusForbidden, do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Command: "echo hello"}, nil))
+
+	deny := gocmd.PolicyFunc(func(_ context.Context, in gocmd.PolicyInput) (gocmd.PolicyDecision, error) {
+		return gocmd.PolicyDecision{Allow: in.Args[0] != "hostname", Reasons: []string{"no hostname"}}, nil
+	})
+	changes := s.Reload(server.WithAllow("sleep", "echo", "hostname"), server.WithTimeout(5*time.Minute),
+		server.WithToken("secret"), server.WithPolicy(deny))
+	assert.Equal(t, []string{"allow: [sleep] -> [sleep echo hostname]", "timeout: 1m0s -> 5m0s", "policy: none -> set"}, changes)
+	assert.Empty(t, s.Reload(server.WithTimeout(5*time.Minute)))
+	assert.Equal(t, []string{"token changed"}, s.Reload(server.WithToken("rotated")))
+	assert.Equal(t, http.StatusUnauthorized, do(t, ts, http.MethodGet, "/jobs", nil, nil))
+	s.Reload(server.WithToken("secret"))
+
+	var status server.JobStatus
+	assert.Equal(t, http.StatusCreated, do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Command: "echo hello"}, &status))
+	assert.Equal(t, server.Succeeded, waitDone(t, ts, status.ID).State)
+	assert.Equal(t, http.StatusCreated, do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Command: "hostname"}, &status))
+	status = waitDone(t, ts, status.ID)
+	assert.Equal(t, server.Failed, status.State)
+	assert.Contains(t, status.Error, "no hostname")
+
+	// the running job was not affected
+	assert.Equal(t, server.Succeeded, waitDone(t, ts, running.ID).State)
+}
+
+func TestServerPresets(t *testing.T) {
+	s := server.New(1, server.WithToken("secret"), server.WithAllow("echo"), server.WithPresets(map[string]server.Preset{
+		"greet": {Command: "echo hello", Labels: map[string]string{"team": "ops"}},
+	}))
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	var status server.JobStatus
+	assert.Equal(t, http.StatusCreated, do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Preset: "greet", Args: []string{"a b; id"}}, &status))
+	assert.Equal(t, gocmd.Labels{"team": "ops"}, status.Labels)
+	assert.Equal(t, server.Succeeded, waitDone(t, ts, status.ID).State)
+	var logs string
+	do(t, ts, http.MethodGet, "/jobs/"+status.ID+"/logs", nil, &logs)
+	assert.Equal(t, "hello a b; id\n", logs)
+
+	assert.Equal(t, http.StatusBadRequest, do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Preset: "nope"}, nil))
+	assert.Equal(t, http.StatusBadRequest, do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Preset: "greet", Command: "echo"}, nil))
+
+	changes := s.Reload(server.WithPresets(map[string]server.Preset{"greet": {Command: "echo hi"}, "bye": {Command: "echo bye"}}))
+	assert.Equal(t, []string{"preset bye added", "preset greet changed"}, changes)
+	assert.Equal(t, []string{"preset bye removed", "preset greet removed"}, s.Reload(server.WithPresets(nil)))
+}
+
+func TestServerSchedules(t *testing.T) {
+	every := func(name, spec, command string) server.Schedule {
+		return server.Schedule{Name: name, Spec: spec, Job: server.JobRequest{Command: command}}
+	}
+	s := server.New(4, server.WithToken("secret"), server.WithSchedules(
+		every("fast", "@every 50ms", "echo fast"),
+		every("slow", "@every 100ms", "sleep 0.5"),
+		every("bad", "not a spec", "true"),
+		every("hourly", "@every 1h", "true"),
+	))
+	defer s.Close()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	ran := func(name string) []server.JobStatus {
+		var jobs []server.JobStatus
+		do(t, ts, http.MethodGet, "/jobs?label=schedule="+name, nil, &jobs)
+		return jobs
+	}
+	assert.Eventually(t, func() bool { return len(ran("fast")) >= 2 && len(ran("slow")) >= 1 }, 5*time.Second, 10*time.Millisecond)
+	debug := s.Debug()
+	assert.Len(t, debug.Schedules, 4)
+	assert.Equal(t, "bad", debug.Schedules[0].Name)
+	assert.Contains(t, debug.Schedules[0].Error, "not a spec")
+
+	// the unchanged ones are not restarted, the next run of hourly stays, slow is stopped, its jobs keep running
+	hourly := debug.Schedules[2]
+	changes := s.Reload(server.WithSchedules(every("fast", "@every 50ms", "echo fast"), every("hourly", "@every 1h", "true"),
+		every("new", "@every 50ms", "true")))
+	assert.Equal(t, []string{"schedule bad removed", "schedule new added", "schedule slow removed"}, changes)
+	slow := ran("slow")
+	for _, j := range slow {
+		assert.Equal(t, server.Succeeded, waitDone(t, ts, j.ID).State)
+	}
+	time.Sleep(200 * time.Millisecond)
+	assert.Len(t, ran("slow"), len(slow))
+	assert.Eventually(t, func() bool { return len(ran("new")) >= 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, hourly, s.Debug().Schedules[1])
+
+	assert.Equal(t, []string{"schedule fast changed", "schedule hourly removed", "schedule new removed"},
+		s.Reload(server.WithSchedules(every("fast", "@every 1h", "echo fast"))))
+	assert.Empty(t, s.Reload(server.WithSchedules(every("fast", "@every 1h", "echo fast"))))
+}
+
+func TestServerAdmin(t *testing.T) {
+	l := &gocmd.Limiter{Label: "tenant", Concurrent: 5}
+	s := server.New(1, server.WithToken("secret"), server.WithLimiter(l), server.WithMaxQueued(1))
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	// the probes need no token
+	for _, path := range []string{"/healthz", "/readyz"} {
+		resp, err := http.Get(ts.URL + path)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+	}
+	resp, err := http.Get(ts.URL + "/debug")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	var failed server.JobStatus
+	assert.Equal(t, http.StatusCreated, do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Command: "exit 3"}, &failed))
+	waitDone(t, ts, failed.ID)
+
+	var running server.JobStatus
+	acme := map[string]string{"tenant": "acme"}
+	assert.Equal(t, http.StatusCreated, do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Command: "sleep 10", Labels: acme}, &running))
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusCreated, do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Command: "true", Labels: acme}, nil))
+	}
+	assert.Eventually(t, func() bool { return len(s.Debug().Running) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	var d server.Debug
+	assert.Equal(t, http.StatusOK, do(t, ts, http.MethodGet, "/debug", nil, &d))
+	assert.Equal(t, 1, d.Parallel)
+	assert.Equal(t, running.ID, d.Running[0].ID)
+	assert.Equal(t, 2, d.Queued)
+	assert.Equal(t, map[string]gocmd.LimiterKeyState{"acme": {Running: 3, LastMinute: 3}, "": {LastMinute: 1}}, d.Limiter)
+	assert.Len(t, d.RecentFailures, 1)
+	assert.Equal(t, 3, d.RecentFailures[0].ExitCode)
+	assert.Equal(t, 4, d.Store.Jobs)
+
+	resp, err = http.Get(ts.URL + "/readyz")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.EqualError(t, s.Ready(), "2 jobs queued, more than 1")
+
+	do(t, ts, http.MethodDelete, "/jobs/"+running.ID, nil, nil)
+}
+
+func TestServerLogURL(t *testing.T) {
+	posted := make(chan map[string]interface{}, 10)
+	logs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		posted <- body
+	}))
+	defer logs.Close()
+
+	ts := httptest.NewServer(server.New(1, server.WithToken("secret"), server.WithLogURL(logs.URL)))
+	defer ts.Close()
+
+	var status server.JobStatus
+	do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Command: "echo hello", Labels: map[string]string{"tenant": "acme"}}, &status)
+	waitDone(t, ts, status.ID)
+
+	body := <-posted
+	assert.Equal(t, map[string]interface{}{"job": status.ID, "tenant": "acme"}, body["labels"])
+	assert.Equal(t, "hello", body["lines"].([]interface{})[0].(map[string]interface{})["line"])
+}
+
+func TestServerLogObject(t *testing.T) {
+	// a storage accepting any upload
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("uploads") {
+			_, _ = io.WriteString(w, "<InitiateMultipartUploadResult><UploadId>u1</UploadId></InitiateMultipartUploadResult>")
+		}
+	}))
+	defer storage.Close()
+
+	ts := httptest.NewServer(server.New(1, server.WithToken("secret"), server.WithLogObject(func(id string) *gocmd.S3Sink {
+		return gocmd.NewS3Sink(storage.URL, "logs", "jobs/"+id+".log.gz")
+	})))
+	defer ts.Close()
+
+	var status server.JobStatus
+	do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Command: "echo hello"}, &status)
+	status = waitDone(t, ts, status.ID)
+	assert.Equal(t, "s3://logs/jobs/"+status.ID+".log.gz", status.LogRef)
+}
+
+func TestStoreClean(t *testing.T) {
+	s := server.New(4, server.WithToken("secret"))
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	submit := func(command, tenant string) string {
+		var status server.JobStatus
+		do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Command: command, Labels: map[string]string{"tenant": tenant}}, &status)
+		waitDone(t, ts, status.ID)
+		return status.ID
+	}
+	a1 := submit("echo a1", "a")
+	a2 := submit("echo a2", "a")
+	a3 := submit("echo a3", "a")
+	b1 := submit("echo b1", "b")
+
+	var running server.JobStatus
+	do(t, ts, http.MethodPost, "/jobs", server.JobRequest{Command: "echo running; sleep 10"}, &running)
+	defer do(t, ts, http.MethodDelete, "/jobs/"+running.ID, nil, nil)
+	assert.Eventually(t, func() bool { return s.Store().Stats().LogBytes == 3*3+3+8 }, 5*time.Second, 10*time.Millisecond)
+
+	// the newest 2 jobs of each tenant
+	assert.Equal(t, 1, s.Store().Clean(server.Retention{MaxPerLabel: map[string]int{"tenant": 2}}))
+	assert.Nil(t, s.Store().Get(a1))
+
+	// the oldest finished ones, but not the running one
+	assert.Equal(t, 2, s.Store().Clean(server.Retention{MaxBytes: 11}))
+	assert.Nil(t, s.Store().Get(a2))
+	assert.Nil(t, s.Store().Get(a3))
+	assert.NotNil(t, s.Store().Get(b1))
+
+	assert.Equal(t, 1, s.Store().Clean(server.Retention{MaxAge: time.Nanosecond}))
+	assert.NotNil(t, s.Store().Get(running.ID))
+
+	var stats server.StoreStats
+	assert.Equal(t, http.StatusOK, do(t, ts, http.MethodGet, "/stats", nil, &stats))
+	assert.Equal(t, 1, stats.Jobs)
+	assert.Equal(t, int64(8), stats.LogBytes)
+	assert.Equal(t, int64(4), stats.Deleted)
+	assert.Equal(t, int64(12), stats.DeletedBytes)
+	assert.False(t, stats.Cleaned.IsZero())
+}
+
+func TestServerCloseStopsJanitor(t *testing.T) {
+	s := server.New(1, server.WithRetention(server.Retention{MaxAge: time.Hour}, 10*time.Millisecond))
+	assert.Eventually(t, func() bool { return !s.Store().Stats().Cleaned.IsZero() }, 5*time.Second, 10*time.Millisecond)
+
+	assert.Nil(t, s.Close())
+	cleaned := s.Store().Stats().Cleaned
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, cleaned, s.Store().Stats().Cleaned)
+}
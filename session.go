@@ -0,0 +1,159 @@
+package gocmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// sessionCloseGrace is how long Close waits for the command to exit after
+// its stdin was closed, before canceling it.
+const sessionCloseGrace = 3 * time.Second
+
+// Session drives an interactive command, like a mysql, ftp or python client,
+// the way expect does, by sending it lines and waiting for its output to
+// match patterns. Its stdout and stderr are matched together, as they stream,
+// including their unterminated last line, like a prompt.
+//
+// Many programs prompt only when their stdin is a terminal, they need their
+// interactive flag then, like python3 -i or mysql -n.
+//
+// Example:
+//
+//	s, err := gocmd.NewSession(ctx, "python3 -iq", gocmd.WithTimeout(0))
+//	if err != nil {
+//		return err
+//	}
+//	defer s.Close()
+//	if _, _, err := s.Expect(`>>> `, 5*time.Second); err != nil {
+//		return err
+//	}
+//	_ = s.Send("print(6 * 7)")
+//	_, m, err := s.Expect(`(\d+)\n>>> `, 5*time.Second) // m[1] == "42"
+type Session struct {
+	c     *Cmd
+	stdin io.WriteCloser
+	done  chan struct{}
+	err   error // of Run, once done
+
+	mu      sync.Mutex
+	buf     []byte        // the output not consumed by Expect yet
+	changed chan struct{} // closed when buf grows
+}
+
+// NewSession runs the command, with the options, until it exits, ctx is done
+// or the session is closed. Its timeout is the one of the options, like for
+// Run, WithTimeout(0) for none.
+func NewSession(ctx context.Context, cmd string, options ...func(*Cmd)) (*Session, error) {
+	c := New(cmd, options...)
+	stdin, err := c.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{c: c, stdin: stdin, done: make(chan struct{}), changed: make(chan struct{})}
+	c.stdoutWriters = append(c.stdoutWriters, s)
+	c.stderrWriters = append(c.stderrWriters, s)
+
+	go func() {
+		s.err = c.Run(ctx)
+		close(s.done)
+	}()
+	return s, nil
+}
+
+// Write implements io.Writer, for the outputs of the command.
+func (s *Session) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buf = append(s.buf, p...)
+	close(s.changed)
+	s.changed = make(chan struct{})
+	return len(p), nil
+}
+
+// Cmd returns the command of the session, like for its Status once closed.
+func (s *Session) Cmd() *Cmd { return s.c }
+
+// Send writes the line, and a newline, to the stdin of the command.
+func (s *Session) Send(line string) error {
+	_, err := io.WriteString(s.stdin, line+"\n")
+	return err
+}
+
+// Expect waits for the output of the command to match the regexp pattern,
+// and consumes it, up to the end of the match, so that the next Expect
+// matches the output after it. It returns the consumed output, and the match
+// and its submatches, like regexp.FindStringSubmatch.
+//
+// If the output does not match within timeout, a wrapped ErrTimeout is
+// returned, and io.EOF if the command exited, with the output left unconsumed.
+func (s *Session) Expect(pattern string, timeout time.Duration) (output string, match []string, err error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", nil, err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		s.mu.Lock()
+		changed := s.changed
+		if loc := re.FindSubmatchIndex(s.buf); loc != nil {
+			output = string(s.buf[:loc[1]])
+			for i := 0; i < len(loc); i += 2 {
+				if loc[i] >= 0 {
+					match = append(match, string(s.buf[loc[i]:loc[i+1]]))
+				} else {
+					match = append(match, "")
+				}
+			}
+			s.buf = s.buf[loc[1]:]
+			s.mu.Unlock()
+			return output, match, nil
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-s.done:
+			// the last output is written before Run returns
+			s.mu.Lock()
+			eof := s.changed == changed
+			s.mu.Unlock()
+			if eof {
+				return "", nil, fmt.Errorf("expect %q: %w", pattern, io.EOF)
+			}
+		case <-timer.C:
+			return "", nil, fmt.Errorf("expect %q: timeout %v: %w", pattern, timeout, ErrTimeout)
+		}
+	}
+}
+
+// Buffered returns the output not consumed by Expect yet.
+func (s *Session) Buffered() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return string(s.buf)
+}
+
+// Close closes the stdin of the command, which ends most interactive
+// programs, cancels the command if it is still running a few seconds later,
+// and returns the error of its Run.
+func (s *Session) Close() error {
+	_ = s.stdin.Close()
+	select {
+	case <-s.done:
+	case <-time.After(sessionCloseGrace):
+		if err := s.c.Cancel("session closed"); err != nil && !errors.Is(err, ErrNotRunning) {
+			return err
+		}
+		<-s.done
+	}
+	return s.err
+}
@@ -0,0 +1,53 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSession(t *testing.T) {
+	s, err := gocmd.NewSession(context.TODO(),
+		`printf '> '; while read -r l; do echo "got $l"; printf '> '; done; echo bye >&2`,
+		gocmd.WithTimeout(0))
+	assert.Nil(t, err)
+
+	output, _, err := s.Expect(`> `, 5*time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, "> ", output)
+
+	assert.Nil(t, s.Send("hello"))
+	_, m, err := s.Expect(`got (\w+)\n`, 5*time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"got hello\n", "hello"}, m)
+
+	_, _, err = s.Expect(`never`, 50*time.Millisecond)
+	assert.ErrorIs(t, err, gocmd.ErrTimeout)
+	assert.EqualError(t, err, `expect "never": timeout 50ms: timeout`)
+
+	_, _, err = s.Expect(`(`, time.Second)
+	assert.Error(t, err)
+
+	assert.Nil(t, s.Close())
+	assert.Equal(t, "> bye\n", s.Buffered()) // stderr too
+	_, _, err = s.Expect(`never`, 5*time.Second)
+	assert.ErrorIs(t, err, io.EOF)
+	_, _, err = s.Expect(`bye`, time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, s.Cmd().ExitCode())
+}
+
+func TestSessionCloseCancel(t *testing.T) {
+	s, err := gocmd.NewSession(context.TODO(), `trap '' HUP; exec 0<&-; sleep 30`, gocmd.WithTimeout(0))
+	assert.Nil(t, err)
+	start := time.Now()
+	_ = s.Close()
+	assert.Less(t, time.Since(start), 10*time.Second)
+	assert.True(t, s.Cmd().Executed)
+}
@@ -0,0 +1,361 @@
+package gocmd
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/gocmd/shellquote"
+)
+
+// ShellResult is the result of a snippet run by a ShellPool.
+type ShellResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	Duration time.Duration
+	// Fallback tells the snippet was run by a command of its own, the shell
+	// being incompatible with the workers of the pool.
+	Fallback bool
+}
+
+// ShellPool is an experimental pool of long-lived POSIX shell workers, for
+// workloads running thousands of tiny shell snippets, which avoids the
+// fork/exec and startup of a shell per snippet. A worker reads the snippets
+// from a control pipe, runs each one in a subshell, so that its exit, cd or
+// variables do not leak into the next ones, with stdin from /dev/null, and
+// delimits its output and exit code by a random marker.
+//
+// Snippets are run by a command of their own, like by New with WithShell,
+// if the shell is not a POSIX one, like cmd.exe, a worker can't be started,
+// or a snippet can't be quoted. Snippets must not leave background processes
+// writing to their stdout or stderr, which would mix into the output of the
+// next snippets of the worker.
+//
+// Example:
+//
+//	p := &gocmd.ShellPool{Shell: "sh", Size: 8}
+//	defer p.Close()
+//	r, err := p.Run(ctx, "test -e /etc/passwd && echo yes")
+type ShellPool struct {
+	// Shell is the shell of the workers, the default shell of New if empty.
+	Shell string
+	// Size is the maximum number of workers, and of snippets running at the same time, 1 if less.
+	Size int
+	// Dir is the working directory of the workers, Env their env vars added to the ones of the process.
+	Dir string
+	Env EnvVars
+	// Timeout, if not zero, is the timeout of each snippet, if the context has no deadline.
+	Timeout time.Duration
+
+	once   sync.Once
+	sem    chan struct{}
+	marker string
+
+	mu           sync.Mutex
+	idle         []*shellWorker
+	closed       bool
+	incompatible error
+}
+
+// ErrShellPoolClosed is returned by ShellPool.Run once it was closed.
+var ErrShellPoolClosed = errors.New("shell pool closed")
+
+func (p *ShellPool) init() {
+	p.once.Do(func() {
+		size := p.Size
+		if size < 1 {
+			size = 1
+		}
+		p.sem = make(chan struct{}, size)
+		b := make([]byte, 16)
+		_, _ = rand.Read(b)
+		p.marker = "__gocmd_" + hex.EncodeToString(b)
+		if shellquote.DialectOf(p.shell()) != shellquote.POSIX {
+			p.incompatible = fmt.Errorf("shell %s is not a POSIX one", p.shell())
+		}
+	})
+}
+
+func (p *ShellPool) shell() string {
+	if p.Shell != "" {
+		return p.Shell
+	}
+	return defaultShell
+}
+
+// Incompatible returns why the snippets are run by commands of their own,
+// nil if they are run by the workers.
+func (p *ShellPool) Incompatible() error {
+	p.init()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.incompatible
+}
+
+// Run runs the snippet by an idle worker, or a new one, waiting for one if
+// Size ones are busy. A non-zero exit code is not an error, like for Run of
+// a Cmd. If timeout, a wrapped ErrTimeout is returned and the worker killed.
+func (p *ShellPool) Run(ctx context.Context, script string) (*ShellResult, error) {
+	p.init()
+	_, hasDeadline := ctx.Deadline()
+	timeoutCtx := p.Timeout > 0 && !hasDeadline
+	if timeoutCtx {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, p.ctxErr(ctx, timeoutCtx)
+	}
+	defer func() { <-p.sem }()
+
+	w, err := p.worker()
+	if errors.Is(err, ErrShellPoolClosed) {
+		return nil, err
+	} else if err != nil {
+		return p.fallback(ctx, script, timeoutCtx)
+	}
+	quoted, err := shellquote.Quote(script)
+	if err != nil {
+		p.release(w)
+		return p.fallback(ctx, script, timeoutCtx)
+	}
+
+	start := time.Now()
+	r, err := w.run(ctx, quoted, p.marker)
+	if err != nil {
+		w.kill()
+		if ctx.Err() != nil {
+			return nil, p.ctxErr(ctx, timeoutCtx)
+		}
+		return nil, fmt.Errorf("shell worker %s: %w", p.shell(), err)
+	}
+	r.Duration = time.Since(start)
+	p.release(w)
+	return r, nil
+}
+
+func (p *ShellPool) ctxErr(ctx context.Context, timeoutCtx bool) error {
+	if timeoutCtx && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timeout %v: %w", p.Timeout, ErrTimeout)
+	}
+	return ctx.Err()
+}
+
+// worker returns an idle worker, or starts a new one.
+func (p *ShellPool) worker() (*shellWorker, error) {
+	p.mu.Lock()
+	switch {
+	case p.closed:
+		p.mu.Unlock()
+		return nil, ErrShellPoolClosed
+	case p.incompatible != nil:
+		p.mu.Unlock()
+		return nil, p.incompatible
+	case len(p.idle) > 0:
+		w := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		p.mu.Unlock()
+		return w, nil
+	}
+	p.mu.Unlock()
+
+	w, err := p.startWorker()
+	if err != nil {
+		p.mu.Lock()
+		p.incompatible = err
+		p.mu.Unlock()
+	}
+	return w, err
+}
+
+// release returns the worker to the idle ones, or stops it if the pool was closed.
+func (p *ShellPool) release(w *shellWorker) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		w.stop()
+		return
+	}
+	p.idle = append(p.idle, w)
+}
+
+// startWorker starts a worker, and checks it speaks the protocol by a no-op snippet.
+func (p *ShellPool) startWorker() (*shellWorker, error) {
+	cmd := exec.Command(p.shell())
+	cmd.Dir = p.Dir
+	if len(p.Env) > 0 {
+		cmd.Env = os.Environ()
+		for k, v := range p.Env {
+			cmd.Env = append(cmd.Env, k+"="+os.ExpandEnv(v))
+		}
+	}
+	setShellWorkerAttr(cmd)
+
+	w := &shellWorker{cmd: cmd}
+	var err error
+	if w.stdin, err = cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	w.stdout, w.stderr = bufio.NewReader(stdout), bufio.NewReader(stderr)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start shell worker %s: %w", p.shell(), err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if r, err := w.run(ctx, ":", p.marker); err != nil || r.ExitCode != 0 || r.Stdout != "" || r.Stderr != "" {
+		w.kill()
+		return nil, fmt.Errorf("shell %s is incompatible with the workers", p.shell())
+	}
+	return w, nil
+}
+
+// fallback runs the snippet by a command of its own.
+func (p *ShellPool) fallback(ctx context.Context, script string, timeoutCtx bool) (*ShellResult, error) {
+	// the timeout is the one of ctx already
+	options := []func(*Cmd){WithShell(p.shell()), WithTimeout(0), WithWorkingDir(p.Dir)}
+	if len(p.Env) > 0 {
+		options = append(options, WithEnv(p.Env))
+	}
+	c := New(script, options...)
+	start := time.Now()
+	if err := c.Run(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil, p.ctxErr(ctx, timeoutCtx)
+		}
+		return nil, err
+	}
+	return &ShellResult{
+		Stdout:   c.Stdout(),
+		Stderr:   c.Stderr(),
+		ExitCode: c.ExitCode(),
+		Duration: time.Since(start),
+		Fallback: true,
+	}, nil
+}
+
+// Close stops the idle workers, and the busy ones once their snippets are done.
+func (p *ShellPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	for _, w := range p.idle {
+		w.stop()
+	}
+	p.idle = nil
+	return nil
+}
+
+// shellWorker is a long-lived shell reading snippets from its stdin.
+type shellWorker struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	stderr *bufio.Reader
+}
+
+// run runs the quoted snippet in a subshell, and reads its output up to the marker lines.
+func (w *shellWorker) run(ctx context.Context, quoted, marker string) (*ShellResult, error) {
+	type output struct {
+		data, rest string
+		err        error
+	}
+	stdout, stderr := make(chan output, 1), make(chan output, 1)
+	go func() {
+		data, rest, err := readUntilMarker(w.stdout, marker)
+		stdout <- output{data: data, rest: rest, err: err}
+	}()
+	go func() {
+		data, rest, err := readUntilMarker(w.stderr, marker)
+		stderr <- output{data: data, rest: rest, err: err}
+	}()
+
+	// the marker lines start with a newline, in case the output does not end with one
+	line := fmt.Sprintf("( eval %s ) </dev/null; printf '\\n%%s %%d\\n' %s \"$?\"; printf '\\n%%s\\n' %s >&2\n",
+		quoted, marker, marker)
+	if _, err := io.WriteString(w.stdin, line); err != nil {
+		return nil, err
+	}
+
+	r := &ShellResult{}
+	for i := 0; i < 2; i++ {
+		select {
+		case o := <-stdout:
+			if o.err != nil {
+				return nil, o.err
+			}
+			code, err := strconv.Atoi(o.rest)
+			if err != nil {
+				return nil, fmt.Errorf("invalid exit code %q", o.rest)
+			}
+			r.Stdout, r.ExitCode = o.data, code
+		case o := <-stderr:
+			if o.err != nil {
+				return nil, o.err
+			}
+			r.Stderr = o.data
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return r, nil
+}
+
+// readUntilMarker reads the lines up to the one starting with the marker,
+// returning the ones before it, without the newline preceding the marker,
+// and the rest of the marker line.
+func readUntilMarker(r *bufio.Reader, marker string) (data, rest string, err error) {
+	var b strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = errors.New("shell worker exited")
+			}
+			return "", "", err
+		}
+		if rest, ok := strings.CutPrefix(line, marker); ok {
+			return strings.TrimSuffix(b.String(), "\n"), strings.TrimSpace(rest), nil
+		}
+		b.WriteString(line)
+	}
+}
+
+// stop stops the worker by closing its stdin, which ends the shell.
+func (w *shellWorker) stop() {
+	_ = w.stdin.Close()
+	go func() { _ = w.cmd.Wait() }()
+}
+
+// kill kills the worker and the processes of its snippet.
+func (w *shellWorker) kill() {
+	killShellWorker(w.cmd)
+	_ = w.stdin.Close()
+	go func() { _ = w.cmd.Wait() }()
+}
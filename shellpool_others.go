@@ -0,0 +1,18 @@
+//go:build !windows
+
+package gocmd
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setShellWorkerAttr starts the worker in a process group of its own, so that
+// the processes of its snippets can be killed with it.
+func setShellWorkerAttr(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func killShellWorker(cmd *exec.Cmd) {
+	_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,105 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShellPool(t *testing.T) {
+	p := &gocmd.ShellPool{Shell: "sh", Size: 2, Env: gocmd.EnvVars{"GREETING": "hello"}}
+	defer p.Close()
+
+	r, err := p.Run(context.TODO(), `echo "$GREETING"; printf 'oops' >&2; exit 3`)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello\n", r.Stdout)
+	assert.Equal(t, "oops", r.Stderr)
+	assert.Equal(t, 3, r.ExitCode)
+	assert.False(t, r.Fallback)
+	assert.Nil(t, p.Incompatible())
+
+	// snippets do not leak into the next ones
+	r, err = p.Run(context.TODO(), "cd /; X=1; printf '%s' \"$X\"")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", r.Stdout)
+	r, err = p.Run(context.TODO(), `printf '%s' "$X"; read line; echo "$?"`)
+	assert.Nil(t, err)
+	assert.Equal(t, "1\n", r.Stdout)
+
+	// syntax errors fail the snippet only
+	r, err = p.Run(context.TODO(), `echo "unterminated`)
+	assert.Nil(t, err)
+	assert.NotEqual(t, 0, r.ExitCode)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r, err := p.Run(context.TODO(), fmt.Sprintf("echo %d", i))
+			assert.Nil(t, err)
+			assert.Equal(t, fmt.Sprintf("%d\n", i), r.Stdout)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestShellPool_Timeout(t *testing.T) {
+	p := &gocmd.ShellPool{Shell: "sh", Timeout: 100 * time.Millisecond}
+	defer p.Close()
+
+	start := time.Now()
+	_, err := p.Run(context.TODO(), "sleep 10")
+	assert.True(t, errors.Is(err, gocmd.ErrTimeout))
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	// the killed worker is replaced
+	r, err := p.Run(context.TODO(), "echo ok")
+	assert.Nil(t, err)
+	assert.Equal(t, "ok\n", r.Stdout)
+}
+
+func TestShellPool_Fallback(t *testing.T) {
+	// a shell running -c only, which can't be a worker
+	shell := filepath.Join(t.TempDir(), "onlyc")
+	assert.Nil(t, os.WriteFile(shell, []byte("#!/bin/sh\n[ \"$1\" = -c ] && exec sh -c \"$2\"\nexit 1\n"), 0o755))
+
+	p := &gocmd.ShellPool{Shell: shell}
+	r, err := p.Run(context.TODO(), "echo hello")
+	assert.Nil(t, err)
+	assert.True(t, r.Fallback)
+	assert.Equal(t, "hello\n", r.Stdout)
+	assert.NotNil(t, p.Incompatible())
+	assert.Nil(t, p.Close())
+
+	_, err = p.Run(context.TODO(), "echo hello")
+	assert.ErrorIs(t, err, gocmd.ErrShellPoolClosed)
+}
+
+func BenchmarkShellPool(b *testing.B) {
+	p := &gocmd.ShellPool{Shell: "sh"}
+	defer p.Close()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.Run(context.TODO(), "echo hello"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkShellPool_New(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if err := gocmd.New("echo hello", gocmd.WithShell("sh")).Run(context.TODO()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
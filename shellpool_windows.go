@@ -0,0 +1,9 @@
+package gocmd
+
+import "os/exec"
+
+func setShellWorkerAttr(*exec.Cmd) {}
+
+func killShellWorker(cmd *exec.Cmd) {
+	_ = cmd.Process.Kill()
+}
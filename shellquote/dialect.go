@@ -0,0 +1,142 @@
+package shellquote
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Dialect is the quoting dialect of a shell.
+type Dialect int
+
+const (
+	// POSIX is the dialect of sh, bash, zsh and friends.
+	POSIX Dialect = iota
+	// CmdExe is the dialect of cmd.exe /C command lines.
+	CmdExe
+	// PowerShell is the dialect of powershell.exe and pwsh.
+	PowerShell
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case CmdExe:
+		return "cmd.exe"
+	case PowerShell:
+		return "PowerShell"
+	default:
+		return "POSIX"
+	}
+}
+
+// DialectOf returns the dialect of the shell, which is given by name or path,
+// like "/bin/bash", "cmd" or `C:\Windows\System32\cmd.exe`.
+func DialectOf(shell string) Dialect {
+	if i := strings.LastIndexAny(shell, `/\`); i >= 0 {
+		shell = shell[i+1:]
+	}
+
+	switch strings.TrimSuffix(strings.ToLower(shell), ".exe") {
+	case "cmd":
+		return CmdExe
+	case "powershell", "pwsh":
+		return PowerShell
+	default:
+		return POSIX
+	}
+}
+
+// ErrNewline will be returned from QuoteDialect with CmdExe if any of the
+// strings contains a newline, which ends a cmd.exe command and can't be escaped.
+var ErrNewline = errors.New("no way to quote string containing newlines for cmd.exe")
+
+// QuoteDialectMust will return a quoted string of the passed tokens for the dialect.
+func QuoteDialectMust(d Dialect, in ...string) string {
+	result, err := QuoteDialect(d, in...)
+	if err != nil {
+		panic(err)
+	}
+
+	return result
+}
+
+// QuoteDialect will return a quoted string of the passed tokens for the dialect.
+//
+// For CmdExe the tokens are quoted by QuoteWindows for the program which
+// receives them, then every cmd.exe metacharacter ( ) % ! ^ " < > & | is
+// escaped by a caret, so that cmd.exe neither interprets them nor expands
+// %VAR% or !VAR! references. This is right for command lines passed to
+// cmd.exe /C, which is how commands are run on Windows. Batch files have
+// different rules, percent signs have to be doubled there.
+//
+// For PowerShell the tokens needing quoting are wrapped in single quotes,
+// inside of which neither $ expansions nor backtick escapes are processed.
+// Embedded single quotes, including the typographic ones PowerShell treats
+// alike, are doubled. A quoted command is prefixed by the call operator &,
+// otherwise PowerShell would take it for a string instead of a command.
+func QuoteDialect(d Dialect, in ...string) (string, error) {
+	switch d {
+	case CmdExe:
+		return quoteCmdExe(in...)
+	case PowerShell:
+		return quotePowerShell(in...)
+	default:
+		return Quote(in...)
+	}
+}
+
+func quoteCmdExe(in ...string) (string, error) {
+	for _, x := range in {
+		if strings.ContainsAny(x, "\r\n") {
+			return "", ErrNewline
+		}
+	}
+
+	s, err := QuoteWindows(in...)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(`()%!^"<>&|`, s[i]) >= 0 {
+			b.WriteByte('^')
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String(), nil
+}
+
+var powerShellSafe = regexp.MustCompile(`^[\w./:\\-]+$`)
+
+func quotePowerShell(in ...string) (string, error) {
+	tmp := make([]string, len(in))
+	for i, x := range in {
+		if strings.Contains(x, "\x00") {
+			return "", ErrNull
+		}
+		if powerShellSafe.MatchString(x) {
+			tmp[i] = x
+			continue
+		}
+
+		var b strings.Builder
+		b.WriteByte('\'')
+		for _, r := range x {
+			switch r {
+			case '\'', '\u2018', '\u2019', '\u201a', '\u201b':
+				b.WriteRune(r)
+			}
+			b.WriteRune(r)
+		}
+		b.WriteByte('\'')
+		tmp[i] = b.String()
+	}
+
+	if len(tmp) > 0 && strings.HasPrefix(tmp[0], "'") {
+		tmp[0] = "& " + tmp[0]
+	}
+
+	return strings.Join(tmp, " "), nil
+}
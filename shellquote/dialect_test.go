@@ -0,0 +1,57 @@
+package shellquote_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bingoohuang/gocmd/shellquote"
+)
+
+func TestDialectOf(t *testing.T) {
+	t.Parallel()
+
+	for shell, expected := range map[string]shellquote.Dialect{
+		"/bin/bash":                             shellquote.POSIX,
+		"sh":                                    shellquote.POSIX,
+		"cmd":                                   shellquote.CmdExe,
+		`C:\Windows\System32\CMD.EXE`:           shellquote.CmdExe,
+		"pwsh":                                  shellquote.PowerShell,
+		`C:\x\WindowsPowerShell\powershell.exe`: shellquote.PowerShell,
+	} {
+		Equal(t, shellquote.DialectOf(shell), expected, "wrong dialect of "+shell)
+	}
+}
+
+func TestQuoteDialect(t *testing.T) {
+	t.Parallel()
+
+	for _, c := range []struct {
+		d        shellquote.Dialect
+		in       []string
+		expected string
+	}{
+		{shellquote.POSIX, []string{"echo", "a b"}, `echo 'a b'`},
+		{shellquote.CmdExe, []string{"echo", "hello"}, `echo hello`},
+		{shellquote.CmdExe, []string{"echo", "%PATH%"}, `echo ^%PATH^%`},
+		{shellquote.CmdExe, []string{"echo", "a & b"}, `echo ^"a ^& b^"`},
+		{shellquote.CmdExe, []string{"find", `say "hi"`}, `find ^"say \^"hi\^"^"`},
+		{shellquote.CmdExe, []string{"echo", "^!(x)|<y>"}, `echo ^^^!^(x^)^|^<y^>`},
+		{shellquote.PowerShell, []string{"Write-Output", "C:\\dir\\x.txt"}, `Write-Output C:\dir\x.txt`},
+		{shellquote.PowerShell, []string{"echo", "$HOME `n"}, "echo '$HOME `n'"},
+		{shellquote.PowerShell, []string{"echo", "it's"}, `echo 'it''s'`},
+		{shellquote.PowerShell, []string{"echo", "it\u2019s"}, "echo 'it\u2019\u2019s'"},
+		{shellquote.PowerShell, []string{"C:\\Program Files\\x.exe", "-v"}, `& 'C:\Program Files\x.exe' -v`},
+		{shellquote.PowerShell, []string{"echo", ""}, `echo ''`},
+	} {
+		ret, err := shellquote.QuoteDialect(c.d, c.in...)
+		if err != nil {
+			t.Errorf("QuoteDialect(%s) errored: %s", c.d, err)
+			continue
+		}
+		Equal(t, ret, c.expected, "wrong "+c.d.String()+" quote")
+	}
+
+	if _, err := shellquote.QuoteDialect(shellquote.CmdExe, "a\nb"); !errors.Is(err, shellquote.ErrNewline) {
+		t.Errorf("err should be ErrNewline; was %s", err)
+	}
+}
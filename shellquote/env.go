@@ -0,0 +1,75 @@
+package shellquote
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidEnvKey will be returned from QuoteEnv if the key is not a valid shell variable name.
+var ErrInvalidEnvKey = errors.New("invalid environment variable name")
+
+// QuoteEnv will return a shell assignment KEY=VALUE with the value quoted, like
+// FOO='va l'. The key must be a valid shell variable name, which is made of
+// letters, digits and underscores and does not start with a digit.
+func QuoteEnv(key, value string) (string, error) {
+	if !isEnvKey(key) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidEnvKey, key)
+	}
+	if strings.Contains(value, "\x00") {
+		return "", ErrNull
+	}
+
+	switch {
+	case value == "":
+		value = `''`
+	case needsEscape(value):
+		value = singleQuote(value)
+	}
+
+	return key + "=" + value, nil
+}
+
+// QuoteCommandWithEnv will return a shell command line which runs argv with
+// the environment variables set for it, like FOO='va l' BAR=baz cmd args...
+// The assignments are sorted by key, so that the result is stable.
+func QuoteCommandWithEnv(env map[string]string, argv ...string) (string, error) {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	tmp := make([]string, 0, len(env)+1)
+	for _, k := range keys {
+		assignment, err := QuoteEnv(k, env[k])
+		if err != nil {
+			return "", err
+		}
+		tmp = append(tmp, assignment)
+	}
+
+	command, err := Quote(argv...)
+	if err != nil {
+		return "", err
+	}
+	if command != "" {
+		tmp = append(tmp, command)
+	}
+
+	return strings.Join(tmp, " "), nil
+}
+
+func isEnvKey(key string) bool {
+	if key == "" || '0' <= key[0] && key[0] <= '9' {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
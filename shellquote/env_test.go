@@ -0,0 +1,49 @@
+package shellquote_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bingoohuang/gocmd/shellquote"
+)
+
+func TestQuoteEnv(t *testing.T) {
+	t.Parallel()
+
+	for _, c := range []struct {
+		key, value, expected string
+	}{
+		{"FOO", "bar", `FOO=bar`},
+		{"FOO", "", `FOO=''`},
+		{"FOO", "va l", `FOO='va l'`},
+		{"FOO", "a=b", `FOO=a=b`},
+		{"_x1", "it's", `_x1='it'\''s'`},
+		{"FOO", "$HOME", `FOO='$HOME'`},
+	} {
+		ret, err := shellquote.QuoteEnv(c.key, c.value)
+		if err != nil {
+			t.Errorf("QuoteEnv errored: %s", err)
+			continue
+		}
+		Equal(t, ret, c.expected, "wrong env quote")
+	}
+
+	for _, key := range []string{"", "1A", "A-B", "A=B", "A B"} {
+		if _, err := shellquote.QuoteEnv(key, "v"); !errors.Is(err, shellquote.ErrInvalidEnvKey) {
+			t.Errorf("QuoteEnv(%q) err should be ErrInvalidEnvKey; was %v", key, err)
+		}
+	}
+}
+
+func TestQuoteCommandWithEnv(t *testing.T) {
+	t.Parallel()
+
+	ret, err := shellquote.QuoteCommandWithEnv(map[string]string{"FOO": "va l", "BAR": "baz"}, "cmd", "a=b", "c d")
+	if err != nil {
+		t.Fatalf("QuoteCommandWithEnv errored: %s", err)
+	}
+	Equal(t, ret, `BAR=baz FOO='va l' cmd a=b 'c d'`, "wrong command quote")
+
+	ret, _ = shellquote.QuoteCommandWithEnv(nil, "a=b", "cmd")
+	Equal(t, ret, `'a=b' cmd`, "command must not turn into an assignment")
+}
@@ -0,0 +1,134 @@
+package shellquote
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MetaKind is the kind of danger a shell metacharacter poses when a string
+// is interpolated into a shell command unquoted.
+type MetaKind string
+
+const (
+	// CommandSubstitution is $(...), `...`, <(...) or >(...), which runs commands.
+	CommandSubstitution MetaKind = "command substitution"
+	// VariableExpansion is $VAR or ${VAR}.
+	VariableExpansion MetaKind = "variable expansion"
+	// Redirection is <, > and their variants, which read or write files.
+	Redirection MetaKind = "redirection"
+	// Pipe is |, which feeds the output into another command.
+	Pipe MetaKind = "pipe"
+	// ControlOperator is ;, &, &&, || or a newline, which start another command.
+	ControlOperator MetaKind = "control operator"
+	// Subshell is ( or ).
+	Subshell MetaKind = "subshell"
+	// Globbing is *, ? or [, which expand to file names.
+	Globbing MetaKind = "globbing"
+	// BraceExpansion is { or }.
+	BraceExpansion MetaKind = "brace expansion"
+	// TildeExpansion is a leading ~, which expands to a home directory.
+	TildeExpansion MetaKind = "tilde expansion"
+	// HistoryExpansion is !, which interactive shells expand.
+	HistoryExpansion MetaKind = "history expansion"
+	// Comment is a leading #, which drops the rest of the line.
+	Comment MetaKind = "comment"
+	// Quoting is ', " or \, which changes how the rest is parsed.
+	Quoting MetaKind = "quoting"
+	// Whitespace is a space or tab, which splits the string into several words.
+	Whitespace MetaKind = "whitespace"
+)
+
+// Metachar is a shell metacharacter found in a string.
+type Metachar struct {
+	Kind   MetaKind
+	Offset int    // byte offset in the string
+	Text   string // the metacharacter(s), like "$(" or ">>"
+}
+
+func (m Metachar) String() string {
+	return fmt.Sprintf("%s %q at %d", m.Kind, m.Text, m.Offset)
+}
+
+// ContainsMetacharacters returns the shell metacharacters found in s, so that
+// callers can reject or warn about a string before interpolating it into a
+// shell command. Quote the string to neutralize them instead, whenever possible.
+func ContainsMetacharacters(s string) []Metachar {
+	var found []Metachar
+	add := func(kind MetaKind, i, n int) int {
+		found = append(found, Metachar{Kind: kind, Offset: i, Text: s[i : i+n]})
+		return n - 1
+	}
+	next := func(i int) byte {
+		if i+1 < len(s) {
+			return s[i+1]
+		}
+		return 0
+	}
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '`':
+			add(CommandSubstitution, i, 1)
+		case '$':
+			switch n := next(i); {
+			case n == '(':
+				i += add(CommandSubstitution, i, 2)
+			case n == '{' || n == '_' || strings.IndexByte("@*#?$!-", n) >= 0 ||
+				'a' <= n && n <= 'z' || 'A' <= n && n <= 'Z' || '0' <= n && n <= '9':
+				i += add(VariableExpansion, i, 2)
+			}
+		case '<', '>':
+			switch n := next(i); {
+			case n == '(':
+				i += add(CommandSubstitution, i, 2)
+			case n == c || n == '&' || n == '|' || c == '<' && n == '>':
+				i += add(Redirection, i, 2)
+			default:
+				add(Redirection, i, 1)
+			}
+		case '|':
+			if next(i) == '|' {
+				i += add(ControlOperator, i, 2)
+			} else {
+				add(Pipe, i, 1)
+			}
+		case '&':
+			if next(i) == '&' {
+				i += add(ControlOperator, i, 2)
+			} else {
+				add(ControlOperator, i, 1)
+			}
+		case ';', '\n', '\r':
+			add(ControlOperator, i, 1)
+		case '(', ')':
+			add(Subshell, i, 1)
+		case '*', '?', '[':
+			add(Globbing, i, 1)
+		case '{', '}':
+			add(BraceExpansion, i, 1)
+		case '!':
+			add(HistoryExpansion, i, 1)
+		case '\'', '"', '\\':
+			add(Quoting, i, 1)
+		case ' ', '\t':
+			add(Whitespace, i, 1)
+		case '~':
+			if i == 0 {
+				add(TildeExpansion, i, 1)
+			}
+		case '#':
+			if i == 0 {
+				add(Comment, i, 1)
+			}
+		}
+	}
+
+	return found
+}
+
+// IsSafeWord tells if s can be interpolated into a shell command as a single
+// word without quoting, which is the case when it is not empty and contains no
+// shell metacharacters.
+func IsSafeWord(s string) bool {
+	return s != "" && !strings.Contains(s, "\x00") && len(ContainsMetacharacters(s)) == 0
+}
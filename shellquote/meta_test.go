@@ -0,0 +1,52 @@
+package shellquote_test
+
+import (
+	"testing"
+
+	"github.com/bingoohuang/gocmd/shellquote"
+)
+
+func TestContainsMetacharacters(t *testing.T) {
+	t.Parallel()
+
+	for in, expected := range map[string][]shellquote.Metachar{
+		"file.txt":       nil,
+		"$(id)":          {{Kind: shellquote.CommandSubstitution, Offset: 0, Text: "$("}, {Kind: shellquote.Subshell, Offset: 4, Text: ")"}},
+		"a`id`":          {{Kind: shellquote.CommandSubstitution, Offset: 1, Text: "`"}, {Kind: shellquote.CommandSubstitution, Offset: 4, Text: "`"}},
+		"x>>/etc/passwd": {{Kind: shellquote.Redirection, Offset: 1, Text: ">>"}},
+		"a;rm -rf ~": {
+			{Kind: shellquote.ControlOperator, Offset: 1, Text: ";"},
+			{Kind: shellquote.Whitespace, Offset: 4, Text: " "},
+			{Kind: shellquote.Whitespace, Offset: 8, Text: " "},
+		},
+		"a||b&&c|d":  {{Kind: shellquote.ControlOperator, Offset: 1, Text: "||"}, {Kind: shellquote.ControlOperator, Offset: 4, Text: "&&"}, {Kind: shellquote.Pipe, Offset: 7, Text: "|"}},
+		"*.go":       {{Kind: shellquote.Globbing, Offset: 0, Text: "*"}},
+		"$HOME":      {{Kind: shellquote.VariableExpansion, Offset: 0, Text: "$H"}},
+		"price$":     nil,
+		"~root":      {{Kind: shellquote.TildeExpansion, Offset: 0, Text: "~"}},
+		"a~b#c":      nil,
+		"#x":         {{Kind: shellquote.Comment, Offset: 0, Text: "#"}},
+		"diff <(ls)": {{Kind: shellquote.Whitespace, Offset: 4, Text: " "}, {Kind: shellquote.CommandSubstitution, Offset: 5, Text: "<("}, {Kind: shellquote.Subshell, Offset: 9, Text: ")"}},
+		"{a,b}":      {{Kind: shellquote.BraceExpansion, Offset: 0, Text: "{"}, {Kind: shellquote.BraceExpansion, Offset: 4, Text: "}"}},
+		`it's`:       {{Kind: shellquote.Quoting, Offset: 2, Text: "'"}},
+		"line\nnext": {{Kind: shellquote.ControlOperator, Offset: 4, Text: "\n"}},
+		"!!":         {{Kind: shellquote.HistoryExpansion, Offset: 0, Text: "!"}, {Kind: shellquote.HistoryExpansion, Offset: 1, Text: "!"}},
+	} {
+		Equal(t, shellquote.ContainsMetacharacters(in), expected, "wrong metacharacters of "+in)
+	}
+}
+
+func TestIsSafeWord(t *testing.T) {
+	t.Parallel()
+
+	for in, expected := range map[string]bool{
+		"":                false,
+		"file_1.txt":      true,
+		"a=b,c:d@e%f+g-h": true,
+		"a b":             false,
+		"$(id)":           false,
+		"a\x00b":          false,
+	} {
+		Equal(t, shellquote.IsSafeWord(in), expected, "wrong IsSafeWord of "+in)
+	}
+}
@@ -0,0 +1,73 @@
+package shellquote_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/gocmd/shellquote"
+)
+
+var roundTripSeeds = [][]string{
+	{""},
+	{"foo", "bar"},
+	{"'"},
+	{"''"},
+	{"'''a'''"},
+	{`\'`},
+	{`'\''`},
+	{"a=b", "c=d", "cmd", "e=f"},
+	{"#", "~", "!", "$(id)", "`id`"},
+	{"line\nbreak", "tab\there", "\\\n"},
+	{"\"", `"\"`, `\\`},
+	{"é", "\xff"},
+}
+
+func TestQuoteSplitRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	for _, args := range roundTripSeeds {
+		quoted, err := shellquote.Quote(args...)
+		if err != nil {
+			t.Errorf("Quote(%q) errored: %s", args, err)
+			continue
+		}
+		got, err := shellquote.Split(quoted)
+		if err != nil {
+			t.Errorf("Split(%q) errored: %s", quoted, err)
+			continue
+		}
+		Equal(t, got, args, "round trip of "+quoted)
+	}
+}
+
+// FuzzQuoteSplit checks that Split(Quote(args...)) returns args,
+// run it with go test -fuzz FuzzQuoteSplit ./shellquote
+func FuzzQuoteSplit(f *testing.F) {
+	for _, args := range roundTripSeeds {
+		f.Add(strings.Join(args, "\x01"))
+	}
+
+	f.Fuzz(func(t *testing.T, in string) {
+		if strings.Contains(in, "\x00") {
+			return
+		}
+
+		args := strings.Split(in, "\x01")
+		quoted, err := shellquote.Quote(args...)
+		if err != nil {
+			t.Fatalf("Quote(%q) errored: %s", args, err)
+		}
+		got, err := shellquote.Split(quoted)
+		if err != nil {
+			t.Fatalf("Split(%q) errored: %s", quoted, err)
+		}
+		if len(got) != len(args) {
+			t.Fatalf("Split(Quote(%q)) = %q", args, got)
+		}
+		for i := range args {
+			if got[i] != args[i] {
+				t.Fatalf("Split(Quote(%q)) = %q", args, got)
+			}
+		}
+	})
+}
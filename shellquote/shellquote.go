@@ -3,7 +3,8 @@ Package shellquote quotes strings for shell scripts.
 
 Sometimes you get strings from the internet and need to quote them for security,
 other times you'll need to quote your own strings because doing it by hand is
-just too much work.
+just too much work. Split does the reverse and parses a shell command line
+into its words.
 
 Another option is http://github.com/kballard/go-shellquote.  The quoting algorithms are
 completely different and the results vary as well, but both produce working
@@ -32,8 +33,40 @@ func QuoteMust(in ...string) string {
 // ErrNull will be returned from Quote if any of the strings contains a null byte.
 var ErrNull = errors.New("no way to quote string containing null bytes")
 
+// simplifyRe matches runs of escaped single quotes, which are collapsed
+// into one double-quoted string.
+var simplifyRe = regexp.MustCompile(`(?:'\\''){2,}`)
+
+// isSafe tells if the byte needs no quoting, that is if it is in [\w!%+,\-./:=@^].
+func isSafe(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		strings.IndexByte("_!%+,-./:=@^", c) >= 0
+}
+
+// needsEscape tells if the token contains any byte which is not safe.
+func needsEscape(x string) bool {
+	for i := 0; i < len(x); i++ {
+		if !isSafe(x[i]) {
+			return true
+		}
+	}
+	return false
+}
+
 // Quote will return a shell quoted string for the passed tokens.
+//
+// Leading tokens containing = are always quoted, otherwise the shell would
+// take them for variable assignments instead of the command and its arguments.
+// Use QuoteEnv or QuoteCommandWithEnv to render assignments.
+//
+// Quote round-trips: for any tokens without null bytes, Split(Quote(in...))
+// returns the tokens again, and so does a POSIX shell. FuzzQuoteSplit checks it.
 func Quote(in ...string) (string, error) {
+	// fast path: nothing to quote
+	if allPlain(in) {
+		return strings.Join(in, " "), nil
+	}
+
 	tmp := make([]string, len(in))
 	var sawNonEqual bool
 	for i, x := range in {
@@ -55,28 +88,12 @@ func Quote(in ...string) (string, error) {
 			sawNonEqual = true
 		}
 
-		toEsc := regexp.MustCompile(`[^\w!%+,\-./:=@^]`)
-		if !escape && toEsc.MatchString(x) {
+		if !escape && needsEscape(x) {
 			escape = true
 		}
 
 		if escape || (!sawNonEqual && hasEqual) {
-			y := strings.ReplaceAll(x, `'`, `'\''`)
-
-			simplifyRe := regexp.MustCompile(`(?:'\\''){2,}`)
-			y = simplifyRe.ReplaceAllStringFunc(y, func(str string) string {
-				var inner string
-				for i := 0; i < len(str)/4; i++ {
-					inner += "'"
-				}
-				return `'"` + inner + `"'`
-			})
-
-			y = `'` + y + `'`
-			y = strings.TrimSuffix(y, `''`)
-			y = strings.TrimPrefix(y, `''`)
-
-			tmp[i] = y
+			tmp[i] = singleQuote(x)
 			continue
 		}
 		tmp[i] = x
@@ -84,3 +101,33 @@ func Quote(in ...string) (string, error) {
 
 	return strings.Join(tmp, " "), nil
 }
+
+// singleQuote wraps x in single quotes, escaping embedded single quotes.
+func singleQuote(x string) string {
+	y := strings.ReplaceAll(x, `'`, `'\''`)
+
+	y = simplifyRe.ReplaceAllStringFunc(y, func(str string) string {
+		var inner string
+		for i := 0; i < len(str)/4; i++ {
+			inner += "'"
+		}
+		return `'"` + inner + `"'`
+	})
+
+	y = `'` + y + `'`
+	y = strings.TrimSuffix(y, `''`)
+	y = strings.TrimPrefix(y, `''`)
+
+	return y
+}
+
+// allPlain tells if none of the tokens needs quoting, which are the ones
+// which are non-empty, and consist of safe bytes other than =.
+func allPlain(in []string) bool {
+	for _, x := range in {
+		if x == "" || strings.IndexByte(x, '=') >= 0 || needsEscape(x) {
+			return false
+		}
+	}
+	return true
+}
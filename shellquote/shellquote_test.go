@@ -73,3 +73,17 @@ func JSONEqual(t *testing.T, got, expected string, prefix string, opts ...cmp.Op
 
 	return Equal(t, gotValue, expectedValue, prefix, opts...)
 }
+
+func BenchmarkQuotePlain(b *testing.B) {
+	args := []string{"rsync", "-avz", "--delete", "/data/src/", "backup@host:/data/dst/"}
+	for i := 0; i < b.N; i++ {
+		_, _ = shellquote.Quote(args...)
+	}
+}
+
+func BenchmarkQuoteEscaped(b *testing.B) {
+	args := []string{"FOO=bar baz", "grep", "-e", "it's a ''trap''", "file name.txt"}
+	for i := 0; i < b.N; i++ {
+		_, _ = shellquote.Quote(args...)
+	}
+}
@@ -0,0 +1,121 @@
+package shellquote
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrUnterminatedSingleQuote is returned from Split if a single quote is not closed.
+	ErrUnterminatedSingleQuote = errors.New("unterminated single-quoted string")
+	// ErrUnterminatedDoubleQuote is returned from Split if a double quote is not closed.
+	ErrUnterminatedDoubleQuote = errors.New("unterminated double-quoted string")
+	// ErrUnterminatedEscape is returned from Split if the input ends with a backslash.
+	ErrUnterminatedEscape = errors.New("unterminated backslash-escape")
+)
+
+const (
+	splitChars        = " \n\t"
+	singleChar        = '\''
+	doubleChar        = '"'
+	escapeChar        = '\\'
+	doubleEscapeChars = "$`\"\n\\"
+	commentChar       = '#'
+)
+
+// Split splits a string into words according to the POSIX shell rules of
+// quoting, so that commands entered by users can be executed without a shell.
+//
+// Single quotes preserve everything up to the next single quote, double quotes
+// preserve everything except backslash-escapes of $ ` " \ and newline, and a
+// backslash outside of quotes preserves the next character. A backslash-newline
+// pair is a line continuation. A # at the beginning of a word starts a comment
+// which lasts to the end of the line.
+//
+// No expansion of variables, globs or command substitutions is performed, they
+// are kept literally.
+func Split(s string) ([]string, error) {
+	var (
+		words  []string
+		word   strings.Builder
+		inWord bool
+	)
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case strings.IndexByte(splitChars, c) >= 0:
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == commentChar && !inWord:
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case c == escapeChar:
+			if i+1 >= len(s) {
+				return nil, ErrUnterminatedEscape
+			}
+			i++
+			if s[i] == '\n' {
+				continue // line continuation
+			}
+			word.WriteByte(s[i])
+			inWord = true
+		case c == singleChar:
+			end := strings.IndexByte(s[i+1:], singleChar)
+			if end < 0 {
+				return nil, ErrUnterminatedSingleQuote
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == doubleChar:
+			n, err := splitDoubleQuoted(s[i+1:], &word)
+			if err != nil {
+				return nil, err
+			}
+			i += n + 1
+			inWord = true
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
+
+// splitDoubleQuoted writes the content of the double-quoted string s, which
+// starts right after the opening quote, to word and returns the offset of the closing quote.
+func splitDoubleQuoted(s string, word *strings.Builder) (int, error) {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case doubleChar:
+			return i, nil
+		case escapeChar:
+			if i+1 >= len(s) {
+				return 0, ErrUnterminatedDoubleQuote
+			}
+			switch next := s[i+1]; {
+			case next == '\n':
+				i++ // line continuation
+			case strings.IndexByte(doubleEscapeChars, next) >= 0:
+				word.WriteByte(next)
+				i++
+			default:
+				word.WriteByte(c)
+			}
+		default:
+			word.WriteByte(c)
+		}
+	}
+
+	return 0, ErrUnterminatedDoubleQuote
+}
@@ -0,0 +1,56 @@
+package shellquote_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bingoohuang/gocmd/shellquote"
+)
+
+func testSplit(t *testing.T, in string, expected []string) {
+	t.Helper()
+	ret, err := shellquote.Split(in)
+	if err != nil {
+		t.Errorf("Split(%q) errored: %s", in, err)
+		return
+	}
+	Equal(t, ret, expected, "wrong split of "+in)
+}
+
+func TestSplit(t *testing.T) {
+	t.Parallel()
+
+	testSplit(t, ``, nil)
+	testSplit(t, `  `, nil)
+	testSplit(t, `foo`, []string{"foo"})
+	testSplit(t, ` foo  bar	baz `, []string{"foo", "bar", "baz"})
+	testSplit(t, `'foo bar'`, []string{"foo bar"})
+	testSplit(t, `''`, []string{""})
+	testSplit(t, `""`, []string{""})
+	testSplit(t, `'foo'\''bar'`, []string{"foo'bar"})
+	testSplit(t, `a'b'"c"d`, []string{"abcd"})
+	testSplit(t, `foo\ bar`, []string{"foo bar"})
+	testSplit(t, `"a \"b\" \$c \\ \d"`, []string{`a "b" $c \ \d`})
+	testSplit(t, `'a \"b'`, []string{`a \"b`})
+	testSplit(t, "foo \\\nbar", []string{"foo", "bar"})
+	testSplit(t, "\"foo\\\nbar\"", []string{"foobar"})
+	testSplit(t, "foo # comment\nbar", []string{"foo", "bar"})
+	testSplit(t, "foo#bar", []string{"foo#bar"})
+	testSplit(t, "echo $HOME *.go", []string{"echo", "$HOME", "*.go"})
+}
+
+func TestSplitErrors(t *testing.T) {
+	t.Parallel()
+
+	for in, expected := range map[string]error{
+		`'foo`:    shellquote.ErrUnterminatedSingleQuote,
+		`"foo`:    shellquote.ErrUnterminatedDoubleQuote,
+		`"foo\"`:  shellquote.ErrUnterminatedDoubleQuote,
+		`foo\`:    shellquote.ErrUnterminatedEscape,
+		`a 'b' "`: shellquote.ErrUnterminatedDoubleQuote,
+	} {
+		if _, err := shellquote.Split(in); !errors.Is(err, expected) {
+			t.Errorf("Split(%q) err should be %v; was %v", in, expected, err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package shellquote
+
+import (
+	"strings"
+)
+
+// QuoteWindows will return a command line for the passed tokens which
+// CommandLineToArgvW and the MSVC runtime parse back into the same tokens.
+//
+// Tokens without white space or double quotes are kept as they are. Other
+// tokens are wrapped in double quotes, embedded double quotes are escaped by
+// backslashes, and backslashes are doubled where they precede a double quote,
+// which is the one case they are special in.
+//
+// These are the rules of the programs receiving the arguments, cmd.exe has
+// its own metacharacters on top of them.
+func QuoteWindows(in ...string) (string, error) {
+	tmp := make([]string, len(in))
+	for i, x := range in {
+		if strings.Contains(x, "\x00") {
+			return "", ErrNull
+		}
+		tmp[i] = quoteWindowsArg(x)
+	}
+
+	return strings.Join(tmp, " "), nil
+}
+
+func quoteWindowsArg(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n\v\"") {
+		return s
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+	slashes := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			slashes++
+		case '"':
+			b.WriteString(strings.Repeat(`\`, 2*slashes+1))
+			b.WriteByte(c)
+			slashes = 0
+		default:
+			b.WriteString(strings.Repeat(`\`, slashes))
+			b.WriteByte(c)
+			slashes = 0
+		}
+	}
+	// double the trailing backslashes, so that they do not escape the closing quote
+	b.WriteString(strings.Repeat(`\`, 2*slashes))
+	b.WriteByte('"')
+
+	return b.String()
+}
+
+// SplitWindows splits a Windows command line into arguments the way
+// CommandLineToArgvW and the MSVC runtime do:
+//
+//   - arguments are separated by spaces or tabs outside of double quotes;
+//   - 2n backslashes followed by a double quote produce n backslashes and the
+//     quote starts or ends a quoted part;
+//   - 2n+1 backslashes followed by a double quote produce n backslashes and a
+//     literal double quote;
+//   - backslashes not followed by a double quote are literal;
+//   - two double quotes inside a quoted part produce a literal double quote
+//     and end the quoted part, the pre-2008 rule CommandLineToArgvW keeps.
+//
+// An unterminated quoted part lasts to the end of the command line, like on Windows.
+// Unlike CommandLineToArgvW, the first argument is parsed by the same rules as
+// the others instead of the simpler rules for program names.
+func SplitWindows(s string) []string {
+	var args []string
+	for len(s) > 0 {
+		if s[0] == ' ' || s[0] == '\t' {
+			s = s[1:]
+			continue
+		}
+
+		var arg string
+		arg, s = nextWindowsArg(s)
+		args = append(args, arg)
+	}
+
+	return args
+}
+
+func nextWindowsArg(s string) (arg, rest string) {
+	var (
+		b       strings.Builder
+		inQuote bool
+		slashes int
+	)
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case ' ', '\t':
+			if !inQuote {
+				b.WriteString(strings.Repeat(`\`, slashes))
+				return b.String(), s[i+1:]
+			}
+		case '\\':
+			slashes++
+			continue
+		case '"':
+			b.WriteString(strings.Repeat(`\`, slashes/2))
+			if slashes%2 == 1 {
+				b.WriteByte(c)
+			} else if inQuote && i+1 < len(s) && s[i+1] == '"' {
+				b.WriteByte(c)
+				i++
+				inQuote = false
+			} else {
+				inQuote = !inQuote
+			}
+			slashes = 0
+			continue
+		}
+
+		b.WriteString(strings.Repeat(`\`, slashes))
+		slashes = 0
+		b.WriteByte(s[i])
+	}
+
+	b.WriteString(strings.Repeat(`\`, slashes))
+	return b.String(), ""
+}
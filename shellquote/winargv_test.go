@@ -0,0 +1,67 @@
+package shellquote_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bingoohuang/gocmd/shellquote"
+)
+
+func TestQuoteWindows(t *testing.T) {
+	t.Parallel()
+
+	for _, c := range []struct {
+		in       []string
+		expected string
+	}{
+		{[]string{""}, `""`},
+		{[]string{"foo", "bar"}, `foo bar`},
+		{[]string{`C:\Program Files\x`}, `"C:\Program Files\x"`},
+		{[]string{`C:\dir\`}, `C:\dir\`},
+		{[]string{`C:\my dir\`}, `"C:\my dir\\"`},
+		{[]string{`say "hi"`}, `"say \"hi\""`},
+		{[]string{`a\"b`}, `"a\\\"b"`},
+		{[]string{`a\\b c`}, `"a\\b c"`},
+	} {
+		ret, err := shellquote.QuoteWindows(c.in...)
+		if err != nil {
+			t.Errorf("QuoteWindows errored: %s", err)
+			continue
+		}
+		Equal(t, ret, c.expected, "wrong quote")
+	}
+
+	if _, err := shellquote.QuoteWindows("\x00"); !errors.Is(err, shellquote.ErrNull) {
+		t.Errorf("err should be ErrNull; was %s", err)
+	}
+}
+
+func TestSplitWindows(t *testing.T) {
+	t.Parallel()
+
+	for in, expected := range map[string][]string{
+		``:                     nil,
+		`foo  bar`:             {"foo", "bar"},
+		`"a b" c`:              {"a b", "c"},
+		`""`:                   {""},
+		`a\\b`:                 {`a\\b`},
+		`a\\\"b`:               {`a\"b`},
+		`a\\\\"b c"`:           {`a\\b c`},
+		`"a""b"`:               {`a"b`},
+		`"unterminated quote `: {`unterminated quote `},
+		"tab\tsep":             {"tab", "sep"},
+	} {
+		Equal(t, shellquote.SplitWindows(in), expected, "wrong split of "+in)
+	}
+}
+
+func TestQuoteWindowsRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	args := []string{"", "plain", `C:\my dir\`, `"`, `\"`, `a "b" c`, `\\server\share\`, "tab\there", `""`}
+	line, err := shellquote.QuoteWindows(args...)
+	if err != nil {
+		t.Fatalf("QuoteWindows errored: %s", err)
+	}
+	Equal(t, shellquote.SplitWindows(line), args, "round trip of "+line)
+}
@@ -0,0 +1,255 @@
+package gocmd
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/bingoohuang/gocmd/linestream"
+)
+
+// Sink receives the output of a command. It is started when the command is
+// run and closed after, it may be written by stdout and stderr at the same time.
+// FileSink is one, Lines adapts a LineSink to one.
+type Sink interface {
+	io.Writer
+	Start() error
+	Close() error
+}
+
+// LineSink receives the output of a command line by line, without the line endings.
+type LineSink interface {
+	Start() error
+	WriteLine(line string) error
+	Close() error
+}
+
+// WithStdoutSink also writes stdout to the sink.
+//
+// Example:
+//
+//	c := gocmd.New("make", gocmd.WithStdoutSink(gocmd.ChanSink(lines)))
+func WithStdoutSink(s Sink) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.sinks = append(c.sinks, s)
+		c.stdoutWriters = append(c.stdoutWriters, streamWriter(s))
+	}
+}
+
+// WithStderrSink also writes stderr to the sink.
+func WithStderrSink(s Sink) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.sinks = append(c.sinks, s)
+		c.stderrWriters = append(c.stderrWriters, streamWriter(s))
+	}
+}
+
+// WithCombinedSink also writes stdout and stderr to the sink.
+func WithCombinedSink(s Sink) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.sinks = append(c.sinks, s)
+		c.stdoutWriters = append(c.stdoutWriters, streamWriter(s))
+		c.stderrWriters = append(c.stderrWriters, streamWriter(s))
+	}
+}
+
+// streamer is implemented by sinks keeping state per stream, like the
+// unterminated last line, which are written by a writer per stream then.
+type streamer interface {
+	stream() io.Writer
+}
+
+// streamWriter returns the writer of a stream to the sink.
+func streamWriter(s Sink) io.Writer {
+	if st, ok := s.(streamer); ok {
+		return st.stream()
+	}
+	return s
+}
+
+// startSinks starts the sinks, closing the started ones on errors.
+func (c *Cmd) startSinks() error {
+	for i, s := range c.sinks {
+		if err := s.Start(); err != nil {
+			for _, o := range c.sinks[:i] {
+				_ = o.Close()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Cmd) closeSinks() {
+	for _, s := range c.sinks {
+		_ = s.Close()
+	}
+}
+
+// Lines adapts the LineSink to a Sink, splitting the output into lines.
+// The last line is written on Close even if it is not terminated.
+// The first error of WriteLine is returned by Close, Write never fails so
+// that the command is not stopped by a failing sink.
+func Lines(s LineSink) Sink {
+	l := &lineSink{sink: s}
+	l.lines = l.newStream()
+	return l
+}
+
+type lineSink struct {
+	mu      sync.Mutex
+	sink    LineSink
+	lines   *linestream.LineStream // of Write
+	streams []*linestream.LineStream
+	err     error
+}
+
+func (l *lineSink) newStream() *linestream.LineStream {
+	lines := linestream.New(func(line string) {
+		if err := l.sink.WriteLine(line); err != nil && l.err == nil {
+			l.err = err
+		}
+	})
+	l.streams = append(l.streams, lines)
+	return lines
+}
+
+func (l *lineSink) stream() io.Writer {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return &lineStream{l: l, lines: l.newStream()}
+}
+
+// lineStream writes a stream to a lineSink, split into lines by its own LineStream.
+type lineStream struct {
+	l     *lineSink
+	lines *linestream.LineStream
+}
+
+func (s *lineStream) Write(p []byte) (int, error) {
+	s.l.mu.Lock()
+	defer s.l.mu.Unlock()
+
+	return s.lines.Write(p)
+}
+
+func (l *lineSink) Start() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.err = nil
+	return l.sink.Start()
+}
+
+func (l *lineSink) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.lines.Write(p)
+}
+
+// Flush writes the unterminated last lines, and flushes the LineSink if it is a Flusher.
+func (l *lineSink) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, lines := range l.streams {
+		lines.Flush()
+	}
+	if f, ok := l.sink.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (l *lineSink) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, lines := range l.streams {
+		lines.Flush()
+	}
+	return errors.Join(l.err, l.sink.Close())
+}
+
+// MultiSink returns a Sink writing to all the sinks, like io.MultiWriter.
+// Start starts them all, closing the started ones if one fails,
+// Close closes them all and returns their errors joined.
+func MultiSink(sinks ...Sink) Sink {
+	return multiSink(append([]Sink(nil), sinks...))
+}
+
+type multiSink []Sink
+
+func (m multiSink) Start() error {
+	for i, s := range m {
+		if err := s.Start(); err != nil {
+			for _, o := range m[:i] {
+				_ = o.Close()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiSink) Write(p []byte) (int, error) {
+	for _, s := range m {
+		n, err := s.Write(p)
+		if err != nil {
+			return n, err
+		}
+		if n != len(p) {
+			return n, io.ErrShortWrite
+		}
+	}
+	return len(p), nil
+}
+
+func (m multiSink) stream() io.Writer {
+	writers := make([]io.Writer, len(m))
+	for i, s := range m {
+		writers[i] = streamWriter(s)
+	}
+	return io.MultiWriter(writers...)
+}
+
+func (m multiSink) Flush() error {
+	var errs []error
+	for _, s := range m {
+		if f, ok := s.(Flusher); ok {
+			errs = append(errs, f.Flush())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m multiSink) Close() error {
+	var errs []error
+	for _, s := range m {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// ChanSink returns a Sink sending the lines of the output to ch, blocking the
+// command while ch is full. The channel is not closed.
+//
+// Example:
+//
+//	lines := make(chan string, 100)
+//	c := gocmd.New("tail -f app.log", gocmd.WithStdoutSink(gocmd.ChanSink(lines)))
+func ChanSink(ch chan<- string) Sink {
+	return Lines(chanSink(ch))
+}
+
+type chanSink chan<- string
+
+func (chanSink) Start() error { return nil }
+func (chanSink) Close() error { return nil }
+
+func (c chanSink) WriteLine(line string) error {
+	c <- line
+	return nil
+}
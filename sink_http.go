@@ -0,0 +1,293 @@
+package gocmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HTTPSink is a Sink posting the lines of the output as JSON batches to an
+// HTTP endpoint, to collect the logs of commands run on many hosts, like
+//
+//	{"labels": {"job": "backup"}, "lines": [{"time": "2006-01-02T15:04:05.999999999Z", "line": "hello"}]}
+//
+// Lines are buffered and posted in the background, a failed post is retried
+// with an exponential backoff. Lines beyond the buffer, and the ones not posted
+// when the sink is closed after a failure, are dropped and counted.
+type HTTPSink struct {
+	URL    string
+	Client *http.Client
+	Header http.Header
+	// Labels are sent with every batch.
+	Labels map[string]string
+	// BatchSize is the maximum number of lines of a post, 100 by default.
+	BatchSize int
+	// FlushInterval is how long lines wait for a batch to fill, 1s by default.
+	FlushInterval time.Duration
+	// BufferSize is the maximum number of lines buffered, 10000 by default.
+	BufferSize int
+	// MaxBackoff is the maximum delay between retries, 30s by default.
+	MaxBackoff time.Duration
+	// CloseTimeout is how long Close keeps retrying to post the buffered lines, 5s by default.
+	CloseTimeout time.Duration
+
+	lines Sink
+
+	mu      sync.Mutex
+	buf     []httpLine
+	kick    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	lastErr error
+
+	sent, dropped int64
+}
+
+type httpLine struct {
+	Time time.Time `json:"time"`
+	Line string    `json:"line"`
+}
+
+// NewHTTPSink creates an HTTPSink posting to url.
+//
+// Example:
+//
+//	s := gocmd.NewHTTPSink("https://logs.example.com/ingest", gocmd.HTTPLabels(map[string]string{"job": "backup"}))
+//	c := gocmd.New("./backup.sh", gocmd.WithCombinedSink(s))
+func NewHTTPSink(url string, options ...func(*HTTPSink)) *HTTPSink {
+	s := &HTTPSink{
+		URL:           url,
+		Client:        &http.Client{Timeout: 10 * time.Second},
+		Header:        http.Header{},
+		BatchSize:     100,
+		FlushInterval: time.Second,
+		BufferSize:    10000,
+		MaxBackoff:    30 * time.Second,
+		CloseTimeout:  5 * time.Second,
+	}
+	for _, o := range options {
+		o(s)
+	}
+	s.lines = Lines(httpLines{s})
+	return s
+}
+
+// HTTPHeader sets a header of the posts, like Authorization.
+func HTTPHeader(key, value string) func(*HTTPSink) {
+	return func(s *HTTPSink) {
+		s.Header.Set(key, value)
+	}
+}
+
+// HTTPLabels sets the labels sent with every batch.
+func HTTPLabels(labels map[string]string) func(*HTTPSink) {
+	return func(s *HTTPSink) {
+		s.Labels = labels
+	}
+}
+
+// HTTPBatch sets the maximum lines of a post, and how long lines wait for a batch to fill.
+func HTTPBatch(size int, interval time.Duration) func(*HTTPSink) {
+	return func(s *HTTPSink) {
+		s.BatchSize, s.FlushInterval = size, interval
+	}
+}
+
+// HTTPBuffer sets the maximum number of lines buffered.
+func HTTPBuffer(lines int) func(*HTTPSink) {
+	return func(s *HTTPSink) {
+		s.BufferSize = lines
+	}
+}
+
+// Sent returns the number of lines posted.
+func (s *HTTPSink) Sent() int64 { return atomic.LoadInt64(&s.sent) }
+
+// Dropped returns the number of lines dropped.
+func (s *HTTPSink) Dropped() int64 { return atomic.LoadInt64(&s.dropped) }
+
+// Start starts posting in the background.
+func (s *HTTPSink) Start() error { return s.lines.Start() }
+
+// Write buffers the lines of p, it never fails.
+func (s *HTTPSink) Write(p []byte) (int, error) { return s.lines.Write(p) }
+
+// Close posts the buffered lines and stops. If they are not posted within
+// CloseTimeout, the remaining lines are dropped and the last error is returned.
+func (s *HTTPSink) Close() error { return s.lines.Close() }
+
+// Flush buffers the unterminated last lines, posted in the background.
+func (s *HTTPSink) Flush() error { return s.lines.(Flusher).Flush() }
+
+func (s *HTTPSink) stream() io.Writer { return streamWriter(s.lines) }
+
+// httpLines is the LineSink of an HTTPSink.
+type httpLines struct{ s *HTTPSink }
+
+func (h httpLines) Start() error {
+	s := h.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.kick = make(chan struct{}, 1)
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	s.lastErr = nil
+	go s.run()
+	return nil
+}
+
+func (h httpLines) WriteLine(line string) error {
+	s := h.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.buf) >= s.BufferSize {
+		atomic.AddInt64(&s.dropped, 1)
+		return nil
+	}
+	s.buf = append(s.buf, httpLine{Time: time.Now(), Line: line})
+	if len(s.buf) >= s.BatchSize {
+		select {
+		case s.kick <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (h httpLines) Close() error {
+	s := h.s
+	close(s.stop)
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n := len(s.buf); n > 0 {
+		atomic.AddInt64(&s.dropped, int64(n))
+		s.buf = nil
+		return fmt.Errorf("post %s: %d lines dropped: %w", s.URL, n, s.lastErr)
+	}
+	return nil
+}
+
+// run posts the buffered lines when a batch is full or every FlushInterval,
+// and all of them when stopped, until CloseTimeout elapsed then.
+func (s *HTTPSink) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.FlushInterval)
+	defer ticker.Stop()
+
+	var backoff time.Duration
+	var deadline time.Time
+	stopping := false
+	for {
+		select {
+		case <-s.kick:
+		case <-ticker.C:
+		case <-s.stop:
+			stopping, deadline = true, time.Now().Add(s.CloseTimeout)
+		}
+
+		for {
+			s.mu.Lock()
+			n := len(s.buf)
+			if n > s.BatchSize {
+				n = s.BatchSize
+			}
+			batch := append([]httpLine(nil), s.buf[:n]...)
+			s.mu.Unlock()
+			if n == 0 {
+				break
+			}
+
+			if err := s.post(batch); err != nil {
+				s.mu.Lock()
+				s.lastErr = err
+				s.mu.Unlock()
+				backoff = nextBackoff(backoff, s.MaxBackoff)
+				if stopping {
+					left := time.Until(deadline)
+					if left <= 0 {
+						return
+					}
+					if backoff > left {
+						backoff = left
+					}
+					time.Sleep(backoff)
+					continue
+				}
+
+				select {
+				case <-time.After(backoff):
+				case <-s.stop:
+					stopping, deadline = true, time.Now().Add(s.CloseTimeout)
+				}
+				continue
+			}
+
+			backoff = 0
+			atomic.AddInt64(&s.sent, int64(n))
+			s.mu.Lock()
+			s.buf = s.buf[:copy(s.buf, s.buf[n:])]
+			s.mu.Unlock()
+			if n < s.BatchSize && !stopping {
+				break
+			}
+		}
+
+		if stopping {
+			return
+		}
+	}
+}
+
+func (s *HTTPSink) post(batch []httpLine) error {
+	body, err := json.Marshal(struct {
+		Labels map[string]string `json:"labels,omitempty"`
+		Lines  []httpLine        `json:"lines"`
+	}{Labels: s.Labels, Lines: batch})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range s.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	_, _ = io.Copy(io.Discard, rsp.Body)
+
+	if rsp.StatusCode/100 != 2 {
+		return fmt.Errorf("post %s: %s", s.URL, rsp.Status)
+	}
+	return nil
+}
+
+func nextBackoff(d, max time.Duration) time.Duration {
+	if d == 0 {
+		d = 100 * time.Millisecond
+	} else {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
@@ -0,0 +1,88 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+type ingest struct {
+	mu      sync.Mutex
+	fails   int
+	batches [][]string
+	labels  map[string]string
+	auth    string
+}
+
+func (g *ingest) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.fails > 0 {
+		g.fails--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	var body struct {
+		Labels map[string]string `json:"labels"`
+		Lines  []struct {
+			Line string `json:"line"`
+		} `json:"lines"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var lines []string
+	for _, l := range body.Lines {
+		lines = append(lines, l.Line)
+	}
+	g.batches = append(g.batches, lines)
+	g.labels, g.auth = body.Labels, r.Header.Get("Authorization")
+}
+
+func TestHTTPSink(t *testing.T) {
+	g := &ingest{fails: 2}
+	srv := httptest.NewServer(g)
+	defer srv.Close()
+
+	s := gocmd.NewHTTPSink(srv.URL,
+		gocmd.HTTPLabels(map[string]string{"job": "test"}),
+		gocmd.HTTPHeader("Authorization", "Bearer secret"),
+		gocmd.HTTPBatch(2, 10*time.Millisecond))
+	c := gocmd.New("echo a; echo b >&2; echo c; printf d", gocmd.WithCombinedSink(s))
+	assert.Nil(t, c.Run(context.TODO()))
+
+	var lines []string
+	for _, b := range g.batches {
+		assert.LessOrEqual(t, len(b), 2)
+		lines = append(lines, b...)
+	}
+	assert.ElementsMatch(t, []string{"a", "b", "c", "d"}, lines)
+	assert.Equal(t, map[string]string{"job": "test"}, g.labels)
+	assert.Equal(t, "Bearer secret", g.auth)
+	assert.Equal(t, int64(4), s.Sent())
+	assert.Equal(t, int64(0), s.Dropped())
+}
+
+func TestHTTPSinkDrops(t *testing.T) {
+	srv := httptest.NewServer(&ingest{fails: 1000})
+	defer srv.Close()
+
+	s := gocmd.NewHTTPSink(srv.URL, gocmd.HTTPBuffer(3))
+	s.CloseTimeout = 200 * time.Millisecond
+	c := gocmd.New("seq 5", gocmd.WithStdoutSink(s))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, int64(0), s.Sent())
+	assert.Equal(t, int64(5), s.Dropped())
+}
@@ -0,0 +1,84 @@
+package gocmd
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Publisher publishes messages to subjects of a message broker.
+// The *Conn of github.com/nats-io/nats.go and of the nats package of gocmd
+// implement it, a Kafka producer can be adapted by a PublisherFunc using the
+// subject as the topic or the message key.
+type Publisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// PublisherFunc adapts a function to a Publisher.
+//
+// Example, with github.com/segmentio/kafka-go:
+//
+//	p := gocmd.PublisherFunc(func(subject string, data []byte) error {
+//		return w.WriteMessages(context.Background(), kafka.Message{Key: []byte(subject), Value: data})
+//	})
+type PublisherFunc func(subject string, data []byte) error
+
+// Publish calls f.
+func (f PublisherFunc) Publish(subject string, data []byte) error { return f(subject, data) }
+
+// PublishSink returns a Sink publishing the lines of the output as JSON events
+// to the subject by p, like
+//
+//	{"time": "2006-01-02T15:04:05.999999999Z", "line": "hello", "labels": {"tenant": "acme"}}
+//
+// The {key} placeholders of subject are replaced by the values of the labels,
+// "_" for missing ones, so that the events of commands are keyed by their labels.
+// Characters not allowed in subject tokens, like dots and spaces, are replaced by "_".
+// The Publisher is neither started nor closed by the sink.
+//
+// Example:
+//
+//	labels := map[string]string{"tenant": "acme"}
+//	c := gocmd.New("./etl.sh", gocmd.WithLabels(labels),
+//		gocmd.WithCombinedSink(gocmd.PublishSink(conn, "logs.{tenant}", labels)))
+func PublishSink(p Publisher, subject string, labels map[string]string) Sink {
+	return Lines(&publishSink{p: p, subject: expandSubject(subject, labels), labels: labels})
+}
+
+type publishSink struct {
+	p       Publisher
+	subject string
+	labels  map[string]string
+}
+
+func (s *publishSink) Start() error { return nil }
+func (s *publishSink) Close() error { return nil }
+
+func (s *publishSink) WriteLine(line string) error {
+	data, err := json.Marshal(struct {
+		Time   time.Time         `json:"time"`
+		Line   string            `json:"line"`
+		Labels map[string]string `json:"labels,omitempty"`
+	}{Time: time.Now(), Line: line, Labels: s.labels})
+	if err != nil {
+		return err
+	}
+	return s.p.Publish(s.subject, data)
+}
+
+var (
+	subjectPlaceholder = regexp.MustCompile(`\{([^{}]+)}`)
+	subjectReplacer    = strings.NewReplacer(".", "_", " ", "_", "\t", "_", "*", "_", ">", "_")
+)
+
+// expandSubject replaces the {key} placeholders of subject by the values of labels.
+func expandSubject(subject string, labels map[string]string) string {
+	return subjectPlaceholder.ReplaceAllStringFunc(subject, func(m string) string {
+		v := labels[m[1:len(m)-1]]
+		if v == "" {
+			return "_"
+		}
+		return subjectReplacer.Replace(v)
+	})
+}
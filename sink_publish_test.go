@@ -0,0 +1,33 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishSink(t *testing.T) {
+	var subjects, lines []string
+	p := gocmd.PublisherFunc(func(subject string, data []byte) error {
+		var event struct {
+			Line   string            `json:"line"`
+			Labels map[string]string `json:"labels"`
+		}
+		assert.Nil(t, json.Unmarshal(data, &event))
+		assert.Equal(t, "a.b", event.Labels["tenant"])
+		subjects, lines = append(subjects, subject), append(lines, event.Line)
+		return nil
+	})
+
+	labels := map[string]string{"tenant": "a.b"}
+	c := gocmd.New("echo hello; echo world", gocmd.WithLabels(labels),
+		gocmd.WithStdoutSink(gocmd.PublishSink(p, "logs.{tenant}.{purpose}", labels)))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, []string{"hello", "world"}, lines)
+	assert.Equal(t, []string{"logs.a_b._", "logs.a_b._"}, subjects)
+}
@@ -0,0 +1,359 @@
+package gocmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// S3Sink is a Sink streaming the output gzipped to an object of S3, or of a
+// storage with an S3 compatible API like MinIO or GCS with HMAC keys, by a
+// multipart upload, so that huge outputs are kept without a disk holding
+// them. A part is uploaded by the Write filling it, which waits for the
+// upload, at most PartSize bytes are buffered. The object is complete once the
+// sink is closed, the upload is aborted if a part failed.
+//
+// Example:
+//
+//	s := gocmd.NewS3Sink("https://s3.eu-west-1.amazonaws.com", "logs", "jobs/42.log.gz",
+//		gocmd.S3Region("eu-west-1"), gocmd.S3Credentials(os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")))
+//	c := gocmd.New("./backup.sh", gocmd.WithCombinedSink(s), gocmd.WithMaxBuffer(1<<20))
+//	if err := c.Run(ctx); err == nil && s.Err() == nil {
+//		history.Log(c.Status(), s.Ref())
+//	}
+type S3Sink struct {
+	// Endpoint is the URL of the storage, the objects are addressed by path, like endpoint/bucket/key.
+	Endpoint string
+	Bucket   string
+	Key      string
+	// Region is the region of the bucket, us-east-1 by default, auto for GCS.
+	Region                             string
+	AccessKey, SecretKey, SessionToken string
+	Client                             *http.Client
+	// PartSize is the size of the uploaded parts, 8MiB by default, at least 5MiB but the last one.
+	PartSize int
+
+	mu       sync.Mutex
+	uploadID string
+	parts    []s3Part
+	buf      bytes.Buffer // compressed, not uploaded yet
+	gz       *gzip.Writer
+	size     int64 // compressed bytes written
+	err      error
+}
+
+type s3Part struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// NewS3Sink creates an S3Sink writing the object of the key in the bucket.
+func NewS3Sink(endpoint, bucket, key string, options ...func(*S3Sink)) *S3Sink {
+	s := &S3Sink{
+		Endpoint: strings.TrimSuffix(endpoint, "/"),
+		Bucket:   bucket,
+		Key:      key,
+		Region:   "us-east-1",
+		Client:   &http.Client{Timeout: 5 * time.Minute},
+		PartSize: 8 << 20,
+	}
+	for _, o := range options {
+		o(s)
+	}
+	return s
+}
+
+// S3Region sets the region of the bucket.
+func S3Region(region string) func(*S3Sink) {
+	return func(s *S3Sink) {
+		s.Region = region
+	}
+}
+
+// S3Credentials sets the access key and the secret key signing the requests.
+func S3Credentials(accessKey, secretKey string) func(*S3Sink) {
+	return func(s *S3Sink) {
+		s.AccessKey, s.SecretKey = accessKey, secretKey
+	}
+}
+
+// S3PartSize sets the size of the uploaded parts.
+func S3PartSize(n int) func(*S3Sink) {
+	return func(s *S3Sink) {
+		s.PartSize = n
+	}
+}
+
+// Ref returns the reference of the object, like s3://bucket/key, to keep instead of the output.
+func (s *S3Sink) Ref() string {
+	return "s3://" + s.Bucket + "/" + s.Key
+}
+
+// Size returns the number of compressed bytes written.
+func (s *S3Sink) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.size
+}
+
+// Err returns the error of the upload, to check after the command ran,
+// whose Run does not fail by the errors of its sinks.
+func (s *S3Sink) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+// Start initiates the multipart upload.
+func (s *S3Sink) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.parts, s.err, s.size = nil, nil, 0
+	s.buf.Reset()
+	s.gz = gzip.NewWriter(&s.buf)
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := s.do(http.MethodPost, url.Values{"uploads": {""}}, nil, &result); err != nil {
+		return fmt.Errorf("s3 sink: create upload of %s: %w", s.Ref(), err)
+	}
+	s.uploadID = result.UploadID
+	return nil
+}
+
+// Write compresses p, uploading a part once PartSize bytes are buffered.
+func (s *S3Sink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return 0, s.err
+	}
+	if _, err := s.gz.Write(p); err != nil {
+		return 0, err
+	}
+	for s.buf.Len() >= s.partSize() {
+		if err := s.uploadPart(s.buf.Next(s.partSize())); err != nil {
+			s.err = err
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close uploads the last part and completes the upload, or aborts it after a failure.
+func (s *S3Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.uploadID == "" {
+		return s.err
+	}
+	uploadID := url.Values{"uploadId": {s.uploadID}}
+	defer func() { s.uploadID = "" }()
+
+	if s.err == nil {
+		if err := s.gz.Close(); err != nil {
+			s.err = err
+		} else if err := s.uploadPart(s.buf.Next(s.buf.Len())); err != nil {
+			s.err = err
+		}
+	}
+	if s.err != nil {
+		_ = s.do(http.MethodDelete, uploadID, nil, nil)
+		return s.err
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}{Parts: s.parts})
+	if err != nil {
+		return err
+	}
+	if err := s.do(http.MethodPost, uploadID, body, nil); err != nil {
+		s.err = fmt.Errorf("s3 sink: complete upload of %s: %w", s.Ref(), err)
+		_ = s.do(http.MethodDelete, uploadID, nil, nil)
+	}
+	return s.err
+}
+
+func (s *S3Sink) partSize() int {
+	if s.PartSize < 5<<20 {
+		return 5 << 20
+	}
+	return s.PartSize
+}
+
+func (s *S3Sink) uploadPart(data []byte) error {
+	n := len(s.parts) + 1
+	query := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {s.uploadID}}
+	req, err := s.request(http.MethodPut, query, data)
+	if err != nil {
+		return err
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("s3 sink: upload part %d of %s: %w", n, s.Ref(), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("s3 sink: upload part %d of %s: %w", n, s.Ref(), s3Error(resp))
+	}
+
+	s.parts = append(s.parts, s3Part{PartNumber: n, ETag: resp.Header.Get("ETag")})
+	s.size += int64(len(data))
+	return nil
+}
+
+// do sends a request, decoding the XML response into result if not nil.
+func (s *S3Sink) do(method string, query url.Values, body []byte, result interface{}) error {
+	req, err := s.request(method, query, body)
+	if err != nil {
+		return err
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return s3Error(resp)
+	}
+	if result != nil {
+		return xml.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
+
+// request returns the request of the object, signed by AWS Signature Version 4.
+func (s *S3Sink) request(method string, query url.Values, body []byte) (*http.Request, error) {
+	path := "/" + s.Bucket + "/" + s.Key
+	u, err := url.Parse(s.Endpoint + s3Escape(path) + "?" + s3Query(query))
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+	signS3(req, s3Hash(body), s.AccessKey, s.SecretKey, s.Region, time.Now())
+	return req, nil
+}
+
+// signS3 signs the request by AWS Signature Version 4, with its headers and the host.
+func signS3(req *http.Request, payloadHash, accessKey, secretKey, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3Query(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + s3Hash([]byte(canonicalRequest))
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func s3Hash(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// s3Escape escapes the path as S3 expects it, all but the unreserved characters and slashes.
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3Query returns the canonical query, sorted by key, keeping the = of empty values.
+func s3Query(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, strings.ReplaceAll(s3Escape(k), "/", "%2F")+"="+strings.ReplaceAll(s3Escape(v), "/", "%2F"))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Error returns the error of a response, by the message of its XML error if any.
+func s3Error(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var e struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.Unmarshal(body, &e) == nil && e.Code != "" {
+		return fmt.Errorf("%s: %s: %s", resp.Status, e.Code, e.Message)
+	}
+	return errors.New(resp.Status)
+}
@@ -0,0 +1,121 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 is a storage of a single multipart upload.
+type fakeS3 struct {
+	mu      sync.Mutex
+	parts   map[string][]byte
+	object  []byte
+	aborted bool
+	failPut bool
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AK/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	q := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		f.parts = map[string][]byte{}
+		fmt.Fprint(w, "<InitiateMultipartUploadResult><UploadId>u1</UploadId></InitiateMultipartUploadResult>")
+	case r.Method == http.MethodPut && q.Get("uploadId") == "u1":
+		if f.failPut {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, "<Error><Code>InternalError</Code><Message>oops</Message></Error>")
+			return
+		}
+		f.parts[q.Get("partNumber")], _ = io.ReadAll(r.Body)
+		w.Header().Set("ETag", `"etag`+q.Get("partNumber")+`"`)
+	case r.Method == http.MethodPost && q.Get("uploadId") == "u1":
+		var complete struct {
+			Parts []struct {
+				PartNumber string
+				ETag       string
+			} `xml:"Part"`
+		}
+		_ = xml.NewDecoder(r.Body).Decode(&complete)
+		for _, p := range complete.Parts {
+			f.object = append(f.object, f.parts[p.PartNumber]...)
+		}
+	case r.Method == http.MethodDelete:
+		f.aborted = true
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func gunzip(t *testing.T, b []byte) []byte {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	assert.Nil(t, err)
+	out, err := io.ReadAll(r)
+	assert.Nil(t, err)
+	return out
+}
+
+func TestS3Sink(t *testing.T) {
+	f := &fakeS3{}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	s := gocmd.NewS3Sink(srv.URL, "logs", "jobs/42.log.gz", gocmd.S3Credentials("AK", "SK"))
+	c := gocmd.New("echo hello; echo world >&2", gocmd.WithCombinedSink(s))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Nil(t, s.Err())
+	assert.Equal(t, "s3://logs/jobs/42.log.gz", s.Ref())
+	// the lines of stdout and stderr may be in any order
+	lines := strings.SplitAfter(string(gunzip(t, f.object)), "\n")
+	sort.Strings(lines)
+	assert.Equal(t, []string{"", "hello\n", "world\n"}, lines)
+	assert.Equal(t, int64(len(f.object)), s.Size())
+
+	// incompressible, more than a part
+	data := make([]byte, 6<<20)
+	_, _ = rand.Read(data)
+	s = gocmd.NewS3Sink(srv.URL, "logs", "big.gz", gocmd.S3Credentials("AK", "SK"), gocmd.S3PartSize(5<<20))
+	f.object = nil
+	assert.Nil(t, s.Start())
+	_, err := s.Write(data)
+	assert.Nil(t, err)
+	assert.Nil(t, s.Close())
+	assert.Len(t, f.parts, 2)
+	assert.Equal(t, data, gunzip(t, f.object))
+}
+
+func TestS3SinkAbort(t *testing.T) {
+	f := &fakeS3{failPut: true}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	s := gocmd.NewS3Sink(srv.URL, "logs", "failed.gz", gocmd.S3Credentials("AK", "SK"))
+	assert.Nil(t, s.Start())
+	_, err := s.Write([]byte("hello\n"))
+	assert.Nil(t, err)
+	assert.ErrorContains(t, s.Close(), "InternalError: oops")
+	assert.True(t, f.aborted)
+	assert.Nil(t, f.object)
+}
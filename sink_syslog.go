@@ -0,0 +1,46 @@
+//go:build !windows && !plan9
+
+package gocmd
+
+import "log/syslog"
+
+// SyslogSink returns a Sink writing the lines of the output to syslog with
+// the priority and tag, connected by syslog.Dial to raddr by network,
+// or to the local syslog server if network is empty.
+//
+// Example:
+//
+//	c := gocmd.New("./backup.sh", gocmd.WithCombinedSink(gocmd.SyslogSink("", "", syslog.LOG_INFO|syslog.LOG_DAEMON, "backup")))
+func SyslogSink(network, raddr string, priority syslog.Priority, tag string) Sink {
+	return Lines(&syslogSink{network: network, raddr: raddr, priority: priority, tag: tag})
+}
+
+type syslogSink struct {
+	network, raddr string
+	priority       syslog.Priority
+	tag            string
+	w              *syslog.Writer
+}
+
+func (s *syslogSink) Start() error {
+	w, err := syslog.Dial(s.network, s.raddr, s.priority, s.tag)
+	if err != nil {
+		return err
+	}
+	s.w = w
+	return nil
+}
+
+func (s *syslogSink) WriteLine(line string) error {
+	_, err := s.w.Write([]byte(line))
+	return err
+}
+
+func (s *syslogSink) Close() error {
+	if s.w == nil {
+		return nil
+	}
+	err := s.w.Close()
+	s.w = nil
+	return err
+}
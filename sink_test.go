@@ -0,0 +1,90 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"errors"
+	"log/syslog"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordSink struct {
+	lines           []string
+	started, closed int
+	err             error
+}
+
+func (s *recordSink) Start() error { s.started++; return nil }
+func (s *recordSink) Close() error { s.closed++; return s.err }
+
+func (s *recordSink) WriteLine(line string) error {
+	s.lines = append(s.lines, line)
+	return nil
+}
+
+func TestSinks(t *testing.T) {
+	out, all := &recordSink{}, &recordSink{}
+	ch := make(chan string, 10)
+	c := gocmd.New("echo a; echo b >&2; printf c",
+		gocmd.WithStdoutSink(gocmd.MultiSink(gocmd.Lines(out), gocmd.ChanSink(ch))),
+		gocmd.WithCombinedSink(gocmd.Lines(all)))
+	assert.Nil(t, c.Run(context.TODO()))
+
+	assert.Equal(t, []string{"a", "c"}, out.lines)
+	assert.Equal(t, 1, out.started)
+	assert.Equal(t, 1, out.closed)
+
+	sort.Strings(all.lines)
+	assert.Equal(t, []string{"a", "b", "c"}, all.lines)
+
+	close(ch)
+	var got []string
+	for line := range ch {
+		got = append(got, line)
+	}
+	assert.Equal(t, []string{"a", "c"}, got)
+}
+
+func TestMultiSinkClose(t *testing.T) {
+	a, b := &recordSink{err: errors.New("a failed")}, &recordSink{}
+	m := gocmd.MultiSink(gocmd.Lines(a), gocmd.Lines(b))
+	assert.Nil(t, m.Start())
+	_, err := m.Write([]byte("x\ny"))
+	assert.Nil(t, err)
+
+	err = m.Close()
+	assert.True(t, strings.Contains(err.Error(), "a failed"))
+	assert.Equal(t, []string{"x", "y"}, b.lines)
+	assert.Equal(t, 1, b.closed)
+}
+
+func TestSyslogSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	c := gocmd.New("echo hello; echo oops >&2",
+		gocmd.WithCombinedSink(gocmd.SyslogSink("udp", conn.LocalAddr().String(), syslog.LOG_INFO|syslog.LOG_USER, "gocmd-test")))
+	assert.Nil(t, c.Run(context.TODO()))
+
+	var got []string
+	buf := make([]byte, 1024)
+	for i := 0; i < 2; i++ {
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		assert.Nil(t, err)
+		got = append(got, string(buf[:n]))
+	}
+	all := strings.Join(got, "")
+	assert.Contains(t, all, "gocmd-test")
+	assert.Contains(t, all, " hello\n")
+	assert.Contains(t, all, " oops\n")
+}
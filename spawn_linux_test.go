@@ -0,0 +1,47 @@
+package gocmd_test
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+)
+
+// heap keeps the allocated heap of a benchmark reachable.
+var heap [][]byte
+
+// BenchmarkSpawn measures the latency of running /bin/true with parent heaps
+// of growing sizes. os/exec spawns by clone(CLONE_VM|CLONE_VFORK) on Linux,
+// like posix_spawn of glibc, the page tables of the parent are not copied, so
+// the latency does not grow with the heap, unlike with fork.
+func BenchmarkSpawn(b *testing.B) {
+	for _, mb := range []int{0, 64, 512} {
+		heap = make([][]byte, mb)
+		for i := range heap {
+			heap[i] = make([]byte, 1<<20)
+			for j := 0; j < len(heap[i]); j += 4096 {
+				heap[i][j] = 1 // touch the pages
+			}
+		}
+		runtime.GC()
+
+		b.Run(fmt.Sprintf("exec/heap=%dMB", mb), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := exec.Command("/bin/true").Run(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("gocmd/heap=%dMB", mb), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := gocmd.New("", gocmd.WithCmd(exec.Command("/bin/true"))).Run(context.TODO()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+	heap = nil
+}
@@ -0,0 +1,228 @@
+package gocmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Spec is a declarative spec of a command, parsed from YAML or JSON by
+// FromSpec, so that commands can be defined in config files and run by
+// generic runners, and servers accepting commands share its schema, like
+// the JobRequest of the server package.
+//
+// Example:
+//
+//	command: pg_dump -Fc app
+//	timeout: 30m
+//	retries: 2
+//	retry_delay: 10s
+//	env: {PGHOST: db.internal}
+//	limits: {max_buffer: 65536, io_write_bps: 10485760}
+//	sinks: {stdout: /backup/app.dump}
+type Spec struct {
+	// Name is the name of a job of a BatchSpec.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Command is run by the shell, Args are executed directly if Command is empty.
+	Command string   `json:"command,omitempty" yaml:"command,omitempty"`
+	Args    []string `json:"args,omitempty" yaml:"args,omitempty"`
+	// Shell runs Command instead of the default shell, see WithShell.
+	Shell   string            `json:"shell,omitempty" yaml:"shell,omitempty"`
+	Workdir string            `json:"workdir,omitempty" yaml:"workdir,omitempty"`
+	Env     map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	// Timeout is a duration like "5m", DefaultTimeout if empty, "0" for none.
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Retries int    `json:"retries,omitempty" yaml:"retries,omitempty"`
+	// RetryDelay is a duration like "10s", see RetryPolicy.
+	RetryDelay       string     `json:"retry_delay,omitempty" yaml:"retry_delay,omitempty"`
+	RetryOnExitCodes []int      `json:"retry_on_exit_codes,omitempty" yaml:"retry_on_exit_codes,omitempty"`
+	Limits           SpecLimits `json:"limits,omitempty" yaml:"limits,omitempty"`
+	Sinks            SpecSinks  `json:"sinks,omitempty" yaml:"sinks,omitempty"`
+}
+
+// SpecLimits are the limits of a Spec.
+type SpecLimits struct {
+	// MaxBuffer bounds the buffered output, see WithMaxBuffer.
+	MaxBuffer int `json:"max_buffer,omitempty" yaml:"max_buffer,omitempty"`
+	// KillAfter is a duration like "10s", see WithKillAfter.
+	KillAfter   string `json:"kill_after,omitempty" yaml:"kill_after,omitempty"`
+	CPUs        []int  `json:"cpus,omitempty" yaml:"cpus,omitempty"`
+	OOMScoreAdj *int   `json:"oom_score_adj,omitempty" yaml:"oom_score_adj,omitempty"`
+	IOReadBps   int64  `json:"io_read_bps,omitempty" yaml:"io_read_bps,omitempty"`
+	IOWriteBps  int64  `json:"io_write_bps,omitempty" yaml:"io_write_bps,omitempty"`
+	NoNetwork   bool   `json:"no_network,omitempty" yaml:"no_network,omitempty"`
+}
+
+// SpecSinks are the sinks of a Spec, the outputs are written to files at
+// the paths, and their lines posted to the HTTP URL with the labels.
+type SpecSinks struct {
+	Stdout   string `json:"stdout,omitempty" yaml:"stdout,omitempty"`
+	Stderr   string `json:"stderr,omitempty" yaml:"stderr,omitempty"`
+	Combined string `json:"combined,omitempty" yaml:"combined,omitempty"`
+	HTTP     string `json:"http,omitempty" yaml:"http,omitempty"`
+}
+
+// BatchSpec is a declarative spec of a Batch, parsed by BatchFromSpec.
+//
+// Example:
+//
+//	parallel: 2
+//	halt_on_error: true
+//	jobs:
+//	  - {name: web, command: make web}
+//	  - {name: api, command: make api, timeout: 10m}
+type BatchSpec struct {
+	Parallel    int    `json:"parallel,omitempty" yaml:"parallel,omitempty"`
+	HaltOnError bool   `json:"halt_on_error,omitempty" yaml:"halt_on_error,omitempty"`
+	MaxFailures int    `json:"max_failures,omitempty" yaml:"max_failures,omitempty"`
+	Jobs        []Spec `json:"jobs" yaml:"jobs"`
+}
+
+// FromSpec creates a command of the spec, in YAML or JSON. Unknown fields
+// are errors, so that typos are not silently ignored, and invalid ones are
+// reported by SpecErrors, see Spec.Validate.
+//
+// Example:
+//
+//	data, _ := os.ReadFile("backup.yaml")
+//	c, err := gocmd.FromSpec(data)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	c.Run(ctx)
+func FromSpec(data []byte, options ...func(*Cmd)) (*Cmd, error) {
+	var s Spec
+	if err := decodeSpec(data, &s); err != nil {
+		return nil, err
+	}
+	return s.Cmd(options...)
+}
+
+// BatchFromSpec creates a batch and its jobs of the batch spec, in YAML or
+// JSON, to be run by b.Run(ctx, jobs...). The options are applied to the
+// commands of all jobs, after the ones of their specs.
+func BatchFromSpec(data []byte, options ...func(*Cmd)) (*Batch, []BatchJob, error) {
+	var s BatchSpec
+	if err := decodeSpec(data, &s); err != nil {
+		return nil, nil, err
+	}
+	if err := s.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	jobs := make([]BatchJob, 0, len(s.Jobs))
+	for _, js := range s.Jobs {
+		c, err := js.Cmd(options...)
+		if err != nil {
+			return nil, nil, err
+		}
+		jobs = append(jobs, BatchJob{Name: js.Name, Cmd: c})
+	}
+	b := &Batch{Parallel: s.Parallel, HaltOnError: s.HaltOnError, MaxFailures: s.MaxFailures}
+	return b, jobs, nil
+}
+
+// decodeSpec decodes the YAML or JSON data, JSON being YAML too.
+func decodeSpec(data []byte, v interface{}) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parse spec: %w", err)
+	}
+	return nil
+}
+
+// Cmd creates the command of the spec, the options are applied after the
+// ones of the spec.
+func (s Spec) Cmd(options ...func(*Cmd)) (*Cmd, error) {
+	specOptions, err := s.Options()
+	if err != nil {
+		return nil, err
+	}
+	return New(s.Command, append(specOptions, options...)...), nil
+}
+
+// Options returns the options of the spec, for callers creating the command
+// themselves, like with options of their own applied before them. Settings
+// not specified have no option, like the timeout, so that the ones applied
+// before are kept. The spec is validated first, see Validate.
+func (s Spec) Options() ([]func(*Cmd), error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	// parsed durations are valid ones
+	var options []func(*Cmd)
+	switch {
+	case len(s.Args) > 0:
+		options = append(options, WithCmd(exec.Command(s.Args[0], s.Args[1:]...)))
+	case s.Shell != "":
+		options = append(options, WithShell(s.Shell))
+	}
+
+	if s.Timeout != "" {
+		timeout, _ := time.ParseDuration(s.Timeout)
+		options = append(options, WithTimeout(timeout))
+	}
+	if s.Workdir != "" {
+		options = append(options, WithWorkingDir(s.Workdir))
+	}
+	if len(s.Env) > 0 {
+		options = append(options, WithEnv(s.Env))
+	}
+	if len(s.Labels) > 0 {
+		options = append(options, WithLabels(s.Labels))
+	}
+	if s.Retries > 0 {
+		p := RetryPolicy{Retries: s.Retries, OnExitCodes: s.RetryOnExitCodes}
+		p.Delay, _ = time.ParseDuration(s.RetryDelay)
+		options = append(options, WithRetry(p))
+	}
+
+	options = append(options, s.Limits.options()...)
+
+	if s.Sinks.Stdout != "" {
+		options = append(options, WithStdoutFile(s.Sinks.Stdout))
+	}
+	if s.Sinks.Stderr != "" {
+		options = append(options, WithStderrFile(s.Sinks.Stderr))
+	}
+	if s.Sinks.Combined != "" {
+		options = append(options, WithCombinedFile(s.Sinks.Combined))
+	}
+	if s.Sinks.HTTP != "" {
+		options = append(options, WithCombinedSink(NewHTTPSink(s.Sinks.HTTP, HTTPLabels(s.Labels))))
+	}
+	return options, nil
+}
+
+// options returns the options of the limits.
+func (l SpecLimits) options() []func(*Cmd) {
+	var options []func(*Cmd)
+	if l.MaxBuffer > 0 {
+		options = append(options, WithMaxBuffer(l.MaxBuffer))
+	}
+	if l.KillAfter != "" {
+		d, _ := time.ParseDuration(l.KillAfter)
+		options = append(options, WithKillAfter(d))
+	}
+	if len(l.CPUs) > 0 {
+		options = append(options, WithCPUAffinity(l.CPUs...))
+	}
+	if l.OOMScoreAdj != nil {
+		options = append(options, WithOOMScoreAdj(*l.OOMScoreAdj))
+	}
+	if l.IOReadBps > 0 || l.IOWriteBps > 0 {
+		options = append(options, WithIOThrottle(l.IOReadBps, l.IOWriteBps))
+	}
+	if l.NoNetwork {
+		options = append(options, WithNoNetwork())
+	}
+	return options
+}
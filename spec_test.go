@@ -0,0 +1,73 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromSpec(t *testing.T) {
+	out := t.TempDir() + "/out.log"
+	c, err := gocmd.FromSpec([]byte(`
+command: echo $GREETING from $PWD
+workdir: /tmp
+env: {GREETING: hello}
+labels: {purpose: test}
+timeout: 5s
+retries: 2
+retry_delay: 10ms
+limits: {max_buffer: 1024}
+sinks: {stdout: ` + out + `}
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, 5*time.Second, c.Timeout)
+	assert.Equal(t, "test", c.Labels()["purpose"])
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, "hello from /tmp\n", c.Stdout())
+	data, err := os.ReadFile(out)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello from /tmp\n", string(data))
+
+	c, err = gocmd.FromSpec([]byte(`{"args": ["echo", "$HOME"], "timeout": "0"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), c.Timeout)
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, "$HOME\n", c.Stdout())
+
+	_, err = gocmd.FromSpec([]byte(`{"command": "true", "timeot": "5s"}`))
+	assert.ErrorContains(t, err, "field timeot not found")
+	_, err = gocmd.FromSpec([]byte(`{"command": "true", "timeout": "5"}`))
+	assert.EqualError(t, err, `timeout: invalid duration "5", like 30s or 5m`)
+	_, err = gocmd.FromSpec([]byte(`{"command": "true", "args": ["true"]}`))
+	assert.EqualError(t, err, "args: command and args are exclusive")
+	_, err = gocmd.FromSpec(nil)
+	assert.EqualError(t, err, "command: command or args required")
+}
+
+func TestBatchFromSpec(t *testing.T) {
+	b, jobs, err := gocmd.BatchFromSpec([]byte(`
+parallel: 2
+halt_on_error: true
+jobs:
+  - {name: a, command: echo a}
+  - {name: b, command: exit 3, timeout: 1m}
+`), gocmd.WithLabels(map[string]string{"tenant": "acme"}))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, b.Parallel)
+	assert.True(t, b.HaltOnError)
+	assert.Len(t, jobs, 2)
+
+	results := b.Run(context.TODO(), jobs...)
+	assert.Equal(t, "a\n", results[0].Cmd.Stdout())
+	assert.Equal(t, 3, results[1].ExitCode)
+	assert.Equal(t, "acme", results[1].Labels["tenant"])
+
+	_, _, err = gocmd.BatchFromSpec([]byte(`jobs: [{name: a, command: true, retry_delay: soon, retries: 1}]`))
+	assert.EqualError(t, err, `jobs[0].retry_delay: invalid duration "soon", like 30s or 5m`)
+}
@@ -0,0 +1,174 @@
+package gocmd
+
+import (
+	_ "embed"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SpecSchema is the JSON Schema of a Spec, for UIs and APIs accepting
+// command specs to validate them before submission. Its $defs.batch is the
+// one of a BatchSpec.
+//
+//go:embed spec.schema.json
+var SpecSchema []byte
+
+// SpecError is an invalid field of a spec.
+type SpecError struct {
+	// Path is the path of the field, like limits.kill_after or jobs[1].timeout.
+	Path    string
+	Message string
+}
+
+func (e *SpecError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// SpecErrors are all invalid fields of a spec, returned by Validate.
+type SpecErrors []*SpecError
+
+func (e SpecErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// specErrors collects the SpecErrors of a spec.
+type specErrors struct {
+	prefix string
+	errs   SpecErrors
+}
+
+func (v *specErrors) add(path, format string, args ...interface{}) {
+	v.errs = append(v.errs, &SpecError{Path: v.prefix + path, Message: fmt.Sprintf(format, args...)})
+}
+
+// duration checks a duration field, not negative.
+func (v *specErrors) duration(path, s string) {
+	if s == "" {
+		return
+	}
+	if d, err := time.ParseDuration(s); err != nil {
+		v.add(path, "invalid duration %q, like 30s or 5m", s)
+	} else if d < 0 {
+		v.add(path, "negative duration %s", s)
+	}
+}
+
+func (v *specErrors) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// Validate checks the spec, it returns the SpecErrors of all invalid fields,
+// with their paths, so that UIs can point at them.
+//
+// Example:
+//
+//	if err := spec.Validate(); err != nil {
+//		var errs gocmd.SpecErrors
+//		errors.As(err, &errs) // limits.kill_after: invalid duration "10", like 30s or 5m
+//	}
+func (s Spec) Validate() error {
+	var v specErrors
+	s.validate(&v)
+	return v.err()
+}
+
+func (s Spec) validate(v *specErrors) {
+	switch {
+	case s.Command == "" && len(s.Args) == 0:
+		v.add("command", "command or args required")
+	case s.Command != "" && len(s.Args) > 0:
+		v.add("args", "command and args are exclusive")
+	case len(s.Args) > 0 && s.Args[0] == "":
+		v.add("args[0]", "empty executable")
+	case len(s.Args) > 0 && s.Shell != "":
+		v.add("shell", "shell runs command only, not args")
+	}
+
+	for k := range s.Env {
+		if k == "" || strings.ContainsAny(k, "=\x00") {
+			v.add("env", "invalid name %q", k)
+		}
+	}
+	for k := range s.Labels {
+		if k == "" {
+			v.add("labels", "empty name")
+		}
+	}
+
+	v.duration("timeout", s.Timeout)
+	if s.Retries < 0 {
+		v.add("retries", "negative retries %d", s.Retries)
+	}
+	v.duration("retry_delay", s.RetryDelay)
+	for i, code := range s.RetryOnExitCodes {
+		if code < 1 || code > 255 {
+			v.add(fmt.Sprintf("retry_on_exit_codes[%d]", i), "exit code %d out of 1..255", code)
+		}
+	}
+
+	s.Limits.validate(v)
+
+	if s.Sinks.HTTP != "" {
+		if u, err := url.Parse(s.Sinks.HTTP); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.add("sinks.http", "invalid URL %q, like https://logs.example.com/ingest", s.Sinks.HTTP)
+		}
+	}
+}
+
+func (l SpecLimits) validate(v *specErrors) {
+	if l.MaxBuffer < 0 {
+		v.add("limits.max_buffer", "negative size %d", l.MaxBuffer)
+	}
+	v.duration("limits.kill_after", l.KillAfter)
+	for i, cpu := range l.CPUs {
+		if cpu < 0 {
+			v.add(fmt.Sprintf("limits.cpus[%d]", i), "negative cpu %d", cpu)
+		}
+	}
+	if l.OOMScoreAdj != nil && (*l.OOMScoreAdj < -1000 || *l.OOMScoreAdj > 1000) {
+		v.add("limits.oom_score_adj", "%d out of -1000..1000", *l.OOMScoreAdj)
+	}
+	if l.IOReadBps < 0 {
+		v.add("limits.io_read_bps", "negative rate %d", l.IOReadBps)
+	}
+	if l.IOWriteBps < 0 {
+		v.add("limits.io_write_bps", "negative rate %d", l.IOWriteBps)
+	}
+}
+
+// Validate checks the batch spec and the specs of its jobs, see Spec.Validate.
+func (s BatchSpec) Validate() error {
+	var v specErrors
+	if s.Parallel < 0 {
+		v.add("parallel", "negative parallel %d", s.Parallel)
+	}
+	if s.MaxFailures < 0 {
+		v.add("max_failures", "negative max_failures %d", s.MaxFailures)
+	}
+	if len(s.Jobs) == 0 {
+		v.add("jobs", "jobs required")
+	}
+
+	names := map[string]int{}
+	for i, job := range s.Jobs {
+		v.prefix = fmt.Sprintf("jobs[%d].", i)
+		if job.Name == "" {
+			v.add("name", "name required")
+		} else if j, ok := names[job.Name]; ok {
+			v.add("name", "duplicate name %q of jobs[%d]", job.Name, j)
+		} else {
+			names[job.Name] = i
+		}
+		job.validate(&v)
+	}
+	return v.err()
+}
@@ -0,0 +1,90 @@
+package gocmd_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpecValidate(t *testing.T) {
+	adj := 2000
+	err := gocmd.Spec{
+		Args:             []string{"rsync"},
+		Shell:            "sh",
+		Env:              map[string]string{"A=B": "c"},
+		Timeout:          "-1s",
+		RetryOnExitCodes: []int{0},
+		Limits:           gocmd.SpecLimits{KillAfter: "10", OOMScoreAdj: &adj},
+		Sinks:            gocmd.SpecSinks{HTTP: "logs.example.com"},
+	}.Validate()
+
+	var errs gocmd.SpecErrors
+	assert.True(t, errors.As(err, &errs))
+	paths := make([]string, len(errs))
+	for i, e := range errs {
+		paths[i] = e.Path
+	}
+	assert.Equal(t, []string{"shell", "env", "timeout", "retry_on_exit_codes[0]",
+		"limits.kill_after", "limits.oom_score_adj", "sinks.http"}, paths)
+	assert.Contains(t, err.Error(), `limits.kill_after: invalid duration "10", like 30s or 5m; `)
+
+	assert.Nil(t, gocmd.Spec{Command: "make", Timeout: "0", Limits: gocmd.SpecLimits{KillAfter: "1m30s"}}.Validate())
+}
+
+func TestBatchSpecValidate(t *testing.T) {
+	err := gocmd.BatchSpec{Parallel: -1, Jobs: []gocmd.Spec{
+		{Name: "a", Command: "true"},
+		{Command: "true"},
+		{Name: "a"},
+	}}.Validate()
+	assert.EqualError(t, err, "parallel: negative parallel -1; jobs[1].name: name required; "+
+		`jobs[2].name: duplicate name "a" of jobs[0]; jobs[2].command: command or args required`)
+
+	assert.EqualError(t, gocmd.BatchSpec{}.Validate(), "jobs: jobs required")
+}
+
+func TestSpecSchema(t *testing.T) {
+	var schema struct {
+		Properties map[string]struct {
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"properties"`
+		Defs struct {
+			Batch struct {
+				Properties map[string]interface{} `json:"properties"`
+			} `json:"batch"`
+		} `json:"$defs"`
+	}
+	assert.Nil(t, json.Unmarshal(gocmd.SpecSchema, &schema))
+
+	// the schema is the one of the structs
+	assert.Equal(t, jsonFields(gocmd.Spec{}), sortedKeys(schema.Properties))
+	assert.Equal(t, jsonFields(gocmd.SpecLimits{}), sortedKeys(schema.Properties["limits"].Properties))
+	assert.Equal(t, jsonFields(gocmd.SpecSinks{}), sortedKeys(schema.Properties["sinks"].Properties))
+	assert.Equal(t, jsonFields(gocmd.BatchSpec{}), sortedKeys(schema.Defs.Batch.Properties))
+}
+
+func jsonFields(v interface{}) []string {
+	var names []string
+	typ := reflect.TypeOf(v)
+	for i := 0; i < typ.NumField(); i++ {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,278 @@
+package ssh
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bingoohuang/gocmd"
+)
+
+// Inventory lists the hosts to run commands on.
+type Inventory interface {
+	Hosts(ctx context.Context) ([]Host, error)
+}
+
+// InventoryFunc adapts a func, like the one of a cloud provider listing its
+// instances by tag, to an Inventory.
+type InventoryFunc func(ctx context.Context) ([]Host, error)
+
+// Hosts calls f(ctx).
+func (f InventoryFunc) Hosts(ctx context.Context) ([]Host, error) { return f(ctx) }
+
+// StaticInventory is an Inventory of a fixed list of hosts.
+type StaticInventory []Host
+
+// Hosts returns the hosts of the list.
+func (s StaticInventory) Hosts(context.Context) ([]Host, error) { return s, nil }
+
+// FileInventory returns an Inventory of the hosts in the file of the path, read
+// at each call of Hosts, one [user@]host[:port] per line, blank lines and lines
+// starting by # are ignored.
+func FileInventory(path string) Inventory {
+	return InventoryFunc(func(context.Context) ([]Host, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		hosts, err := readHosts(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return hosts, nil
+	})
+}
+
+func readHosts(r io.Reader) ([]Host, error) {
+	var hosts []Host
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		h, err := ParseHost(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, scanner.Err()
+}
+
+// FanOut runs a command on the hosts of an Inventory, a few hosts at a time,
+// and stops starting on further hosts once too many failed, like a rolling
+// change which breaks the first hosts it reaches.
+//
+// Example:
+//
+//	f := &ssh.FanOut{
+//		Executor:        ssh.Executor{ConnectTimeout: 5 * time.Second},
+//		Inventory:       ssh.FileInventory("hosts.txt"),
+//		Parallel:        10,
+//		MaxFailureRatio: 0.2, // stop if more than 20% of the hosts fail
+//	}
+//	report, err := f.Run(ctx, "systemctl restart app")
+//	fmt.Println(report)
+type FanOut struct {
+	Executor  Executor
+	Inventory Inventory
+	// Parallel is the maximum number of hosts running the command at the same time, 1 if less.
+	Parallel int
+	// MaxPerHost, if not zero, is the maximum number of commands running on the
+	// same host at the same time, by the concurrent Runs of the FanOut.
+	MaxPerHost int
+	// HaltOnError stops starting on further hosts after one failed.
+	HaltOnError bool
+	// MaxFailures, if not zero, stops starting on further hosts once more than
+	// MaxFailures hosts failed.
+	MaxFailures int
+	// MaxFailureRatio, if not zero, stops starting on further hosts once more
+	// than this ratio of the hosts failed, like 0.2 for 20%.
+	MaxFailureRatio float64
+	// Options are applied to the command of each host, like gocmd.WithTimeout.
+	Options []func(*gocmd.Cmd)
+	// Output, if not nil, receives the output lines of all hosts, prefixed by the host.
+	Output io.Writer
+	// NoColor disables the colors of the Output prefixes.
+	NoColor bool
+
+	mu    sync.Mutex
+	slots map[string]chan struct{} // by host, by MaxPerHost
+}
+
+// Report is the result of a FanOut run on the hosts of an inventory.
+type Report struct {
+	Command string
+	Hosts   []Host
+	// Results are the results of the hosts, in the order of Hosts.
+	Results []gocmd.BatchResult
+}
+
+// Run runs the command on the hosts of the inventory, and reports the result
+// of each host, the hosts not started on because too many failed are skipped.
+// It returns an error only if the inventory could not be listed.
+func (f *FanOut) Run(ctx context.Context, command string) (*Report, error) {
+	hosts, err := f.Inventory.Hosts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list inventory: %w", err)
+	}
+
+	jobs := make([]gocmd.BatchJob, len(hosts))
+	for i, h := range hosts {
+		jobs[i] = gocmd.BatchJob{Name: h.String(), Cmd: f.Executor.Command(h, command, f.Options...)}
+	}
+
+	var mu sync.Mutex
+	acquired := map[*gocmd.Cmd]string{}
+	b := gocmd.Batch{Parallel: f.Parallel, HaltOnError: f.HaltOnError, Output: f.Output, NoColor: f.NoColor}
+	if f.MaxFailures > 0 || f.MaxFailureRatio > 0 {
+		b.MaxFailures = f.maxFailures(len(hosts))
+		// not more than 0 failures
+		b.HaltOnError = b.HaltOnError || b.MaxFailures == 0
+	}
+	if f.MaxPerHost > 0 {
+		b.OnStart = func(job gocmd.BatchJob) {
+			if f.acquire(ctx, job.Name) {
+				mu.Lock()
+				acquired[job.Cmd] = job.Name
+				mu.Unlock()
+			}
+		}
+		b.OnDone = func(r gocmd.BatchResult) {
+			mu.Lock()
+			host, ok := acquired[r.Cmd]
+			mu.Unlock()
+			if ok {
+				f.release(host)
+			}
+		}
+	}
+
+	return &Report{Command: command, Hosts: hosts, Results: b.Run(ctx, jobs...)}, nil
+}
+
+// maxFailures returns the failures allowed on n hosts, the lower of
+// MaxFailures and MaxFailureRatio of n.
+func (f *FanOut) maxFailures(n int) int {
+	max := f.MaxFailures
+	if f.MaxFailureRatio > 0 {
+		if m := int(f.MaxFailureRatio * float64(n)); f.MaxFailures == 0 || m < max {
+			max = m
+		}
+	}
+	return max
+}
+
+// acquire waits for a slot of the host, it tells if it got one before ctx is done.
+func (f *FanOut) acquire(ctx context.Context, host string) bool {
+	f.mu.Lock()
+	if f.slots == nil {
+		f.slots = map[string]chan struct{}{}
+	}
+	slots, ok := f.slots[host]
+	if !ok {
+		slots = make(chan struct{}, f.MaxPerHost)
+		f.slots[host] = slots
+	}
+	f.mu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (f *FanOut) release(host string) {
+	f.mu.Lock()
+	slots := f.slots[host]
+	f.mu.Unlock()
+	<-slots
+}
+
+// Succeeded returns the hosts the command succeeded on.
+func (r *Report) Succeeded() []Host {
+	return r.hosts(func(res gocmd.BatchResult) bool { return !res.Failed() })
+}
+
+// Failed returns the hosts the command failed on, not the skipped ones.
+func (r *Report) Failed() []Host {
+	return r.hosts(func(res gocmd.BatchResult) bool { return res.Failed() && !res.Skipped })
+}
+
+// Skipped returns the hosts not started on, because too many hosts failed.
+func (r *Report) Skipped() []Host {
+	return r.hosts(func(res gocmd.BatchResult) bool { return res.Skipped })
+}
+
+// Unreachable returns the failed hosts ssh could not connect to, or
+// authenticate on, by its exit code ExitCodeSSHError.
+func (r *Report) Unreachable() []Host {
+	return r.hosts(func(res gocmd.BatchResult) bool { return !res.Skipped && res.ExitCode == ExitCodeSSHError })
+}
+
+func (r *Report) hosts(match func(gocmd.BatchResult) bool) []Host {
+	var hosts []Host
+	for i, res := range r.Results {
+		if match(res) {
+			hosts = append(hosts, r.Hosts[i])
+		}
+	}
+	return hosts
+}
+
+// ReportGroup is hosts of a Report which had the same result.
+type ReportGroup struct {
+	Hosts    []Host
+	ExitCode int
+	Skipped  bool
+	Stdout   string
+}
+
+// Groups groups the hosts by exit code and stdout, the largest groups first,
+// so that the odd ones out of a fleet stand out.
+func (r *Report) Groups() []ReportGroup {
+	type key struct {
+		exitCode int
+		skipped  bool
+		stdout   string
+	}
+	var groups []ReportGroup
+	index := map[key]int{}
+	for i, res := range r.Results {
+		k := key{exitCode: res.ExitCode, skipped: res.Skipped}
+		if !res.Skipped {
+			k.stdout = res.Cmd.Stdout()
+		}
+		j, ok := index[k]
+		if !ok {
+			j = len(groups)
+			index[k] = j
+			groups = append(groups, ReportGroup{ExitCode: k.exitCode, Skipped: k.skipped, Stdout: k.stdout})
+		}
+		groups[j].Hosts = append(groups[j].Hosts, r.Hosts[i])
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return len(groups[i].Hosts) > len(groups[j].Hosts) })
+	return groups
+}
+
+// String summarizes the report, like "10 hosts: 8 ok, 1 failed, 1 skipped".
+func (r *Report) String() string {
+	s := fmt.Sprintf("%d hosts: %d ok, %d failed", len(r.Hosts), len(r.Succeeded()), len(r.Failed()))
+	if n := len(r.Unreachable()); n > 0 {
+		s += fmt.Sprintf(" (%d unreachable)", n)
+	}
+	if n := len(r.Skipped()); n > 0 {
+		s += fmt.Sprintf(", %d skipped", n)
+	}
+	return s
+}
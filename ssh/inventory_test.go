@@ -0,0 +1,101 @@
+package ssh_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd/ssh"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSSH writes a fake ssh failing on the hosts named bad*, unreachable on
+// the ones named down*, and echoing the command on the others.
+func fakeSSH(t *testing.T) string {
+	fake := filepath.Join(t.TempDir(), "ssh")
+	script := "#!/bin/sh\ncase \"$4\" in bad*) exit 1;; down*) exit 255;; esac\necho \"$5\"\n"
+	assert.Nil(t, os.WriteFile(fake, []byte(script), 0o755))
+	return fake
+}
+
+func TestFileInventory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	assert.Nil(t, os.WriteFile(path, []byte("# web\nweb1\n\n  deploy@web2:2222\n"), 0o644))
+
+	hosts, err := ssh.FileInventory(path).Hosts(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, []ssh.Host{{Name: "web1"}, {User: "deploy", Name: "web2", Port: 2222}}, hosts)
+
+	assert.Nil(t, os.WriteFile(path, []byte("web1\nweb1:x\n"), 0o644))
+	_, err = ssh.FileInventory(path).Hosts(context.TODO())
+	assert.ErrorContains(t, err, "line 2")
+}
+
+func TestFanOut(t *testing.T) {
+	f := &ssh.FanOut{
+		Executor:  ssh.Executor{SSH: fakeSSH(t)},
+		Inventory: ssh.StaticInventory{{Name: "web1"}, {Name: "bad1"}, {Name: "web2"}, {Name: "down1"}},
+		Parallel:  2,
+	}
+	report, err := f.Run(context.TODO(), "uptime")
+	assert.Nil(t, err)
+	assert.Equal(t, []ssh.Host{{Name: "web1"}, {Name: "web2"}}, report.Succeeded())
+	assert.Equal(t, []ssh.Host{{Name: "bad1"}, {Name: "down1"}}, report.Failed())
+	assert.Equal(t, []ssh.Host{{Name: "down1"}}, report.Unreachable())
+	assert.Equal(t, "4 hosts: 2 ok, 2 failed (1 unreachable)", report.String())
+
+	groups := report.Groups()
+	assert.Len(t, groups, 3)
+	assert.Equal(t, ssh.ReportGroup{Hosts: []ssh.Host{{Name: "web1"}, {Name: "web2"}}, Stdout: "uptime\n"}, groups[0])
+
+	_, err = (&ssh.FanOut{Inventory: ssh.InventoryFunc(func(context.Context) ([]ssh.Host, error) {
+		return nil, os.ErrPermission
+	})}).Run(context.TODO(), "uptime")
+	assert.ErrorIs(t, err, os.ErrPermission)
+}
+
+func TestFanOutMaxFailureRatio(t *testing.T) {
+	f := &ssh.FanOut{
+		Executor: ssh.Executor{SSH: fakeSSH(t)},
+		Inventory: ssh.StaticInventory{
+			{Name: "bad1"}, {Name: "web1"}, {Name: "bad2"}, {Name: "web2"}, {Name: "web3"},
+			{Name: "web4"}, {Name: "web5"}, {Name: "web6"}, {Name: "web7"}, {Name: "web8"},
+		},
+		MaxFailureRatio: 0.1,
+	}
+	report, err := f.Run(context.TODO(), "uptime")
+	assert.Nil(t, err)
+	assert.Len(t, report.Failed(), 2)
+	assert.Len(t, report.Succeeded(), 1)
+	assert.Len(t, report.Skipped(), 7)
+	assert.Equal(t, "10 hosts: 1 ok, 2 failed, 7 skipped", report.String())
+}
+
+func TestFanOutMaxPerHost(t *testing.T) {
+	fake := filepath.Join(t.TempDir(), "ssh")
+	assert.Nil(t, os.WriteFile(fake, []byte("#!/bin/sh\nsleep 0.2\n"), 0o755))
+
+	f := &ssh.FanOut{
+		Executor:   ssh.Executor{SSH: fake},
+		Inventory:  ssh.StaticInventory{{Name: "web1"}},
+		MaxPerHost: 1,
+	}
+
+	// the runs on the same host wait for each other
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report, err := f.Run(context.TODO(), "uptime")
+			assert.Nil(t, err)
+			assert.Len(t, report.Succeeded(), 1)
+		}()
+	}
+	wg.Wait()
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+}
@@ -0,0 +1,180 @@
+package ssh
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+)
+
+// Pool runs the commands on a host over a single connection per host, kept
+// open between them, by the connection multiplexing of OpenSSH, so that tools
+// running many small remote commands do not pay for a connection and an
+// authentication each. The first command to a host opens the connection.
+//
+// Example:
+//
+//	p := &ssh.Pool{Executor: ssh.Executor{ConnectTimeout: 5 * time.Second}, MaxSessions: 8}
+//	defer p.Close()
+//	for _, f := range files {
+//		c, err := p.Run(ctx, host, "stat -c %s "+f)
+//		...
+//	}
+type Pool struct {
+	Executor Executor
+	// Dir is the directory of the control sockets of the connections, a
+	// temporary one removed by Close if empty. Its path must be short, sockets
+	// paths are limited to about 100 bytes.
+	Dir string
+	// Persist is how long a connection stays open once its last command exited, 10m if 0.
+	Persist time.Duration
+	// KeepAlive is the interval of the keepalives of the connections, which are
+	// closed after 3 of them are unanswered, 30s if 0.
+	KeepAlive time.Duration
+	// MaxSessions, if not zero, is the maximum number of commands run by Run
+	// over the connection of a host at the same time, the others wait. sshd
+	// refuses the sessions above its MaxSessions, 10 by default.
+	MaxSessions int
+
+	mu    sync.Mutex
+	dir   string                 // of the sockets, once created
+	hosts map[Host]chan struct{} // the hosts connected to, with their sessions by MaxSessions
+}
+
+// Command returns a command running the command line on the host over the
+// connection of the host, like Executor.Command. It does not wait for
+// MaxSessions, Run does.
+func (p *Pool) Command(h Host, command string, options ...func(*gocmd.Cmd)) (*gocmd.Cmd, error) {
+	e, err := p.executor(h)
+	if err != nil {
+		return nil, err
+	}
+	return e.Command(h, command, options...), nil
+}
+
+// Run runs the command line on the host over the connection of the host,
+// waiting for a session if MaxSessions are running. It returns the command,
+// nil if ctx was done before a session was free, and the error of its Run.
+func (p *Pool) Run(ctx context.Context, h Host, command string, options ...func(*gocmd.Cmd)) (*gocmd.Cmd, error) {
+	c, err := p.Command(h, command, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if sessions := p.sessions(h); sessions != nil {
+		select {
+		case sessions <- struct{}{}:
+			defer func() { <-sessions }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return c, c.Run(ctx)
+}
+
+// Close closes the connections, and removes the temporary directory of their sockets.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.dir == "" {
+		return nil
+	}
+	ssh := p.Executor.SSH
+	if ssh == "" {
+		ssh = "ssh"
+	}
+	for h := range p.hosts {
+		args := append(p.controlOptions(h), "-O", "exit", "--", h.destination())
+		// fails if the connection was already closed
+		_ = exec.Command(ssh, args...).Run()
+	}
+	p.hosts = nil
+
+	var err error
+	if p.Dir == "" {
+		err = os.RemoveAll(p.dir)
+	}
+	p.dir = ""
+	return err
+}
+
+// executor returns the executor of the connection of the host.
+func (p *Pool) executor(h Host) (*Executor, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.dir == "" {
+		if p.Dir != "" {
+			if err := os.MkdirAll(p.Dir, 0o700); err != nil {
+				return nil, err
+			}
+			p.dir = p.Dir
+		} else {
+			dir, err := os.MkdirTemp("", "gocmd-ssh-")
+			if err != nil {
+				return nil, err
+			}
+			p.dir = dir
+		}
+	}
+	if p.hosts == nil {
+		p.hosts = map[Host]chan struct{}{}
+	}
+	if _, ok := p.hosts[h]; !ok {
+		var sessions chan struct{}
+		if p.MaxSessions > 0 {
+			sessions = make(chan struct{}, p.MaxSessions)
+		}
+		p.hosts[h] = sessions
+	}
+
+	e := p.Executor
+	e.Options = append(append([]string(nil), e.Options...), p.multiplexOptions()...)
+	return &e, nil
+}
+
+func (p *Pool) sessions(h Host) chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.hosts[h]
+}
+
+// multiplexOptions returns the ssh options sharing the connection of a host.
+func (p *Pool) multiplexOptions() []string {
+	persist, keepAlive := p.Persist, p.KeepAlive
+	if persist <= 0 {
+		persist = 10 * time.Minute
+	}
+	if keepAlive <= 0 {
+		keepAlive = 30 * time.Second
+	}
+
+	return []string{
+		"ControlMaster=auto",
+		"ControlPath=" + filepath.Join(p.dir, "%C"),
+		"ControlPersist=" + strconv.Itoa(seconds(persist)),
+		"ServerAliveInterval=" + strconv.Itoa(seconds(keepAlive)),
+		"ServerAliveCountMax=3",
+	}
+}
+
+// controlOptions returns the ssh arguments controlling the connection of the host.
+func (p *Pool) controlOptions(h Host) []string {
+	args := []string{"-o", "ControlPath=" + filepath.Join(p.dir, "%C")}
+	if h.Port != 0 {
+		args = append(args, "-p", strconv.Itoa(h.Port))
+	}
+	return args
+}
+
+// seconds rounds the duration up to whole seconds.
+func seconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,52 @@
+package ssh_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd/ssh"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPool(t *testing.T) {
+	// a fake ssh logging its arguments
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	fake := filepath.Join(dir, "ssh")
+	assert.Nil(t, os.WriteFile(fake, []byte("#!/bin/sh\necho \"$@\" >> "+log+"\nsleep 0.1\n"), 0o755))
+
+	p := &ssh.Pool{Executor: ssh.Executor{SSH: fake}, Dir: filepath.Join(dir, "s"), MaxSessions: 1}
+	h := ssh.MustParseHost("web1")
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := p.Run(context.TODO(), h, "uptime")
+			assert.Nil(t, err)
+			assert.Equal(t, 0, c.ExitCode())
+		}()
+	}
+	wg.Wait()
+	// the sessions of the host wait for each other
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+	assert.Nil(t, p.Close())
+
+	lines, err := os.ReadFile(log)
+	assert.Nil(t, err)
+	control := "-o ControlPath=" + filepath.Join(dir, "s", "%C")
+	assert.Equal(t, []string{
+		"-o BatchMode=yes -o ControlMaster=auto " + control + " -o ControlPersist=600" +
+			" -o ServerAliveInterval=30 -o ServerAliveCountMax=3 -- web1 uptime",
+		"-o BatchMode=yes -o ControlMaster=auto " + control + " -o ControlPersist=600" +
+			" -o ServerAliveInterval=30 -o ServerAliveCountMax=3 -- web1 uptime",
+		control + " -O exit -- web1",
+	}, strings.Split(strings.TrimSpace(string(lines)), "\n"))
+}
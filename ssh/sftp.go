@@ -0,0 +1,127 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/bingoohuang/gocmd/shellquote"
+)
+
+// Staging tells the files uploaded before a command run by Executor.RunStaged,
+// and the artifacts fetched after it.
+type Staging struct {
+	// Files are the local files uploaded to the remote temporary directory, by
+	// their base name, with their modes, like scripts to run.
+	Files []string
+	// Artifacts are the remote paths, relative to the temporary directory,
+	// fetched after the command ran, even if it failed.
+	Artifacts []string
+	// ArtifactDir is the local directory the artifacts are fetched to, the current directory if empty.
+	ArtifactDir string
+	// Keep keeps the remote temporary directory, which is removed else.
+	Keep bool
+}
+
+// SFTPArgs returns the sftp arguments running the batch of sftp commands read
+// from stdin on the host, aborting on the first failing one.
+func (e *Executor) SFTPArgs(h Host) []string {
+	return append(e.options(h, "-P"), "-b", "-", "--", h.destination())
+}
+
+// SFTPBatch returns a command running the batch of sftp commands on the host,
+// like "put -p deploy.sh".
+func (e *Executor) SFTPBatch(h Host, batch string, options ...func(*gocmd.Cmd)) *gocmd.Cmd {
+	sftp := e.SFTP
+	if sftp == "" {
+		sftp = "sftp"
+	}
+
+	cmd := exec.Command(sftp, e.SFTPArgs(h)...)
+	cmd.Stdin = strings.NewReader(batch)
+	options = append([]func(*gocmd.Cmd){gocmd.WithCmd(cmd)}, options...)
+	return gocmd.New("", options...)
+}
+
+// RunStaged runs the command on the host in a remote temporary directory,
+// after the files of the staging were uploaded to it by sftp, then fetches
+// the artifacts and removes the directory. It returns the command run, nil if
+// it was not run because the staging failed, and the errors of the run and of
+// the staging.
+//
+// Example:
+//
+//	s := ssh.Staging{Files: []string{"collect.sh"}, Artifacts: []string{"report.tgz"}, ArtifactDir: "reports/web1"}
+//	c, err := e.RunStaged(ctx, ssh.MustParseHost("web1"), s, "./collect.sh report.tgz")
+func (e *Executor) RunStaged(ctx context.Context, h Host, s Staging, command string,
+	options ...func(*gocmd.Cmd),
+) (c *gocmd.Cmd, err error) {
+	mktemp := e.Command(h, "mktemp -d")
+	if err := succeed(ctx, mktemp); err != nil {
+		return nil, fmt.Errorf("create remote directory: %w", err)
+	}
+	dir := strings.TrimSpace(mktemp.Stdout())
+	if dir == "" {
+		return nil, errors.New("create remote directory: mktemp -d printed nothing")
+	}
+	if !s.Keep {
+		defer func() {
+			// even if ctx is done
+			rm := e.Command(h, "rm -rf -- "+shellquote.QuoteMust(dir))
+			if rmErr := succeed(context.Background(), rm); rmErr != nil {
+				err = errors.Join(err, fmt.Errorf("remove remote directory: %w", rmErr))
+			}
+		}()
+	}
+
+	if len(s.Files) > 0 {
+		var batch strings.Builder
+		for _, f := range s.Files {
+			fmt.Fprintf(&batch, "put -p %s %s\n", sftpQuote(f), sftpQuote(path.Join(dir, filepath.Base(f))))
+		}
+		if err := succeed(ctx, e.SFTPBatch(h, batch.String())); err != nil {
+			return nil, fmt.Errorf("upload files: %w", err)
+		}
+	}
+
+	c = e.Command(h, "cd "+shellquote.QuoteMust(dir)+" && "+command, options...)
+	runErr := c.Run(ctx)
+
+	var fetchErr error
+	if len(s.Artifacts) > 0 {
+		local := s.ArtifactDir
+		if local == "" {
+			local = "."
+		}
+		var batch strings.Builder
+		for _, a := range s.Artifacts {
+			fmt.Fprintf(&batch, "get -p %s %s\n", sftpQuote(path.Join(dir, a)), sftpQuote(filepath.Join(local, path.Base(a))))
+		}
+		if err := succeed(ctx, e.SFTPBatch(h, batch.String())); err != nil {
+			fetchErr = fmt.Errorf("fetch artifacts: %w", err)
+		}
+	}
+	return c, errors.Join(runErr, fetchErr)
+}
+
+// succeed runs the command, a non-zero exit code is an error with its stderr.
+func succeed(ctx context.Context, c *gocmd.Cmd) error {
+	if err := c.Run(ctx); err != nil {
+		return err
+	}
+	if code := c.ExitCode(); code != 0 {
+		return fmt.Errorf("exit code %d: %s", code, strings.TrimSpace(c.Stderr()))
+	}
+	return nil
+}
+
+// sftpQuote quotes the path for a sftp batch, in double quotes escaping
+// backslashes and double quotes.
+func sftpQuote(p string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(p) + `"`
+}
@@ -0,0 +1,70 @@
+package ssh_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/gocmd/ssh"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRemote returns an Executor whose ssh and sftp run locally, the remote
+// host being the local one.
+func fakeRemote(t *testing.T) ssh.Executor {
+	dir := t.TempDir()
+	fakeSSH := filepath.Join(dir, "ssh")
+	assert.Nil(t, os.WriteFile(fakeSSH, []byte("#!/bin/sh\neval last=\\${$#}\nexec sh -c \"$last\"\n"), 0o755))
+	fakeSFTP := filepath.Join(dir, "sftp")
+	script := `#!/bin/sh
+while read -r op flag src dst; do
+	src=${src#\"}; src=${src%\"}; dst=${dst#\"}; dst=${dst%\"}
+	cp -p "$src" "$dst" || exit 1
+done
+`
+	assert.Nil(t, os.WriteFile(fakeSFTP, []byte(script), 0o755))
+	return ssh.Executor{SSH: fakeSSH, SFTP: fakeSFTP}
+}
+
+func TestExecutorSFTPArgs(t *testing.T) {
+	e := ssh.Executor{IdentityFile: "id_ed25519"}
+	assert.Equal(t, []string{"-o", "BatchMode=yes", "-i", "id_ed25519", "-P", "2222", "-b", "-", "--", "deploy@web1"},
+		e.SFTPArgs(ssh.MustParseHost("deploy@web1:2222")))
+}
+
+func TestRunStaged(t *testing.T) {
+	e := fakeRemote(t)
+	local := t.TempDir()
+	script := filepath.Join(local, "collect.sh")
+	assert.Nil(t, os.WriteFile(script, []byte("#!/bin/sh\npwd > where\necho collected > report.txt\n"), 0o755))
+
+	artifacts := t.TempDir()
+	s := ssh.Staging{Files: []string{script}, Artifacts: []string{"report.txt", "where"}, ArtifactDir: artifacts}
+	c, err := e.RunStaged(context.TODO(), ssh.MustParseHost("web1"), s, "./collect.sh")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, c.ExitCode())
+
+	report, err := os.ReadFile(filepath.Join(artifacts, "report.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, "collected\n", string(report))
+
+	// the remote directory is removed
+	where, err := os.ReadFile(filepath.Join(artifacts, "where"))
+	assert.Nil(t, err)
+	_, err = os.Stat(strings.TrimSpace(string(where)))
+	assert.True(t, os.IsNotExist(err))
+
+	// a missing artifact
+	s.Artifacts = []string{"missing.txt"}
+	c, err = e.RunStaged(context.TODO(), ssh.MustParseHost("web1"), s, "exit 3")
+	assert.ErrorContains(t, err, "fetch artifacts")
+	assert.Equal(t, 3, c.ExitCode())
+
+	// a missing file is not uploaded, and the command not run
+	s.Files = []string{filepath.Join(local, "missing.sh")}
+	c, err = e.RunStaged(context.TODO(), ssh.MustParseHost("web1"), s, "true")
+	assert.ErrorContains(t, err, "upload files")
+	assert.Nil(t, c)
+}
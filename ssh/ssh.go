@@ -0,0 +1,221 @@
+// Package ssh runs gocmd commands on remote hosts by the OpenSSH client, so
+// that the ssh configuration, keys and agent of the user are honored as they are.
+//
+//	e := ssh.Executor{ConnectTimeout: 5 * time.Second}
+//	c := e.Command(ssh.MustParseHost("deploy@web1"), "uptime")
+//	c.Run(context.TODO())
+//	fmt.Println(c.Stdout())
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+)
+
+// Host is a remote host, like user@host:port.
+type Host struct {
+	User string
+	Name string
+	Port int // 0 for the port of the ssh configuration
+}
+
+// ParseHost parses a host of the form [user@]host[:port], IPv6 addresses with a
+// port are written in brackets, like [::1]:2222.
+func ParseHost(s string) (Host, error) {
+	var h Host
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		h.User, s = s[:i], s[i+1:]
+	}
+
+	if host, port, err := net.SplitHostPort(s); err == nil {
+		p, err := strconv.Atoi(port)
+		if err != nil || p <= 0 || p > 65535 {
+			return Host{}, fmt.Errorf("invalid port in %q", s)
+		}
+		h.Name, h.Port = host, p
+	} else {
+		h.Name = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	}
+
+	if h.Name == "" {
+		return Host{}, fmt.Errorf("host name required in %q", s)
+	}
+	return h, nil
+}
+
+// MustParseHost is like ParseHost but panics on errors.
+func MustParseHost(s string) Host {
+	h, err := ParseHost(s)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// ParseHosts parses a comma separated list of hosts, like web1,deploy@web2:2222.
+func ParseHosts(s string) ([]Host, error) {
+	var hosts []Host
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		h, err := ParseHost(part)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, nil
+}
+
+func (h Host) String() string {
+	s := h.Name
+	if h.Port != 0 {
+		s = net.JoinHostPort(h.Name, strconv.Itoa(h.Port))
+	}
+	if h.User != "" {
+		s = h.User + "@" + s
+	}
+	return s
+}
+
+// destination returns the host as ssh expects it, the port is passed by -p.
+func (h Host) destination() string {
+	if h.User != "" {
+		return h.User + "@" + h.Name
+	}
+	return h.Name
+}
+
+// ExitCodeSSHError is the exit code of ssh if it failed itself, like when the
+// host could not be connected, instead of the remote command failing.
+const ExitCodeSSHError = 255
+
+// HostKeyPolicy tells how the keys of the hosts are verified.
+type HostKeyPolicy int
+
+const (
+	// HostKeyConfig verifies the host keys by the ssh configuration, strict unless configured otherwise.
+	HostKeyConfig HostKeyPolicy = iota
+	// HostKeyStrict refuses the hosts whose key is not in the known hosts.
+	HostKeyStrict
+	// HostKeyTOFU trusts the key of a host on first use, adding it to the known
+	// hosts, and refuses the hosts whose key changed.
+	HostKeyTOFU
+)
+
+// ParseHostKeyPolicy parses a HostKeyPolicy, one of config, strict and tofu.
+func ParseHostKeyPolicy(s string) (HostKeyPolicy, error) {
+	switch s {
+	case "config":
+		return HostKeyConfig, nil
+	case "strict":
+		return HostKeyStrict, nil
+	case "tofu":
+		return HostKeyTOFU, nil
+	}
+	return 0, fmt.Errorf("invalid host key policy %q, expected config, strict or tofu", s)
+}
+
+func (p HostKeyPolicy) String() string {
+	switch p {
+	case HostKeyStrict:
+		return "strict"
+	case HostKeyTOFU:
+		return "tofu"
+	}
+	return "config"
+}
+
+// Executor runs commands on remote hosts by the OpenSSH client.
+type Executor struct {
+	// SSH is the ssh executable, "ssh" if empty.
+	SSH string
+	// SFTP is the sftp executable, "sftp" if empty.
+	SFTP string
+	// IdentityFile is the private key to authenticate with, if not empty.
+	IdentityFile string
+	// ConnectTimeout is the timeout of connecting to a host, if not zero.
+	ConnectTimeout time.Duration
+	// Jump are the bastions the hosts are connected through, in order, by ProxyJump.
+	Jump []Host
+	// AgentSocket is the socket of the ssh-agent to authenticate with, instead
+	// of the one of SSH_AUTH_SOCK, if not empty.
+	AgentSocket string
+	// ForwardAgent forwards the agent to the hosts, for the remote commands
+	// connecting further, like git clone from a private repository.
+	ForwardAgent bool
+	// HostKeyPolicy tells how the keys of the hosts are verified.
+	HostKeyPolicy HostKeyPolicy
+	// KnownHosts is the known hosts file verifying the host keys, instead of
+	// the ones of the ssh configuration, if not empty.
+	KnownHosts string
+	// Options are additional ssh options, like "Compression=yes". The first
+	// value of an option is the one used by ssh, the ones above come first.
+	Options []string
+}
+
+// Args returns the ssh arguments running the command on the host.
+// ssh never prompts, BatchMode is on, so commands fail instead of hanging
+// when a password would be needed.
+func (e *Executor) Args(h Host, command string) []string {
+	return append(e.options(h, "-p"), "--", h.destination(), command)
+}
+
+// options returns the options of ssh and sftp, whose port flags differ.
+func (e *Executor) options(h Host, portFlag string) []string {
+	args := []string{"-o", "BatchMode=yes"}
+	if e.ConnectTimeout > 0 {
+		args = append(args, "-o", "ConnectTimeout="+strconv.Itoa(seconds(e.ConnectTimeout)))
+	}
+	if e.IdentityFile != "" {
+		args = append(args, "-i", e.IdentityFile)
+	}
+	if len(e.Jump) > 0 {
+		jumps := make([]string, len(e.Jump))
+		for i, j := range e.Jump {
+			jumps[i] = j.String()
+		}
+		args = append(args, "-o", "ProxyJump="+strings.Join(jumps, ","))
+	}
+	if e.AgentSocket != "" {
+		args = append(args, "-o", "IdentityAgent="+e.AgentSocket)
+	}
+	if e.ForwardAgent {
+		args = append(args, "-o", "ForwardAgent=yes")
+	}
+	switch e.HostKeyPolicy {
+	case HostKeyStrict:
+		args = append(args, "-o", "StrictHostKeyChecking=yes")
+	case HostKeyTOFU:
+		args = append(args, "-o", "StrictHostKeyChecking=accept-new")
+	}
+	if e.KnownHosts != "" {
+		args = append(args, "-o", "UserKnownHostsFile="+e.KnownHosts)
+	}
+	for _, o := range e.Options {
+		args = append(args, "-o", o)
+	}
+	if h.Port != 0 {
+		args = append(args, portFlag, strconv.Itoa(h.Port))
+	}
+	return args
+}
+
+// Command returns a command running the command line on the host, which is
+// interpreted by the shell of the remote user, like ssh does.
+func (e *Executor) Command(h Host, command string, options ...func(*gocmd.Cmd)) *gocmd.Cmd {
+	ssh := e.SSH
+	if ssh == "" {
+		ssh = "ssh"
+	}
+
+	options = append([]func(*gocmd.Cmd){gocmd.WithCmd(exec.Command(ssh, e.Args(h, command)...))}, options...)
+	return gocmd.New("", options...)
+}
@@ -0,0 +1,86 @@
+package ssh_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd/ssh"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHost(t *testing.T) {
+	for in, expected := range map[string]ssh.Host{
+		"web1":               {Name: "web1"},
+		"deploy@web1":        {User: "deploy", Name: "web1"},
+		"deploy@web1:2222":   {User: "deploy", Name: "web1", Port: 2222},
+		"[::1]:22":           {Name: "::1", Port: 22},
+		"root@[fe80::1]":     {User: "root", Name: "fe80::1"},
+		"a@b@10.0.0.1:10022": {User: "a@b", Name: "10.0.0.1", Port: 10022},
+	} {
+		h, err := ssh.ParseHost(in)
+		assert.Nil(t, err, in)
+		assert.Equal(t, expected, h, in)
+	}
+
+	for _, in := range []string{"", "user@", "web1:x", "web1:70000"} {
+		_, err := ssh.ParseHost(in)
+		assert.Error(t, err, in)
+	}
+
+	hosts, err := ssh.ParseHosts("web1, deploy@web2:2222,")
+	assert.Nil(t, err)
+	assert.Equal(t, []ssh.Host{{Name: "web1"}, {User: "deploy", Name: "web2", Port: 2222}}, hosts)
+	assert.Equal(t, "deploy@web2:2222", hosts[1].String())
+}
+
+func TestExecutorArgs(t *testing.T) {
+	e := ssh.Executor{
+		IdentityFile:   "id_ed25519",
+		ConnectTimeout: 1500 * time.Millisecond,
+		Options:        []string{"StrictHostKeyChecking=no"},
+	}
+
+	assert.Equal(t, []string{
+		"-o", "BatchMode=yes", "-o", "ConnectTimeout=2", "-i", "id_ed25519",
+		"-o", "StrictHostKeyChecking=no", "-p", "2222", "--", "deploy@web1", "uptime",
+	}, e.Args(ssh.MustParseHost("deploy@web1:2222"), "uptime"))
+}
+
+func TestExecutorArgsJump(t *testing.T) {
+	jump, err := ssh.ParseHosts("bastion,ops@[fe80::1]:2222")
+	assert.Nil(t, err)
+	e := ssh.Executor{
+		Jump:          jump,
+		AgentSocket:   "/run/agent.sock",
+		ForwardAgent:  true,
+		HostKeyPolicy: ssh.HostKeyTOFU,
+		KnownHosts:    "known_hosts",
+	}
+
+	assert.Equal(t, []string{
+		"-o", "BatchMode=yes", "-o", "ProxyJump=bastion,ops@[fe80::1]:2222",
+		"-o", "IdentityAgent=/run/agent.sock", "-o", "ForwardAgent=yes",
+		"-o", "StrictHostKeyChecking=accept-new", "-o", "UserKnownHostsFile=known_hosts",
+		"--", "web1", "uptime",
+	}, e.Args(ssh.MustParseHost("web1"), "uptime"))
+
+	p, err := ssh.ParseHostKeyPolicy("strict")
+	assert.Nil(t, err)
+	assert.Equal(t, ssh.HostKeyStrict, p)
+	_, err = ssh.ParseHostKeyPolicy("none")
+	assert.Error(t, err)
+}
+
+func TestExecutorCommand(t *testing.T) {
+	// a fake ssh echoing its arguments
+	fake := filepath.Join(t.TempDir(), "ssh")
+	assert.Nil(t, os.WriteFile(fake, []byte("#!/bin/sh\necho \"$@\"\n"), 0o755))
+
+	e := ssh.Executor{SSH: fake}
+	c := e.Command(ssh.MustParseHost("web1"), "ls -l | wc -l")
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, "-o BatchMode=yes -- web1 ls -l | wc -l\n", c.Stdout())
+}
@@ -0,0 +1,93 @@
+package gocmd
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// asyncRun is the run of a command started by Start.
+type asyncRun struct {
+	started bool
+	done    chan struct{}
+	err     error // of Run, once done
+}
+
+// asyncRun returns the run of Start, c.mu must be held.
+func (c *Cmd) asyncRun() *asyncRun {
+	if c.async == nil {
+		c.async = &asyncRun{done: make(chan struct{})}
+	}
+	return c.async
+}
+
+// Start starts running the command, like Run, and returns once its process
+// started, or Run failed before, like when the command was denied or not
+// found, with the error Wait returns then. The command is joined by Wait, or
+// Done, with the buffering, timeout, retries and sinks of Run.
+//
+// Example:
+//
+//	if err := c.Start(ctx); err != nil {
+//		return err
+//	}
+//	... // other work
+//	err := c.Wait()
+//	fmt.Print(c.Stdout())
+func (c *Cmd) Start(ctx context.Context) error {
+	c.mu.Lock()
+	a := c.asyncRun()
+	if a.started {
+		c.mu.Unlock()
+		return errors.New("command already started")
+	}
+	a.started = true
+	c.mu.Unlock()
+
+	started := make(chan struct{})
+	var once sync.Once
+	c.afterStart = append(c.afterStart, func(int) error {
+		once.Do(func() { close(started) })
+		return nil
+	})
+	go func() {
+		a.err = c.Run(ctx)
+		close(a.done)
+	}()
+
+	select {
+	case <-started:
+		return nil
+	case <-a.done:
+		select {
+		case <-started:
+			return nil
+		default:
+			return a.err
+		}
+	}
+}
+
+// Wait waits for the command started by Start to finish, and returns the
+// error of its Run.
+func (c *Cmd) Wait() error {
+	c.mu.Lock()
+	a := c.asyncRun()
+	started := a.started
+	c.mu.Unlock()
+	if !started {
+		return errors.New("command not started")
+	}
+
+	<-a.done
+	return a.err
+}
+
+// Done returns a channel closed once the command started by Start finished,
+// like to select on it with other channels. It can be called before Start.
+func (c *Cmd) Done() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.asyncRun().done
+}
@@ -0,0 +1,50 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartWait(t *testing.T) {
+	c := gocmd.New("sleep 0.2; echo done")
+	done := c.Done()
+	assert.EqualError(t, c.Wait(), "command not started")
+
+	start := time.Now()
+	assert.Nil(t, c.Start(context.TODO()))
+	assert.Less(t, time.Since(start), 150*time.Millisecond)
+	assert.True(t, c.Status().Running)
+	assert.EqualError(t, c.Start(context.TODO()), "command already started")
+
+	select {
+	case <-done:
+		t.Fatal("done before the command exited")
+	default:
+	}
+	assert.Nil(t, c.Wait())
+	<-done
+	assert.Equal(t, "done\n", c.Stdout())
+	assert.Nil(t, c.Wait()) // again
+}
+
+func TestStartErrors(t *testing.T) {
+	c := gocmd.New("true", gocmd.WithShell("no-such-shell-xyz"))
+	err := c.Start(context.TODO())
+	assert.Contains(t, err.Error(), "no-such-shell-xyz")
+	assert.Equal(t, err, c.Wait())
+
+	c = gocmd.New("sleep 10", gocmd.WithTimeout(50*time.Millisecond))
+	assert.Nil(t, c.Start(context.TODO()))
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("not done after its timeout")
+	}
+	assert.ErrorIs(t, c.Wait(), gocmd.ErrTimeout)
+}
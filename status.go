@@ -0,0 +1,135 @@
+package gocmd
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// WithLabels sets labels of the command, like purpose or tenant, which are
+// not passed to it but reported by Status and batch results, so that many
+// commands can be told apart and grouped in logs, metrics and reports.
+// Later labels of the same key override earlier ones.
+//
+// Example:
+//
+//	c := gocmd.New("make deploy", gocmd.WithLabels(map[string]string{"tenant": "acme", "purpose": "deploy"}))
+func WithLabels(labels map[string]string) func(c *Cmd) {
+	return func(c *Cmd) {
+		if c.labels == nil {
+			c.labels = make(Labels, len(labels))
+		}
+		for k, v := range labels {
+			c.labels[k] = v
+		}
+	}
+}
+
+// Labels returns a copy of the labels set by WithLabels.
+func (c *Cmd) Labels() Labels {
+	if len(c.labels) == 0 {
+		return nil
+	}
+	labels := make(Labels, len(c.labels))
+	for k, v := range c.labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// Status is a snapshot of a command.
+type Status struct {
+	Command  string      `json:"command"`
+	Labels   Labels      `json:"labels,omitempty"`
+	Running  bool        `json:"running"`
+	Pid      int         `json:"pid,omitempty"`
+	Executed bool        `json:"executed"`
+	ExitCode int         `json:"exit_code"`
+	Outcome  Outcome     `json:"outcome,omitempty"`
+	Failure  FailureKind `json:"failure,omitempty"`
+	Attempts int         `json:"attempts,omitempty"`
+	Started  time.Time   `json:"started"`
+	// StopReason tells why the last attempt was stopped before it exited by
+	// itself: the reason given to Cancel, "timeout" or the error of the context.
+	StopReason string `json:"stop_reason,omitempty"`
+	// Duration is the duration of the last attempt, up to now while running.
+	Duration time.Duration `json:"duration"`
+	// Env are the env vars differing from the ones of the current process.
+	Env EnvDiff `json:"env,omitempty"`
+	// Stats are the last statistics sampled by WithProcessStats.
+	Stats *ProcessStats `json:"stats,omitempty"`
+	// CoreDump is the core file of the last attempt found by WithCoreDumps.
+	CoreDump string `json:"core_dump,omitempty"`
+	// TraceFile is the trace file of the last attempt of WithTraceSyscalls or WithTraceLibraryCalls.
+	TraceFile string `json:"trace_file,omitempty"`
+	// Approval is the decision of the approval of WithApproval.
+	Approval *Approval `json:"approval,omitempty"`
+}
+
+// Status returns a snapshot of the command, it can be called while the command is running.
+func (c *Cmd) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := Status{
+		Command:    c.Redacted(),
+		Labels:     c.Labels(),
+		Executed:   c.Executed,
+		Attempts:   c.attempts,
+		Started:    c.started,
+		StopReason: c.stopReason,
+		Env:        c.envDiff(),
+		Stats:      c.processStats(),
+		CoreDump:   c.coreDump,
+		TraceFile:  c.traceFile,
+		Approval:   c.approval,
+	}
+
+	switch {
+	case c.process != nil:
+		s.Running, s.Pid = true, c.process.Pid
+		s.Duration = time.Since(c.started)
+	case c.Executed:
+		s.ExitCode = c.exitCode
+		if c.stopReason == "" {
+			s.Outcome = c.outcome()
+			s.Failure = c.failure
+		}
+		s.Duration = c.finished.Sub(c.started)
+	}
+	return s
+}
+
+// Labels are the labels of a command, set by WithLabels.
+type Labels map[string]string
+
+// Values returns the values of keys, empty for missing ones.
+// Metrics should be labeled by a fixed set of keys, like the label names of a
+// Prometheus metric vector, to keep their cardinality bounded, instead of by
+// all the labels of commands.
+//
+// Example:
+//
+//	runs.WithLabelValues(c.Labels().Values("tenant", "purpose")...).Inc()
+func (l Labels) Values(keys ...string) []string {
+	values := make([]string, len(keys))
+	for i, k := range keys {
+		values[i] = l[k]
+	}
+	return values
+}
+
+// Pairs returns the labels as key=value pairs sorted by key, for logs and reports.
+func (l Labels) Pairs() []string {
+	pairs := make([]string, 0, len(l))
+	for k, v := range l {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+// String returns the pairs joined by commas.
+func (l Labels) String() string {
+	return strings.Join(l.Pairs(), ",")
+}
@@ -0,0 +1,49 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommand_Status(t *testing.T) {
+	c := gocmd.New("sleep 0.2; exit 2",
+		gocmd.WithLabels(map[string]string{"tenant": "acme", "purpose": "test"}),
+		gocmd.WithLabels(map[string]string{"purpose": "status"}))
+
+	s := c.Status()
+	assert.Equal(t, "sleep 0.2; exit 2", s.Command)
+	assert.Equal(t, gocmd.Labels{"tenant": "acme", "purpose": "status"}, s.Labels)
+	assert.False(t, s.Running)
+	assert.False(t, s.Executed)
+
+	done := make(chan error)
+	go func() { done <- c.Run(context.TODO()) }()
+	for i := 0; i < 50 && !c.Status().Running; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	s = c.Status()
+	assert.True(t, s.Running)
+	assert.NotZero(t, s.Pid)
+
+	assert.Nil(t, <-done)
+	s = c.Status()
+	assert.False(t, s.Running)
+	assert.True(t, s.Executed)
+	assert.Equal(t, 2, s.ExitCode)
+	assert.Equal(t, 1, s.Attempts)
+	assert.GreaterOrEqual(t, s.Duration, 200*time.Millisecond)
+}
+
+func TestLabels(t *testing.T) {
+	l := gocmd.Labels{"tenant": "acme", "env": "prod"}
+	assert.Equal(t, []string{"acme", ""}, l.Values("tenant", "region"))
+	assert.Equal(t, []string{"env=prod", "tenant=acme"}, l.Pairs())
+	assert.Equal(t, "env=prod,tenant=acme", l.String())
+	assert.Nil(t, gocmd.New("true").Labels())
+}
@@ -0,0 +1,53 @@
+package gocmd
+
+import (
+	"regexp"
+	"strings"
+)
+
+// WithExpectedStderr tells the stderr lines matching any of the patterns are
+// expected, like progress and informational messages many tools write to
+// stderr by design, so that they are not taken for errors: they are left out
+// by UnexpectedStderr, which the failure classifier of WithFailureClassifier,
+// the StageError of a Pipeline, the ExitError of the package level Run and
+// its WithLegacyStderrFailure see instead of the whole stderr. Stderr still
+// returns all of it.
+//
+// Example:
+//
+//	c := gocmd.New("git clone "+repo, gocmd.WithExpectedStderr(regexp.MustCompile(`^(Cloning into|Receiving|Resolving)`)))
+func WithExpectedStderr(patterns ...*regexp.Regexp) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.expectedStderr = append(c.expectedStderr, patterns...)
+	}
+}
+
+// UnexpectedStderr returns the output to StderrBuf but the lines expected by WithExpectedStderr.
+func (c *Cmd) UnexpectedStderr() string {
+	c.checkExecuted("UnexpectedStderr")
+	return c.unexpectedStderr()
+}
+
+func (c *Cmd) unexpectedStderr() string {
+	stderr := c.StderrBuf.String()
+	if len(c.expectedStderr) == 0 {
+		return stderr
+	}
+
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(stderr, "\n") {
+		if line != "" && !c.expectedLine(strings.TrimRight(line, "\r\n")) {
+			b.WriteString(line)
+		}
+	}
+	return b.String()
+}
+
+func (c *Cmd) expectedLine(line string) bool {
+	for _, re := range c.expectedStderr {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	out, err := gocmd.Run("echo progress >&2; echo done")
+	assert.Nil(t, err)
+	assert.Equal(t, "done\n", out)
+
+	_, err = gocmd.Run("echo bad >&2; exit 3")
+	var exitErr *gocmd.ExitError
+	if assert.True(t, errors.As(err, &exitErr)) {
+		assert.Equal(t, 3, exitErr.ExitCode)
+		assert.Equal(t, "bad\n", exitErr.Stderr)
+	}
+
+	out, err = gocmd.Run("echo done; exit 1", gocmd.WithExitCodeMap(map[int]gocmd.Outcome{1: gocmd.Success}))
+	assert.Nil(t, err)
+	assert.Equal(t, "done\n", out)
+
+	_, err = gocmd.Run("echo progress >&2", gocmd.WithLegacyStderrFailure())
+	assert.EqualError(t, err, "progress\n")
+}
+
+func TestWithExpectedStderr(t *testing.T) {
+	progress := gocmd.WithExpectedStderr(regexp.MustCompile(`^Receiving objects`), regexp.MustCompile(`^warning: `))
+
+	out, err := gocmd.Run("echo 'Receiving objects: 100%' >&2; echo 'warning: old' >&2; echo done", progress, gocmd.WithLegacyStderrFailure())
+	assert.Nil(t, err)
+	assert.Equal(t, "done\n", out)
+
+	_, err = gocmd.Run("echo 'Receiving objects: 100%' >&2; echo 'fatal: bad' >&2", progress, gocmd.WithLegacyStderrFailure())
+	assert.EqualError(t, err, "fatal: bad\n")
+
+	_, err = gocmd.Run("echo 'fatal: bad' >&2; echo 'warning: old' >&2; exit 2", progress)
+	assert.EqualError(t, err, `"echo 'fatal: bad' >&2; echo 'warning: old' >&2; exit 2": exit code 2: fatal: bad`)
+
+	var seen string
+	c := gocmd.New("echo 'warning: old' >&2; echo 'fatal: bad' >&2; exit 1", progress,
+		gocmd.WithFailureClassifier(func(stderr string, _ int) gocmd.FailureKind {
+			seen = stderr
+			return gocmd.FailureUnknown
+		}))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, "fatal: bad\n", seen)
+	assert.Equal(t, "fatal: bad\n", c.UnexpectedStderr())
+	assert.Equal(t, "warning: old\nfatal: bad\n", c.Stderr())
+}
@@ -0,0 +1,217 @@
+// Package supervisor keeps long-running commands running, restarting them
+// with a backoff when they exit or when their output tells they crashed.
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+)
+
+// Trigger restarts the command when a line of its output matches Pattern, even
+// if it did not exit, like a server logging "panic:" from a goroutine which
+// recovered, or a JVM logging OutOfMemoryError.
+type Trigger struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// NewTrigger returns the Trigger of the pattern regexp, it panics if it does not compile.
+func NewTrigger(name, pattern string) Trigger {
+	return Trigger{Name: name, Pattern: regexp.MustCompile(pattern)}
+}
+
+// Restart is a restart of a Supervisor.
+type Restart struct {
+	Start    time.Time // of the run which ended
+	Duration time.Duration
+	ExitCode int
+	Err      error  // the error of Cmd.Run
+	Trigger  string // the name of the trigger which stopped the run, if any
+	Line     string // the line which matched the trigger
+	Backoff  time.Duration
+}
+
+// Reason tells why the command is restarted.
+func (r Restart) Reason() string {
+	switch {
+	case r.Trigger != "":
+		return fmt.Sprintf("trigger %s: %s", r.Trigger, r.Line)
+	case r.Err != nil:
+		return r.Err.Error()
+	}
+	return fmt.Sprintf("exit code %d", r.ExitCode)
+}
+
+// Supervisor runs a command, and runs it again after it exited, or after it
+// was stopped gracefully because its output matched a Trigger, by SIGTERM
+// and the KillAfter of the command. The restarts are delayed by an
+// exponential backoff, from MinBackoff up to MaxBackoff, reset once a run
+// lasted MaxBackoff.
+//
+// Example:
+//
+//	s := &supervisor.Supervisor{
+//		Command: func() *gocmd.Cmd {
+//			return gocmd.New("./server", gocmd.WithTimeout(0), gocmd.WithKillAfter(10*time.Second))
+//		},
+//		Triggers: []supervisor.Trigger{supervisor.NewTrigger("panic", `^panic: `)},
+//	}
+//	err := s.Run(ctx)
+type Supervisor struct {
+	// Command creates the command of a run, a Cmd is run only once.
+	Command  func() *gocmd.Cmd
+	Triggers []Trigger
+	// MinBackoff is the delay of the first restart, 1s if 0.
+	MinBackoff time.Duration
+	// MaxBackoff is the maximum delay of a restart, 1m if 0.
+	MaxBackoff time.Duration
+	// MaxRestarts, if not zero, is the number of restarts after which Run gives up.
+	MaxRestarts int
+	// OnRestart, if not nil, is called before the backoff of a restart.
+	OnRestart func(Restart)
+	// Notifier, if not nil, is told the restarts, to notify restart storms.
+	Notifier *gocmd.Notifier
+
+	mu       sync.Mutex
+	restarts int
+	triggers map[string]int
+}
+
+// Restarts returns the number of restarts.
+func (s *Supervisor) Restarts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.restarts
+}
+
+// TriggerCounts returns the number of restarts by trigger name.
+func (s *Supervisor) TriggerCounts() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[string]int, len(s.triggers))
+	for name, n := range s.triggers {
+		counts[name] = n
+	}
+	return counts
+}
+
+// Run runs the command until the context is done, which also stops it, or
+// until MaxRestarts restarts.
+func (s *Supervisor) Run(ctx context.Context) error {
+	minBackoff, maxBackoff := s.MinBackoff, s.MaxBackoff
+	if minBackoff <= 0 {
+		minBackoff = time.Second
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = time.Minute
+	}
+
+	var backoff time.Duration
+	for {
+		c, r := s.run(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if r.Duration >= maxBackoff || backoff == 0 {
+			backoff = minBackoff
+		} else if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+		r.Backoff = backoff
+
+		s.mu.Lock()
+		s.restarts++
+		if r.Trigger != "" {
+			if s.triggers == nil {
+				s.triggers = map[string]int{}
+			}
+			s.triggers[r.Trigger]++
+		}
+		restarts := s.restarts
+		s.mu.Unlock()
+
+		if s.MaxRestarts > 0 && restarts > s.MaxRestarts {
+			return fmt.Errorf("gave up after %d restarts, last by %s", s.MaxRestarts, r.Reason())
+		}
+		if s.OnRestart != nil {
+			s.OnRestart(r)
+		}
+		if s.Notifier != nil {
+			s.Notifier.Restarted(c, r.Reason())
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (s *Supervisor) run(ctx context.Context) (*gocmd.Cmd, Restart) {
+	c := s.Command()
+	w := &watcher{c: c, triggers: s.Triggers}
+	if len(s.Triggers) > 0 {
+		gocmd.WithCombinedSink(gocmd.Lines(w))(c)
+	}
+
+	r := Restart{Start: time.Now()}
+	r.Err = c.Run(ctx)
+	r.Duration = time.Since(r.Start)
+	if c.Executed {
+		r.ExitCode = c.ExitCode()
+	}
+	r.Trigger, r.Line = w.matched()
+	if r.Trigger != "" {
+		// the error of the stop by the trigger, told by Reason
+		r.Err = nil
+	}
+	return c, r
+}
+
+// watcher stops the command on the first line matching a trigger.
+type watcher struct {
+	c        *gocmd.Cmd
+	triggers []Trigger
+
+	mu      sync.Mutex
+	trigger string
+	line    string
+}
+
+func (w *watcher) Start() error { return nil }
+func (w *watcher) Close() error { return nil }
+
+func (w *watcher) WriteLine(line string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.trigger != "" {
+		return nil
+	}
+	for _, t := range w.triggers {
+		if t.Pattern.MatchString(line) {
+			w.trigger, w.line = t.Name, line
+			_ = w.c.Cancel("restart trigger " + t.Name)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (w *watcher) matched() (trigger, line string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.trigger, w.line
+}
@@ -0,0 +1,81 @@
+//go:build !windows
+
+package supervisor_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/bingoohuang/gocmd/supervisor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSupervisorTrigger(t *testing.T) {
+	var restarts []supervisor.Restart
+	s := &supervisor.Supervisor{
+		Command: func() *gocmd.Cmd {
+			return gocmd.New("echo start; sleep 0.05; echo 'panic: boom'; sleep 10", gocmd.WithTimeout(0))
+		},
+		Triggers:    []supervisor.Trigger{supervisor.NewTrigger("panic", `^panic: `)},
+		MinBackoff:  10 * time.Millisecond,
+		MaxRestarts: 2,
+		OnRestart:   func(r supervisor.Restart) { restarts = append(restarts, r) },
+	}
+	start := time.Now()
+	err := s.Run(context.TODO())
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.EqualError(t, err, "gave up after 2 restarts, last by trigger panic: panic: boom")
+	assert.Equal(t, 3, s.Restarts())
+	assert.Equal(t, map[string]int{"panic": 3}, s.TriggerCounts())
+
+	assert.Len(t, restarts, 2)
+	assert.Equal(t, "panic", restarts[0].Trigger)
+	assert.Nil(t, restarts[0].Err)
+	assert.Equal(t, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond},
+		[]time.Duration{restarts[0].Backoff, restarts[1].Backoff})
+}
+
+func TestSupervisorExit(t *testing.T) {
+	s := &supervisor.Supervisor{
+		Command:     func() *gocmd.Cmd { return gocmd.New("exit 3") },
+		MinBackoff:  time.Millisecond,
+		MaxRestarts: 1,
+	}
+	assert.EqualError(t, s.Run(context.TODO()), "gave up after 1 restarts, last by exit code 3")
+	assert.Empty(t, s.TriggerCounts())
+}
+
+func TestSupervisorContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	s := &supervisor.Supervisor{Command: func() *gocmd.Cmd { return gocmd.New("sleep 10", gocmd.WithTimeout(0)) }}
+	assert.Equal(t, context.DeadlineExceeded, s.Run(ctx))
+	assert.Equal(t, 0, s.Restarts())
+}
+
+func TestSupervisorNotifier(t *testing.T) {
+	var notes []gocmd.Notification
+	n := &gocmd.Notifier{
+		StormRestarts: 3,
+		Transports: []gocmd.NotifyTransport{gocmd.NotifyTransportFunc(func(_ context.Context, n gocmd.Notification) error {
+			notes = append(notes, n)
+			return nil
+		})},
+	}
+	s := &supervisor.Supervisor{
+		Command: func() *gocmd.Cmd {
+			return gocmd.New("echo crashed >&2; exit 3", gocmd.WithLabels(map[string]string{"app": "web"}))
+		},
+		MinBackoff:  time.Millisecond,
+		MaxRestarts: 5,
+		Notifier:    n,
+	}
+	assert.Error(t, s.Run(context.TODO()))
+	assert.Len(t, notes, 1)
+	assert.Equal(t, gocmd.NotifyRestartStorm, notes[0].Kind)
+	assert.Equal(t, "3 restarts within 10m0s, last by exit code 3", notes[0].Error)
+	assert.Equal(t, gocmd.Labels{"app": "web"}, notes[0].Labels)
+	assert.Equal(t, []string{"crashed"}, notes[0].StderrTail)
+}
@@ -0,0 +1,91 @@
+package gocmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tool is an executable found by Which.
+type Tool struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// Version is the one of ToolVersion, empty if it could not be probed.
+	Version string `json:"version,omitempty"`
+}
+
+// ErrToolNotFound is returned by Which if none of the tools is found.
+var ErrToolNotFound = errors.New("tool not found")
+
+// Which returns the first of the tools found in PATH, with its version, so
+// that wrappers can select between alternatives, like podman and docker, or
+// gsed and sed. It returns an error wrapping ErrToolNotFound if none is found.
+//
+// Example:
+//
+//	engine, err := gocmd.Which("podman", "docker")
+//	if err != nil {
+//		return err // none of podman, docker found
+//	}
+//	c := gocmd.New("", gocmd.WithCmd(exec.Command(engine.Path, "ps")))
+func Which(names ...string) (Tool, error) {
+	for _, name := range names {
+		path, err := exec.LookPath(name)
+		if err != nil {
+			continue
+		}
+		t := Tool{Name: name, Path: path}
+		t.Version, _ = ToolVersion(context.Background(), name)
+		return t, nil
+	}
+	return Tool{}, fmt.Errorf("none of %s: %w", strings.Join(names, ", "), ErrToolNotFound)
+}
+
+// Feature is a capability of a tool, probed by running it with Args.
+type Feature struct {
+	Args []string
+	// Match, if not nil, must match the output, stdout and stderr, of the probe.
+	Match *regexp.Regexp
+}
+
+var (
+	featureMu    sync.Mutex
+	featureCache = map[string]bool{}
+)
+
+// HasFeature tells whether the tool has the feature, it has if the probe
+// exits with 0 within 10s, with an output matching Match if not nil. The
+// results are cached.
+//
+// Example:
+//
+//	sed, _ := gocmd.Which("gsed", "sed")
+//	gnu := sed.HasFeature(gocmd.Feature{Args: []string{"--version"}, Match: regexp.MustCompile(`GNU`)})
+func (t Tool) HasFeature(f Feature) bool {
+	key := t.Path + "\x00" + strings.Join(f.Args, "\x00")
+	if f.Match != nil {
+		key += "\x00" + f.Match.String()
+	}
+
+	featureMu.Lock()
+	has, ok := featureCache[key]
+	featureMu.Unlock()
+	if ok {
+		return has
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, t.Path, f.Args...).CombinedOutput()
+	has = err == nil && (f.Match == nil || f.Match.Match(out))
+
+	featureMu.Lock()
+	featureCache[key] = has
+	featureMu.Unlock()
+	return has
+}
@@ -0,0 +1,33 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWhich(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\nif [ \"$1\" = --version ]; then echo \"fakesed (GNU sed) 4.9\"; exit 0; fi\nexit 1\n"
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "fakesed"), []byte(script), 0o755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	tool, err := gocmd.Which("gocmd-no-such-sed", "fakesed")
+	assert.Nil(t, err)
+	assert.Equal(t, gocmd.Tool{Name: "fakesed", Path: filepath.Join(dir, "fakesed"), Version: "4.9"}, tool)
+
+	assert.True(t, tool.HasFeature(gocmd.Feature{Args: []string{"--version"}, Match: regexp.MustCompile(`GNU`)}))
+	assert.False(t, tool.HasFeature(gocmd.Feature{Args: []string{"--version"}, Match: regexp.MustCompile(`BSD`)}))
+	assert.False(t, tool.HasFeature(gocmd.Feature{Args: []string{"-E"}}))
+
+	_, err = gocmd.Which("gocmd-no-such-a", "gocmd-no-such-b")
+	assert.True(t, errors.Is(err, gocmd.ErrToolNotFound))
+	assert.Equal(t, "none of gocmd-no-such-a, gocmd-no-such-b: tool not found", err.Error())
+}
@@ -0,0 +1,167 @@
+package gocmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Installer installs the tool of the name into the directory, like by
+// downloading a static binary, so that dir/name is an executable.
+type Installer func(ctx context.Context, name, dir string) error
+
+// Toolchain installs the tools the commands need and which are missing, by
+// its Installer, into a cache directory added to the PATH of the commands,
+// enabling wrappers working without any setup.
+//
+// Example:
+//
+//	tc := &gocmd.Toolchain{Install: gocmd.DownloadInstaller(map[string]string{
+//		"jq": "https://github.com/jqlang/jq/releases/download/jq-1.7.1/jq-{os}-{arch}",
+//	})}
+//	c := gocmd.New("jq .version package.json", gocmd.WithToolchain(tc, "jq"))
+type Toolchain struct {
+	// Dir is the directory the tools are installed into, the gocmd/tools
+	// directory of the user cache directory if empty.
+	Dir     string
+	Install Installer
+
+	mu sync.Mutex // serializes the installations
+}
+
+// dir returns the directory the tools are installed into.
+func (t *Toolchain) dir() (string, error) {
+	if t.Dir != "" {
+		return t.Dir, nil
+	}
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cache, "gocmd", "tools"), nil
+}
+
+// Lookup returns the path of the tool, found in PATH or installed into Dir
+// before, installing it by Install if it is missing from both.
+func (t *Toolchain) Lookup(ctx context.Context, name string) (string, error) {
+	if path, err := exec.LookPath(name); err == nil {
+		return path, nil
+	}
+	dir, err := t.dir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if isExecutable(path) {
+		return path, nil
+	}
+	if t.Install == nil {
+		return "", fmt.Errorf("%s: %w", name, ErrToolNotFound)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	if err := t.Install(ctx, name, dir); err != nil {
+		return "", fmt.Errorf("install %s: %w", name, err)
+	}
+	if !isExecutable(path) {
+		return "", fmt.Errorf("install %s: no executable %s", name, path)
+	}
+	return path, nil
+}
+
+func isExecutable(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.Mode().IsRegular() && fi.Mode()&0o111 != 0
+}
+
+// WithToolchain installs the tools the command needs by the toolchain if
+// they are missing, before it is started, and appends the directory of the
+// toolchain to its PATH. Run fails if a tool could not be installed.
+func WithToolchain(t *Toolchain, names ...string) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.beforeStart = append(c.beforeStart, func(cmd *exec.Cmd) error {
+			for _, name := range names {
+				path, err := t.Lookup(context.Background(), name)
+				if err != nil {
+					return err
+				}
+				// executed directly by WithCmd, it was not found when the command was created
+				if cmd.Path == name && errors.Is(cmd.Err, exec.ErrNotFound) {
+					cmd.Path, cmd.Err = path, nil
+				}
+			}
+			dir, err := t.dir()
+			if err != nil {
+				return err
+			}
+			cmd.Env = appendPath(cmd.Env, dir)
+			return nil
+		})
+	}
+}
+
+// appendPath returns the env with the dir appended to its PATH.
+func appendPath(env []string, dir string) []string {
+	path := dir
+	if old, ok := envMap(env)["PATH"]; ok && old != "" {
+		path = old + string(os.PathListSeparator) + dir
+	}
+	return append(env[:len(env):len(env)], "PATH="+path)
+}
+
+// DownloadInstaller returns an Installer downloading the tools from the URLs
+// of their names, in which {os} and {arch} are replaced by the ones of the
+// current platform, like linux and amd64.
+func DownloadInstaller(urls map[string]string) Installer {
+	return func(ctx context.Context, name, dir string) error {
+		u, ok := urls[name]
+		if !ok {
+			return fmt.Errorf("no download URL of %s", name)
+		}
+		u = strings.NewReplacer("{os}", runtime.GOOS, "{arch}", runtime.GOARCH).Replace(u)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("download %s: %s", u, resp.Status)
+		}
+
+		// renamed once complete, so that an interrupted download is not taken for the tool
+		f, err := os.CreateTemp(dir, name+".download-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+		if _, err := io.Copy(f, resp.Body); err != nil {
+			f.Close()
+			return fmt.Errorf("download %s: %w", u, err)
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		if err := os.Chmod(f.Name(), 0o755); err != nil {
+			return err
+		}
+		return os.Rename(f.Name(), filepath.Join(dir, name))
+	}
+}
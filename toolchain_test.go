@@ -0,0 +1,62 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithToolchain(t *testing.T) {
+	installs := 0
+	tc := &gocmd.Toolchain{Dir: t.TempDir(), Install: func(_ context.Context, name, dir string) error {
+		installs++
+		return os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\necho installed \"$@\"\n"), 0o755)
+	}}
+
+	c := gocmd.New("gocmd-fake-tool a", gocmd.WithToolchain(tc, "gocmd-fake-tool"))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, "installed a\n", c.Stdout())
+
+	c = gocmd.New("", gocmd.WithCmd(exec.Command("gocmd-fake-tool", "b")), gocmd.WithToolchain(tc, "gocmd-fake-tool"))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, "installed b\n", c.Stdout())
+	assert.Equal(t, 1, installs)
+
+	path, err := tc.Lookup(context.TODO(), "sh")
+	assert.Nil(t, err)
+	assert.NotEqual(t, tc.Dir, filepath.Dir(path))
+
+	tc.Install = func(context.Context, string, string) error { return errors.New("offline") }
+	c = gocmd.New("gocmd-other-tool", gocmd.WithToolchain(tc, "gocmd-other-tool"))
+	assert.ErrorContains(t, c.Run(context.TODO()), "install gocmd-other-tool: offline")
+}
+
+func TestDownloadInstaller(t *testing.T) {
+	var requested string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		_, _ = w.Write([]byte("#!/bin/sh\necho downloaded\n"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	install := gocmd.DownloadInstaller(map[string]string{"tool": srv.URL + "/tool-{os}-{arch}"})
+	assert.Nil(t, install(context.TODO(), "tool", dir))
+	assert.Equal(t, "/tool-"+runtime.GOOS+"-"+runtime.GOARCH, requested)
+
+	out, err := exec.Command(filepath.Join(dir, "tool")).Output()
+	assert.Nil(t, err)
+	assert.Equal(t, "downloaded\n", string(out))
+	assert.Error(t, install(context.TODO(), "other", dir))
+}
@@ -0,0 +1,66 @@
+package gocmd
+
+import (
+	"os/exec"
+	"path/filepath"
+)
+
+// WithTraceSyscalls runs the command under strace, if it is found in PATH,
+// writing the system calls of the command and of the processes it starts to
+// the output file, with their times, durations and the paths of their file
+// descriptors, a one-option deep debugging mode for mysterious failures. The
+// path of the trace file is reported by TraceFile and Status; it is the one
+// of the last attempt. The command runs without being traced if strace is
+// not found, TraceFile is empty then.
+//
+// Example:
+//
+//	c := gocmd.New("./flaky-installer", gocmd.WithTraceSyscalls("installer.strace"))
+func WithTraceSyscalls(outputPath string) func(c *Cmd) {
+	return withTrace("strace", []string{"-f", "-tt", "-T", "-y", "-s", "256"}, outputPath)
+}
+
+// WithTraceLibraryCalls runs the command under ltrace, if it is found in
+// PATH, writing the library calls of the command and of the processes it
+// starts to the output file, like WithTraceSyscalls.
+func WithTraceLibraryCalls(outputPath string) func(c *Cmd) {
+	return withTrace("ltrace", []string{"-f", "-tt", "-T", "-s", "256"}, outputPath)
+}
+
+func withTrace(tracer string, flags []string, outputPath string) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.beforeStart = append(c.beforeStart, func(cmd *exec.Cmd) error {
+			c.mu.Lock()
+			c.traceFile = ""
+			c.mu.Unlock()
+
+			path, err := exec.LookPath(tracer)
+			if err != nil {
+				return nil // untraced
+			}
+			// the working dir of the command may differ
+			output, err := filepath.Abs(outputPath)
+			if err != nil {
+				return err
+			}
+
+			args := append(append([]string{tracer}, flags...), "-o", output, "--", cmd.Path)
+			cmd.Args = append(args, cmd.Args[1:]...)
+			cmd.Path = path
+
+			c.mu.Lock()
+			c.traceFile = output
+			c.mu.Unlock()
+			return nil
+		})
+	}
+}
+
+// TraceFile returns the trace file of the last attempt of the command, written by
+// WithTraceSyscalls or WithTraceLibraryCalls, empty if it was not traced.
+func (c *Cmd) TraceFile() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.traceFile
+}
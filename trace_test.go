@@ -0,0 +1,45 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithTraceSyscalls(t *testing.T) {
+	dir := t.TempDir()
+	// a fake strace writing its args to the -o file, then running the command
+	script := `#!/bin/sh
+while [ "$1" != -- ]; do
+	if [ "$1" = -o ]; then out=$2; shift; fi
+	shift
+done
+shift
+echo "traced $*" > "$out"
+exec "$@"
+`
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "strace"), []byte(script), 0o755))
+	t.Setenv("PATH", dir) // without ltrace
+
+	output := filepath.Join(dir, "run.strace")
+	c := gocmd.New("echo hello", gocmd.WithTraceSyscalls(output))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, "hello\n", c.Stdout())
+	assert.Equal(t, output, c.TraceFile())
+	assert.Equal(t, output, c.Status().TraceFile)
+
+	trace, err := os.ReadFile(output)
+	assert.Nil(t, err)
+	assert.Equal(t, "traced /bin/bash -c echo hello\n", string(trace))
+
+	c = gocmd.New("echo untraced", gocmd.WithTraceLibraryCalls(filepath.Join(dir, "run.ltrace")))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, "untraced\n", c.Stdout())
+	assert.Equal(t, "", c.TraceFile())
+}
@@ -0,0 +1,209 @@
+package gocmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// TTY is the controlling terminal of a command run WithTTY, for the tools
+// which prompt on /dev/tty instead of reading stdin, like ssh for a password or
+// gpg for a passphrase. It answers the prompts matching its Answers, and
+// cancels the command on a prompt it can not answer, instead of letting it
+// wait forever for a user who is not there. Linux only.
+//
+// Example:
+//
+//	tty := &gocmd.TTY{Answers: []gocmd.TTYAnswer{gocmd.Answer(`(?i)password: $`, pass)}}
+//	c := gocmd.New("ssh -o BatchMode=no host uptime", gocmd.WithTTY(tty))
+//	err := c.Run(ctx) // errors.Is(err, gocmd.ErrCanceled) on an unexpected prompt
+type TTY struct {
+	// Answers answer the prompts, the first one matching is written.
+	Answers []TTYAnswer
+	// PromptTimeout is how long output to the tty not ending by a line end, and
+	// not matched by an answer, waits for more before it is taken for a prompt
+	// which can not be answered, 1s if 0.
+	PromptTimeout time.Duration
+
+	mu         sync.Mutex
+	master     *os.File
+	slave      *os.File
+	transcript bytes.Buffer
+	unanswered string
+}
+
+// TTYAnswer answers the prompts matching Prompt by Answer, followed by a line end.
+type TTYAnswer struct {
+	Prompt *regexp.Regexp
+	Answer string
+}
+
+// Answer returns the TTYAnswer of the prompt regexp, it panics if it does not compile.
+func Answer(prompt, answer string) TTYAnswer {
+	return TTYAnswer{Prompt: regexp.MustCompile(prompt), Answer: answer}
+}
+
+// WithTTY runs the command in a session of its own, whose controlling terminal
+// is a pseudo-terminal answering the prompts by the TTY. Stdin, stdout and
+// stderr are still the ones of the command, only /dev/tty is the terminal.
+func WithTTY(t *TTY) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.Setsid = true
+		c.beforeStart = append(c.beforeStart, func(cmd *exec.Cmd) error {
+			master, slave, err := openPTY()
+			if err != nil {
+				return err
+			}
+			t.open(master, slave)
+			cmd.ExtraFiles = append(cmd.ExtraFiles, slave)
+			cmd.SysProcAttr.Setctty = true
+			cmd.SysProcAttr.Ctty = 2 + len(cmd.ExtraFiles)
+			return nil
+		})
+		c.afterStart = append(c.afterStart, func(int) error {
+			// else the master does not get EOF once the command exited
+			t.closeSlave()
+			return nil
+		})
+		c.watchers = append(c.watchers, func(ctx context.Context) {
+			t.answer(ctx, c)
+		})
+		c.flushers = append(c.flushers, t.close)
+	}
+}
+
+// Transcript returns what the command wrote to the tty, and the echo of the answers.
+func (t *TTY) Transcript() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.transcript.String()
+}
+
+// Unanswered returns the prompt the command was canceled for, if any.
+func (t *TTY) Unanswered() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.unanswered
+}
+
+func (t *TTY) open(master, slave *os.File) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.master, t.slave = master, slave
+	t.transcript.Reset()
+	t.unanswered = ""
+}
+
+func (t *TTY) closeSlave() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.slave != nil {
+		_ = t.slave.Close()
+		t.slave = nil
+	}
+}
+
+func (t *TTY) close() {
+	t.closeSlave()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.master != nil {
+		_ = t.master.Close()
+		t.master = nil
+	}
+}
+
+// answer reads the tty until ctx is done, answering the prompts, and cancels
+// the command on a prompt unanswered for PromptTimeout.
+func (t *TTY) answer(ctx context.Context, c *Cmd) {
+	t.mu.Lock()
+	master := t.master
+	t.mu.Unlock()
+	if master == nil {
+		return
+	}
+
+	chunks := make(chan []byte)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := master.Read(buf)
+			if n > 0 {
+				select {
+				case chunks <- append([]byte(nil), buf[:n]...):
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	timeout := t.PromptTimeout
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	timer := time.NewTimer(timeout)
+	timer.Stop()
+	defer timer.Stop()
+
+	var pending []byte // since the last line end or answer
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case chunk := <-chunks:
+			t.mu.Lock()
+			t.transcript.Write(chunk)
+			t.mu.Unlock()
+
+			pending = append(pending, chunk...)
+			if i := bytes.LastIndexAny(pending, "\r\n"); i >= 0 {
+				pending = append(pending[:0], pending[i+1:]...)
+			}
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			if len(pending) == 0 {
+				continue
+			}
+			if a, ok := t.match(pending); ok {
+				_, _ = master.Write([]byte(a.Answer + "\n"))
+				pending = pending[:0]
+				continue
+			}
+			timer.Reset(timeout)
+		case <-timer.C:
+			t.mu.Lock()
+			t.unanswered = string(pending)
+			t.mu.Unlock()
+			_ = c.Cancel(fmt.Sprintf("unanswered tty prompt %q", pending))
+			return
+		}
+	}
+}
+
+func (t *TTY) match(prompt []byte) (TTYAnswer, bool) {
+	for _, a := range t.Answers {
+		if a.Prompt.Match(prompt) {
+			return a, true
+		}
+	}
+	return TTYAnswer{}, false
+}
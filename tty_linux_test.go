@@ -0,0 +1,34 @@
+package gocmd_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTTYAnswer(t *testing.T) {
+	tty := &gocmd.TTY{Answers: []gocmd.TTYAnswer{gocmd.Answer(`Password: $`, "s3cret")}}
+	c := gocmd.New(`printf 'Password: ' >/dev/tty; read -r p </dev/tty; echo "got $p"`, gocmd.WithTTY(tty))
+	err := c.Run(context.TODO())
+	if errors.Is(err, gocmd.ErrNotSupported) {
+		t.Skip(err)
+	}
+	assert.Nil(t, err)
+	assert.Equal(t, "got s3cret\n", c.Stdout())
+	assert.Contains(t, tty.Transcript(), "Password: ")
+}
+
+func TestTTYUnanswered(t *testing.T) {
+	tty := &gocmd.TTY{PromptTimeout: 100 * time.Millisecond}
+	c := gocmd.New(`printf 'Passphrase: ' >/dev/tty; read -r p </dev/tty`, gocmd.WithTTY(tty))
+	start := time.Now()
+	err := c.Run(context.TODO())
+	assert.True(t, errors.Is(err, gocmd.ErrCanceled), err)
+	assert.Contains(t, err.Error(), `unanswered tty prompt "Passphrase: "`)
+	assert.Equal(t, "Passphrase: ", tty.Unanswered())
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
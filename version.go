@@ -0,0 +1,236 @@
+package gocmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VersionProbe tells how the version of a tool is probed.
+type VersionProbe struct {
+	// Args are the args printing the version, "--version" if empty.
+	Args []string
+	// Parse returns the version in the output of the probe, its stdout and
+	// stderr, the first number like 2.30.1 in it if nil.
+	Parse func(output string) (string, error)
+}
+
+var (
+	versionMu     sync.Mutex
+	versionProbes = map[string]VersionProbe{
+		"go":      {Args: []string{"version"}},
+		"java":    {Args: []string{"-version"}},
+		"kubectl": {Args: []string{"version", "--client"}},
+		"ssh":     {Args: []string{"-V"}},
+	}
+	versionCache = map[string]string{} // by path and modification time of the executable
+)
+
+// RegisterVersionProbe registers how the version of the tool of the name is probed.
+//
+// Example:
+//
+//	gocmd.RegisterVersionProbe("terraform", gocmd.VersionProbe{Args: []string{"version", "-json"}, Parse: parseTerraformJSON})
+func RegisterVersionProbe(name string, p VersionProbe) {
+	versionMu.Lock()
+	defer versionMu.Unlock()
+
+	versionProbes[name] = p
+}
+
+// ToolVersion returns the version of the tool, an executable looked up in
+// PATH, probed by its VersionProbe, "--version" by default. Versions are
+// cached until the executable changes.
+func ToolVersion(ctx context.Context, name string) (string, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	key := path + "@" + fi.ModTime().String()
+
+	versionMu.Lock()
+	version, ok := versionCache[key]
+	p := versionProbes[name]
+	versionMu.Unlock()
+	if ok {
+		return version, nil
+	}
+
+	args := p.Args
+	if len(args) == 0 {
+		args = []string{"--version"}
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	out, runErr := exec.CommandContext(ctx, path, args...).CombinedOutput()
+
+	parse := p.Parse
+	if parse == nil {
+		parse = parseVersion
+	}
+	if version, err = parse(string(out)); err != nil {
+		if runErr != nil {
+			err = runErr
+		}
+		return "", fmt.Errorf("probe version of %s: %w", name, err)
+	}
+
+	versionMu.Lock()
+	versionCache[key] = version
+	versionMu.Unlock()
+	return version, nil
+}
+
+var versionRe = regexp.MustCompile(`\d+(\.\d+)+`)
+
+// parseVersion returns the first number like 2.30.1 in the output.
+func parseVersion(output string) (string, error) {
+	if v := versionRe.FindString(output); v != "" {
+		return v, nil
+	}
+	return "", fmt.Errorf("no version in %q", firstLine(output))
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
+
+// VersionError is the error of RequireVersion for a tool whose version does not satisfy the constraint.
+type VersionError struct {
+	Name       string
+	Version    string
+	Constraint string
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("%s %s does not satisfy %s", e.Name, e.Version, e.Constraint)
+}
+
+// RequireVersion returns an error if the tool is not found or its version,
+// by ToolVersion, does not satisfy the constraint, a *VersionError then, so
+// that tools fail fast with a clear error instead of by obscure ones of old
+// versions. The constraint is a comma separated list of comparisons, all of
+// which must be satisfied, like ">=2.30" or ">=1.20, <2", a bare version
+// meaning at least it.
+//
+// Example:
+//
+//	if err := gocmd.RequireVersion(ctx, "git", ">=2.30"); err != nil {
+//		log.Fatal(err) // git 2.25.1 does not satisfy >=2.30
+//	}
+func RequireVersion(ctx context.Context, name, constraint string) error {
+	version, err := ToolVersion(ctx, name)
+	if err != nil {
+		return err
+	}
+	ok, err := SatisfiesVersion(version, constraint)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &VersionError{Name: name, Version: version, Constraint: constraint}
+	}
+	return nil
+}
+
+// WithRequiredVersion checks the version of a tool the command depends on
+// by RequireVersion before it is started, Run fails if it is not satisfied.
+//
+// Example:
+//
+//	c := gocmd.New("git switch -c topic", gocmd.WithRequiredVersion("git", ">=2.23"))
+func WithRequiredVersion(name, constraint string) func(c *Cmd) {
+	return func(c *Cmd) {
+		c.beforeStart = append(c.beforeStart, func(*exec.Cmd) error {
+			return RequireVersion(context.Background(), name, constraint)
+		})
+	}
+}
+
+// SatisfiesVersion tells whether the version satisfies the constraint, see RequireVersion.
+// Versions are compared number by number, missing ones are 0, like 2.30 and 2.30.0.
+func SatisfiesVersion(version, constraint string) (bool, error) {
+	v, err := versionNumbers(version)
+	if err != nil {
+		return false, err
+	}
+	for _, part := range strings.Split(constraint, ",") {
+		part = strings.TrimSpace(part)
+		rest := strings.TrimLeft(part, "<>=!")
+		op := part[:len(part)-len(rest)]
+		want, err := versionNumbers(strings.TrimSpace(rest))
+		if err != nil {
+			return false, fmt.Errorf("invalid version constraint %q: %w", constraint, err)
+		}
+
+		cmp := compareVersions(v, want)
+		var ok bool
+		switch op {
+		case "", ">=":
+			ok = cmp >= 0
+		case ">":
+			ok = cmp > 0
+		case "<=":
+			ok = cmp <= 0
+		case "<":
+			ok = cmp < 0
+		case "=", "==":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		default:
+			return false, fmt.Errorf("invalid version constraint %q: operator %q", constraint, op)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// versionNumbers returns the numbers of a version like v2.30.1, ignoring suffixes like -rc1.
+func versionNumbers(s string) ([]int, error) {
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexAny(s, "-+ "); i >= 0 {
+		s = s[:i]
+	}
+	var numbers []int
+	for _, part := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q", s)
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers, nil
+}
+
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
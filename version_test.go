@@ -0,0 +1,77 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSatisfiesVersion(t *testing.T) {
+	for _, c := range []struct {
+		version, constraint string
+		ok                  bool
+	}{
+		{"2.30.1", ">=2.30", true},
+		{"2.30", ">=2.30.0", true},
+		{"2.25.1", ">=2.30", false},
+		{"2.30", "2.30", true},
+		{"v1.21.3", ">=1.20, <2", true},
+		{"2.0.0-rc1", ">=1.20,<2", false},
+		{"3.1", "!=3.1", false},
+		{"3.1", "=3.1.0", true},
+		{"10.0", ">9.9", true},
+	} {
+		ok, err := gocmd.SatisfiesVersion(c.version, c.constraint)
+		assert.Nil(t, err)
+		assert.Equal(t, c.ok, ok, "%s %s", c.version, c.constraint)
+	}
+
+	_, err := gocmd.SatisfiesVersion("1.2", "~>1.2")
+	assert.Error(t, err)
+	_, err = gocmd.SatisfiesVersion("1.2", ">=x")
+	assert.Error(t, err)
+}
+
+func TestRequireVersion(t *testing.T) {
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	script := "#!/bin/sh\necho probed >> " + calls + "\necho \"faketool version 2.25.1 (build 7)\"\n"
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "faketool"), []byte(script), 0o755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	v, err := gocmd.ToolVersion(context.TODO(), "faketool")
+	assert.Nil(t, err)
+	assert.Equal(t, "2.25.1", v)
+
+	err = gocmd.RequireVersion(context.TODO(), "faketool", ">=2.30")
+	var versionErr *gocmd.VersionError
+	assert.True(t, errors.As(err, &versionErr))
+	assert.Equal(t, "faketool 2.25.1 does not satisfy >=2.30", err.Error())
+	assert.Nil(t, gocmd.RequireVersion(context.TODO(), "faketool", ">=2.20, <3"))
+
+	data, _ := os.ReadFile(calls)
+	assert.Equal(t, 1, strings.Count(string(data), "probed"), "cached")
+
+	c := gocmd.New("echo run", gocmd.WithRequiredVersion("faketool", ">=3"))
+	err = c.Run(context.TODO())
+	assert.True(t, errors.As(err, &versionErr))
+	assert.False(t, c.Executed)
+
+	_, err = gocmd.ToolVersion(context.TODO(), "gocmd-no-such-tool")
+	assert.Error(t, err)
+
+	gocmd.RegisterVersionProbe("faketool2", gocmd.VersionProbe{Args: []string{"-V"},
+		Parse: func(output string) (string, error) { return strings.Fields(output)[0], nil }})
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "faketool2"), []byte("#!/bin/sh\necho \"$1\"\n"), 0o755))
+	v, err = gocmd.ToolVersion(context.TODO(), "faketool2")
+	assert.Nil(t, err)
+	assert.Equal(t, "-V", v)
+}
@@ -0,0 +1,217 @@
+package gocmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WebhookSignatureHeader is the header of the HMAC-SHA256 signature of the
+// body of the posts of a Webhook with a secret, like sha256=hex.
+const WebhookSignatureHeader = "X-Gocmd-Signature"
+
+// WebhookEvent is the JSON body posted by a Webhook.
+type WebhookEvent struct {
+	// Event is "command" for the result of a command, "batch" for the one of a batch.
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	// Status and Error are the ones of a command, Error the one of Run.
+	Status *Status `json:"status,omitempty"`
+	Error  string  `json:"error,omitempty"`
+	// Results are the ones of the jobs of a batch, Failed the number of failed ones.
+	Results []BatchRecord `json:"results,omitempty"`
+	Failed  int           `json:"failed,omitempty"`
+}
+
+// Webhook posts the results of commands, and of batches, to an HTTP endpoint
+// as a JSON WebhookEvent when they finished, so that external systems react
+// to their completion without polling. With a Secret, the body is signed by
+// HMAC-SHA256 in the WebhookSignatureHeader, see VerifyWebhook. A failed
+// post is retried with an exponential backoff.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+	Header http.Header
+	// Secret, if not empty, is the key of the signature of the bodies.
+	Secret string
+	// Retries is the maximum number of posts after the first one, 3 by default.
+	// Posts answered by a 4xx status other than 429 are not retried.
+	Retries int
+	// MaxBackoff is the maximum delay between retries, 5s by default.
+	MaxBackoff time.Duration
+	// OnError, if not nil, is called with the error of the last post, if all failed.
+	OnError func(error)
+}
+
+// NewWebhook creates a Webhook posting to url.
+//
+// Example:
+//
+//	w := gocmd.NewWebhook("https://ci.example.com/hooks/gocmd", gocmd.WebhookSecret(os.Getenv("HOOK_SECRET")))
+//	b := gocmd.Batch{Parallel: 4, Webhook: w}
+func NewWebhook(url string, options ...func(*Webhook)) *Webhook {
+	w := &Webhook{
+		URL:        url,
+		Client:     &http.Client{Timeout: 10 * time.Second},
+		Header:     http.Header{},
+		Retries:    3,
+		MaxBackoff: 5 * time.Second,
+	}
+	for _, o := range options {
+		o(w)
+	}
+	return w
+}
+
+// WebhookSecret sets the secret signing the posts.
+func WebhookSecret(secret string) func(*Webhook) {
+	return func(w *Webhook) {
+		w.Secret = secret
+	}
+}
+
+// WebhookHeader sets a header of the posts, like Authorization.
+func WebhookHeader(key, value string) func(*Webhook) {
+	return func(w *Webhook) {
+		w.Header.Set(key, value)
+	}
+}
+
+// WebhookRetries sets the maximum number of retries of a failed post.
+func WebhookRetries(n int) func(*Webhook) {
+	return func(w *Webhook) {
+		w.Retries = n
+	}
+}
+
+// WebhookOnError sets the func called with the error of a post which failed for good.
+func WebhookOnError(f func(error)) func(*Webhook) {
+	return func(w *Webhook) {
+		w.OnError = f
+	}
+}
+
+// WithWebhook posts the result of the command to url when Run returns, once
+// the output was written and its retries are done, with the Status of the
+// command and the error of Run, including the ones of commands denied before
+// they started. Run returns once the post succeeded or failed for good.
+//
+// Example:
+//
+//	c := gocmd.New("./deploy.sh", gocmd.WithWebhook("https://ci.example.com/hooks/gocmd", gocmd.WebhookSecret(secret)))
+func WithWebhook(url string, options ...func(*Webhook)) func(c *Cmd) {
+	w := NewWebhook(url, options...)
+	return func(c *Cmd) {
+		c.afterRun = append(c.afterRun, func(err error) {
+			status := c.Status()
+			e := WebhookEvent{Event: "command", Time: time.Now(), Status: &status}
+			if err != nil {
+				e.Error = err.Error()
+			}
+			w.post(e)
+		})
+	}
+}
+
+// post posts the event, and reports its failure to OnError.
+func (w *Webhook) post(e WebhookEvent) {
+	if err := w.Post(context.Background(), e); err != nil && w.OnError != nil {
+		w.OnError(err)
+	}
+}
+
+// Post posts the event, retrying a failed post, and returns the error of the last one.
+func (w *Webhook) Post(ctx context.Context, e WebhookEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	maxBackoff := w.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 5 * time.Second
+	}
+	var backoff time.Duration
+	for attempt := 0; ; attempt++ {
+		retry, err := w.send(ctx, body)
+		if err == nil || !retry || attempt >= w.Retries {
+			return err
+		}
+		backoff = nextBackoff(backoff, maxBackoff)
+		if !sleepContext(ctx, backoff) {
+			return err
+		}
+	}
+}
+
+// send posts the body once, and tells whether a failure is worth a retry.
+func (w *Webhook) send(ctx context.Context, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	for k, v := range w.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, signWebhook(w.Secret, body))
+	}
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("webhook %s: %w", w.URL, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("webhook %s: %s", w.URL, resp.Status)
+}
+
+func signWebhook(secret string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(body)
+	return "sha256=" + hex.EncodeToString(h.Sum(nil))
+}
+
+// VerifyWebhook tells if the signature, the value of the
+// WebhookSignatureHeader of a post, is the one of the body by the secret,
+// for the receivers of a Webhook.
+//
+// Example:
+//
+//	body, _ := io.ReadAll(r.Body)
+//	if !gocmd.VerifyWebhook(secret, body, r.Header.Get(gocmd.WebhookSignatureHeader)) {
+//		http.Error(w, "invalid signature", http.StatusUnauthorized)
+//	}
+func VerifyWebhook(secret string, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	return hmac.Equal([]byte(signWebhook(secret, body)), []byte(signature))
+}
+
+// postWebhook posts the results of the batch to its webhook.
+func (b *Batch) postWebhook(results []BatchResult) {
+	e := WebhookEvent{Event: "batch", Time: time.Now(), Results: make([]BatchRecord, len(results))}
+	for i, r := range results {
+		e.Results[i] = newBatchRecord(r)
+		if r.Failed() {
+			e.Failed++
+		}
+	}
+	b.Webhook.post(e)
+}
@@ -0,0 +1,83 @@
+//go:build !windows
+
+package gocmd_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithWebhook(t *testing.T) {
+	var posts int32
+	events := make(chan gocmd.WebhookEvent, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.True(t, gocmd.VerifyWebhook("s3cret", body, r.Header.Get(gocmd.WebhookSignatureHeader)))
+		assert.False(t, gocmd.VerifyWebhook("other", body, r.Header.Get(gocmd.WebhookSignatureHeader)))
+		assert.Equal(t, "Bearer t", r.Header.Get("Authorization"))
+		if atomic.AddInt32(&posts, 1) == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable) // retried
+			return
+		}
+		var e gocmd.WebhookEvent
+		assert.Nil(t, json.Unmarshal(body, &e))
+		events <- e
+	}))
+	defer ts.Close()
+
+	c := gocmd.New("echo hello; exit 3", gocmd.WithLabels(map[string]string{"job": "deploy"}),
+		gocmd.WithWebhook(ts.URL, gocmd.WebhookSecret("s3cret"), gocmd.WebhookHeader("Authorization", "Bearer t")))
+	assert.Nil(t, c.Run(context.TODO()))
+
+	e := <-events
+	assert.Equal(t, "command", e.Event)
+	assert.Equal(t, 3, e.Status.ExitCode)
+	assert.Equal(t, gocmd.Labels{"job": "deploy"}, e.Status.Labels)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&posts))
+}
+
+func TestWebhook_Failure(t *testing.T) {
+	var posts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&posts, 1)
+		http.Error(w, "nope", http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	var failed error
+	c := gocmd.New("true", gocmd.WithWebhook(ts.URL, gocmd.WebhookOnError(func(err error) { failed = err })))
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.EqualError(t, failed, "webhook "+ts.URL+": 400 Bad Request")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&posts)) // not retried
+}
+
+func TestBatch_Webhook(t *testing.T) {
+	events := make(chan gocmd.WebhookEvent, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e gocmd.WebhookEvent
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&e))
+		events <- e
+	}))
+	defer ts.Close()
+
+	b := gocmd.Batch{Parallel: 2, Webhook: gocmd.NewWebhook(ts.URL)}
+	b.Run(context.TODO(),
+		gocmd.BatchJob{Name: "ok", Cmd: gocmd.New("true")},
+		gocmd.BatchJob{Name: "ko", Cmd: gocmd.New("exit 1")},
+	)
+
+	e := <-events
+	assert.Equal(t, "batch", e.Event)
+	assert.Equal(t, 1, e.Failed)
+	assert.Len(t, e.Results, 2)
+	assert.Equal(t, "ko", e.Results[1].Name)
+	assert.Equal(t, 1, e.Results[1].ExitCode)
+}
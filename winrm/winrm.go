@@ -0,0 +1,112 @@
+// Package winrm runs gocmd commands on remote Windows hosts by PowerShell
+// remoting over WinRM, by the local PowerShell, like package ssh does by the
+// OpenSSH client, so that mixed fleets are run with the same streaming and
+// timeout semantics.
+//
+//	e := winrm.Executor{User: `CORP\deploy`, Password: vault, PasswordKey: "secret/deploy", UseSSL: true}
+//	c := e.Command("win1.corp.example.com", "Get-Service W3SVC | Select-Object -ExpandProperty Status")
+//	c.Run(context.TODO())
+//	fmt.Println(c.Stdout())
+package winrm
+
+import (
+	"os/exec"
+	"strconv"
+
+	"github.com/bingoohuang/gocmd"
+)
+
+// ExitCodeWinRMError is the exit code of a command whose session could not be
+// opened, like when the host could not be connected, instead of the remote
+// script failing, like ssh.ExitCodeSSHError.
+const ExitCodeWinRMError = 255
+
+// Executor runs PowerShell scripts on remote hosts by PowerShell remoting.
+// The remote output is streamed as it is written, the exit code is the
+// $LASTEXITCODE of the script, and the timeout of a command stops the local
+// PowerShell, which closes the remote session.
+type Executor struct {
+	// PowerShell is the local PowerShell executable, "pwsh" if empty.
+	PowerShell string
+	// User is the user to authenticate as, the current one by Kerberos if empty.
+	User string
+	// Password, if not nil, provides the password of User by PasswordKey, it
+	// is passed to PowerShell by the environment, never by the arguments.
+	Password    gocmd.CredentialProvider
+	PasswordKey string
+	// Port is the WinRM port, 5985 or 5986 for SSL if 0.
+	Port int
+	// UseSSL connects by HTTPS.
+	UseSSL bool
+	// SkipCertCheck does not verify the certificate of the host by SSL.
+	SkipCertCheck bool
+	// Authentication is the authentication mechanism, like Negotiate, Kerberos
+	// or Basic, the default one of PowerShell if empty.
+	Authentication string
+}
+
+// script opens the session by the parameters passed by the environment, runs
+// the script in it, and exits with its $LASTEXITCODE.
+const script = `$p = @{ ComputerName = $env:GOCMD_WINRM_HOST }
+if ($env:GOCMD_WINRM_PORT) { $p.Port = [int]$env:GOCMD_WINRM_PORT }
+if ($env:GOCMD_WINRM_SSL) { $p.UseSSL = $true }
+if ($env:GOCMD_WINRM_SKIP_CERT_CHECK) { $p.SessionOption = New-PSSessionOption -SkipCACheck -SkipCNCheck }
+if ($env:GOCMD_WINRM_AUTH) { $p.Authentication = $env:GOCMD_WINRM_AUTH }
+if ($env:GOCMD_WINRM_USER) {
+  $pw = ConvertTo-SecureString "$env:GOCMD_WINRM_PASSWORD" -AsPlainText -Force
+  $p.Credential = New-Object System.Management.Automation.PSCredential($env:GOCMD_WINRM_USER, $pw)
+}
+try { $s = New-PSSession @p -ErrorAction Stop } catch { [Console]::Error.WriteLine($_); exit 255 }
+try {
+  Invoke-Command -Session $s -ScriptBlock ([scriptblock]::Create($env:GOCMD_WINRM_SCRIPT))
+  $code = Invoke-Command -Session $s -ScriptBlock { $LASTEXITCODE }
+} finally { Remove-PSSession $s }
+if ($code) { exit $code }
+`
+
+// Args returns the arguments of the local PowerShell running the commands.
+func (e *Executor) Args() []string {
+	return []string{"-NoProfile", "-NonInteractive", "-Command", script}
+}
+
+// Env returns the environment variables passing the host and the script to
+// the local PowerShell, but the password.
+func (e *Executor) Env(host, command string) []string {
+	env := []string{"GOCMD_WINRM_HOST=" + host, "GOCMD_WINRM_SCRIPT=" + command}
+	if e.Port != 0 {
+		env = append(env, "GOCMD_WINRM_PORT="+strconv.Itoa(e.Port))
+	}
+	if e.UseSSL {
+		env = append(env, "GOCMD_WINRM_SSL=1")
+	}
+	if e.SkipCertCheck {
+		env = append(env, "GOCMD_WINRM_SKIP_CERT_CHECK=1")
+	}
+	if e.Authentication != "" {
+		env = append(env, "GOCMD_WINRM_AUTH="+e.Authentication)
+	}
+	if e.User != "" {
+		env = append(env, "GOCMD_WINRM_USER="+e.User)
+	}
+	return env
+}
+
+// Command returns a command running the PowerShell script on the host.
+func (e *Executor) Command(host, command string, options ...func(*gocmd.Cmd)) *gocmd.Cmd {
+	pwsh := e.PowerShell
+	if pwsh == "" {
+		pwsh = "pwsh"
+	}
+
+	base := []func(*gocmd.Cmd){
+		gocmd.WithCmd(exec.Command(pwsh, e.Args()...)),
+		func(c *gocmd.Cmd) {
+			// not by AddEnv, which expands the $ of the script
+			c.Env = append(c.Env, e.Env(host, command)...)
+		},
+	}
+	if e.Password != nil {
+		base = append(base, gocmd.WithCredentialEnv(e.Password, "GOCMD_WINRM_PASSWORD", e.PasswordKey))
+	}
+	return gocmd.New("", append(base, options...)...)
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+
+package winrm_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bingoohuang/gocmd"
+	"github.com/bingoohuang/gocmd/winrm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecutorCommand(t *testing.T) {
+	// a fake pwsh printing what it is passed
+	fake := filepath.Join(t.TempDir(), "pwsh")
+	script := "#!/bin/sh\necho \"$1 $2 $3\"\necho \"$GOCMD_WINRM_HOST $GOCMD_WINRM_PORT $GOCMD_WINRM_SSL $GOCMD_WINRM_USER $GOCMD_WINRM_PASSWORD\"\n" +
+		"echo \"$GOCMD_WINRM_SCRIPT\"\nexit 3\n"
+	assert.Nil(t, os.WriteFile(fake, []byte(script), 0o755))
+
+	vault := gocmd.CredentialFunc(func(_ context.Context, key string) (string, error) { return "pw-of-" + key, nil })
+	e := winrm.Executor{PowerShell: fake, User: `CORP\deploy`, Password: vault, PasswordKey: "deploy", Port: 5986, UseSSL: true}
+	c := e.Command("win1", "Get-Item $env:TEMP")
+	assert.Nil(t, c.Run(context.TODO()))
+	assert.Equal(t, 3, c.ExitCode())
+	assert.Equal(t, "-NoProfile -NonInteractive -Command\n"+
+		"win1 5986 1 CORP\\deploy pw-of-deploy\n"+
+		"Get-Item $env:TEMP\n", c.Stdout())
+}